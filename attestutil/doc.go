@@ -0,0 +1,9 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+/*
+Package attestutil contains functions for verifying attestations produced by a TPM without
+communicating with it. This is useful for remote verifiers.
+*/
+package attestutil
@@ -0,0 +1,177 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package attestutil
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/canonical/go-tpm2"
+	internal_util "github.com/canonical/go-tpm2/internal/util"
+	"github.com/canonical/go-tpm2/mu"
+	"github.com/canonical/go-tpm2/policyutil"
+)
+
+// verifyAttest unmarshals the supplied attestation structure and verifies that it was
+// generated by the TPM, that it has the expected type, that it is signed by the key with
+// the supplied public area and that it contains the supplied qualifying data.
+func verifyAttest(signer *tpm2.Public, attest []byte, signature *tpm2.Signature, qualifyingData tpm2.Data, expectedType tpm2.StructTag) (*tpm2.Attest, error) {
+	if len(attest) == 0 {
+		return nil, errors.New("no attestation")
+	}
+
+	var a *tpm2.Attest
+	n, err := mu.UnmarshalFromBytes(attest, &a)
+	if err != nil {
+		return nil, fmt.Errorf("cannot unmarshal attestation: %w", err)
+	}
+	if n < len(attest) {
+		return nil, fmt.Errorf("%d trailing byte(s) in attestation", len(attest)-n)
+	}
+
+	if err := internal_util.VerifyAttest(signer, a, attest, signature, qualifyingData, expectedType); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// VerifyQuote verifies an attestation structure and signature returned from
+// [tpm2.TPMContext.Quote]. The attestation structure is supplied in its serialized form.
+// This checks that the attestation was generated by the TPM for the supplied qualifying data,
+// that it is signed by the key with the supplied public area, and that it quotes the supplied
+// PCR values. The PCRs selected by the quote must be the same as those in pcrValues.
+//
+// On success, the unmarshalled attestation structure is returned.
+//
+// Note that this can only verify the signature if the signing key is a RSA or ECC key.
+func VerifyQuote(signer *tpm2.Public, attest []byte, signature *tpm2.Signature, qualifyingData tpm2.Data, pcrValues tpm2.PCRValues) (*tpm2.Attest, error) {
+	a, err := verifyAttest(signer, attest, signature, qualifyingData, tpm2.TagAttestQuote)
+	if err != nil {
+		return nil, err
+	}
+
+	quote := a.Attested.Quote
+	expectedPcrs, err := pcrValues.SelectionList()
+	if err != nil {
+		return nil, fmt.Errorf("invalid PCR values: %w", err)
+	}
+	extra, err := quote.PCRSelect.Remove(expectedPcrs)
+	if err != nil {
+		return nil, fmt.Errorf("cannot compare PCR selections: %w", err)
+	}
+	missing, err := expectedPcrs.Remove(quote.PCRSelect)
+	if err != nil {
+		return nil, fmt.Errorf("cannot compare PCR selections: %w", err)
+	}
+	if !extra.IsEmpty() || !missing.IsEmpty() {
+		return nil, fmt.Errorf("unexpected PCR selection %v", quote.PCRSelect)
+	}
+
+	// The PCR digest is computed with the digest algorithm of the signing scheme.
+	pcrDigest, err := policyutil.ComputePCRDigest(signature.HashAlg(), quote.PCRSelect, pcrValues)
+	if err != nil {
+		return nil, fmt.Errorf("cannot compute PCR digest: %w", err)
+	}
+	if !bytes.Equal(quote.PCRDigest, pcrDigest) {
+		return nil, fmt.Errorf("unexpected PCR digest %#x", quote.PCRDigest)
+	}
+
+	return a, nil
+}
+
+// VerifyCertify verifies an attestation structure and signature returned from
+// [tpm2.TPMContext.Certify]. The attestation structure is supplied in its serialized form.
+// This checks that the attestation was generated by the TPM for the supplied qualifying data,
+// that it is signed by the key with the supplied public area, and that it certifies an object
+// with the expected name and qualified name. If expectedQualifiedName is nil, then the
+// qualified name is not checked.
+//
+// On success, the unmarshalled attestation structure is returned.
+//
+// Note that this can only verify the signature if the signing key is a RSA or ECC key.
+func VerifyCertify(signer *tpm2.Public, attest []byte, signature *tpm2.Signature, qualifyingData tpm2.Data, expectedName, expectedQualifiedName tpm2.Name) (*tpm2.Attest, error) {
+	a, err := verifyAttest(signer, attest, signature, qualifyingData, tpm2.TagAttestCertify)
+	if err != nil {
+		return nil, err
+	}
+
+	info := a.Attested.Certify
+	if !bytes.Equal(info.Name, expectedName) {
+		return nil, fmt.Errorf("unexpected name %#x", info.Name)
+	}
+	if expectedQualifiedName != nil && !bytes.Equal(info.QualifiedName, expectedQualifiedName) {
+		return nil, fmt.Errorf("unexpected qualified name %#x", info.QualifiedName)
+	}
+
+	return a, nil
+}
+
+// VerifyCreation verifies an attestation structure and signature returned from
+// [tpm2.TPMContext.CertifyCreation]. The attestation structure is supplied in its serialized
+// form. This checks that the attestation was generated by the TPM for the supplied qualifying
+// data, that it is signed by the key with the supplied public area, and that it certifies the
+// creation of an object with the expected name and creation hash.
+//
+// On success, the unmarshalled attestation structure is returned.
+//
+// Note that this can only verify the signature if the signing key is a RSA or ECC key.
+func VerifyCreation(signer *tpm2.Public, attest []byte, signature *tpm2.Signature, qualifyingData tpm2.Data, expectedName tpm2.Name, expectedCreationHash tpm2.Digest) (*tpm2.Attest, error) {
+	a, err := verifyAttest(signer, attest, signature, qualifyingData, tpm2.TagAttestCreation)
+	if err != nil {
+		return nil, err
+	}
+
+	info := a.Attested.Creation
+	if !bytes.Equal(info.ObjectName, expectedName) {
+		return nil, fmt.Errorf("unexpected name %#x", info.ObjectName)
+	}
+	if !bytes.Equal(info.CreationHash, expectedCreationHash) {
+		return nil, fmt.Errorf("unexpected creation hash %#x", info.CreationHash)
+	}
+
+	return a, nil
+}
+
+// VerifyTime verifies an attestation structure and signature returned from
+// [tpm2.TPMContext.GetTime]. The attestation structure is supplied in its serialized form.
+// This checks that the attestation was generated by the TPM for the supplied qualifying data
+// and that it is signed by the key with the supplied public area. The caller can obtain the
+// attested time and clock values from the returned attestation structure.
+//
+// Note that this can only verify the signature if the signing key is a RSA or ECC key.
+func VerifyTime(signer *tpm2.Public, attest []byte, signature *tpm2.Signature, qualifyingData tpm2.Data) (*tpm2.Attest, error) {
+	return verifyAttest(signer, attest, signature, qualifyingData, tpm2.TagAttestTime)
+}
+
+// VerifyNV verifies an attestation structure and signature returned from TPM2_NV_Certify.
+// The attestation structure is supplied in its serialized form. This checks that the
+// attestation was generated by the TPM for the supplied qualifying data, that it is signed by
+// the key with the supplied public area, and that it certifies the expected contents at the
+// specified offset of the NV index with the expected name.
+//
+// On success, the unmarshalled attestation structure is returned.
+//
+// Note that this can only verify the signature if the signing key is a RSA or ECC key.
+func VerifyNV(signer *tpm2.Public, attest []byte, signature *tpm2.Signature, qualifyingData tpm2.Data, expectedIndexName tpm2.Name, offset uint16, expectedContents []byte) (*tpm2.Attest, error) {
+	a, err := verifyAttest(signer, attest, signature, qualifyingData, tpm2.TagAttestNV)
+	if err != nil {
+		return nil, err
+	}
+
+	info := a.Attested.NV
+	if !bytes.Equal(info.IndexName, expectedIndexName) {
+		return nil, fmt.Errorf("unexpected index name %#x", info.IndexName)
+	}
+	if info.Offset != offset {
+		return nil, fmt.Errorf("unexpected offset %d", info.Offset)
+	}
+	if !bytes.Equal(info.NVContents, expectedContents) {
+		return nil, fmt.Errorf("unexpected NV contents %#x", info.NVContents)
+	}
+
+	return a, nil
+}
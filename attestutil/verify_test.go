@@ -0,0 +1,331 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package attestutil_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/go-tpm2"
+	. "github.com/canonical/go-tpm2/attestutil"
+	"github.com/canonical/go-tpm2/cryptutil"
+	internal_testutil "github.com/canonical/go-tpm2/internal/testutil"
+	"github.com/canonical/go-tpm2/mu"
+	"github.com/canonical/go-tpm2/objectutil"
+	"github.com/canonical/go-tpm2/policyutil"
+	"github.com/canonical/go-tpm2/testutil"
+)
+
+type verifySuiteNoTPM struct {
+	key    *ecdsa.PrivateKey
+	signer *tpm2.Public
+}
+
+func (s *verifySuiteNoTPM) SetUpSuite(c *C) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+	s.key = key
+
+	signer, err := objectutil.NewECCPublicKey(&key.PublicKey)
+	c.Assert(err, IsNil)
+	s.signer = signer
+}
+
+// sign serializes the supplied attestation structure and signs it with the suite's
+// key, in the same way as the TPM would.
+func (s *verifySuiteNoTPM) sign(c *C, attest *tpm2.Attest) ([]byte, *tpm2.Signature) {
+	attestBytes, err := mu.MarshalToBytes(attest)
+	c.Assert(err, IsNil)
+
+	h := crypto.SHA256.New()
+	h.Write(attestBytes)
+	sig, err := cryptutil.Sign(rand.Reader, s.key, h.Sum(nil), crypto.SHA256)
+	c.Assert(err, IsNil)
+	return attestBytes, sig
+}
+
+func (s *verifySuiteNoTPM) newAttest(tag tpm2.StructTag, attested *tpm2.AttestU) *tpm2.Attest {
+	return &tpm2.Attest{
+		Magic:           tpm2.TPMGeneratedValue,
+		Type:            tag,
+		QualifiedSigner: s.signer.Name(),
+		ExtraData:       []byte("foo"),
+		ClockInfo:       tpm2.ClockInfo{Clock: 1000, ResetCount: 2, RestartCount: 1, Safe: true},
+		FirmwareVersion: 0x100,
+		Attested:        attested}
+}
+
+func (s *verifySuiteNoTPM) pcrValues(c *C) tpm2.PCRValues {
+	return tpm2.PCRValues{
+		tpm2.HashAlgorithmSHA256: {
+			7:  internal_testutil.DecodeHexString(c, "3d458cfe55cc03ea1f443f1562beec8df51c75e14a9fcf9a7234a13f198e7969"),
+			23: make(tpm2.Digest, 32)}}
+}
+
+func (s *verifySuiteNoTPM) newQuote(c *C, values tpm2.PCRValues) ([]byte, *tpm2.Signature) {
+	pcrs, digest, err := policyutil.ComputePCRDigestFromAllValues(tpm2.HashAlgorithmSHA256, values)
+	c.Assert(err, IsNil)
+	return s.sign(c, s.newAttest(tpm2.TagAttestQuote, &tpm2.AttestU{
+		Quote: &tpm2.QuoteInfo{PCRSelect: pcrs, PCRDigest: digest}}))
+}
+
+var _ = Suite(&verifySuiteNoTPM{})
+
+func (s *verifySuiteNoTPM) TestVerifyQuote(c *C) {
+	values := s.pcrValues(c)
+	attest, sig := s.newQuote(c, values)
+
+	a, err := VerifyQuote(s.signer, attest, sig, []byte("foo"), values)
+	c.Assert(err, IsNil)
+	c.Check(a.Type, Equals, tpm2.TagAttestQuote)
+	c.Check(a.ClockInfo.Clock, Equals, uint64(1000))
+}
+
+func (s *verifySuiteNoTPM) TestVerifyQuoteWrongPCRValue(c *C) {
+	attest, sig := s.newQuote(c, s.pcrValues(c))
+
+	values := s.pcrValues(c)
+	values[tpm2.HashAlgorithmSHA256][23] = internal_testutil.DecodeHexString(c, "a7e5ea7e1c1a1ae3e4bd2dbc3e7b1c2c8c5bb6c5e3e8d6fc3a0c3b5a8c1c7b43")
+
+	_, err := VerifyQuote(s.signer, attest, sig, []byte("foo"), values)
+	c.Check(err, ErrorMatches, `unexpected PCR digest 0x[[:xdigit:]]+`)
+}
+
+func (s *verifySuiteNoTPM) TestVerifyQuoteMissingPCR(c *C) {
+	attest, sig := s.newQuote(c, s.pcrValues(c))
+
+	values := s.pcrValues(c)
+	values[tpm2.HashAlgorithmSHA256][4] = make(tpm2.Digest, 32)
+
+	_, err := VerifyQuote(s.signer, attest, sig, []byte("foo"), values)
+	c.Check(err, ErrorMatches, `unexpected PCR selection .*`)
+}
+
+func (s *verifySuiteNoTPM) TestVerifyQuoteExtraPCR(c *C) {
+	attest, sig := s.newQuote(c, s.pcrValues(c))
+
+	values := s.pcrValues(c)
+	delete(values[tpm2.HashAlgorithmSHA256], 23)
+
+	_, err := VerifyQuote(s.signer, attest, sig, []byte("foo"), values)
+	c.Check(err, ErrorMatches, `unexpected PCR selection .*`)
+}
+
+func (s *verifySuiteNoTPM) TestVerifyCertify(c *C) {
+	name := internal_testutil.DecodeHexString(c, "000bdb0ea4e49b8f77d6dad4d4b7fa4f0ee93c3c1e24ce3b7ac66d9b2a2d0fa3c4c5")
+	qn := internal_testutil.DecodeHexString(c, "000b4be77f8ee1b42b0ddbcfbcd4f4a4a6bde38ae8e8f5e3b2e8e0a7a2a85aeca0bf")
+	attest, sig := s.sign(c, s.newAttest(tpm2.TagAttestCertify, &tpm2.AttestU{
+		Certify: &tpm2.CertifyInfo{Name: name, QualifiedName: qn}}))
+
+	a, err := VerifyCertify(s.signer, attest, sig, []byte("foo"), name, qn)
+	c.Assert(err, IsNil)
+	c.Check(a.Attested.Certify.Name, DeepEquals, tpm2.Name(name))
+
+	_, err = VerifyCertify(s.signer, attest, sig, []byte("foo"), name, nil)
+	c.Check(err, IsNil)
+
+	_, err = VerifyCertify(s.signer, attest, sig, []byte("foo"), qn, nil)
+	c.Check(err, ErrorMatches, `unexpected name 0x[[:xdigit:]]+`)
+
+	_, err = VerifyCertify(s.signer, attest, sig, []byte("foo"), name, name)
+	c.Check(err, ErrorMatches, `unexpected qualified name 0x[[:xdigit:]]+`)
+}
+
+func (s *verifySuiteNoTPM) TestVerifyCreation(c *C) {
+	name := internal_testutil.DecodeHexString(c, "000bdb0ea4e49b8f77d6dad4d4b7fa4f0ee93c3c1e24ce3b7ac66d9b2a2d0fa3c4c5")
+	creationHash := internal_testutil.DecodeHexString(c, "8fcd2169ab92694e0c633f1ab772842b8241bbc20288981fc7ac1eddc1fddb0e")
+	attest, sig := s.sign(c, s.newAttest(tpm2.TagAttestCreation, &tpm2.AttestU{
+		Creation: &tpm2.CreationInfo{ObjectName: name, CreationHash: creationHash}}))
+
+	a, err := VerifyCreation(s.signer, attest, sig, []byte("foo"), name, creationHash)
+	c.Assert(err, IsNil)
+	c.Check(a.Type, Equals, tpm2.TagAttestCreation)
+
+	_, err = VerifyCreation(s.signer, attest, sig, []byte("foo"), name, make(tpm2.Digest, 32))
+	c.Check(err, ErrorMatches, `unexpected creation hash 0x[[:xdigit:]]+`)
+}
+
+func (s *verifySuiteNoTPM) TestVerifyTime(c *C) {
+	attest, sig := s.sign(c, s.newAttest(tpm2.TagAttestTime, &tpm2.AttestU{
+		Time: &tpm2.TimeAttestInfo{Time: tpm2.TimeInfo{Time: 5000}, FirmwareVersion: 0x100}}))
+
+	a, err := VerifyTime(s.signer, attest, sig, []byte("foo"))
+	c.Assert(err, IsNil)
+	c.Check(a.Attested.Time.Time.Time, Equals, uint64(5000))
+}
+
+func (s *verifySuiteNoTPM) TestVerifyNV(c *C) {
+	name := internal_testutil.DecodeHexString(c, "000bdb0ea4e49b8f77d6dad4d4b7fa4f0ee93c3c1e24ce3b7ac66d9b2a2d0fa3c4c5")
+	attest, sig := s.sign(c, s.newAttest(tpm2.TagAttestNV, &tpm2.AttestU{
+		NV: &tpm2.NVCertifyInfo{IndexName: name, Offset: 2, NVContents: []byte("bar")}}))
+
+	a, err := VerifyNV(s.signer, attest, sig, []byte("foo"), name, 2, []byte("bar"))
+	c.Assert(err, IsNil)
+	c.Check(a.Attested.NV.NVContents, DeepEquals, tpm2.MaxNVBuffer("bar"))
+
+	_, err = VerifyNV(s.signer, attest, sig, []byte("foo"), name, 0, []byte("bar"))
+	c.Check(err, ErrorMatches, `unexpected offset 2`)
+
+	_, err = VerifyNV(s.signer, attest, sig, []byte("foo"), name, 2, []byte("baz"))
+	c.Check(err, ErrorMatches, `unexpected NV contents 0x626172`)
+}
+
+func (s *verifySuiteNoTPM) TestVerifyWrongType(c *C) {
+	attest, sig := s.sign(c, s.newAttest(tpm2.TagAttestTime, &tpm2.AttestU{
+		Time: &tpm2.TimeAttestInfo{}}))
+
+	_, err := VerifyQuote(s.signer, attest, sig, []byte("foo"), s.pcrValues(c))
+	c.Check(err, ErrorMatches, `invalid attestation type 32793`)
+}
+
+func (s *verifySuiteNoTPM) TestVerifyInvalidMagic(c *C) {
+	a := s.newAttest(tpm2.TagAttestTime, &tpm2.AttestU{Time: &tpm2.TimeAttestInfo{}})
+	a.Magic = 0
+	attest, sig := s.sign(c, a)
+
+	_, err := VerifyTime(s.signer, attest, sig, []byte("foo"))
+	c.Check(err, ErrorMatches, `invalid magic value`)
+}
+
+func (s *verifySuiteNoTPM) TestVerifyWrongQualifyingData(c *C) {
+	attest, sig := s.sign(c, s.newAttest(tpm2.TagAttestTime, &tpm2.AttestU{
+		Time: &tpm2.TimeAttestInfo{}}))
+
+	_, err := VerifyTime(s.signer, attest, sig, []byte("bar"))
+	c.Check(err, ErrorMatches, `unexpected qualifying data`)
+}
+
+func (s *verifySuiteNoTPM) TestVerifyModified(c *C) {
+	attest, sig := s.sign(c, s.newAttest(tpm2.TagAttestTime, &tpm2.AttestU{
+		Time: &tpm2.TimeAttestInfo{}}))
+	attest[len(attest)-1] ^= 0xff
+
+	_, err := VerifyTime(s.signer, attest, sig, []byte("foo"))
+	c.Check(err, ErrorMatches, `invalid signature`)
+}
+
+func (s *verifySuiteNoTPM) TestVerifyTrailingBytes(c *C) {
+	attest, sig := s.sign(c, s.newAttest(tpm2.TagAttestTime, &tpm2.AttestU{
+		Time: &tpm2.TimeAttestInfo{}}))
+	attest = append(attest, 0)
+
+	_, err := VerifyTime(s.signer, attest, sig, []byte("foo"))
+	c.Check(err, ErrorMatches, `1 trailing byte\(s\) in attestation`)
+}
+
+func (s *verifySuiteNoTPM) TestVerifyInvalidSigner(c *C) {
+	attest, sig := s.sign(c, s.newAttest(tpm2.TagAttestTime, &tpm2.AttestU{
+		Time: &tpm2.TimeAttestInfo{}}))
+
+	_, err := VerifyTime(objectutil.NewSealedObjectTemplate(), attest, sig, []byte("foo"))
+	c.Check(err, ErrorMatches, `invalid signing key`)
+}
+
+type verifySuite struct {
+	testutil.TPMTest
+
+	ak    tpm2.ResourceContext
+	akPub *tpm2.Public
+}
+
+func (s *verifySuite) SetUpSuite(c *C) {
+	s.TPMFeatures = testutil.TPMFeatureOwnerHierarchy | testutil.TPMFeatureEndorsementHierarchy
+}
+
+func (s *verifySuite) SetUpTest(c *C) {
+	s.TPMTest.SetUpTest(c)
+
+	s.ak = s.CreatePrimary(c, tpm2.HandleEndorsement, objectutil.NewECCAttestationKeyTemplate())
+	pub, _, _, err := s.TPM.ReadPublic(s.ak)
+	c.Assert(err, IsNil)
+	s.akPub = pub
+}
+
+var _ = Suite(&verifySuite{})
+
+func (s *verifySuite) TestVerifyQuote(c *C) {
+	pcrs := tpm2.PCRSelectionList{{Hash: tpm2.HashAlgorithmSHA256, Select: []int{0, 7, 23}}}
+	_, values, err := s.TPM.PCRRead(pcrs)
+	c.Assert(err, IsNil)
+
+	quoted, sig, err := s.TPM.Quote(s.ak, []byte("foo"), nil, pcrs, nil)
+	c.Assert(err, IsNil)
+	attest, err := mu.MarshalToBytes(quoted)
+	c.Assert(err, IsNil)
+
+	a, err := VerifyQuote(s.akPub, attest, sig, []byte("foo"), values)
+	c.Check(err, IsNil)
+	c.Check(a, DeepEquals, quoted)
+
+	// Change a PCR value.
+	_, err = s.TPM.PCREvent(s.TPM.PCRHandleContext(23), []byte("bar"), nil)
+	c.Check(err, IsNil)
+	_, values, err = s.TPM.PCRRead(pcrs)
+	c.Assert(err, IsNil)
+
+	_, err = VerifyQuote(s.akPub, attest, sig, []byte("foo"), values)
+	c.Check(err, ErrorMatches, `unexpected PCR digest 0x[[:xdigit:]]+`)
+}
+
+func (s *verifySuite) TestVerifyCertify(c *C) {
+	srk := s.CreateStoragePrimaryKeyRSA(c)
+	srkPub, _, _, err := s.TPM.ReadPublic(srk)
+	c.Assert(err, IsNil)
+
+	priv, pub, _, _, _, err := s.TPM.Create(srk, nil, objectutil.NewECCKeyTemplate(objectutil.UsageSign), nil, nil, nil)
+	c.Assert(err, IsNil)
+	key, err := s.TPM.Load(srk, priv, pub, nil)
+	c.Assert(err, IsNil)
+	defer s.TPM.FlushContext(key)
+
+	certifyInfo, sig, err := s.TPM.Certify(key, s.ak, []byte("foo"), nil, nil, nil)
+	c.Assert(err, IsNil)
+	attest, err := mu.MarshalToBytes(certifyInfo)
+	c.Assert(err, IsNil)
+
+	qn, err := objectutil.ComputeQualifiedNameInHierarchy(pub, tpm2.HandleOwner, srkPub)
+	c.Assert(err, IsNil)
+
+	a, err := VerifyCertify(s.akPub, attest, sig, []byte("foo"), pub.Name(), qn)
+	c.Check(err, IsNil)
+	c.Check(a, DeepEquals, certifyInfo)
+}
+
+func (s *verifySuite) TestVerifyCreation(c *C) {
+	srk := s.CreateStoragePrimaryKeyRSA(c)
+
+	priv, pub, _, creationHash, creationTicket, err := s.TPM.Create(srk, nil, objectutil.NewECCKeyTemplate(objectutil.UsageSign), nil, nil, nil)
+	c.Assert(err, IsNil)
+	key, err := s.TPM.Load(srk, priv, pub, nil)
+	c.Assert(err, IsNil)
+	defer s.TPM.FlushContext(key)
+
+	certifyInfo, sig, err := s.TPM.CertifyCreation(s.ak, key, []byte("foo"), creationHash, nil, creationTicket, nil)
+	c.Assert(err, IsNil)
+	attest, err := mu.MarshalToBytes(certifyInfo)
+	c.Assert(err, IsNil)
+
+	a, err := VerifyCreation(s.akPub, attest, sig, []byte("foo"), pub.Name(), creationHash)
+	c.Check(err, IsNil)
+	c.Check(a, DeepEquals, certifyInfo)
+}
+
+func (s *verifySuite) TestVerifyTime(c *C) {
+	timeInfo, sig, err := s.TPM.GetTime(s.TPM.EndorsementHandleContext(), s.ak, []byte("foo"), nil, nil, nil)
+	c.Assert(err, IsNil)
+	attest, err := mu.MarshalToBytes(timeInfo)
+	c.Assert(err, IsNil)
+
+	a, err := VerifyTime(s.akPub, attest, sig, []byte("foo"))
+	c.Check(err, IsNil)
+	c.Check(a, DeepEquals, timeInfo)
+
+	_, err = VerifyTime(s.akPub, attest, sig, []byte("bar"))
+	c.Check(err, ErrorMatches, `unexpected qualifying data`)
+}
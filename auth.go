@@ -58,24 +58,68 @@ func newSessionParamForAuth(session SessionContext, resource ResourceContext) (*
 	switch {
 	case s.Session.Handle() == HandlePW:
 		// Passphrase session
+	case data.SessionType == SessionTypeHMAC || data.SessionType == SessionTypePolicy:
+		s.IncludeAuthValue = mustIncludeAuthValue(s.Session, s.AssociatedResource)
+	default:
+		return nil, errors.New("invalid context for session: invalid session type")
+	}
+
+	return s, nil
+}
+
+// MustIncludeAuthValue indicates whether the authorization value of the supplied
+// resource is included in the HMAC key when the supplied session is used to authorize
+// it. This is always true for an unbound HMAC session. A bound HMAC session only omits
+// the authorization value when it is used to authorize the bind entity. If a bound
+// session is used to authorize a different resource, or the bind entity's authorization
+// value has changed since the session was started, the authorization value of the
+// supplied resource is included. For a policy session, this is true if the session
+// includes a TPM2_PolicyAuthValue assertion.
+//
+// This returns false if either the session or the resource is nil or wasn't created by
+// this package.
+func MustIncludeAuthValue(session SessionContext, resource ResourceContext) bool {
+	s, ok := session.(sessionContextInternal)
+	if !ok {
+		return false
+	}
+	r, ok := resource.(resourceContextInternal)
+	if !ok {
+		return false
+	}
+	return mustIncludeAuthValue(s, r)
+}
+
+// mustIncludeAuthValue determines whether the authorization value of the supplied
+// resource is included in the HMAC key when the supplied session is used to
+// authorize it.
+func mustIncludeAuthValue(session sessionContextInternal, resource resourceContextInternal) bool {
+	if session.Handle() == HandlePW {
+		return false
+	}
+
+	data := session.Data()
+	if data == nil {
+		return false
+	}
+
+	switch {
 	case data.SessionType == SessionTypeHMAC && !data.IsBound:
 		// A non-bound HMAC session. Include the auth value of the associated
 		// context in the HMAC key
-		s.IncludeAuthValue = true
+		return true
 	case data.SessionType == SessionTypeHMAC:
 		// A bound HMAC session. Include the auth value of the associated
 		// context only if it is not the bind entity.
-		bindName := computeBindName(s.AssociatedResource.Name(), s.AssociatedResource.GetAuthValue())
-		s.IncludeAuthValue = !bytes.Equal(bindName, data.BoundEntity)
+		bindName := computeBindName(resource.Name(), resource.GetAuthValue())
+		return !bytes.Equal(bindName, data.BoundEntity)
 	case data.SessionType == SessionTypePolicy:
 		// A policy session. Include the auth value of the associated context
 		// if the session includes a TPM2_PolicyAuthValue assertion.
-		s.IncludeAuthValue = data.PolicyHMACType == policyHMACTypeAuth
+		return data.PolicyHMACType == policyHMACTypeAuth
 	default:
-		return nil, errors.New("invalid context for session: invalid session type")
+		return false
 	}
-
-	return s, nil
 }
 
 func (s *sessionParam) IsAuth() bool {
@@ -140,6 +184,26 @@ func (s *sessionParam) BuildCommandAuth(commandCode CommandCode, commandHandles
 		HMAC:              hmac}
 }
 
+// BuildPlaceholderCommandAuth returns a command auth with the same size as the one
+// returned from BuildCommandAuth, but without computing the HMAC. This doesn't
+// depend on or modify the caller nonce.
+func (s *sessionParam) BuildPlaceholderCommandAuth() *AuthCommand {
+	data := s.Session.Data()
+
+	var hmac []byte
+	if s.IsPassword() {
+		hmac = s.AssociatedResource.GetAuthValue()
+	} else {
+		hmac = make([]byte, data.HashAlg.Size())
+	}
+
+	return &AuthCommand{
+		SessionHandle:     s.Session.Handle(),
+		Nonce:             make(Nonce, len(data.NonceCaller)),
+		SessionAttributes: s.Session.Attrs(),
+		HMAC:              hmac}
+}
+
 func (s *sessionParam) ProcessResponseAuth(resp AuthResponse, commandCode CommandCode, rpBytes []byte) error {
 	if s.IsPassword() {
 		if len(resp.HMAC) != 0 {
@@ -205,6 +269,15 @@ func (p *sessionParams) append(s *sessionParam) error {
 	return nil
 }
 
+func (p *sessionParams) hasSession(session SessionContext) bool {
+	for _, s := range p.Sessions {
+		if s.Session.Handle() == session.Handle() {
+			return true
+		}
+	}
+	return false
+}
+
 func (p *sessionParams) AppendSessionForResource(session SessionContext, resource ResourceContext) error {
 	s, err := newSessionParamForAuth(session, resource)
 	if err != nil {
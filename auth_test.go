@@ -143,6 +143,69 @@ func (s *authSuite) TestNewSessionParamForAuthPolicyAuth(c *C) {
 	c.Check(p, DeepEquals, newMockSessionParam(session, resource, true, nil, nil))
 }
 
+func (s *authSuite) TestMustIncludeAuthValuePW(c *C) {
+	session := &mockSessionContext{
+		handle: HandlePW,
+		data:   new(SessionContextData)}
+	c.Check(MustIncludeAuthValue(session, &mockResourceContext{handle: HandleOwner}), internal_testutil.IsFalse)
+}
+
+func (s *authSuite) TestMustIncludeAuthValueUnloaded(c *C) {
+	session := &mockSessionContext{handle: 0x02000000}
+	c.Check(MustIncludeAuthValue(session, &mockResourceContext{handle: HandleOwner}), internal_testutil.IsFalse)
+}
+
+func (s *authSuite) TestMustIncludeAuthValueBoundHMACBindTarget(c *C) {
+	session := &mockSessionContext{
+		handle: 0x02000000,
+		data: &SessionContextData{
+			SessionType: SessionTypeHMAC,
+			IsBound:     true,
+			BoundEntity: []byte{0xaa, 0xaa, 0xaa, 0xaa, 0xff, 0xff}}}
+	resource := &mockResourceContext{
+		handle:    0x81000001,
+		name:      []byte{0xaa, 0xaa, 0xaa, 0xaa, 0xaa, 0xaa},
+		authValue: []byte{0x55, 0x55}}
+	c.Check(MustIncludeAuthValue(session, resource), internal_testutil.IsFalse)
+}
+
+func (s *authSuite) TestMustIncludeAuthValueBoundHMACDifferentObject(c *C) {
+	session := &mockSessionContext{
+		handle: 0x02000000,
+		data: &SessionContextData{
+			SessionType: SessionTypeHMAC,
+			IsBound:     true,
+			BoundEntity: []byte{0xaa, 0xaa, 0xaa, 0xaa, 0xff, 0xff}}}
+	resource := &mockResourceContext{
+		handle:    0x81000002,
+		name:      []byte{0xbb, 0xbb, 0xbb, 0xbb, 0xbb, 0xbb},
+		authValue: []byte{0x55, 0x55}}
+	c.Check(MustIncludeAuthValue(session, resource), internal_testutil.IsTrue)
+}
+
+func (s *authSuite) TestMustIncludeAuthValueBoundHMACChangedAuthValue(c *C) {
+	session := &mockSessionContext{
+		handle: 0x02000000,
+		data: &SessionContextData{
+			SessionType: SessionTypeHMAC,
+			IsBound:     true,
+			BoundEntity: []byte{0xaa, 0xaa, 0xaa, 0xaa, 0xff, 0xff}}}
+	resource := &mockResourceContext{
+		handle:    0x81000001,
+		name:      []byte{0xaa, 0xaa, 0xaa, 0xaa, 0xaa, 0xaa},
+		authValue: []byte{0x66, 0x66}}
+	c.Check(MustIncludeAuthValue(session, resource), internal_testutil.IsTrue)
+}
+
+func (s *authSuite) TestMustIncludeAuthValueForeignResource(c *C) {
+	session := &mockSessionContext{
+		handle: 0x02000000,
+		data:   &SessionContextData{SessionType: SessionTypeHMAC}}
+	resource := struct{ ResourceContext }{&mockResourceContext{handle: HandleOwner}}
+	c.Check(MustIncludeAuthValue(session, resource), internal_testutil.IsFalse)
+	c.Check(MustIncludeAuthValue(session, nil), internal_testutil.IsFalse)
+}
+
 func (s *authSuite) TestSessionParamIsAuthFalse(c *C) {
 	p := newMockSessionParam(nil, nil, false, nil, nil)
 	c.Check(p.IsAuth(), internal_testutil.IsFalse)
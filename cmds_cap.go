@@ -427,6 +427,71 @@ func (t *TPMContext) GetMinPCRSelectSize(sessions ...SessionContext) (uint8, err
 	return uint8(n), nil
 }
 
+// LockoutInfo contains the current state of the TPM's dictionary attack protection,
+// as returned from [TPMContext.GetLockoutInfo].
+type LockoutInfo struct {
+	InLockout bool // The TPM is in lockout mode (the inLockout attribute of PropertyPermanent)
+
+	FailedTries     uint32 // The current value of the failure counter (PropertyLockoutCounter)
+	MaxTries        uint32 // The number of failures before the TPM enters lockout mode (PropertyMaxAuthFail)
+	LockoutInterval uint32 // The number of seconds before the failure counter is decremented (PropertyLockoutInterval)
+	LockoutRecovery uint32 // The number of seconds after a failure for the lockout hierarchy before it can be used again (PropertyLockoutRecovery)
+}
+
+// WouldLockout indicates whether the specified number of additional authorization
+// failures for DA protected resources would cause the TPM to enter lockout mode. This
+// assumes that the failure counter is not decremented in the meantime. This returns true
+// if the TPM is already in lockout mode.
+func (i *LockoutInfo) WouldLockout(attempts int) bool {
+	if i.InLockout {
+		return true
+	}
+	if attempts <= 0 {
+		return false
+	}
+	return uint64(i.FailedTries)+uint64(attempts) >= uint64(i.MaxTries)
+}
+
+// GetLockoutInfo is a convenience function for [TPMContext.GetCapability] that returns the
+// current state of the TPM's dictionary attack protection. This can be used to avoid
+// triggering lockout mode when attempting operations that might fail authorization, in
+// combination with [LockoutInfo.WouldLockout].
+func (t *TPMContext) GetLockoutInfo(sessions ...SessionContext) (*LockoutInfo, error) {
+	permanent, err := t.GetCapabilityTPMProperty(PropertyPermanent, sessions...)
+	if err != nil {
+		return nil, err
+	}
+	props, err := t.GetCapabilityTPMProperties(PropertyLockoutCounter, 4, sessions...)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &LockoutInfo{InLockout: PermanentAttributes(permanent)&AttrInLockout != 0}
+	for _, p := range []struct {
+		property Property
+		value    *uint32
+	}{
+		{property: PropertyLockoutCounter, value: &info.FailedTries},
+		{property: PropertyMaxAuthFail, value: &info.MaxTries},
+		{property: PropertyLockoutInterval, value: &info.LockoutInterval},
+		{property: PropertyLockoutRecovery, value: &info.LockoutRecovery},
+	} {
+		found := false
+		for _, prop := range props {
+			if prop.Property == p.property {
+				*p.value = prop.Value
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("property %v does not exist", p.property)
+		}
+	}
+
+	return info, nil
+}
+
 // GetCapabilityPCRProperties is a convenience function for [TPMContext.GetCapability], and returns
 // the values of PCR properties. The first parameter indicates the first property for which to
 // return a value. If the property does not exist, then the value of the next available property is
@@ -511,6 +511,26 @@ func (s *capabilitiesSuite) TestGetManufacturer(c *C) {
 	c.Check(id, internal_testutil.IsOneOf(Equals), []TPMManufacturer{TPMManufacturerIBM, TPMManufacturerMSFT, TPMManufacturerNTC, TPMManufacturerSTM})
 }
 
+func (s *capabilitiesSuite) TestGetLockoutInfo(c *C) {
+	info, err := s.TPM.GetLockoutInfo()
+	c.Assert(err, IsNil)
+
+	permanent, err := s.TPM.GetCapabilityTPMProperty(PropertyPermanent)
+	c.Check(err, IsNil)
+	c.Check(info.InLockout, Equals, PermanentAttributes(permanent)&AttrInLockout != 0)
+
+	for prop, value := range map[Property]uint32{
+		PropertyLockoutCounter:  info.FailedTries,
+		PropertyMaxAuthFail:     info.MaxTries,
+		PropertyLockoutInterval: info.LockoutInterval,
+		PropertyLockoutRecovery: info.LockoutRecovery,
+	} {
+		expected, err := s.TPM.GetCapabilityTPMProperty(prop)
+		c.Check(err, IsNil)
+		c.Check(value, Equals, expected, Commentf("property %v", prop))
+	}
+}
+
 func (s *capabilitiesSuite) testTestParms(c *C, params *PublicParams) {
 	c.Check(s.TPM.TestParms(params), IsNil)
 }
@@ -627,6 +647,41 @@ func (s *capabilitiesSuite) TestGetCapabilityPCRProperties3(c *C) {
 			{Tag: PropertyPCRSave, Select: []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}}}})
 }
 
+type lockoutInfoSuite struct{}
+
+var _ = Suite(&lockoutInfoSuite{})
+
+func (s *lockoutInfoSuite) TestWouldLockoutNoFailures(c *C) {
+	info := &LockoutInfo{MaxTries: 3, LockoutInterval: 1000, LockoutRecovery: 1000}
+	c.Check(info.WouldLockout(0), internal_testutil.IsFalse)
+	c.Check(info.WouldLockout(2), internal_testutil.IsFalse)
+	c.Check(info.WouldLockout(3), internal_testutil.IsTrue)
+	c.Check(info.WouldLockout(4), internal_testutil.IsTrue)
+}
+
+func (s *lockoutInfoSuite) TestWouldLockoutSomeFailures(c *C) {
+	info := &LockoutInfo{FailedTries: 30, MaxTries: 32, LockoutInterval: 7200, LockoutRecovery: 86400}
+	c.Check(info.WouldLockout(1), internal_testutil.IsFalse)
+	c.Check(info.WouldLockout(2), internal_testutil.IsTrue)
+}
+
+func (s *lockoutInfoSuite) TestWouldLockoutInLockout(c *C) {
+	info := &LockoutInfo{InLockout: true, FailedTries: 3, MaxTries: 3}
+	c.Check(info.WouldLockout(0), internal_testutil.IsTrue)
+	c.Check(info.WouldLockout(1), internal_testutil.IsTrue)
+}
+
+func (s *lockoutInfoSuite) TestWouldLockoutNoMaxTries(c *C) {
+	info := &LockoutInfo{}
+	c.Check(info.WouldLockout(0), internal_testutil.IsFalse)
+	c.Check(info.WouldLockout(1), internal_testutil.IsTrue)
+}
+
+func (s *lockoutInfoSuite) TestWouldLockoutNegativeAttempts(c *C) {
+	info := &LockoutInfo{FailedTries: 2, MaxTries: 3}
+	c.Check(info.WouldLockout(-1), internal_testutil.IsFalse)
+}
+
 // We don't have a TPM1.2 simulator, so create a mock TCTI that just returns
 // a TPM_BAD_ORDINAL error
 type mockTPM12Tcti struct{}
@@ -207,3 +207,99 @@ func TestDictionaryAttackLockReset(t *testing.T) {
 		run(t, sessionContext.WithAttrs(AttrContinueSession))
 	})
 }
+
+func TestGetLockoutInfoPredictsLockout(t *testing.T) {
+	tpm, _, closeTPM := testutil.NewTPMContextT(t, testutil.TPMFeatureOwnerHierarchy|testutil.TPMFeatureLockoutHierarchy|testutil.TPMFeatureNV)
+	defer closeTPM()
+
+	primary := createRSASrkForTesting(t, tpm, nil)
+	defer flushContext(t, tpm, primary)
+
+	template := Public{
+		Type:    ObjectTypeRSA,
+		NameAlg: HashAlgorithmSHA256,
+		Attrs:   AttrFixedTPM | AttrFixedParent | AttrSensitiveDataOrigin | AttrUserWithAuth | AttrDecrypt | AttrSign,
+		Params: &PublicParamsU{
+			RSADetail: &RSAParams{
+				Symmetric: SymDefObject{Algorithm: SymObjectAlgorithmNull},
+				Scheme:    RSAScheme{Scheme: RSASchemeNull},
+				KeyBits:   2048,
+				Exponent:  0}}}
+	sensitive := SensitiveCreate{UserAuth: testAuth}
+	priv, pub, _, _, _, err := tpm.Create(primary, &sensitive, &template, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	context, err := tpm.Load(primary, priv, pub, nil)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	defer flushContext(t, tpm, context)
+
+	origMaxTries, origRecoveryTime, origLockoutRecovery := getDictionaryAttackParams(t, tpm)
+	if err := tpm.DictionaryAttackParameters(tpm.LockoutHandleContext(), 2, 7200, 86400, nil); err != nil {
+		t.Fatalf("DictionaryAttackParameters failed: %v", err)
+	}
+	defer func() {
+		if err := tpm.DictionaryAttackParameters(tpm.LockoutHandleContext(), origMaxTries, origRecoveryTime, origLockoutRecovery, nil); err != nil {
+			t.Errorf("Failed to reset dictionary attack parameters: %v", err)
+		}
+	}()
+	defer func() {
+		if err := tpm.DictionaryAttackLockReset(tpm.LockoutHandleContext(), nil); err != nil {
+			t.Errorf("DictionaryAttackLockReset failed: %v", err)
+		}
+	}()
+
+	info, err := tpm.GetLockoutInfo()
+	if err != nil {
+		t.Fatalf("GetLockoutInfo failed: %v", err)
+	}
+	expected := LockoutInfo{MaxTries: 2, LockoutInterval: 7200, LockoutRecovery: 86400}
+	if *info != expected {
+		t.Errorf("Unexpected lockout info: %+v", info)
+	}
+	if info.WouldLockout(1) {
+		t.Errorf("WouldLockout(1) should have returned false")
+	}
+	if !info.WouldLockout(2) {
+		t.Errorf("WouldLockout(2) should have returned true")
+	}
+
+	context.SetAuthValue(nil)
+	_, err = tpm.ObjectChangeAuth(context, primary, nil, nil)
+	if !IsTPMSessionError(err, ErrorAuthFail, CommandObjectChangeAuth, 1) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	info, err = tpm.GetLockoutInfo()
+	if err != nil {
+		t.Fatalf("GetLockoutInfo failed: %v", err)
+	}
+	if info.FailedTries != 1 {
+		t.Errorf("Unexpected failure count %d", info.FailedTries)
+	}
+	if info.InLockout {
+		t.Errorf("TPM should not be in lockout mode")
+	}
+	if !info.WouldLockout(1) {
+		t.Errorf("WouldLockout(1) should have returned true")
+	}
+
+	_, err = tpm.ObjectChangeAuth(context, primary, nil, nil)
+	if !IsTPMSessionError(err, ErrorAuthFail, CommandObjectChangeAuth, 1) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	info, err = tpm.GetLockoutInfo()
+	if err != nil {
+		t.Fatalf("GetLockoutInfo failed: %v", err)
+	}
+	if !info.InLockout {
+		t.Errorf("TPM should be in lockout mode")
+	}
+	if !info.WouldLockout(0) {
+		t.Errorf("WouldLockout(0) should have returned true in lockout mode")
+	}
+}
@@ -540,8 +540,63 @@ func (t *TPMContext) PolicyNvWritten(policySession SessionContext, writtenSet bo
 		Run(nil)
 }
 
-// func (t *TPMContext) PolicyTemplate(policySession HandleContext, templateHash Digest, sessions ...SessionContext) error {
-// }
+// PolicyTemplate executes the TPM2_PolicyTemplate command to bind a policy to a specific object
+// template, and is a deferred assertion. This is used to limit usage of the session to
+// [TPMContext.Create], [TPMContext.CreatePrimary] and [TPMContext.CreateLoaded] with a specific
+// template. The templateHash argument is the digest of the template's public area, computed using
+// the session's digest algorithm.
+//
+// If the size of templateHash does not match the size of the session's digest algorithm, a
+// *[TPMParameterError] error with an error code of [ErrorSize] will be returned for parameter
+// index 1.
+//
+// If the session associated with policySession already has a cpHash, nameHash or template digest
+// set that doesn't match templateHash, a *[TPMParameterError] error with an error code of
+// [ErrorCpHash] will be returned for parameter index 1.
+//
+// On successful completion, the policy digest of the session associated with policySession will be
+// extended to include the value of templateHash, and templateHash will be recorded on the session
+// context so that it can be compared with the template of the object being created when the
+// session is used.
+func (t *TPMContext) PolicyTemplate(policySession SessionContext, templateHash Digest, sessions ...SessionContext) error {
+	return t.StartCommand(CommandPolicyTemplate).
+		AddHandles(UseHandleContext(policySession)).
+		AddParams(templateHash).
+		AddExtraSessions(sessions...).
+		Run(nil)
+}
 
-// func (t *TPMContext) PolicyAuthorizeNV(authContext, nvIndex, policySession HandleContext, authContextAuth interface{}, sessions ...SessionContext) error {
-// }
+// PolicyAuthorizeNV executes the TPM2_PolicyAuthorizeNV command to allow a policy to be approved
+// by the contents of the NV index associated with nvIndex, and is an immediate assertion. The NV
+// index contains a [TaggedHash] with the digest of the approved policy.
+//
+// The command requires authorization to read the NV index, defined by the state of the
+// [AttrNVPPRead], [AttrNVOwnerRead], [AttrNVAuthRead] and [AttrNVPolicyRead] attributes. The
+// handle used for authorization is specified via authContext, in the same way as for
+// [TPMContext.PolicyNV]. The command requires authorization with the user auth role for
+// authContext, with session based authorization provided via authContextAuthSession. If the
+// resource associated with authContext is not permitted to authorize this access, a *[TPMError]
+// error with an error code of [ErrorNVAuthorization] will be returned.
+//
+// If the index associated with nvIndex has the [AttrNVReadLocked] attribute set, a *[TPMError]
+// error with an error code of [ErrorNVLocked] will be returned.
+//
+// If the index associated with nvIndex has not been initialized (ie, the [AttrNVWritten] attribute
+// is not set), a *[TPMError] with an error code of [ErrorNVUninitialized] will be returned.
+//
+// If the index associated with nvIndex does not contain a valid [TaggedHash] for the session's
+// digest algorithm, a *[TPMHandleError] error with an error code of [ErrorHash] will be returned
+// for handle index 2.
+//
+// If the session associated with policySession is not a trial session and its current policy
+// digest does not match the digest contained in the NV index, a *[TPMError] error with an error
+// code of [ErrorValue] will be returned.
+//
+// On successful completion, the policy digest of the session associated with policySession is
+// cleared, and then extended to include the name of nvIndex.
+func (t *TPMContext) PolicyAuthorizeNV(authContext, nvIndex ResourceContext, policySession SessionContext, authContextAuthSession SessionContext, sessions ...SessionContext) error {
+	return t.StartCommand(CommandPolicyAuthorizeNV).
+		AddHandles(UseResourceContextWithAuth(authContext, authContextAuthSession), UseHandleContext(nvIndex), UseHandleContext(policySession)).
+		AddExtraSessions(sessions...).
+		Run(nil)
+}
@@ -15,6 +15,7 @@ import (
 
 	. "github.com/canonical/go-tpm2"
 	"github.com/canonical/go-tpm2/mu"
+	"github.com/canonical/go-tpm2/objectutil"
 	"github.com/canonical/go-tpm2/testutil"
 	"github.com/canonical/go-tpm2/util"
 )
@@ -744,6 +745,53 @@ func TestPolicyNameHash(t *testing.T) {
 	}
 }
 
+func TestPolicyTemplate(t *testing.T) {
+	tpm, _, closeTPM := testutil.NewTPMContextT(t, 0)
+	defer closeTPM()
+
+	for _, data := range []struct {
+		desc     string
+		template *Public
+	}{
+		{
+			desc:     "RSA",
+			template: objectutil.NewRSAStorageKeyTemplate(),
+		},
+		{
+			desc:     "ECC",
+			template: objectutil.NewECCKeyTemplate(objectutil.UsageSign),
+		},
+	} {
+		t.Run(data.desc, func(t *testing.T) {
+			h := crypto.SHA256.New()
+			mu.MustMarshalToWriter(h, data.template)
+			templateHash := h.Sum(nil)
+
+			trial := util.ComputeAuthPolicy(HashAlgorithmSHA256)
+			trial.PolicyTemplate(templateHash)
+
+			sessionContext, err := tpm.StartAuthSession(nil, nil, SessionTypePolicy, nil, HashAlgorithmSHA256)
+			if err != nil {
+				t.Fatalf("StartAuthSession failed: %v", err)
+			}
+			defer flushContext(t, tpm, sessionContext)
+
+			if err := tpm.PolicyTemplate(sessionContext, templateHash); err != nil {
+				t.Fatalf("PolicyTemplate failed: %v", err)
+			}
+
+			digest, err := tpm.PolicyGetDigest(sessionContext)
+			if err != nil {
+				t.Fatalf("PolicyGetDigest failed: %v", err)
+			}
+
+			if !bytes.Equal(digest, trial.GetDigest()) {
+				t.Errorf("Unexpected session digest")
+			}
+		})
+	}
+}
+
 func TestPolicyDuplicationSelect(t *testing.T) {
 	tpm, _, closeTPM := testutil.NewTPMContextT(t, 0)
 	defer closeTPM()
@@ -1186,6 +1234,64 @@ func TestPolicyNV(t *testing.T) {
 	}
 }
 
+func TestPolicyAuthorizeNV(t *testing.T) {
+	tpm, _, closeTPM := testutil.NewTPMContextT(t, testutil.TPMFeatureOwnerHierarchy|testutil.TPMFeatureNV)
+	defer closeTPM()
+
+	owner := tpm.OwnerHandleContext()
+
+	approvedTrial := util.ComputeAuthPolicy(HashAlgorithmSHA256)
+	approvedTrial.PolicyAuthValue()
+
+	pub := NVPublic{
+		Index:   Handle(0x0181ffff),
+		NameAlg: HashAlgorithmSHA256,
+		Attrs:   NVTypeOrdinary.WithAttrs(AttrNVAuthWrite | AttrNVAuthRead | AttrNVNoDA),
+		Size:    34}
+	index, err := tpm.NVDefineSpace(owner, nil, &pub, nil)
+	if err != nil {
+		t.Fatalf("NVDefineSpace failed: %v", err)
+	}
+	defer undefineNVSpace(t, tpm, index, owner)
+
+	if err := tpm.NVWrite(index, index, mu.MustMarshalToBytes(MakeTaggedHash(HashAlgorithmSHA256, approvedTrial.GetDigest())), 0, nil); err != nil {
+		t.Fatalf("NVWrite failed: %v", err)
+	}
+
+	trial := util.ComputeAuthPolicy(HashAlgorithmSHA256)
+	trial.PolicyAuthorizeNV(index.Name())
+
+	sessionContext, err := tpm.StartAuthSession(nil, nil, SessionTypePolicy, nil, HashAlgorithmSHA256)
+	if err != nil {
+		t.Fatalf("StartAuthSession failed: %v", err)
+	}
+	defer flushContext(t, tpm, sessionContext)
+
+	if err := tpm.PolicyAuthValue(sessionContext); err != nil {
+		t.Fatalf("PolicyAuthValue failed: %v", err)
+	}
+	if err := tpm.PolicyAuthorizeNV(index, index, sessionContext, nil); err != nil {
+		t.Fatalf("PolicyAuthorizeNV failed: %v", err)
+	}
+
+	digest, err := tpm.PolicyGetDigest(sessionContext)
+	if err != nil {
+		t.Fatalf("PolicyGetDigest failed: %v", err)
+	}
+
+	if !bytes.Equal(digest, trial.GetDigest()) {
+		t.Errorf("Unexpected session digest")
+	}
+
+	if err := tpm.PolicyRestart(sessionContext); err != nil {
+		t.Fatalf("PolicyRestart failed: %v", err)
+	}
+	err = tpm.PolicyAuthorizeNV(index, index, sessionContext, nil)
+	if !IsTPMError(err, ErrorValue, CommandPolicyAuthorizeNV) {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
 func TestPolicyCounterTimer(t *testing.T) {
 	tpm, _, closeTPM := testutil.NewTPMContextT(t, 0)
 	defer closeTPM()
@@ -4,7 +4,7 @@
 
 package tpm2
 
-// Section 10 - Testing
+// Section 9 - Start-up
 
 // Startup executes the TPM2_Startup command with the specified StartupType. If this isn't preceded
 // by _TPM_Init then it will return a *[TPMError] error with an error code of [ErrorInitialize].
@@ -25,9 +25,14 @@ package tpm2
 // the function must be called with startupType == [StartupClear].
 //
 // Subsequent use of HandleContext instances corresponding to entities that are evicted as a
-// consequence of this function will no longer work.
+// consequence of this function will no longer work. Properties cached by [TPMContext.InitProperties]
+// are discarded on success, and will be queried again when they are next needed.
 func (t *TPMContext) Startup(startupType StartupType) error {
-	return t.StartCommand(CommandStartup).AddParams(startupType).Run(nil)
+	if err := t.StartCommand(CommandStartup).AddParams(startupType).Run(nil); err != nil {
+		return err
+	}
+	t.propertiesInitialized = false
+	return nil
 }
 
 // Shutdown executes the TPM2_Shutdown command with the specified StartupType, and is used to
@@ -5,3 +5,66 @@
 package tpm2
 
 // Section 15 - Symmetric Primitives
+
+// EncryptDecrypt executes the TPM2_EncryptDecrypt command to perform symmetric encryption or
+// decryption of inData with the symmetric key associated with keyContext. This command requires
+// authorization with the user auth role for keyContext, with session based authorization provided
+// via keyContextAuthSession.
+//
+// This command may not be supported by some TPMs because the parameter ordering prevents the
+// use of parameter encryption for inData. Use [TPMContext.EncryptDecrypt2] instead where
+// possible.
+//
+// See [TPMContext.EncryptDecrypt2] for a description of the arguments and errors.
+func (t *TPMContext) EncryptDecrypt(keyContext ResourceContext, decrypt bool, mode SymModeId, ivIn IV, inData MaxBuffer, keyContextAuthSession SessionContext, sessions ...SessionContext) (outData MaxBuffer, ivOut IV, err error) {
+	if err := t.StartCommand(CommandEncryptDecrypt).
+		AddHandles(UseResourceContextWithAuth(keyContext, keyContextAuthSession)).
+		AddParams(decrypt, mode, ivIn, inData).
+		AddExtraSessions(sessions...).
+		Run(nil, &outData, &ivOut); err != nil {
+		return nil, nil, err
+	}
+	return outData, ivOut, nil
+}
+
+// EncryptDecrypt2 executes the TPM2_EncryptDecrypt2 command to perform symmetric encryption or
+// decryption of inData with the symmetric key associated with keyContext. This command requires
+// authorization with the user auth role for keyContext, with session based authorization provided
+// via keyContextAuthSession.
+//
+// If keyContext does not correspond to an object with the type [ObjectTypeSymCipher], a
+// *[TPMHandleError] error with an error code of [ErrorType] will be returned.
+//
+// If keyContext corresponds to an object with the [AttrRestricted] attribute set, a
+// *[TPMHandleError] error with an error code of [ErrorAttributes] will be returned.
+//
+// If decrypt is true and keyContext corresponds to an object without the [AttrDecrypt] attribute
+// set, or decrypt is false and keyContext corresponds to an object without the [AttrSign]
+// attribute set, a *[TPMHandleError] error with an error code of [ErrorAttributes] will be
+// returned.
+//
+// The mode argument specifies the block cipher mode. If the key associated with keyContext has a
+// mode other than [SymModeNull], then mode must either be [SymModeNull] or must match the key's
+// mode, else a *[TPMParameterError] error with an error code of [ErrorMode] will be returned for
+// parameter index 3. If the key's mode is [SymModeNull], then mode must not be [SymModeNull].
+//
+// The ivIn argument specifies the initialization vector or initial counter value, and must be the
+// same size as the block size of the key's algorithm for modes other than [SymModeECB], else a
+// *[TPMParameterError] error with an error code of [ErrorSize] will be returned for parameter
+// index 4. For [SymModeCBC] and [SymModeECB], the size of inData must be a multiple of the block
+// size, else a *[TPMParameterError] error with an error code of [ErrorSize] will be returned for
+// parameter index 1.
+//
+// On success, the encrypted or decrypted data is returned, along with the chaining value that
+// can be supplied as ivIn in a subsequent call in order to process data that is too large for a
+// single call.
+func (t *TPMContext) EncryptDecrypt2(keyContext ResourceContext, inData MaxBuffer, decrypt bool, mode SymModeId, ivIn IV, keyContextAuthSession SessionContext, sessions ...SessionContext) (outData MaxBuffer, ivOut IV, err error) {
+	if err := t.StartCommand(CommandEncryptDecrypt2).
+		AddHandles(UseResourceContextWithAuth(keyContext, keyContextAuthSession)).
+		AddParams(inData, decrypt, mode, ivIn).
+		AddExtraSessions(sessions...).
+		Run(nil, &outData, &ivOut); err != nil {
+		return nil, nil, err
+	}
+	return outData, ivOut, nil
+}
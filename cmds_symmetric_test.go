@@ -0,0 +1,108 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package tpm2_test
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+
+	. "gopkg.in/check.v1"
+
+	. "github.com/canonical/go-tpm2"
+	internal_testutil "github.com/canonical/go-tpm2/internal/testutil"
+	"github.com/canonical/go-tpm2/objectutil"
+	"github.com/canonical/go-tpm2/testutil"
+)
+
+type symmetricSuite struct {
+	testutil.TPMTest
+}
+
+func (s *symmetricSuite) SetUpSuite(c *C) {
+	s.TPMFeatures = testutil.TPMFeatureOwnerHierarchy
+}
+
+var _ = Suite(&symmetricSuite{})
+
+type testEncryptDecrypt2Data struct {
+	keyMode   SymModeId
+	mode      SymModeId
+	newCipher func(block cipher.Block, iv []byte) cipher.Stream
+}
+
+func (s *symmetricSuite) testEncryptDecrypt2(c *C, data *testEncryptDecrypt2Data) {
+	s.RequireAlgorithm(c, AlgorithmId(data.mode))
+
+	key := internal_testutil.DecodeHexString(c, "4d2ae3cd7e8a1d9b0e6c3f6a8a1dfb1e3c7e5a9b0d2c4f6e8a1b3c5d7e9f0a1b")
+	iv := internal_testutil.DecodeHexString(c, "000102030405060708090a0b0c0d0e0f")
+	plaintext := []byte("some data that is going to be encrypted by the TPM")
+
+	primary := s.CreateStoragePrimaryKeyRSA(c)
+	template := objectutil.NewSymmetricKeyTemplate(objectutil.UsageEncrypt|objectutil.UsageDecrypt,
+		objectutil.WithExternalSensitiveData(),
+		objectutil.WithSymmetricScheme(SymObjectAlgorithmAES, 256, data.keyMode))
+	priv, pub, _, _, _, err := s.TPM.Create(primary, &SensitiveCreate{Data: key}, template, nil, nil, nil)
+	c.Assert(err, IsNil)
+	object, err := s.TPM.Load(primary, priv, pub, nil)
+	c.Assert(err, IsNil)
+
+	ciphertext, ivOut, err := s.TPM.EncryptDecrypt2(object, plaintext, false, data.mode, iv, nil)
+	c.Assert(err, IsNil)
+
+	block, err := aes.NewCipher(key)
+	c.Assert(err, IsNil)
+	expected := make([]byte, len(plaintext))
+	data.newCipher(block, iv).XORKeyStream(expected, plaintext)
+	c.Check(ciphertext, DeepEquals, MaxBuffer(expected))
+	c.Check(ivOut, internal_testutil.LenEquals, len(iv))
+
+	recovered, _, err := s.TPM.EncryptDecrypt2(object, ciphertext, true, data.mode, iv, nil)
+	c.Check(err, IsNil)
+	c.Check(recovered, DeepEquals, MaxBuffer(plaintext))
+}
+
+func (s *symmetricSuite) TestEncryptDecrypt2CFB(c *C) {
+	s.testEncryptDecrypt2(c, &testEncryptDecrypt2Data{
+		keyMode:   SymModeCFB,
+		mode:      SymModeCFB,
+		newCipher: cipher.NewCFBEncrypter})
+}
+
+func (s *symmetricSuite) TestEncryptDecrypt2CTR(c *C) {
+	s.testEncryptDecrypt2(c, &testEncryptDecrypt2Data{
+		keyMode:   SymModeCTR,
+		mode:      SymModeCTR,
+		newCipher: cipher.NewCTR})
+}
+
+func (s *symmetricSuite) TestEncryptDecrypt2OFB(c *C) {
+	s.testEncryptDecrypt2(c, &testEncryptDecrypt2Data{
+		keyMode:   SymModeOFB,
+		mode:      SymModeOFB,
+		newCipher: cipher.NewOFB})
+}
+
+func (s *symmetricSuite) TestEncryptDecrypt2KeyWithNullMode(c *C) {
+	s.testEncryptDecrypt2(c, &testEncryptDecrypt2Data{
+		keyMode:   SymModeNull,
+		mode:      SymModeCTR,
+		newCipher: cipher.NewCTR})
+}
+
+func (s *symmetricSuite) TestEncryptDecrypt2WrongMode(c *C) {
+	s.RequireAlgorithm(c, AlgorithmCTR)
+
+	primary := s.CreateStoragePrimaryKeyRSA(c)
+	template := objectutil.NewSymmetricKeyTemplate(objectutil.UsageEncrypt|objectutil.UsageDecrypt,
+		objectutil.WithSymmetricScheme(SymObjectAlgorithmAES, 128, SymModeCTR))
+	priv, pub, _, _, _, err := s.TPM.Create(primary, nil, template, nil, nil, nil)
+	c.Assert(err, IsNil)
+	object, err := s.TPM.Load(primary, priv, pub, nil)
+	c.Assert(err, IsNil)
+
+	_, _, err = s.TPM.EncryptDecrypt2(object, []byte("foo"), false, SymModeCFB, make(IV, 16), nil)
+	c.Check(err, internal_testutil.ConvertibleTo, &TPMParameterError{})
+	c.Check(err.(*TPMParameterError), DeepEquals, &TPMParameterError{TPMError: &TPMError{Command: CommandEncryptDecrypt2, Code: ErrorMode}, Index: 3})
+}
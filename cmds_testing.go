@@ -4,8 +4,16 @@
 
 package tpm2
 
-// Section 9 - Start-up
+// Section 10 - Testing
 
+// SelfTest executes the TPM2_SelfTest command, which causes the TPM to test its capabilities.
+// If fullTest is true, the TPM tests all of its functions. If fullTest is false, the TPM only
+// tests functions that haven't already been tested.
+//
+// The TPM may return before the tests complete, in which case subsequent commands that depend
+// on functions that are still being tested will fail with a *[TPMWarning] error with a
+// warning code of [WarningTesting]. The status of the tests can be obtained with
+// [TPMContext.GetTestResult]. See also [TPMContext.SetSelfTestPolicy].
 func (t *TPMContext) SelfTest(fullTest bool, sessions ...SessionContext) error {
 	return t.StartCommand(CommandSelfTest).
 		AddParams(fullTest).
@@ -13,6 +21,10 @@ func (t *TPMContext) SelfTest(fullTest bool, sessions ...SessionContext) error {
 		Run(nil)
 }
 
+// IncrementalSelfTest executes the TPM2_IncrementalSelfTest command, which causes the TPM to
+// test the algorithms in the supplied list that haven't already been tested. On success, it
+// returns a list of algorithms that still need to be tested, which may include algorithms
+// that weren't in the supplied list. The TPM may return before the tests complete.
 func (t *TPMContext) IncrementalSelfTest(toTest AlgorithmList, sessions ...SessionContext) (AlgorithmList, error) {
 	var toDoList AlgorithmList
 	if err := t.StartCommand(CommandIncrementalSelfTest).
@@ -24,6 +36,15 @@ func (t *TPMContext) IncrementalSelfTest(toTest AlgorithmList, sessions ...Sessi
 	return toDoList, nil
 }
 
+// GetTestResult executes the TPM2_GetTestResult command, which returns the status of the
+// TPM's self-tests. The testResult return value is [ResponseSuccess] if all tests have
+// completed successfully, a code that corresponds to [WarningTesting] if tests are still in
+// progress, a code that corresponds to [ErrorNeedsTest] if functions still need to be tested,
+// or a code that corresponds to [ErrorFailure] if the TPM is in failure mode. The testResult
+// can be converted to an error with [DecodeResponseCode]. The outData return value contains
+// manufacturer specific information.
+//
+// This command can be executed when the TPM is in failure mode.
 func (t *TPMContext) GetTestResult(sessions ...SessionContext) (outData MaxBuffer, testResult ResponseCode, err error) {
 	if err := t.StartCommand(CommandGetTestResult).
 		AddExtraSessions(sessions...).
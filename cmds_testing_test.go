@@ -0,0 +1,82 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package tpm2_test
+
+import (
+	. "gopkg.in/check.v1"
+
+	. "github.com/canonical/go-tpm2"
+	internal_testutil "github.com/canonical/go-tpm2/internal/testutil"
+	"github.com/canonical/go-tpm2/mu"
+	"github.com/canonical/go-tpm2/testutil"
+)
+
+type testingSuite struct {
+	testutil.TPMTest
+}
+
+var _ = Suite(&testingSuite{})
+
+// waitForTestResult polls TPM2_GetTestResult until the TPM is no longer testing.
+func (s *testingSuite) waitForTestResult(c *C) (MaxBuffer, ResponseCode) {
+	for {
+		outData, testResult, err := s.TPM.GetTestResult()
+		c.Assert(err, IsNil)
+		if IsTPMWarning(DecodeResponseCode(CommandGetTestResult, testResult), WarningTesting, CommandGetTestResult) {
+			continue
+		}
+		return outData, testResult
+	}
+}
+
+func (s *testingSuite) testSelfTest(c *C, fullTest bool) {
+	c.Check(s.TPM.SelfTest(fullTest), IsNil)
+
+	_, _, cpBytes := s.LastCommand(c).UnmarshalCommand(c)
+	var expectedFullTest bool
+	_, err := mu.UnmarshalFromBytes(cpBytes, &expectedFullTest)
+	c.Check(err, IsNil)
+	c.Check(expectedFullTest, Equals, fullTest)
+
+	_, testResult := s.waitForTestResult(c)
+	c.Check(testResult, Equals, ResponseSuccess)
+}
+
+func (s *testingSuite) TestSelfTestFull(c *C) {
+	s.testSelfTest(c, true)
+}
+
+func (s *testingSuite) TestSelfTestNotFull(c *C) {
+	s.testSelfTest(c, false)
+}
+
+func (s *testingSuite) TestGetTestResult(c *C) {
+	outData, testResult, err := s.TPM.GetTestResult()
+	c.Check(err, IsNil)
+
+	_, _, rpBytes, _ := s.LastCommand(c).UnmarshalResponse(c)
+	var expectedOutData MaxBuffer
+	var expectedTestResult ResponseCode
+	_, err = mu.UnmarshalFromBytes(rpBytes, &expectedOutData, &expectedTestResult)
+	c.Check(err, IsNil)
+	c.Check(outData, DeepEquals, expectedOutData)
+	c.Check(testResult, Equals, expectedTestResult)
+}
+
+func (s *testingSuite) TestIncrementalSelfTestAfterFullTest(c *C) {
+	c.Check(s.TPM.SelfTest(true), IsNil)
+	_, testResult := s.waitForTestResult(c)
+	c.Assert(testResult, Equals, ResponseSuccess)
+
+	toDoList, err := s.TPM.IncrementalSelfTest(AlgorithmList{AlgorithmSHA256, AlgorithmAES})
+	c.Check(err, IsNil)
+	c.Check(toDoList, internal_testutil.LenEquals, 0)
+
+	_, _, cpBytes := s.LastCommand(c).UnmarshalCommand(c)
+	var toTest AlgorithmList
+	_, err = mu.UnmarshalFromBytes(cpBytes, &toTest)
+	c.Check(err, IsNil)
+	c.Check(toTest, DeepEquals, AlgorithmList{AlgorithmSHA256, AlgorithmAES})
+}
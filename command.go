@@ -313,6 +313,7 @@ func UseHandleContext(h HandleContext) *CommandHandleContext {
 type commandDispatcher interface {
 	RunCommand(c *cmdContext, responseHandle *Handle) (*rspContext, error)
 	CompleteResponse(r *rspContext, responseParams ...interface{}) error
+	CommandSize(c *cmdContext) (int, error)
 }
 
 // CommandContext provides an API for building a command to execute via a [TPMContext].
@@ -359,6 +360,16 @@ func (c *CommandContext) AddExtraSessions(sessions ...SessionContext) *CommandCo
 	return c
 }
 
+// EstimateSize returns the size in bytes of the command packet that would be sent to
+// the TPM in order to execute the command defined by this context, without executing
+// it. This can be used to check whether a command will exceed the maximum command size
+// supported by a TPM or transmission interface before submitting it. The command
+// parameters are marshalled and the sessions are checked in the same way as they are
+// when the command is executed, but the session state is not modified.
+func (c *CommandContext) EstimateSize() (int, error) {
+	return c.dispatcher.CommandSize(&c.cmd)
+}
+
 // RunWithoutProcessingResponse executes the command defined by this context using the [TPMContext]
 // that created it. The caller supplies a pointer to the response handle if the command returns
 // one.
@@ -288,6 +288,11 @@ func (d *mockCommandDispatcher) RunCommand(c *CmdContext, responseHandle *Handle
 	return d.runRsp, nil
 }
 
+func (d *mockCommandDispatcher) CommandSize(c *CmdContext) (int, error) {
+	d.cmd = c
+	return 0, nil
+}
+
 func (d *mockCommandDispatcher) CompleteResponse(r *RspContext, responseParams ...interface{}) error {
 	d.rsp = r
 	if d.completeErr != nil {
@@ -7,6 +7,7 @@ package cryptutil
 import (
 	"crypto"
 	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/hmac"
 	"crypto/rsa"
 	"crypto/subtle"
@@ -59,12 +60,60 @@ func digestFromSignerOpts(opts crypto.SignerOpts) (tpm2.HashAlgorithmId, error)
 	}
 }
 
+// ECDSALowSOptions can be supplied to [Sign] when signing with an ECDSA key in order to
+// ensure that the returned signature has a low s value (see [NormalizeECDSALowS]).
+type ECDSALowSOptions struct {
+	Hash crypto.Hash // The digest algorithm
+}
+
+// HashFunc implements [crypto.SignerOpts.HashFunc].
+func (o *ECDSALowSOptions) HashFunc() crypto.Hash {
+	return o.Hash
+}
+
+// NormalizeECDSALowS canonicalizes the supplied ECDSA signature so that its s value
+// is not greater than half of the order of the supplied curve, by replacing a high s
+// value with N - s. Both values produce a valid signature, but some verifiers only
+// accept the low form in order to make signatures non-malleable. Signatures created by
+// the TPM aren't guaranteed to have a low s value. The signature is modified in place.
+func NormalizeECDSALowS(sig *tpm2.Signature, curve elliptic.Curve) error {
+	if sig == nil {
+		return errors.New("no signature")
+	}
+	if sig.SigAlg != tpm2.SigSchemeAlgECDSA || sig.Signature == nil || sig.Signature.ECDSA == nil {
+		return errors.New("not an ECDSA signature")
+	}
+	if curve == nil {
+		return errors.New("no curve")
+	}
+
+	n := curve.Params().N
+	s := new(big.Int).SetBytes(sig.Signature.ECDSA.SignatureS)
+	if s.Sign() == 0 || s.Cmp(n) >= 0 {
+		return errors.New("invalid s value")
+	}
+
+	if s.Cmp(new(big.Int).Rsh(n, 1)) > 0 {
+		sig.Signature.ECDSA.SignatureS = s.Sub(n, s).Bytes()
+	}
+	return nil
+}
+
 // Sign creates a signature of the supplied digest using the supplied signer and options.
 // Note that only RSA-SSA, RSA-PSS, ECDSA and HMAC signatures can be created. The returned
 // signature can be verified on a TPM using the associated public key.
 //
+// If opts is a *[ECDSALowSOptions] and the signer is an ECDSA key, the returned signature
+// will have a low s value.
+//
 // This may panic if the requested digest algorithm is not available.
 func Sign(rand io.Reader, signer crypto.Signer, digest []byte, opts crypto.SignerOpts) (*tpm2.Signature, error) {
+	lowS := false
+	if o, ok := opts.(*ECDSALowSOptions); ok {
+		lowS = true
+		opts = o.Hash
+	}
+
 	hashAlg, err := digestFromSignerOpts(opts)
 	if err != nil {
 		return nil, err
@@ -92,21 +141,10 @@ func Sign(rand io.Reader, signer crypto.Signer, digest []byte, opts crypto.Signe
 	case *rsa.PublicKey:
 		_ = k
 		if _, pss := opts.(*rsa.PSSOptions); pss {
-			return &tpm2.Signature{
-				SigAlg: tpm2.SigSchemeAlgRSAPSS,
-				Signature: &tpm2.SignatureU{
-					RSAPSS: &tpm2.SignatureRSAPSS{
-						Hash: hashAlg,
-						Sig:  sig}}}, nil
+			return tpm2.NewRSAPSSSignature(hashAlg, sig), nil
 		}
-		return &tpm2.Signature{
-			SigAlg: tpm2.SigSchemeAlgRSASSA,
-			Signature: &tpm2.SignatureU{
-				RSASSA: &tpm2.SignatureRSASSA{
-					Hash: hashAlg,
-					Sig:  sig}}}, nil
+		return tpm2.NewRSASSASignature(hashAlg, sig), nil
 	case *ecdsa.PublicKey:
-		_ = k
 		r, s := new(big.Int), new(big.Int)
 		var inner cryptobyte.String
 
@@ -118,13 +156,13 @@ func Sign(rand io.Reader, signer crypto.Signer, digest []byte, opts crypto.Signe
 			!inner.Empty() {
 			return nil, errors.New("invalid ASN.1 signature")
 		}
-		return &tpm2.Signature{
-			SigAlg: tpm2.SigSchemeAlgECDSA,
-			Signature: &tpm2.SignatureU{
-				ECDSA: &tpm2.SignatureECDSA{
-					Hash:       hashAlg,
-					SignatureR: r.Bytes(),
-					SignatureS: s.Bytes()}}}, nil
+		out := tpm2.NewECDSASignature(hashAlg, r.Bytes(), s.Bytes())
+		if lowS {
+			if err := NormalizeECDSALowS(out, k.Curve); err != nil {
+				return nil, fmt.Errorf("cannot normalize signature: %w", err)
+			}
+		}
+		return out, nil
 	case HMACKey:
 		_ = k
 		d := tpm2.MakeTaggedHash(hashAlg, sig)
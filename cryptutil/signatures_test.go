@@ -11,6 +11,7 @@ import (
 	"crypto/rand"
 	"crypto/rsa"
 	"io"
+	"math/big"
 
 	. "gopkg.in/check.v1"
 
@@ -311,3 +312,132 @@ func (s *signaturesSuite) TestVerifyHMACInvalid(c *C) {
 	c.Check(err, IsNil)
 	c.Check(ok, internal_testutil.IsFalse)
 }
+
+type signaturesSuiteNoTPM struct{}
+
+var _ = Suite(&signaturesSuiteNoTPM{})
+
+func (s *signaturesSuiteNoTPM) makeECDSASignature(c *C, key *ecdsa.PrivateKey, digest []byte, highS bool) *tpm2.Signature {
+	r, sigS, err := ecdsa.Sign(rand.Reader, key, digest)
+	c.Assert(err, IsNil)
+
+	n := key.Curve.Params().N
+	halfN := new(big.Int).Rsh(n, 1)
+	if (sigS.Cmp(halfN) > 0) != highS {
+		sigS.Sub(n, sigS)
+	}
+
+	return &tpm2.Signature{
+		SigAlg: tpm2.SigSchemeAlgECDSA,
+		Signature: &tpm2.SignatureU{
+			ECDSA: &tpm2.SignatureECDSA{
+				Hash:       tpm2.HashAlgorithmSHA256,
+				SignatureR: r.Bytes(),
+				SignatureS: sigS.Bytes()}}}
+}
+
+func (s *signaturesSuiteNoTPM) testNormalizeECDSALowS(c *C, curve elliptic.Curve, highS bool) {
+	key, err := ecdsa.GenerateKey(curve, rand.Reader)
+	c.Assert(err, IsNil)
+
+	h := tpm2.HashAlgorithmSHA256.NewHash()
+	io.WriteString(h, "foo")
+	digest := h.Sum(nil)
+
+	sig := s.makeECDSASignature(c, key, digest, highS)
+	origS := new(big.Int).SetBytes(sig.Signature.ECDSA.SignatureS)
+
+	ok, err := VerifySignature(&key.PublicKey, digest, sig)
+	c.Check(err, IsNil)
+	c.Check(ok, internal_testutil.IsTrue)
+
+	c.Check(NormalizeECDSALowS(sig, curve), IsNil)
+
+	n := curve.Params().N
+	normS := new(big.Int).SetBytes(sig.Signature.ECDSA.SignatureS)
+	c.Check(normS.Cmp(new(big.Int).Rsh(n, 1)) <= 0, internal_testutil.IsTrue)
+	if highS {
+		c.Check(normS, DeepEquals, new(big.Int).Sub(n, origS))
+	} else {
+		c.Check(normS, DeepEquals, origS)
+	}
+
+	ok, err = VerifySignature(&key.PublicKey, digest, sig)
+	c.Check(err, IsNil)
+	c.Check(ok, internal_testutil.IsTrue)
+}
+
+func (s *signaturesSuiteNoTPM) TestNormalizeECDSALowSHighP256(c *C) {
+	s.testNormalizeECDSALowS(c, elliptic.P256(), true)
+}
+
+func (s *signaturesSuiteNoTPM) TestNormalizeECDSALowSLowP256(c *C) {
+	s.testNormalizeECDSALowS(c, elliptic.P256(), false)
+}
+
+func (s *signaturesSuiteNoTPM) TestNormalizeECDSALowSHighP384(c *C) {
+	s.testNormalizeECDSALowS(c, elliptic.P384(), true)
+}
+
+func (s *signaturesSuiteNoTPM) TestNormalizeECDSALowSNotECDSA(c *C) {
+	sig := &tpm2.Signature{
+		SigAlg: tpm2.SigSchemeAlgRSASSA,
+		Signature: &tpm2.SignatureU{
+			RSASSA: &tpm2.SignatureRSASSA{
+				Hash: tpm2.HashAlgorithmSHA256,
+				Sig:  []byte{1, 2, 3}}}}
+	c.Check(NormalizeECDSALowS(sig, elliptic.P256()), ErrorMatches, `not an ECDSA signature`)
+}
+
+func (s *signaturesSuiteNoTPM) TestNormalizeECDSALowSInvalidS(c *C) {
+	sig := &tpm2.Signature{
+		SigAlg: tpm2.SigSchemeAlgECDSA,
+		Signature: &tpm2.SignatureU{
+			ECDSA: &tpm2.SignatureECDSA{
+				Hash:       tpm2.HashAlgorithmSHA256,
+				SignatureR: []byte{1},
+				SignatureS: elliptic.P256().Params().N.Bytes()}}}
+	c.Check(NormalizeECDSALowS(sig, elliptic.P256()), ErrorMatches, `invalid s value`)
+}
+
+func (s *signaturesSuiteNoTPM) TestSignECDSALowS(c *C) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+
+	h := tpm2.HashAlgorithmSHA256.NewHash()
+	io.WriteString(h, "foo")
+	digest := h.Sum(nil)
+
+	halfN := new(big.Int).Rsh(elliptic.P256().Params().N, 1)
+
+	// Sign several times, as roughly half of the signatures would
+	// have a high s value without normalization.
+	for i := 0; i < 16; i++ {
+		sig, err := Sign(rand.Reader, key, digest, &ECDSALowSOptions{Hash: crypto.SHA256})
+		c.Assert(err, IsNil)
+		c.Check(sig.SigAlg, Equals, tpm2.SigSchemeAlgECDSA)
+		c.Check(sig.Signature.ECDSA.Hash, Equals, tpm2.HashAlgorithmSHA256)
+		c.Check(new(big.Int).SetBytes(sig.Signature.ECDSA.SignatureS).Cmp(halfN) <= 0, internal_testutil.IsTrue)
+
+		ok, err := VerifySignature(&key.PublicKey, digest, sig)
+		c.Check(err, IsNil)
+		c.Check(ok, internal_testutil.IsTrue)
+	}
+}
+
+func (s *signaturesSuiteNoTPM) TestSignRSAWithECDSALowSOptions(c *C) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	c.Assert(err, IsNil)
+
+	h := tpm2.HashAlgorithmSHA256.NewHash()
+	io.WriteString(h, "foo")
+	digest := h.Sum(nil)
+
+	sig, err := Sign(rand.Reader, key, digest, &ECDSALowSOptions{Hash: crypto.SHA256})
+	c.Assert(err, IsNil)
+	c.Check(sig.SigAlg, Equals, tpm2.SigSchemeAlgRSASSA)
+
+	ok, err := VerifySignature(&key.PublicKey, digest, sig)
+	c.Check(err, IsNil)
+	c.Check(ok, internal_testutil.IsTrue)
+}
@@ -0,0 +1,11 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+/*
+Package eventlog contains a decoder for the TCG crypto-agile event log format, as
+described in the TCG PC Client Platform Firmware Profile Specification. It can be used
+to compute the expected values of PCRs so that they can be compared with the values
+returned from the TPM by [tpm2.TPMContext.PCRRead].
+*/
+package eventlog
@@ -0,0 +1,327 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package eventlog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/canonical/go-tpm2"
+)
+
+// EventType corresponds to the type of an event in an event log.
+type EventType uint32
+
+const (
+	EventTypePrebootCert          EventType = 0x00000000 // EV_PREBOOT_CERT
+	EventTypePostCode             EventType = 0x00000001 // EV_POST_CODE
+	EventTypeNoAction             EventType = 0x00000003 // EV_NO_ACTION
+	EventTypeSeparator            EventType = 0x00000004 // EV_SEPARATOR
+	EventTypeAction               EventType = 0x00000005 // EV_ACTION
+	EventTypeEventTag             EventType = 0x00000006 // EV_EVENT_TAG
+	EventTypeSCRTMContents        EventType = 0x00000007 // EV_S_CRTM_CONTENTS
+	EventTypeSCRTMVersion         EventType = 0x00000008 // EV_S_CRTM_VERSION
+	EventTypeCPUMicrocode         EventType = 0x00000009 // EV_CPU_MICROCODE
+	EventTypePlatformConfigFlags  EventType = 0x0000000a // EV_PLATFORM_CONFIG_FLAGS
+	EventTypeTableOfDevices       EventType = 0x0000000b // EV_TABLE_OF_DEVICES
+	EventTypeCompactHash          EventType = 0x0000000c // EV_COMPACT_HASH
+	EventTypeIPL                  EventType = 0x0000000d // EV_IPL
+	EventTypeIPLPartitionData     EventType = 0x0000000e // EV_IPL_PARTITION_DATA
+	EventTypeNonhostCode          EventType = 0x0000000f // EV_NONHOST_CODE
+	EventTypeNonhostConfig        EventType = 0x00000010 // EV_NONHOST_CONFIG
+	EventTypeNonhostInfo          EventType = 0x00000011 // EV_NONHOST_INFO
+	EventTypeOmitBootDeviceEvents EventType = 0x00000012 // EV_OMIT_BOOT_DEVICE_EVENTS
+
+	EventTypeEFIVariableDriverConfig    EventType = 0x80000001 // EV_EFI_VARIABLE_DRIVER_CONFIG
+	EventTypeEFIVariableBoot            EventType = 0x80000002 // EV_EFI_VARIABLE_BOOT
+	EventTypeEFIBootServicesApplication EventType = 0x80000003 // EV_EFI_BOOT_SERVICES_APPLICATION
+	EventTypeEFIBootServicesDriver      EventType = 0x80000004 // EV_EFI_BOOT_SERVICES_DRIVER
+	EventTypeEFIRuntimeServicesDriver   EventType = 0x80000005 // EV_EFI_RUNTIME_SERVICES_DRIVER
+	EventTypeEFIGPTEvent                EventType = 0x80000006 // EV_EFI_GPT_EVENT
+	EventTypeEFIAction                  EventType = 0x80000007 // EV_EFI_ACTION
+	EventTypeEFIPlatformFirmwareBlob    EventType = 0x80000008 // EV_EFI_PLATFORM_FIRMWARE_BLOB
+	EventTypeEFIHandoffTables           EventType = 0x80000009 // EV_EFI_HANDOFF_TABLES
+	EventTypeEFIHCRTMEvent              EventType = 0x80000010 // EV_EFI_HCRTM_EVENT
+	EventTypeEFIVariableAuthority       EventType = 0x800000e0 // EV_EFI_VARIABLE_AUTHORITY
+)
+
+const (
+	// maxPCRIndex is the maximum PCR index that can appear in a log.
+	maxPCRIndex = 23
+
+	// maxEventDataSize is a sanity limit on the size of event data.
+	maxEventDataSize = 1024 * 1024
+)
+
+var (
+	specIdEvent03Signature   = []byte("Spec ID Event03\x00")
+	startupLocalitySignature = []byte("StartupLocality\x00")
+)
+
+// Event corresponds to a single event in an event log.
+type Event struct {
+	PCRIndex  int                                  // The PCR that this event was measured to
+	EventType EventType                            // The type of this event
+	Digests   map[tpm2.HashAlgorithmId]tpm2.Digest // The digests of this event for each algorithm
+	Data      []byte                               // The raw event data
+}
+
+// EventLog corresponds to a decoded crypto-agile event log.
+type EventLog struct {
+	// Algorithms is the list of digest algorithms that each event contains
+	// digests for, as advertised in the Spec ID event.
+	Algorithms []tpm2.HashAlgorithmId
+
+	// Events contains the events in the log, excluding the Spec ID event.
+	Events []*Event
+}
+
+type digestSize struct {
+	alg  tpm2.HashAlgorithmId
+	size uint16
+}
+
+type specIdEvent struct {
+	digestSizes []digestSize
+}
+
+func parseSpecIdEvent(data []byte) (*specIdEvent, error) {
+	r := bytes.NewReader(data)
+
+	var hdr struct {
+		Signature        [16]byte
+		PlatformClass    uint32
+		SpecVersionMinor uint8
+		SpecVersionMajor uint8
+		SpecErrata       uint8
+		UintnSize        uint8
+		NumAlgs          uint32
+	}
+	if err := binary.Read(r, binary.LittleEndian, &hdr); err != nil {
+		return nil, fmt.Errorf("cannot decode header: %w", err)
+	}
+	if !bytes.Equal(hdr.Signature[:], specIdEvent03Signature) {
+		return nil, errors.New("log is not in the crypto-agile format")
+	}
+	if int64(hdr.NumAlgs) > int64(r.Len()/4) {
+		return nil, errors.New("invalid number of algorithms")
+	}
+
+	out := new(specIdEvent)
+	for i := uint32(0); i < hdr.NumAlgs; i++ {
+		var d struct {
+			Alg  uint16
+			Size uint16
+		}
+		if err := binary.Read(r, binary.LittleEndian, &d); err != nil {
+			return nil, fmt.Errorf("cannot decode digest size %d: %w", i, err)
+		}
+		alg := tpm2.HashAlgorithmId(d.Alg)
+		if alg.IsValid() && int(d.Size) != alg.Size() {
+			return nil, fmt.Errorf("invalid digest size for algorithm %v", alg)
+		}
+		out.digestSizes = append(out.digestSizes, digestSize{alg: alg, size: d.Size})
+	}
+
+	return out, nil
+}
+
+func readEventData(r io.Reader) ([]byte, error) {
+	var size uint32
+	if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+		return nil, err
+	}
+	if size > maxEventDataSize {
+		return nil, fmt.Errorf("event data too large (%d bytes)", size)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func readEvent(r io.Reader, spec *specIdEvent) (*Event, error) {
+	var hdr struct {
+		PCRIndex  uint32
+		EventType uint32
+		Count     uint32
+	}
+	if err := binary.Read(r, binary.LittleEndian, &hdr); err != nil {
+		return nil, err
+	}
+	if hdr.PCRIndex > maxPCRIndex {
+		return nil, fmt.Errorf("invalid PCR index %d", hdr.PCRIndex)
+	}
+	if hdr.Count > uint32(len(spec.digestSizes)) {
+		return nil, fmt.Errorf("invalid number of digests (%d)", hdr.Count)
+	}
+
+	event := &Event{
+		PCRIndex:  int(hdr.PCRIndex),
+		EventType: EventType(hdr.EventType),
+		Digests:   make(map[tpm2.HashAlgorithmId]tpm2.Digest)}
+
+	for i := uint32(0); i < hdr.Count; i++ {
+		var alg tpm2.HashAlgorithmId
+		if err := binary.Read(r, binary.LittleEndian, &alg); err != nil {
+			return nil, fmt.Errorf("cannot decode digest algorithm: %w", err)
+		}
+
+		size := -1
+		for _, s := range spec.digestSizes {
+			if s.alg == alg {
+				size = int(s.size)
+				break
+			}
+		}
+		if size < 0 {
+			return nil, fmt.Errorf("digest for unexpected algorithm %v", alg)
+		}
+
+		digest := make(tpm2.Digest, size)
+		if _, err := io.ReadFull(r, digest); err != nil {
+			return nil, fmt.Errorf("cannot decode digest for algorithm %v: %w", alg, err)
+		}
+		event.Digests[alg] = digest
+	}
+
+	data, err := readEventData(r)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode event data: %w", err)
+	}
+	event.Data = data
+
+	return event, nil
+}
+
+// Parse decodes a TCG crypto-agile event log from the supplied reader. The log must
+// begin with a TCG_PCClientPCREvent structure containing a Spec ID event, which
+// describes the digest algorithms present in the remaining events.
+func Parse(r io.Reader) (*EventLog, error) {
+	// The first event is in the legacy SHA-1 format.
+	var hdr struct {
+		PCRIndex  uint32
+		EventType uint32
+		Digest    [20]byte
+	}
+	if err := binary.Read(r, binary.LittleEndian, &hdr); err != nil {
+		return nil, fmt.Errorf("cannot decode Spec ID event header: %w", err)
+	}
+	if hdr.PCRIndex != 0 || EventType(hdr.EventType) != EventTypeNoAction {
+		return nil, errors.New("log does not begin with a Spec ID event")
+	}
+	data, err := readEventData(r)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode Spec ID event data: %w", err)
+	}
+	spec, err := parseSpecIdEvent(data)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode Spec ID event: %w", err)
+	}
+
+	log := new(EventLog)
+	for _, s := range spec.digestSizes {
+		log.Algorithms = append(log.Algorithms, s.alg)
+	}
+
+	br, ok := r.(interface {
+		io.Reader
+		Len() int
+	})
+	if !ok {
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read log: %w", err)
+		}
+		br = bytes.NewReader(b)
+	}
+
+	for br.Len() > 0 {
+		event, err := readEvent(br, spec)
+		if err != nil {
+			return nil, fmt.Errorf("cannot decode event %d: %w", len(log.Events), err)
+		}
+		log.Events = append(log.Events, event)
+	}
+
+	return log, nil
+}
+
+// Replay computes the expected PCR values for the specified algorithm by extending
+// the digests from each event in the log. Only PCRs that have events measured to them
+// are included in the result, which can be compared against the values returned from
+// [tpm2.TPMContext.PCRRead].
+//
+// EV_NO_ACTION events are not measured, with the exception of a StartupLocality event
+// which determines the initial value of PCR 0. This must appear before the first event
+// that is measured to PCR 0.
+//
+// An error is returned if the algorithm is not present in the log, if any measured
+// event is missing a digest for it, or if a StartupLocality event appears after the
+// first event that is measured to PCR 0.
+func (l *EventLog) Replay(alg tpm2.HashAlgorithmId) (tpm2.PCRValues, error) {
+	if !alg.Available() {
+		return nil, fmt.Errorf("algorithm %v is not available", alg)
+	}
+
+	found := false
+	for _, a := range l.Algorithms {
+		if a == alg {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("log does not contain digests for algorithm %v", alg)
+	}
+
+	values := make(tpm2.PCRValues)
+	current := func(pcr int) tpm2.Digest {
+		if d, ok := values[alg][pcr]; ok {
+			return d
+		}
+		return make(tpm2.Digest, alg.Size())
+	}
+
+	pcr0Measured := false
+	for i, event := range l.Events {
+		if event.EventType == EventTypeNoAction {
+			if event.PCRIndex == 0 && len(event.Data) == len(startupLocalitySignature)+1 &&
+				bytes.HasPrefix(event.Data, startupLocalitySignature) {
+				if pcr0Measured {
+					return nil, fmt.Errorf("StartupLocality event %d appears after the first measurement to PCR 0", i)
+				}
+				initial := make(tpm2.Digest, alg.Size())
+				initial[len(initial)-1] = event.Data[len(startupLocalitySignature)]
+				if err := values.SetValue(alg, 0, initial); err != nil {
+					return nil, fmt.Errorf("cannot set initial value for PCR 0: %w", err)
+				}
+			}
+			continue
+		}
+
+		digest, ok := event.Digests[alg]
+		if !ok {
+			return nil, fmt.Errorf("event %d has no digest for algorithm %v", i, alg)
+		}
+		if event.PCRIndex == 0 {
+			pcr0Measured = true
+		}
+
+		h := alg.NewHash()
+		h.Write(current(event.PCRIndex))
+		h.Write(digest)
+		if err := values.SetValue(alg, event.PCRIndex, h.Sum(nil)); err != nil {
+			return nil, fmt.Errorf("cannot extend PCR %d for event %d: %w", event.PCRIndex, i, err)
+		}
+	}
+
+	return values, nil
+}
@@ -0,0 +1,155 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package eventlog_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/go-tpm2"
+	. "github.com/canonical/go-tpm2/eventlog"
+	internal_testutil "github.com/canonical/go-tpm2/internal/testutil"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type eventlogSuite struct{}
+
+var _ = Suite(&eventlogSuite{})
+
+func (s *eventlogSuite) readLog(c *C, path string) []byte {
+	data, err := ioutil.ReadFile(path)
+	c.Assert(err, IsNil)
+	return data
+}
+
+func (s *eventlogSuite) digest(alg tpm2.HashAlgorithmId, data []byte) tpm2.Digest {
+	h := alg.NewHash()
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+func (s *eventlogSuite) extend(alg tpm2.HashAlgorithmId, pcr tpm2.Digest, data ...[]byte) tpm2.Digest {
+	for _, d := range data {
+		h := alg.NewHash()
+		h.Write(pcr)
+		h.Write(s.digest(alg, d))
+		pcr = h.Sum(nil)
+	}
+	return pcr
+}
+
+func (s *eventlogSuite) TestParse(c *C) {
+	log, err := Parse(bytes.NewReader(s.readLog(c, "testdata/eventlog1.bin")))
+	c.Assert(err, IsNil)
+	c.Check(log.Algorithms, DeepEquals, []tpm2.HashAlgorithmId{tpm2.HashAlgorithmSHA1, tpm2.HashAlgorithmSHA256})
+	c.Assert(log.Events, internal_testutil.LenEquals, 6)
+
+	c.Check(log.Events[0].PCRIndex, Equals, 0)
+	c.Check(log.Events[0].EventType, Equals, EventTypeNoAction)
+	c.Check(log.Events[0].Data, DeepEquals, []byte("StartupLocality\x00\x03"))
+
+	c.Check(log.Events[1].PCRIndex, Equals, 0)
+	c.Check(log.Events[1].EventType, Equals, EventTypeSCRTMVersion)
+	c.Check(log.Events[1].Data, DeepEquals, []byte("1.0\x00"))
+	c.Check(log.Events[1].Digests, DeepEquals, map[tpm2.HashAlgorithmId]tpm2.Digest{
+		tpm2.HashAlgorithmSHA1:   s.digest(tpm2.HashAlgorithmSHA1, []byte("1.0\x00")),
+		tpm2.HashAlgorithmSHA256: s.digest(tpm2.HashAlgorithmSHA256, []byte("1.0\x00"))})
+
+	c.Check(log.Events[2].PCRIndex, Equals, 0)
+	c.Check(log.Events[2].EventType, Equals, EventTypeSeparator)
+
+	c.Check(log.Events[3].PCRIndex, Equals, 4)
+	c.Check(log.Events[3].EventType, Equals, EventTypeEFIAction)
+	c.Check(log.Events[3].Data, DeepEquals, []byte("Calling EFI Application from Boot Option"))
+
+	c.Check(log.Events[4].PCRIndex, Equals, 7)
+	c.Check(log.Events[4].EventType, Equals, EventTypeSeparator)
+
+	c.Check(log.Events[5].PCRIndex, Equals, 4)
+	c.Check(log.Events[5].EventType, Equals, EventTypeEFIBootServicesApplication)
+	c.Check(log.Events[5].Data, DeepEquals, []byte("application"))
+}
+
+func (s *eventlogSuite) testReplay(c *C, alg tpm2.HashAlgorithmId) {
+	log, err := Parse(bytes.NewReader(s.readLog(c, "testdata/eventlog1.bin")))
+	c.Assert(err, IsNil)
+
+	values, err := log.Replay(alg)
+	c.Assert(err, IsNil)
+
+	pcr0 := make(tpm2.Digest, alg.Size())
+	pcr0[len(pcr0)-1] = 3
+	zero := make(tpm2.Digest, alg.Size())
+	separator := []byte{0, 0, 0, 0}
+
+	c.Check(values, DeepEquals, tpm2.PCRValues{
+		alg: {
+			0: s.extend(alg, pcr0, []byte("1.0\x00"), separator),
+			4: s.extend(alg, zero, []byte("Calling EFI Application from Boot Option"), []byte("application")),
+			7: s.extend(alg, zero, separator)}})
+}
+
+func (s *eventlogSuite) TestReplaySHA1(c *C) {
+	s.testReplay(c, tpm2.HashAlgorithmSHA1)
+}
+
+func (s *eventlogSuite) TestReplaySHA256(c *C) {
+	s.testReplay(c, tpm2.HashAlgorithmSHA256)
+}
+
+func (s *eventlogSuite) TestReplayMissingAlgorithm(c *C) {
+	log, err := Parse(bytes.NewReader(s.readLog(c, "testdata/eventlog1.bin")))
+	c.Assert(err, IsNil)
+
+	_, err = log.Replay(tpm2.HashAlgorithmSHA384)
+	c.Check(err, ErrorMatches, `log does not contain digests for algorithm TPM_ALG_SHA384`)
+}
+
+func (s *eventlogSuite) TestReplayStartupLocalityAfterPCR0Measurement(c *C) {
+	log, err := Parse(bytes.NewReader(s.readLog(c, "testdata/eventlog1.bin")))
+	c.Assert(err, IsNil)
+
+	// Move the StartupLocality event after the EV_S_CRTM_VERSION event.
+	log.Events[0], log.Events[1] = log.Events[1], log.Events[0]
+
+	_, err = log.Replay(tpm2.HashAlgorithmSHA256)
+	c.Check(err, ErrorMatches, `StartupLocality event 1 appears after the first measurement to PCR 0`)
+}
+
+func (s *eventlogSuite) TestReplayStartupLocalityAfterOtherMeasurements(c *C) {
+	log, err := Parse(bytes.NewReader(s.readLog(c, "testdata/eventlog1.bin")))
+	c.Assert(err, IsNil)
+
+	// Move the PCR 7 EV_SEPARATOR event to the start of the log. Events
+	// measured to other PCRs before the StartupLocality event are permitted.
+	events := log.Events
+	log.Events = []*Event{events[4], events[0], events[1], events[2], events[3], events[5]}
+
+	values, err := log.Replay(tpm2.HashAlgorithmSHA256)
+	c.Assert(err, IsNil)
+
+	pcr0 := make(tpm2.Digest, 32)
+	pcr0[len(pcr0)-1] = 3
+	c.Check(values[tpm2.HashAlgorithmSHA256][0], DeepEquals, s.extend(tpm2.HashAlgorithmSHA256, pcr0, []byte("1.0\x00"), []byte{0, 0, 0, 0}))
+}
+
+func (s *eventlogSuite) TestParseNotCryptoAgile(c *C) {
+	data := s.readLog(c, "testdata/eventlog1.bin")
+	data[32] = 'X'
+
+	_, err := Parse(bytes.NewReader(data))
+	c.Check(err, ErrorMatches, `cannot decode Spec ID event: log is not in the crypto-agile format`)
+}
+
+func (s *eventlogSuite) TestParseTruncated(c *C) {
+	data := s.readLog(c, "testdata/eventlog1.bin")
+
+	_, err := Parse(bytes.NewReader(data[:len(data)-4]))
+	c.Check(err, ErrorMatches, `cannot decode event 5: cannot decode event data: unexpected EOF`)
+}
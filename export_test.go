@@ -6,8 +6,10 @@ package tpm2
 
 import (
 	"bytes"
+	"context"
 	"crypto/rand"
 	"io"
+	"time"
 
 	"github.com/canonical/go-tpm2/mu"
 )
@@ -78,3 +80,17 @@ func NewMockResponseContext(dispatcher commandDispatcher, rsp *RspContext) *Resp
 		dispatcher: dispatcher,
 		rsp:        rsp}
 }
+
+func MockSleep(fn func(time.Duration)) (restore func()) {
+	orig := sleep
+	sleep = func(ctx context.Context, d time.Duration) error {
+		fn(d)
+		if ctx.Err() != nil {
+			return ErrCommandCancelled
+		}
+		return nil
+	}
+	return func() {
+		sleep = orig
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package util
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/cryptutil"
+)
+
+// VerifyAttest verifies that the supplied attestation structure was generated by
+// the TPM, that it has the expected type, that it is signed by the key with the
+// supplied public area and that it contains the supplied qualifying data. The
+// signature is verified against attestBytes, which must be the serialized form
+// of attest.
+func VerifyAttest(signer *tpm2.Public, attest *tpm2.Attest, attestBytes []byte, signature *tpm2.Signature, qualifyingData tpm2.Data, expectedType tpm2.StructTag) error {
+	if signer == nil || !signer.IsAsymmetric() {
+		return errors.New("invalid signing key")
+	}
+	if attest == nil {
+		return errors.New("no attestation")
+	}
+	if signature == nil {
+		return errors.New("no signature")
+	}
+
+	if attest.Magic != tpm2.TPMGeneratedValue {
+		return errors.New("invalid magic value")
+	}
+	if attest.Type != expectedType {
+		return fmt.Errorf("invalid attestation type %v", attest.Type)
+	}
+
+	if !signature.SigAlg.IsValid() {
+		return errors.New("invalid signature algorithm")
+	}
+	hashAlg := signature.HashAlg()
+	if !hashAlg.Available() {
+		return fmt.Errorf("signature digest algorithm %v is not available", hashAlg)
+	}
+	h := hashAlg.NewHash()
+	h.Write(attestBytes)
+	ok, err := cryptutil.VerifySignature(signer.Public(), h.Sum(nil), signature)
+	if err != nil {
+		return fmt.Errorf("cannot verify signature: %w", err)
+	}
+	if !ok {
+		return errors.New("invalid signature")
+	}
+
+	if !bytes.Equal(attest.ExtraData, qualifyingData) {
+		return errors.New("unexpected qualifying data")
+	}
+
+	return nil
+}
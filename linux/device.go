@@ -18,10 +18,6 @@ import (
 	"github.com/canonical/go-tpm2/ppi"
 )
 
-const (
-	devPath = "/dev"
-)
-
 var (
 	// ErrDefaultNotTPM2Device indicates that the default device is not a TPM device.
 	ErrDefaultNotTPM2Device = errors.New("the default TPM device is not a TPM2 device")
@@ -39,6 +35,7 @@ var (
 
 	errClosed = errors.New("use of closed file")
 
+	devPath   = "/dev"
 	sysfsPath = "/sys"
 )
 
@@ -142,6 +139,22 @@ func (d *TPMDeviceRaw) ResourceManagedDevice() (*TPMDeviceRM, error) {
 	}
 }
 
+// OpenPreferResourceManaged opens a connection to the corresponding resource managed
+// device if one is available, else it opens a connection to this raw device. This is
+// useful for opening a connection to a specific device on a system with multiple TPM
+// devices.
+func (d *TPMDeviceRaw) OpenPreferResourceManaged() (tpm2.TCTI, error) {
+	rm, err := d.ResourceManagedDevice()
+	switch {
+	case err == ErrNoResourceManagedDevice:
+		return d.Open()
+	case err != nil:
+		return nil, err
+	default:
+		return rm.Open()
+	}
+}
+
 // TPMDeviceRM represents a Linux TPM character device that makes use of the kernel
 // resource manager.
 type TPMDeviceRM struct {
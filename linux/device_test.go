@@ -5,6 +5,7 @@
 package linux_test
 
 import (
+	"io/ioutil"
 	"os/exec"
 	"path/filepath"
 
@@ -36,6 +37,15 @@ func (s *deviceSuite) unpackTarball(c *C, path string) string {
 	return dir
 }
 
+func (s *deviceSuite) mockDevPath(c *C, names ...string) string {
+	dir := c.MkDir()
+	for _, name := range names {
+		c.Assert(ioutil.WriteFile(filepath.Join(dir, name), nil, 0600), IsNil)
+	}
+	s.AddCleanup(MockDevPath(dir))
+	return dir
+}
+
 func (s *deviceSuite) TestListTPMDevicesTPM2(c *C) {
 	sysfsPath := s.unpackTarball(c, "testdata/tpm2-device-sysfs.tar")
 	s.AddCleanup(MockSysfsPath(sysfsPath))
@@ -423,3 +433,70 @@ func (s *deviceSuite) TestTPMDeviceRawPhysicalPresenceInterfaceNone(c *C) {
 	_, err = device.PhysicalPresenceInterface()
 	c.Assert(err, Equals, ErrNoPhysicalPresenceInterface)
 }
+
+func (s *deviceSuite) TestTPMDeviceRawOpen(c *C) {
+	sysfsPath := s.unpackTarball(c, "testdata/multiple-tpm2-devices-sysfs.tar")
+	s.AddCleanup(MockSysfsPath(sysfsPath))
+	devPath := s.mockDevPath(c, "tpm0", "tpm1", "tpmrm0", "tpmrm1")
+
+	devices, err := ListTPM2Devices()
+	c.Assert(err, IsNil)
+	c.Assert(devices, HasLen, 2)
+
+	tcti, err := devices[1].Open()
+	c.Assert(err, IsNil)
+	defer tcti.Close()
+
+	c.Assert(tcti, FitsTypeOf, &Tcti{})
+	c.Check(tcti.(*Tcti).Name(), Equals, filepath.Join(devPath, "tpm1"))
+}
+
+func (s *deviceSuite) TestTPMDeviceRMOpen(c *C) {
+	sysfsPath := s.unpackTarball(c, "testdata/tpm2-device-sysfs.tar")
+	s.AddCleanup(MockSysfsPath(sysfsPath))
+	devPath := s.mockDevPath(c, "tpm0", "tpmrm0")
+
+	device, err := DefaultTPM2Device()
+	c.Assert(err, IsNil)
+	rm, err := device.ResourceManagedDevice()
+	c.Assert(err, IsNil)
+
+	tcti, err := rm.Open()
+	c.Assert(err, IsNil)
+	defer tcti.Close()
+
+	c.Assert(tcti, FitsTypeOf, &Tcti{})
+	c.Check(tcti.(*Tcti).Name(), Equals, filepath.Join(devPath, "tpmrm0"))
+}
+
+func (s *deviceSuite) TestTPMDeviceRawOpenPreferResourceManaged(c *C) {
+	sysfsPath := s.unpackTarball(c, "testdata/tpm2-device-sysfs.tar")
+	s.AddCleanup(MockSysfsPath(sysfsPath))
+	devPath := s.mockDevPath(c, "tpm0", "tpmrm0")
+
+	device, err := DefaultTPM2Device()
+	c.Assert(err, IsNil)
+
+	tcti, err := device.OpenPreferResourceManaged()
+	c.Assert(err, IsNil)
+	defer tcti.Close()
+
+	c.Assert(tcti, FitsTypeOf, &Tcti{})
+	c.Check(tcti.(*Tcti).Name(), Equals, filepath.Join(devPath, "tpmrm0"))
+}
+
+func (s *deviceSuite) TestTPMDeviceRawOpenPreferResourceManagedNoRM(c *C) {
+	sysfsPath := s.unpackTarball(c, "testdata/tpm2-device-no-rm-sysfs.tar")
+	s.AddCleanup(MockSysfsPath(sysfsPath))
+	devPath := s.mockDevPath(c, "tpm0")
+
+	device, err := DefaultTPM2Device()
+	c.Assert(err, IsNil)
+
+	tcti, err := device.OpenPreferResourceManaged()
+	c.Assert(err, IsNil)
+	defer tcti.Close()
+
+	c.Assert(tcti, FitsTypeOf, &Tcti{})
+	c.Check(tcti.(*Tcti).Name(), Equals, filepath.Join(devPath, "tpm0"))
+}
@@ -8,6 +8,14 @@ type PpiImpl = ppiImpl
 
 var NewPPI = newPPI
 
+func MockDevPath(path string) (restore func()) {
+	orig := devPath
+	devPath = path
+	return func() {
+		devPath = orig
+	}
+}
+
 func MockSysfsPath(path string) (restore func()) {
 	orig := sysfsPath
 	sysfsPath = path
@@ -34,3 +42,7 @@ func NewMockTPMDeviceRM(path, sysfsPath string, version int, raw *TPMDeviceRaw)
 			version:   version},
 		raw: raw}
 }
+
+func (d *Tcti) Name() string {
+	return d.name
+}
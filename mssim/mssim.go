@@ -13,6 +13,7 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"sync"
 	"time"
 
 	"github.com/canonical/go-tpm2"
@@ -21,7 +22,10 @@ import (
 
 const (
 	cmdPowerOn        uint32 = 1
+	cmdPowerOff       uint32 = 2
 	cmdTPMSendCommand uint32 = 8
+	cmdCancelOn       uint32 = 9
+	cmdCancelOff      uint32 = 10
 	cmdNVOn           uint32 = 11
 	cmdReset          uint32 = 17
 	cmdSessionEnd     uint32 = 20
@@ -122,6 +126,9 @@ type Tcti struct {
 
 	commandInProgress bool
 	r                 io.Reader
+
+	platformMu sync.Mutex // protects platform and cancelOn
+	cancelOn   bool       // whether the cancel signal is asserted
 }
 
 // Read implmements [tpm2.TCTI.Read].
@@ -167,6 +174,12 @@ func (t *Tcti) Write(data []byte) (int, error) {
 		return 0, errors.New("command in progress or unread bytes from previous response")
 	}
 
+	// Make sure that a cancellation request for a previous command
+	// doesn't apply to this one.
+	if err := t.clearCancel(); err != nil {
+		return 0, fmt.Errorf("cannot clear cancel signal: %w", err)
+	}
+
 	buf := mu.MustMarshalToBytes(cmdTPMSendCommand, t.locality, uint32(len(data)), mu.RawBytes(data))
 
 	n, err := t.tpm.Write(buf)
@@ -193,6 +206,7 @@ func (t *Tcti) Close() (err error) {
 	return err
 }
 
+// SetTimeout implements [tpm2.TCTI.SetTimeout].
 func (t *Tcti) SetTimeout(timeout time.Duration) error {
 	t.timeout = timeout
 	return nil
@@ -203,8 +217,45 @@ func (t *Tcti) MakeSticky(handle tpm2.Handle, sticky bool) error {
 	return errors.New("not implemented")
 }
 
-// SetTimeout implements [tpm2.TCTI.SetTimeout].
+// Cancel implements [tpm2.CancellableTCTI.Cancel]. It asserts the cancel signal on the
+// platform connection, which causes the simulator to abort a long running command (such as key
+// generation) with a TPM_RC_CANCELED response. The signal is deasserted before the next command
+// is submitted.
+func (t *Tcti) Cancel() error {
+	t.platformMu.Lock()
+	defer t.platformMu.Unlock()
+
+	if t.cancelOn {
+		return nil
+	}
+	if err := t.platformCommandLocked(cmdCancelOn); err != nil {
+		return err
+	}
+	t.cancelOn = true
+	return nil
+}
+
+func (t *Tcti) clearCancel() error {
+	t.platformMu.Lock()
+	defer t.platformMu.Unlock()
+
+	if !t.cancelOn {
+		return nil
+	}
+	if err := t.platformCommandLocked(cmdCancelOff); err != nil {
+		return err
+	}
+	t.cancelOn = false
+	return nil
+}
+
 func (t *Tcti) platformCommand(cmd uint32) error {
+	t.platformMu.Lock()
+	defer t.platformMu.Unlock()
+	return t.platformCommandLocked(cmd)
+}
+
+func (t *Tcti) platformCommandLocked(cmd uint32) error {
 	if err := binary.Write(t.platform, binary.BigEndian, cmd); err != nil {
 		return fmt.Errorf("cannot send command: %w", err)
 	}
@@ -226,6 +277,28 @@ func (t *Tcti) SetLocality(locality uint8) error {
 	return nil
 }
 
+// PowerOn submits the power on command on the platform connection, which
+// simulates the application of power to the TPM simulator and results in the
+// execution of _TPM_Init(). The TPM simulator must be started with
+// TPM2_Startup before it can be used again.
+func (t *Tcti) PowerOn() error {
+	return t.platformCommand(cmdPowerOn)
+}
+
+// PowerOff submits the power off command on the platform connection, which
+// simulates the removal of power from the TPM simulator. The TPM should be
+// shut down with TPM2_Shutdown beforehand if its state is to be preserved.
+func (t *Tcti) PowerOff() error {
+	return t.platformCommand(cmdPowerOff)
+}
+
+// NVOn submits the NV on command on the platform connection, which makes the
+// NV memory of the TPM simulator available. This needs to be called after
+// PowerOn.
+func (t *Tcti) NVOn() error {
+	return t.platformCommand(cmdNVOn)
+}
+
 // Reset submits the reset command on the platform connection, which
 // initiates a reset of the TPM simulator and results in the execution
 // of _TPM_Init().
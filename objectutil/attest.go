@@ -0,0 +1,47 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package objectutil
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/canonical/go-tpm2"
+	internal_util "github.com/canonical/go-tpm2/internal/util"
+	"github.com/canonical/go-tpm2/mu"
+)
+
+// VerifyCertifyInfo verifies an attestation structure and signature returned from
+// [tpm2.TPMContext.Certify] without communicating with the TPM. This checks that the
+// attestation was generated by the TPM for the supplied qualifying data, that it is signed
+// by the key with the supplied public area, and that it certifies an object with the
+// expected name and qualified name. If expectedQualifiedName is nil, then the qualified
+// name is not checked. The expected qualified name can be computed with
+// [ComputeQualifiedName] or [ComputeQualifiedNameInHierarchy].
+//
+// Note that this can only verify the signature if the signing key is a RSA or ECC key.
+func VerifyCertifyInfo(signer *tpm2.Public, certifyInfo *tpm2.Attest, signature *tpm2.Signature, qualifyingData tpm2.Data, expectedName, expectedQualifiedName tpm2.Name) error {
+	if certifyInfo == nil {
+		return errors.New("no attestation")
+	}
+	certifyInfoBytes, err := mu.MarshalToBytes(certifyInfo)
+	if err != nil {
+		return fmt.Errorf("cannot marshal attestation: %w", err)
+	}
+	if err := internal_util.VerifyAttest(signer, certifyInfo, certifyInfoBytes, signature, qualifyingData, tpm2.TagAttestCertify); err != nil {
+		return err
+	}
+
+	info := certifyInfo.Attested.Certify
+	if !bytes.Equal(info.Name, expectedName) {
+		return fmt.Errorf("unexpected name %#x", info.Name)
+	}
+	if expectedQualifiedName != nil && !bytes.Equal(info.QualifiedName, expectedQualifiedName) {
+		return fmt.Errorf("unexpected qualified name %#x", info.QualifiedName)
+	}
+
+	return nil
+}
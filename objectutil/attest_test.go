@@ -0,0 +1,113 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package objectutil_test
+
+import (
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/go-tpm2"
+	. "github.com/canonical/go-tpm2/objectutil"
+	"github.com/canonical/go-tpm2/testutil"
+)
+
+type attestSuite struct {
+	testutil.TPMTest
+}
+
+func (s *attestSuite) SetUpSuite(c *C) {
+	s.TPMFeatures = testutil.TPMFeatureOwnerHierarchy | testutil.TPMFeatureEndorsementHierarchy
+}
+
+var _ = Suite(&attestSuite{})
+
+type certifyResult struct {
+	akPub          *tpm2.Public
+	certifyInfo    *tpm2.Attest
+	signature      *tpm2.Signature
+	qualifyingData tpm2.Data
+	name           tpm2.Name
+	qualifiedName  tpm2.Name
+}
+
+// certifyKey certifies a key created under the storage primary key with an
+// attestation key created in the endorsement hierarchy.
+func (s *attestSuite) certifyKey(c *C) *certifyResult {
+	ak := s.CreatePrimary(c, tpm2.HandleEndorsement, NewECCAttestationKeyTemplate())
+	akPub, _, _, err := s.TPM.ReadPublic(ak)
+	c.Assert(err, IsNil)
+
+	srk := s.CreateStoragePrimaryKeyRSA(c)
+	srkPub, _, _, err := s.TPM.ReadPublic(srk)
+	c.Assert(err, IsNil)
+
+	priv, pub, _, _, _, err := s.TPM.Create(srk, nil, NewECCKeyTemplate(UsageSign), nil, nil, nil)
+	c.Assert(err, IsNil)
+	key, err := s.TPM.Load(srk, priv, pub, nil)
+	c.Assert(err, IsNil)
+	defer s.TPM.FlushContext(key)
+
+	qualifyingData := tpm2.Data("foo")
+	certifyInfo, signature, err := s.TPM.Certify(key, ak, qualifyingData, nil, nil, nil)
+	c.Assert(err, IsNil)
+
+	qn, err := ComputeQualifiedNameInHierarchy(pub, tpm2.HandleOwner, srkPub)
+	c.Assert(err, IsNil)
+
+	return &certifyResult{
+		akPub:          akPub,
+		certifyInfo:    certifyInfo,
+		signature:      signature,
+		qualifyingData: qualifyingData,
+		name:           pub.Name(),
+		qualifiedName:  qn,
+	}
+}
+
+func (s *attestSuite) TestVerifyCertifyInfo(c *C) {
+	r := s.certifyKey(c)
+	c.Check(VerifyCertifyInfo(r.akPub, r.certifyInfo, r.signature, r.qualifyingData, r.name, r.qualifiedName), IsNil)
+}
+
+func (s *attestSuite) TestVerifyCertifyInfoNoQualifiedName(c *C) {
+	r := s.certifyKey(c)
+	c.Check(VerifyCertifyInfo(r.akPub, r.certifyInfo, r.signature, r.qualifyingData, r.name, nil), IsNil)
+}
+
+func (s *attestSuite) TestVerifyCertifyInfoWrongName(c *C) {
+	r := s.certifyKey(c)
+	err := VerifyCertifyInfo(r.akPub, r.certifyInfo, r.signature, r.qualifyingData, NewRSAStorageKeyTemplate().Name(), r.qualifiedName)
+	c.Check(err, ErrorMatches, `unexpected name 0x[[:xdigit:]]+`)
+}
+
+func (s *attestSuite) TestVerifyCertifyInfoWrongQualifiedName(c *C) {
+	r := s.certifyKey(c)
+	qn, err := ComputeQualifiedNameInHierarchy(tpm2.Name(r.name), tpm2.HandleEndorsement)
+	c.Assert(err, IsNil)
+	err = VerifyCertifyInfo(r.akPub, r.certifyInfo, r.signature, r.qualifyingData, r.name, qn)
+	c.Check(err, ErrorMatches, `unexpected qualified name 0x[[:xdigit:]]+`)
+}
+
+func (s *attestSuite) TestVerifyCertifyInfoWrongQualifyingData(c *C) {
+	r := s.certifyKey(c)
+	err := VerifyCertifyInfo(r.akPub, r.certifyInfo, r.signature, []byte("bar"), r.name, r.qualifiedName)
+	c.Check(err, ErrorMatches, `unexpected qualifying data`)
+}
+
+func (s *attestSuite) TestVerifyCertifyInfoWrongSigner(c *C) {
+	r := s.certifyKey(c)
+	other := s.CreatePrimary(c, tpm2.HandleOwner, NewECCAttestationKeyTemplate())
+	otherPub, _, _, err := s.TPM.ReadPublic(other)
+	c.Assert(err, IsNil)
+
+	err = VerifyCertifyInfo(otherPub, r.certifyInfo, r.signature, r.qualifyingData, r.name, r.qualifiedName)
+	c.Check(err, ErrorMatches, `invalid signature`)
+}
+
+func (s *attestSuite) TestVerifyCertifyInfoModified(c *C) {
+	r := s.certifyKey(c)
+	r.certifyInfo.FirmwareVersion++
+	err := VerifyCertifyInfo(r.akPub, r.certifyInfo, r.signature, r.qualifyingData, r.name, r.qualifiedName)
+	c.Check(err, ErrorMatches, `invalid signature`)
+}
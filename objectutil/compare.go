@@ -0,0 +1,102 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package objectutil
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/mu"
+)
+
+// CompareField identifies a field of a public area that can be ignored by [MatchesTemplate].
+type CompareField int
+
+const (
+	// CompareFieldUnique identifies the unique field of a public area.
+	CompareFieldUnique CompareField = iota + 1
+
+	// CompareFieldAuthPolicy identifies the authorization policy field of a
+	// public area.
+	CompareFieldAuthPolicy
+)
+
+// MatchesTemplate determines whether the supplied public area matches the supplied
+// template. This can be used after loading an object to check that it has the
+// expected type, name algorithm, attributes and parameters, in order to guard
+// against a substituted object. All fields are compared, other than those
+// identified by the ignore argument. As the TPM generates the unique field for
+// new objects, CompareFieldUnique will normally need to be supplied when
+// comparing an object against the template it was created from.
+func MatchesTemplate(pub *tpm2.Public, template *tpm2.Public, ignore ...CompareField) (bool, error) {
+	if pub == nil {
+		return false, errors.New("no public area")
+	}
+	if template == nil {
+		return false, errors.New("no template")
+	}
+
+	if pub.Type != template.Type {
+		return false, nil
+	}
+
+	// Make a shallow copy of the template, replacing fields that should be
+	// ignored with the values from the supplied public area.
+	expected := *template
+	for _, field := range ignore {
+		switch field {
+		case CompareFieldUnique:
+			expected.Unique = pub.Unique
+		case CompareFieldAuthPolicy:
+			expected.AuthPolicy = pub.AuthPolicy
+		default:
+			return false, fmt.Errorf("invalid field %d", field)
+		}
+	}
+
+	pubBytes, err := mu.MarshalToBytes(pub)
+	if err != nil {
+		return false, fmt.Errorf("cannot marshal public area: %w", err)
+	}
+	expectedBytes, err := mu.MarshalToBytes(&expected)
+	if err != nil {
+		return false, fmt.Errorf("cannot marshal template: %w", err)
+	}
+
+	return bytes.Equal(pubBytes, expectedBytes), nil
+}
+
+// NameDiff computes the names of the supplied public areas, and indicates whether
+// they are different. As the name of an object is computed from its entire public
+// area using its name algorithm, almost any edit to a public area will change its
+// name. This can be used by provisioning tools to warn that an edit to a template
+// will result in an object with a different name, which will break any policies
+// that reference the object by name.
+func NameDiff(before, after *tpm2.Public) (changed bool, beforeName, afterName tpm2.Name, err error) {
+	if before == nil || after == nil {
+		return false, nil, nil, errors.New("no public area")
+	}
+
+	beforeName, err = before.ComputeName()
+	if err != nil {
+		return false, nil, nil, fmt.Errorf("cannot compute name of original public area: %w", err)
+	}
+	afterName, err = after.ComputeName()
+	if err != nil {
+		return false, nil, nil, fmt.Errorf("cannot compute name of modified public area: %w", err)
+	}
+
+	return !bytes.Equal(beforeName, afterName), beforeName, afterName, nil
+}
+
+// AuthPolicyDigest returns the authorization policy digest of the supplied public area,
+// along with the algorithm that it was computed for, which is the name algorithm of
+// the object. This can be used to determine which policy an object was created with.
+// If the object has no authorization policy, the returned digest will be empty.
+func AuthPolicyDigest(pub *tpm2.Public) (alg tpm2.HashAlgorithmId, digest tpm2.Digest) {
+	return pub.NameAlg, pub.AuthPolicy
+}
@@ -0,0 +1,180 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package objectutil_test
+
+import (
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/go-tpm2"
+	internal_testutil "github.com/canonical/go-tpm2/internal/testutil"
+	. "github.com/canonical/go-tpm2/objectutil"
+	"github.com/canonical/go-tpm2/testutil"
+)
+
+type compareSuiteNoTPM struct{}
+
+type compareSuite struct {
+	testutil.TPMTest
+}
+
+func (s *compareSuite) SetUpSuite(c *C) {
+	s.TPMFeatures = testutil.TPMFeatureOwnerHierarchy
+}
+
+var _ = Suite(&compareSuiteNoTPM{})
+var _ = Suite(&compareSuite{})
+
+func (s *compareSuite) createKey(c *C, template *tpm2.Public) *tpm2.Public {
+	parent := s.CreateStoragePrimaryKeyRSA(c)
+	_, pub, _, _, _, err := s.TPM.Create(parent, nil, template, nil, nil, nil)
+	c.Assert(err, IsNil)
+	return pub
+}
+
+func (s *compareSuite) TestMatchesTemplateCreatedKeyIgnoreUnique(c *C) {
+	template := NewECCKeyTemplate(UsageSign)
+	pub := s.createKey(c, template)
+
+	ok, err := MatchesTemplate(pub, template, CompareFieldUnique)
+	c.Check(err, IsNil)
+	c.Check(ok, internal_testutil.IsTrue)
+}
+
+func (s *compareSuite) TestMatchesTemplateCreatedKey(c *C) {
+	template := NewECCKeyTemplate(UsageSign)
+	pub := s.createKey(c, template)
+
+	ok, err := MatchesTemplate(pub, template)
+	c.Check(err, IsNil)
+	c.Check(ok, internal_testutil.IsFalse)
+}
+
+func (s *compareSuite) TestMatchesTemplateCreatedKeyDifferentTemplate(c *C) {
+	pub := s.createKey(c, NewECCKeyTemplate(UsageSign))
+
+	ok, err := MatchesTemplate(pub, NewECCKeyTemplate(UsageSign, WithoutDictionaryAttackProtection()), CompareFieldUnique)
+	c.Check(err, IsNil)
+	c.Check(ok, internal_testutil.IsFalse)
+}
+
+func (s *compareSuiteNoTPM) TestMatchesTemplate(c *C) {
+	template := NewRSAStorageKeyTemplate()
+	pub := NewRSAStorageKeyTemplate()
+
+	ok, err := MatchesTemplate(pub, template)
+	c.Check(err, IsNil)
+	c.Check(ok, internal_testutil.IsTrue)
+}
+
+func (s *compareSuiteNoTPM) TestMatchesTemplateDifferentType(c *C) {
+	ok, err := MatchesTemplate(NewECCStorageKeyTemplate(), NewRSAStorageKeyTemplate(), CompareFieldUnique)
+	c.Check(err, IsNil)
+	c.Check(ok, internal_testutil.IsFalse)
+}
+
+func (s *compareSuiteNoTPM) TestMatchesTemplateDifferentKeyBits(c *C) {
+	ok, err := MatchesTemplate(NewRSAStorageKeyTemplate(WithRSAKeyBits(3072)), NewRSAStorageKeyTemplate(), CompareFieldUnique)
+	c.Check(err, IsNil)
+	c.Check(ok, internal_testutil.IsFalse)
+}
+
+func (s *compareSuiteNoTPM) TestMatchesTemplateDifferentAuthPolicy(c *C) {
+	template := NewRSAStorageKeyTemplate()
+	pub := NewRSAStorageKeyTemplate()
+	pub.AuthPolicy = make(tpm2.Digest, 32)
+
+	ok, err := MatchesTemplate(pub, template)
+	c.Check(err, IsNil)
+	c.Check(ok, internal_testutil.IsFalse)
+
+	ok, err = MatchesTemplate(pub, template, CompareFieldAuthPolicy)
+	c.Check(err, IsNil)
+	c.Check(ok, internal_testutil.IsTrue)
+}
+
+func (s *compareSuiteNoTPM) TestMatchesTemplateInvalidField(c *C) {
+	_, err := MatchesTemplate(NewRSAStorageKeyTemplate(), NewRSAStorageKeyTemplate(), CompareField(10))
+	c.Check(err, ErrorMatches, `invalid field 10`)
+}
+
+func (s *compareSuiteNoTPM) TestNameDiffUnchanged(c *C) {
+	before := NewRSAStorageKeyTemplate()
+	// The template is already DA protected, so this doesn't change it.
+	after := NewRSAStorageKeyTemplate(WithDictionaryAttackProtection())
+
+	changed, beforeName, afterName, err := NameDiff(before, after)
+	c.Check(err, IsNil)
+	c.Check(changed, internal_testutil.IsFalse)
+	c.Check(beforeName, DeepEquals, before.Name())
+	c.Check(afterName, DeepEquals, beforeName)
+}
+
+func (s *compareSuiteNoTPM) TestNameDiffNameAlg(c *C) {
+	before := NewRSAStorageKeyTemplate()
+	after := NewRSAStorageKeyTemplate(WithNameAlg(tpm2.HashAlgorithmSHA384))
+
+	changed, beforeName, afterName, err := NameDiff(before, after)
+	c.Check(err, IsNil)
+	c.Check(changed, internal_testutil.IsTrue)
+	c.Check(beforeName, DeepEquals, before.Name())
+	c.Check(beforeName.Algorithm(), Equals, tpm2.HashAlgorithmSHA256)
+	c.Check(afterName, DeepEquals, after.Name())
+	c.Check(afterName.Algorithm(), Equals, tpm2.HashAlgorithmSHA384)
+}
+
+func (s *compareSuiteNoTPM) TestNameDiffAttrs(c *C) {
+	before := NewRSAStorageKeyTemplate()
+	after := NewRSAStorageKeyTemplate(WithoutDictionaryAttackProtection())
+
+	changed, beforeName, afterName, err := NameDiff(before, after)
+	c.Check(err, IsNil)
+	c.Check(changed, internal_testutil.IsTrue)
+	c.Check(beforeName, DeepEquals, before.Name())
+	c.Check(afterName, DeepEquals, after.Name())
+}
+
+func (s *compareSuiteNoTPM) TestNameDiffAuthPolicy(c *C) {
+	before := NewRSAStorageKeyTemplate()
+	after := NewRSAStorageKeyTemplate()
+	after.AuthPolicy = make(tpm2.Digest, 32)
+
+	changed, _, _, err := NameDiff(before, after)
+	c.Check(err, IsNil)
+	c.Check(changed, internal_testutil.IsTrue)
+}
+
+func (s *compareSuiteNoTPM) TestNameDiffNoPublic(c *C) {
+	_, _, _, err := NameDiff(NewRSAStorageKeyTemplate(), nil)
+	c.Check(err, ErrorMatches, `no public area`)
+}
+
+func (s *compareSuiteNoTPM) TestNameDiffInvalidNameAlg(c *C) {
+	_, _, _, err := NameDiff(NewRSAStorageKeyTemplate(), NewRSAStorageKeyTemplate(WithNameAlg(tpm2.HashAlgorithmNull)))
+	c.Check(err, ErrorMatches, `cannot compute name of modified public area: unsupported name algorithm or algorithm not linked into binary: TPM_ALG_NULL`)
+}
+
+func (s *compareSuiteNoTPM) TestAuthPolicyDigest(c *C) {
+	pub := NewSealedObjectTemplate()
+	pub.AuthPolicy = internal_testutil.DecodeHexString(c, "8fcd2169ab92694e0c633f1ab772842b8241bbc20288981fc7ac1eddc1fddb0e")
+
+	alg, digest := AuthPolicyDigest(pub)
+	c.Check(alg, Equals, tpm2.HashAlgorithmSHA256)
+	c.Check(digest, DeepEquals, pub.AuthPolicy)
+}
+
+func (s *compareSuiteNoTPM) TestAuthPolicyDigestSHA1(c *C) {
+	pub := NewSealedObjectTemplate(WithNameAlg(tpm2.HashAlgorithmSHA1))
+	pub.AuthPolicy = make(tpm2.Digest, 20)
+
+	alg, digest := AuthPolicyDigest(pub)
+	c.Check(alg, Equals, tpm2.HashAlgorithmSHA1)
+	c.Check(digest, DeepEquals, pub.AuthPolicy)
+}
+
+func (s *compareSuiteNoTPM) TestAuthPolicyDigestNone(c *C) {
+	alg, digest := AuthPolicyDigest(NewSealedObjectTemplate())
+	c.Check(alg, Equals, tpm2.HashAlgorithmSHA256)
+	c.Check(digest, internal_testutil.LenEquals, 0)
+}
@@ -5,10 +5,12 @@
 package objectutil
 
 import (
+	"crypto"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rsa"
 	"errors"
+	"fmt"
 	"io"
 	"math/big"
 
@@ -120,6 +122,28 @@ func NewECCPublicKey(key *ecdsa.PublicKey, options ...PublicTemplateOption) (*tp
 	return pub, nil
 }
 
+// PublicFromCryptoKey returns a public area for the supplied public key, which must be a
+// *[rsa.PublicKey] or *[ecdsa.PublicKey]. The object type, key size or curve, exponent and
+// public identity are all inferred from the supplied key, as described in [NewRSAPublicKey]
+// and [NewECCPublicKey]. The public area can be customized with additional options.
+//
+// The public area indicates that the sensitive data was generated outside of the TPM,
+// which can be overridden with [WithInternalSensitiveData].
+//
+// An error is returned if the key has an unsupported type.
+func PublicFromCryptoKey(key crypto.PublicKey, options ...PublicTemplateOption) (*tpm2.Public, error) {
+	options = append([]PublicTemplateOption{WithExternalSensitiveData()}, options...)
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return NewRSAPublicKey(k, options...)
+	case *ecdsa.PublicKey:
+		return NewECCPublicKey(k, options...)
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", key)
+	}
+}
+
 // NewSealedObject returns a public and sensitive area for a sealed data object containing the
 // supplied data and with the specified auth value. The supplied [io.Reader] is used to generate
 // the seed parameter for the sensitive area. The public area can be customized with additional
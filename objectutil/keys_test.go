@@ -7,9 +7,11 @@ package objectutil_test
 import (
 	"bytes"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
+	"math/big"
 
 	. "gopkg.in/check.v1"
 
@@ -64,6 +66,91 @@ func (s *keysSuite) TestNewECCPublicKey(c *C) {
 	c.Check(err, IsNil)
 }
 
+func (s *keysSuite) TestPublicFromCryptoKeyRSA(c *C) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	c.Assert(err, IsNil)
+
+	pub, err := PublicFromCryptoKey(key.Public())
+	c.Assert(err, IsNil)
+
+	expected, err := NewRSAPublicKey(&key.PublicKey)
+	c.Assert(err, IsNil)
+	c.Check(pub, testutil.TPMValueDeepEquals, expected)
+
+	_, err = s.TPM.LoadExternal(nil, pub, tpm2.HandleOwner)
+	c.Check(err, IsNil)
+}
+
+func (s *keysSuite) TestPublicFromCryptoKeyECC(c *C) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+
+	pub, err := PublicFromCryptoKey(key.Public())
+	c.Assert(err, IsNil)
+
+	expected, err := NewECCPublicKey(&key.PublicKey)
+	c.Assert(err, IsNil)
+	c.Check(pub, testutil.TPMValueDeepEquals, expected)
+
+	_, err = s.TPM.LoadExternal(nil, pub, tpm2.HandleOwner)
+	c.Check(err, IsNil)
+}
+
+type keysSuiteNoTPM struct{}
+
+var _ = Suite(&keysSuiteNoTPM{})
+
+func (s *keysSuiteNoTPM) TestPublicFromCryptoKeyRSA(c *C) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	c.Assert(err, IsNil)
+
+	pub, err := PublicFromCryptoKey(key.Public(), WithNameAlg(tpm2.HashAlgorithmSHA384), WithRSAScheme(tpm2.RSASchemeRSAPSS, tpm2.HashAlgorithmSHA384))
+	c.Assert(err, IsNil)
+
+	c.Check(pub.Type, Equals, tpm2.ObjectTypeRSA)
+	c.Check(pub.NameAlg, Equals, tpm2.HashAlgorithmSHA384)
+	c.Check(pub.Attrs, Equals, tpm2.AttrSign)
+	c.Check(pub.Params.RSADetail, testutil.TPMValueDeepEquals, &tpm2.RSAParams{
+		Symmetric: tpm2.SymDefObject{Algorithm: tpm2.SymObjectAlgorithmNull},
+		Scheme: tpm2.RSAScheme{
+			Scheme:  tpm2.RSASchemeRSAPSS,
+			Details: &tpm2.AsymSchemeU{RSAPSS: &tpm2.SigSchemeRSAPSS{HashAlg: tpm2.HashAlgorithmSHA384}}},
+		KeyBits: 2048})
+	c.Check(pub.Unique.RSA, DeepEquals, tpm2.PublicKeyRSA(key.N.Bytes()))
+}
+
+func (s *keysSuiteNoTPM) TestPublicFromCryptoKeyECC(c *C) {
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	c.Assert(err, IsNil)
+
+	pub, err := PublicFromCryptoKey(key.Public())
+	c.Assert(err, IsNil)
+
+	c.Check(pub.Type, Equals, tpm2.ObjectTypeECC)
+	c.Check(pub.NameAlg, Equals, tpm2.HashAlgorithmSHA256)
+	c.Check(pub.Attrs, Equals, tpm2.AttrSign)
+	c.Check(pub.Params.ECCDetail.CurveID, Equals, tpm2.ECCCurveNIST_P384)
+	c.Check(new(big.Int).SetBytes(pub.Unique.ECC.X), DeepEquals, key.X)
+	c.Check(new(big.Int).SetBytes(pub.Unique.ECC.Y), DeepEquals, key.Y)
+}
+
+func (s *keysSuiteNoTPM) TestPublicFromCryptoKeyInternalSensitiveData(c *C) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+
+	pub, err := PublicFromCryptoKey(key.Public(), WithInternalSensitiveData())
+	c.Assert(err, IsNil)
+	c.Check(pub.Attrs, Equals, tpm2.AttrSign|tpm2.AttrSensitiveDataOrigin)
+}
+
+func (s *keysSuiteNoTPM) TestPublicFromCryptoKeyUnsupported(c *C) {
+	key, _, err := ed25519.GenerateKey(rand.Reader)
+	c.Assert(err, IsNil)
+
+	_, err = PublicFromCryptoKey(key)
+	c.Check(err, ErrorMatches, `unsupported key type ed25519.PublicKey`)
+}
+
 func (s *keysSuite) TestNewSealedObject(c *C) {
 	authValue := []byte("1234")
 	data := []byte("secret data")
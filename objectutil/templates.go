@@ -5,6 +5,10 @@
 package objectutil
 
 import (
+	"errors"
+	"fmt"
+	"strings"
+
 	"github.com/canonical/go-tpm2"
 )
 
@@ -29,6 +33,17 @@ const (
 // template.
 type PublicTemplateOption func(*tpm2.Public)
 
+// Profile returns an option that applies all of the supplied options in order. This
+// allows a set of options that are used repeatedly to be defined once and then passed to
+// any of the template constructors in place of the individual options.
+func Profile(options ...PublicTemplateOption) PublicTemplateOption {
+	return func(pub *tpm2.Public) {
+		for _, option := range options {
+			option(pub)
+		}
+	}
+}
+
 // WithNameAlg returns an option for the specified name algorithm.
 func WithNameAlg(alg tpm2.HashAlgorithmId) PublicTemplateOption {
 	return func(pub *tpm2.Public) {
@@ -217,13 +232,39 @@ func WithDuplicationMode(mode DuplicationMode) PublicTemplateOption {
 	}
 }
 
+func checkSymmetricModeUsage(pub *tpm2.Public, mode tpm2.SymModeId) {
+	if pub.Attrs&(tpm2.AttrRestricted|tpm2.AttrDecrypt) == tpm2.AttrRestricted|tpm2.AttrDecrypt {
+		// Storage keys must use CFB.
+		if mode != tpm2.SymModeCFB {
+			panic("invalid mode for storage key")
+		}
+		return
+	}
+
+	if pub.Type != tpm2.ObjectTypeSymCipher {
+		return
+	}
+
+	switch mode {
+	case tpm2.SymModeNull, tpm2.SymModeCTR, tpm2.SymModeOFB, tpm2.SymModeCBC, tpm2.SymModeCFB, tpm2.SymModeECB:
+	default:
+		panic("invalid mode")
+	}
+}
+
 // WithSymmetricScheme returns an option for the specified symmetric mode. This will panic for
 // objects with the type [tpm2.ObjectTypeKeyedHash].
 //
 // Symmetric keys and asymmetric storage keys always have a symmetric scheme. Other keys never have
-// a symmetric scheme. Only [tpm2.SymModeCFB] is valid for storage keys.
+// a symmetric scheme. Only [tpm2.SymModeCFB] is valid for storage keys, and this will panic if
+// another mode is specified for a storage key. Symmetric keys that aren't storage keys can use
+// [tpm2.SymModeCTR], [tpm2.SymModeOFB], [tpm2.SymModeCBC], [tpm2.SymModeCFB] or
+// [tpm2.SymModeECB], or [tpm2.SymModeNull] to permit the mode to be selected by the caller of
+// TPM2_EncryptDecrypt.
 func WithSymmetricScheme(alg tpm2.SymObjectAlgorithmId, keyBits uint16, mode tpm2.SymModeId) PublicTemplateOption {
 	return func(pub *tpm2.Public) {
+		checkSymmetricModeUsage(pub, mode)
+
 		sym := tpm2.SymDefObject{
 			Algorithm: alg,
 			KeyBits:   &tpm2.SymKeyBitsU{Sym: keyBits},
@@ -288,8 +329,12 @@ func WithRSAParams(keyBits uint16, exponent uint32) PublicTemplateOption {
 // WithRSAScheme returns an option for the specified RSA scheme. This will panic for objects with a
 // type other than [tpm2.ObjectTypeRSA].
 //
-// Attestation keys always have a signing scheme. Storage keys never have a scheme set. Decrypt or
-// signing keys may have an appropriate scheme set.
+// Attestation keys always have a signing scheme. Decrypt or signing keys may have an appropriate
+// scheme set: a signing scheme (RSASSA or RSAPSS) for signing keys, or an encryption scheme (RSAES
+// or OAEP) for decrypt keys. Keys that can be used for both signing and decryption must not have a
+// scheme set. Storage keys (restricted decrypt keys) never have a scheme set - use
+// [WithRestrictedDecryptScheme] to customize the symmetric scheme used to protect their children
+// instead. The TPM rejects templates that don't follow these rules.
 func WithRSAScheme(scheme tpm2.RSASchemeId, hashAlg tpm2.HashAlgorithmId) PublicTemplateOption {
 	return func(pub *tpm2.Public) {
 		if pub.Type != tpm2.ObjectTypeRSA {
@@ -344,12 +389,7 @@ func WithECCCurve(curve tpm2.ECCCurve) PublicTemplateOption {
 	}
 }
 
-// WithECCScheme returns an option for the specified ECC scheme. This will panic for objects with a
-// type other than [tpm2.ObjectTypeECC].
-//
-// Attestation keys always have a signing scheme. Storage keys never have a scheme set. Key
-// exchange or signing keys may have an appropriate scheme set.
-func WithECCScheme(scheme tpm2.ECCSchemeId, hashAlg tpm2.HashAlgorithmId) PublicTemplateOption {
+func withECCScheme(scheme tpm2.ECCSchemeId, hashAlg tpm2.HashAlgorithmId, count uint16) PublicTemplateOption {
 	return func(pub *tpm2.Public) {
 		if pub.Type != tpm2.ObjectTypeECC {
 			panic("invalid object type")
@@ -364,7 +404,7 @@ func WithECCScheme(scheme tpm2.ECCSchemeId, hashAlg tpm2.HashAlgorithmId) Public
 		case tpm2.ECCSchemeECDH:
 			s.Details.ECDH = &tpm2.KeySchemeECDH{HashAlg: hashAlg}
 		case tpm2.ECCSchemeECDAA:
-			s.Details.ECDAA = &tpm2.SigSchemeECDAA{HashAlg: hashAlg}
+			s.Details.ECDAA = &tpm2.SigSchemeECDAA{HashAlg: hashAlg, Count: count}
 		case tpm2.ECCSchemeSM2:
 			s.Details.SM2 = &tpm2.SigSchemeSM2{HashAlg: hashAlg}
 		case tpm2.ECCSchemeECSchnorr:
@@ -377,6 +417,30 @@ func WithECCScheme(scheme tpm2.ECCSchemeId, hashAlg tpm2.HashAlgorithmId) Public
 	}
 }
 
+// WithECCScheme returns an option for the specified ECC scheme. This will panic for objects with a
+// type other than [tpm2.ObjectTypeECC].
+//
+// Attestation keys always have a signing scheme. Signing or key exchange keys may have an
+// appropriate scheme set: a signing scheme (ECDSA, ECDAA, SM2 or ECSchnorr) for signing keys, or a
+// key exchange scheme (ECDH or ECMQV) for unrestricted key exchange keys. Keys that can be used
+// for both signing and key exchange must not have a scheme set. Storage keys (restricted decrypt
+// keys) never have a scheme set - use [WithRestrictedDecryptScheme] to customize the symmetric
+// scheme used to protect their children instead. The TPM rejects templates that don't follow
+// these rules.
+//
+// If the scheme is [tpm2.ECCSchemeECDAA], the count value is zero. Use [WithECCDAAScheme] to
+// specify a different value.
+func WithECCScheme(scheme tpm2.ECCSchemeId, hashAlg tpm2.HashAlgorithmId) PublicTemplateOption {
+	return withECCScheme(scheme, hashAlg, 0)
+}
+
+// WithECCDAAScheme returns an option for the ECDAA scheme with the specified digest algorithm and
+// count value. This will panic for objects with a type other than [tpm2.ObjectTypeECC]. The
+// ECDAA scheme can only be used by signing keys.
+func WithECCDAAScheme(hashAlg tpm2.HashAlgorithmId, count uint16) PublicTemplateOption {
+	return withECCScheme(tpm2.ECCSchemeECDAA, hashAlg, count)
+}
+
 // WithECCUnique returns an option for the specified public identity. This will panic for
 // objects with a type other than [tpm2.ObjectTypeECC].
 //
@@ -396,6 +460,38 @@ func WithECCUnique(unique *tpm2.ECCPoint) PublicTemplateOption {
 	}
 }
 
+// WithRestrictedDecryptScheme returns an option that turns an asymmetric key in to a storage key
+// (a restricted decrypt key) that protects its children with the specified symmetric algorithm and
+// key size in CFB mode. This will panic for objects with a type other than [tpm2.ObjectTypeRSA] or
+// [tpm2.ObjectTypeECC].
+//
+// The restricted and decrypt attributes are set and the sign attribute is cleared. As the TPM
+// requires storage keys to have no asymmetric scheme, any scheme previously set with
+// [WithRSAScheme] or [WithECCScheme] is removed, as is any key derivation scheme for ECC keys.
+func WithRestrictedDecryptScheme(alg tpm2.SymObjectAlgorithmId, keyBits uint16) PublicTemplateOption {
+	return func(pub *tpm2.Public) {
+		sym := tpm2.SymDefObject{
+			Algorithm: alg,
+			KeyBits:   &tpm2.SymKeyBitsU{Sym: keyBits},
+			Mode:      &tpm2.SymModeU{Sym: tpm2.SymModeCFB}}
+
+		switch pub.Type {
+		case tpm2.ObjectTypeRSA:
+			pub.Params.RSADetail.Symmetric = sym
+			pub.Params.RSADetail.Scheme = tpm2.RSAScheme{Scheme: tpm2.RSASchemeNull}
+		case tpm2.ObjectTypeECC:
+			pub.Params.ECCDetail.Symmetric = sym
+			pub.Params.ECCDetail.Scheme = tpm2.ECCScheme{Scheme: tpm2.ECCSchemeNull}
+			pub.Params.ECCDetail.KDF = tpm2.KDFScheme{Scheme: tpm2.KDFAlgorithmNull}
+		default:
+			panic("invalid object type")
+		}
+
+		pub.Attrs &^= tpm2.AttrSign
+		pub.Attrs |= tpm2.AttrRestricted | tpm2.AttrDecrypt
+	}
+}
+
 // WithHMACDigest returns an option for the specified HMAC digest algorithm. This will panic for
 // objects with a type other than [tpm2.ObjectTypeKeyedHash] and a scheme other than
 // [tpm2.KeyedHashSchemeHMAC].
@@ -682,7 +778,9 @@ func NewSymmetricStorageKeyTemplate(options ...PublicTemplateOption) *tpm2.Publi
 //   - Sensitive data generated by the TPM - customize with [WithInternalSensitiveData] and
 //     [WithExternalSensitiveData].
 //   - Not duplicable - customize with [WithProtectionGroupMode] and [WithDuplicationMode].
-//   - AES-128-CFB for the symmetric scheme - customize with [WithSymmetricScheme].
+//   - AES-128-CFB for the symmetric scheme - customize with [WithSymmetricScheme], which
+//     permits other block cipher modes such as [tpm2.SymModeCTR] to be selected for data
+//     encryption.
 func NewSymmetricKeyTemplate(usage Usage, options ...PublicTemplateOption) *tpm2.Public {
 	if usage == 0 {
 		panic("invalid usage")
@@ -788,3 +886,114 @@ func NewSealedObjectTemplate(options ...PublicTemplateOption) *tpm2.Public {
 	applyPublicTemplateOptions(template, options...)
 	return template
 }
+
+func checkTemplateHashAlg(tpm *tpm2.TPMContext, alg tpm2.HashAlgorithmId) bool {
+	return alg == tpm2.HashAlgorithmNull || tpm.IsAlgorithmSupported(tpm2.AlgorithmId(alg))
+}
+
+func checkTemplateSymmetric(tpm *tpm2.TPMContext, sym *tpm2.SymDefObject, problems *[]string) {
+	if sym.Algorithm == tpm2.SymObjectAlgorithmNull {
+		return
+	}
+	if sym.KeyBits == nil || !tpm.IsSymmetricAlgorithmSupported(sym.Algorithm, sym.KeyBits.Sym) {
+		var keyBits uint16
+		if sym.KeyBits != nil {
+			keyBits = sym.KeyBits.Sym
+		}
+		*problems = append(*problems, fmt.Sprintf("symmetric algorithm %v with %d bit key", sym.Algorithm, keyBits))
+	}
+	if sym.Mode != nil && sym.Mode.Sym != tpm2.SymModeNull && !tpm.IsAlgorithmSupported(tpm2.AlgorithmId(sym.Mode.Sym)) {
+		*problems = append(*problems, fmt.Sprintf("symmetric mode %v", sym.Mode.Sym))
+	}
+}
+
+func checkTemplateAsymScheme(tpm *tpm2.TPMContext, scheme tpm2.AsymSchemeId, details *tpm2.SchemeHash, problems *[]string) {
+	if scheme == tpm2.AsymSchemeNull {
+		return
+	}
+	if !tpm.IsAlgorithmSupported(tpm2.AlgorithmId(scheme)) {
+		*problems = append(*problems, fmt.Sprintf("scheme %v", scheme))
+	}
+	if details != nil && !checkTemplateHashAlg(tpm, details.HashAlg) {
+		*problems = append(*problems, fmt.Sprintf("scheme digest algorithm %v", details.HashAlg))
+	}
+}
+
+// FitTemplateToTPM checks whether the supplied template is supported by the specified TPM,
+// using its reported capabilities. This checks the name algorithm, the key size or curve,
+// the symmetric algorithm and the scheme. If any parameters are not supported, an error
+// listing all of them is returned. The template is never modified.
+func FitTemplateToTPM(tpm *tpm2.TPMContext, template *tpm2.Public) error {
+	if template == nil || template.Params == nil {
+		return errors.New("invalid template")
+	}
+
+	var problems []string
+	if !tpm.IsAlgorithmSupported(tpm2.AlgorithmId(template.NameAlg)) {
+		problems = append(problems, fmt.Sprintf("name algorithm %v", template.NameAlg))
+	}
+
+	switch template.Type {
+	case tpm2.ObjectTypeRSA:
+		params := template.Params.RSADetail
+		if params == nil {
+			return errors.New("invalid template: missing RSA parameters")
+		}
+		if !tpm.IsAlgorithmSupported(tpm2.AlgorithmRSA) {
+			problems = append(problems, "object type RSA")
+		} else if !tpm.IsRSAKeySizeSupported(params.KeyBits) {
+			problems = append(problems, fmt.Sprintf("RSA key size %d", params.KeyBits))
+		}
+		checkTemplateSymmetric(tpm, &params.Symmetric, &problems)
+		checkTemplateAsymScheme(tpm, tpm2.AsymSchemeId(params.Scheme.Scheme), params.Scheme.AnyDetails(), &problems)
+	case tpm2.ObjectTypeECC:
+		params := template.Params.ECCDetail
+		if params == nil {
+			return errors.New("invalid template: missing ECC parameters")
+		}
+		if !tpm.IsAlgorithmSupported(tpm2.AlgorithmECC) {
+			problems = append(problems, "object type ECC")
+		} else if !tpm.IsECCCurveSupported(params.CurveID) {
+			problems = append(problems, fmt.Sprintf("ECC curve %#x", uint16(params.CurveID)))
+		}
+		checkTemplateSymmetric(tpm, &params.Symmetric, &problems)
+		checkTemplateAsymScheme(tpm, tpm2.AsymSchemeId(params.Scheme.Scheme), params.Scheme.AnyDetails(), &problems)
+	case tpm2.ObjectTypeKeyedHash:
+		params := template.Params.KeyedHashDetail
+		if params == nil {
+			return errors.New("invalid template: missing keyed hash parameters")
+		}
+		var hashAlg tpm2.HashAlgorithmId
+		switch {
+		case params.Scheme.Scheme == tpm2.KeyedHashSchemeHMAC && params.Scheme.Details != nil && params.Scheme.Details.HMAC != nil:
+			hashAlg = params.Scheme.Details.HMAC.HashAlg
+		case params.Scheme.Scheme == tpm2.KeyedHashSchemeXOR && params.Scheme.Details != nil && params.Scheme.Details.XOR != nil:
+			hashAlg = params.Scheme.Details.XOR.HashAlg
+		default:
+			hashAlg = tpm2.HashAlgorithmNull
+		}
+		if !checkTemplateHashAlg(tpm, hashAlg) {
+			problems = append(problems, fmt.Sprintf("scheme digest algorithm %v", hashAlg))
+		}
+	case tpm2.ObjectTypeSymCipher:
+		params := template.Params.SymDetail
+		if params == nil {
+			return errors.New("invalid template: missing symmetric parameters")
+		}
+		checkTemplateSymmetric(tpm, &params.Sym, &problems)
+	default:
+		return fmt.Errorf("invalid template: unsupported object type %v", template.Type)
+	}
+
+	if len(problems) == 0 {
+		// Give the TPM the final say about the combination of parameters.
+		if err := tpm.TestParms(&tpm2.PublicParams{Type: template.Type, Parameters: template.Params}); err != nil {
+			problems = append(problems, fmt.Sprintf("parameters (%v)", err))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("template is not supported by the TPM: %s", strings.Join(problems, ", "))
+	}
+	return nil
+}
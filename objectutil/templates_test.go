@@ -8,6 +8,7 @@ import (
 	. "gopkg.in/check.v1"
 
 	"github.com/canonical/go-tpm2"
+	internal_testutil "github.com/canonical/go-tpm2/internal/testutil"
 	. "github.com/canonical/go-tpm2/objectutil"
 	"github.com/canonical/go-tpm2/testutil"
 )
@@ -16,6 +17,88 @@ type templatesSuite struct{}
 
 var _ = Suite(&templatesSuite{})
 
+type templatesTPMSuite struct {
+	testutil.TPMTest
+}
+
+func (s *templatesTPMSuite) SetUpSuite(c *C) {
+	s.TPMFeatures = testutil.TPMFeatureOwnerHierarchy
+}
+
+var _ = Suite(&templatesTPMSuite{})
+
+func (s *templatesTPMSuite) testCreateAndLoad(c *C, template *tpm2.Public) {
+	srk := s.CreateStoragePrimaryKeyRSA(c)
+
+	priv, pub, _, _, _, err := s.TPM.Create(srk, nil, template, nil, nil, nil)
+	c.Assert(err, IsNil)
+	c.Check(pub.Params.ECCDetail.Scheme, DeepEquals, template.Params.ECCDetail.Scheme)
+
+	key, err := s.TPM.Load(srk, priv, pub, nil)
+	c.Assert(err, IsNil)
+	s.TPM.FlushContext(key)
+}
+
+func (s *templatesTPMSuite) TestCreateECDAAKey(c *C) {
+	s.RequireAlgorithm(c, tpm2.AlgorithmECDAA)
+	s.RequireECCCurve(c, tpm2.ECCCurveBN_P256)
+	s.testCreateAndLoad(c, NewECCKeyTemplate(UsageSign, WithECCCurve(tpm2.ECCCurveBN_P256), WithECCDAAScheme(tpm2.HashAlgorithmSHA256, 0)))
+}
+
+func (s *templatesTPMSuite) TestCreateECDHKey(c *C) {
+	s.RequireAlgorithm(c, tpm2.AlgorithmECDH)
+	s.testCreateAndLoad(c, NewECCKeyTemplate(UsageKeyAgreement, WithECCScheme(tpm2.ECCSchemeECDH, tpm2.HashAlgorithmSHA256)))
+}
+
+func (s *templatesTPMSuite) TestCreateECMQVKey(c *C) {
+	s.RequireAlgorithm(c, tpm2.AlgorithmECMQV)
+	s.testCreateAndLoad(c, NewECCKeyTemplate(UsageKeyAgreement, WithECCScheme(tpm2.ECCSchemeECMQV, tpm2.HashAlgorithmSHA256)))
+}
+
+func (s *templatesTPMSuite) TestCreateRestrictedDecryptKeyFromDecryptTemplate(c *C) {
+	srk := s.CreateStoragePrimaryKeyRSA(c)
+
+	template := NewRSAKeyTemplate(UsageDecrypt,
+		WithRSAScheme(tpm2.RSASchemeOAEP, tpm2.HashAlgorithmSHA256),
+		WithRestrictedDecryptScheme(tpm2.SymObjectAlgorithmAES, 128))
+	priv, pub, _, _, _, err := s.TPM.Create(srk, nil, template, nil, nil, nil)
+	c.Assert(err, IsNil)
+
+	key, err := s.TPM.Load(srk, priv, pub, nil)
+	c.Assert(err, IsNil)
+	defer s.TPM.FlushContext(key)
+
+	// The new key can be used as a parent.
+	_, _, _, _, _, err = s.TPM.Create(key, nil, NewRSAKeyTemplate(UsageSign), nil, nil, nil)
+	c.Check(err, IsNil)
+}
+
+func (s *templatesTPMSuite) TestCreateAndUseCTRKey(c *C) {
+	s.RequireAlgorithm(c, tpm2.AlgorithmCTR)
+
+	srk := s.CreateStoragePrimaryKeyRSA(c)
+	template := NewSymmetricKeyTemplate(UsageEncrypt|UsageDecrypt, WithSymmetricScheme(tpm2.SymObjectAlgorithmAES, 256, tpm2.SymModeCTR))
+	priv, pub, _, _, _, err := s.TPM.Create(srk, nil, template, nil, nil, nil)
+	c.Assert(err, IsNil)
+	c.Check(pub.Params.SymDetail.Sym, testutil.TPMValueDeepEquals, template.Params.SymDetail.Sym)
+
+	key, err := s.TPM.Load(srk, priv, pub, nil)
+	c.Assert(err, IsNil)
+	defer s.TPM.FlushContext(key)
+
+	plaintext := []byte("some data to encrypt with a CTR mode key")
+	iv := make(tpm2.IV, 16)
+
+	ciphertext, _, err := s.TPM.EncryptDecrypt2(key, plaintext, false, tpm2.SymModeNull, iv, nil)
+	c.Assert(err, IsNil)
+	c.Check(ciphertext, internal_testutil.LenEquals, len(plaintext))
+	c.Check(ciphertext, Not(DeepEquals), tpm2.MaxBuffer(plaintext))
+
+	recovered, _, err := s.TPM.EncryptDecrypt2(key, ciphertext, true, tpm2.SymModeNull, iv, nil)
+	c.Assert(err, IsNil)
+	c.Check(recovered, DeepEquals, tpm2.MaxBuffer(plaintext))
+}
+
 func (s *templatesSuite) TestWithNameAlgSHA256(c *C) {
 	pub := new(tpm2.Public)
 	WithNameAlg(tpm2.HashAlgorithmSHA256)(pub)
@@ -167,6 +250,37 @@ func (s *templatesSuite) TestWithSymmetricSchemeSymCipher(c *C) {
 					Mode:      &tpm2.SymModeU{Sym: tpm2.SymModeCFB}}}}})
 }
 
+func (s *templatesSuite) TestWithSymmetricSchemeSymCipherModes(c *C) {
+	for _, mode := range []tpm2.SymModeId{tpm2.SymModeNull, tpm2.SymModeCTR, tpm2.SymModeOFB, tpm2.SymModeCBC, tpm2.SymModeCFB, tpm2.SymModeECB} {
+		pub := &tpm2.Public{
+			Type:   tpm2.ObjectTypeSymCipher,
+			Attrs:  tpm2.AttrDecrypt | tpm2.AttrSign,
+			Params: &tpm2.PublicParamsU{SymDetail: new(tpm2.SymCipherParams)}}
+		WithSymmetricScheme(tpm2.SymObjectAlgorithmAES, 256, mode)(pub)
+		c.Check(pub.Params.SymDetail.Sym.Mode.Sym, Equals, mode)
+	}
+}
+
+func (s *templatesSuite) TestWithSymmetricSchemeSymCipherInvalidMode(c *C) {
+	pub := &tpm2.Public{
+		Type:   tpm2.ObjectTypeSymCipher,
+		Attrs:  tpm2.AttrDecrypt | tpm2.AttrSign,
+		Params: &tpm2.PublicParamsU{SymDetail: new(tpm2.SymCipherParams)}}
+	c.Check(func() {
+		WithSymmetricScheme(tpm2.SymObjectAlgorithmAES, 256, tpm2.SymModeId(tpm2.AlgorithmSHA256))(pub)
+	}, PanicMatches, "invalid mode")
+}
+
+func (s *templatesSuite) TestWithSymmetricSchemeSymCipherStorageKeyInvalidMode(c *C) {
+	pub := NewSymmetricStorageKeyTemplate()
+	c.Check(func() { WithSymmetricScheme(tpm2.SymObjectAlgorithmAES, 256, tpm2.SymModeCTR)(pub) }, PanicMatches, "invalid mode for storage key")
+}
+
+func (s *templatesSuite) TestWithSymmetricSchemeRSAStorageKeyInvalidMode(c *C) {
+	pub := NewRSAStorageKeyTemplate()
+	c.Check(func() { WithSymmetricScheme(tpm2.SymObjectAlgorithmAES, 128, tpm2.SymModeOFB)(pub) }, PanicMatches, "invalid mode for storage key")
+}
+
 func (s *templatesSuite) TestWithSymmetricSchemeInvalidType(c *C) {
 	pub := &tpm2.Public{
 		Type:   tpm2.ObjectTypeKeyedHash,
@@ -289,6 +403,12 @@ func (s *templatesSuite) TestWithRSASchemeInvalidType(c *C) {
 	c.Check(func() { WithRSAScheme(tpm2.RSASchemeRSASSA, tpm2.HashAlgorithmSHA256)(pub) }, PanicMatches, "invalid object type")
 }
 
+func (s *templatesSuite) TestWithRSASchemeSignAndDecryptKey(c *C) {
+	// Invalid combinations are left for the TPM to reject.
+	pub := NewRSAKeyTemplate(UsageSign|UsageDecrypt, WithRSAScheme(tpm2.RSASchemeRSASSA, tpm2.HashAlgorithmSHA256))
+	c.Check(pub.Params.RSADetail.Scheme.Scheme, Equals, tpm2.RSASchemeRSASSA)
+}
+
 func (s *templatesSuite) TestWithRSAUnique(c *C) {
 	pub := &tpm2.Public{
 		Type:   tpm2.ObjectTypeRSA,
@@ -373,6 +493,53 @@ func (s *templatesSuite) TestWithECCSchemeInvalidType(c *C) {
 	c.Check(func() { WithECCScheme(tpm2.ECCSchemeECDSA, tpm2.HashAlgorithmSHA256)(pub) }, PanicMatches, "invalid object type")
 }
 
+func (s *templatesSuite) TestWithECCSchemeECMQV(c *C) {
+	pub := &tpm2.Public{
+		Type:   tpm2.ObjectTypeECC,
+		Attrs:  tpm2.AttrDecrypt,
+		Params: &tpm2.PublicParamsU{ECCDetail: new(tpm2.ECCParams)}}
+	WithECCScheme(tpm2.ECCSchemeECMQV, tpm2.HashAlgorithmSHA384)(pub)
+	c.Check(pub, DeepEquals, &tpm2.Public{
+		Type:  tpm2.ObjectTypeECC,
+		Attrs: tpm2.AttrDecrypt,
+		Params: &tpm2.PublicParamsU{
+			ECCDetail: &tpm2.ECCParams{
+				Scheme: tpm2.ECCScheme{
+					Scheme: tpm2.ECCSchemeECMQV,
+					Details: &tpm2.AsymSchemeU{
+						ECMQV: &tpm2.KeySchemeECMQV{HashAlg: tpm2.HashAlgorithmSHA384}}}}}})
+}
+
+func (s *templatesSuite) TestWithECCSchemeSignAndDecryptKey(c *C) {
+	// Invalid combinations are left for the TPM to reject.
+	pub := NewECCKeyTemplate(UsageSign|UsageKeyAgreement, WithECCScheme(tpm2.ECCSchemeECDSA, tpm2.HashAlgorithmSHA256))
+	c.Check(pub.Params.ECCDetail.Scheme.Scheme, Equals, tpm2.ECCSchemeECDSA)
+}
+
+func (s *templatesSuite) TestWithECCDAAScheme(c *C) {
+	pub := &tpm2.Public{
+		Type:   tpm2.ObjectTypeECC,
+		Attrs:  tpm2.AttrSign,
+		Params: &tpm2.PublicParamsU{ECCDetail: new(tpm2.ECCParams)}}
+	WithECCDAAScheme(tpm2.HashAlgorithmSHA256, 5)(pub)
+	c.Check(pub, DeepEquals, &tpm2.Public{
+		Type:  tpm2.ObjectTypeECC,
+		Attrs: tpm2.AttrSign,
+		Params: &tpm2.PublicParamsU{
+			ECCDetail: &tpm2.ECCParams{
+				Scheme: tpm2.ECCScheme{
+					Scheme: tpm2.ECCSchemeECDAA,
+					Details: &tpm2.AsymSchemeU{
+						ECDAA: &tpm2.SigSchemeECDAA{HashAlg: tpm2.HashAlgorithmSHA256, Count: 5}}}}}})
+}
+
+func (s *templatesSuite) TestWithECCDAASchemeInvalidType(c *C) {
+	pub := &tpm2.Public{
+		Type:   tpm2.ObjectTypeRSA,
+		Params: &tpm2.PublicParamsU{RSADetail: new(tpm2.RSAParams)}}
+	c.Check(func() { WithECCDAAScheme(tpm2.HashAlgorithmSHA256, 0)(pub) }, PanicMatches, "invalid object type")
+}
+
 func (s *templatesSuite) TestWithECCUnique(c *C) {
 	pub := &tpm2.Public{
 		Type:   tpm2.ObjectTypeECC,
@@ -391,6 +558,32 @@ func (s *templatesSuite) TestWithECCUniqueInvalidType(c *C) {
 	c.Check(func() { WithECCUnique(new(tpm2.ECCPoint))(pub) }, PanicMatches, "invalid object type")
 }
 
+func (s *templatesSuite) TestWithRestrictedDecryptSchemeRSA(c *C) {
+	pub := NewRSAKeyTemplate(UsageDecrypt, WithRSAScheme(tpm2.RSASchemeOAEP, tpm2.HashAlgorithmSHA256))
+	WithRestrictedDecryptScheme(tpm2.SymObjectAlgorithmAES, 128)(pub)
+	c.Check(pub, testutil.TPMValueDeepEquals, NewRSAStorageKeyTemplate())
+}
+
+func (s *templatesSuite) TestWithRestrictedDecryptSchemeRSAFromSignKey(c *C) {
+	pub := NewRSAKeyTemplate(UsageSign, WithRSAScheme(tpm2.RSASchemeRSAPSS, tpm2.HashAlgorithmSHA256))
+	WithRestrictedDecryptScheme(tpm2.SymObjectAlgorithmAES, 256)(pub)
+	c.Check(pub, testutil.TPMValueDeepEquals, NewRSAStorageKeyTemplate(WithSymmetricScheme(tpm2.SymObjectAlgorithmAES, 256, tpm2.SymModeCFB)))
+}
+
+func (s *templatesSuite) TestWithRestrictedDecryptSchemeECC(c *C) {
+	pub := NewECCKeyTemplate(UsageKeyAgreement, WithECCScheme(tpm2.ECCSchemeECDH, tpm2.HashAlgorithmSHA256))
+	pub.Params.ECCDetail.KDF = tpm2.KDFScheme{
+		Scheme:  tpm2.KDFAlgorithmKDF1_SP800_56A,
+		Details: &tpm2.KDFSchemeU{KDF1_SP800_56A: &tpm2.SchemeKDF1_SP800_56A{HashAlg: tpm2.HashAlgorithmSHA256}}}
+	WithRestrictedDecryptScheme(tpm2.SymObjectAlgorithmAES, 128)(pub)
+	c.Check(pub, testutil.TPMValueDeepEquals, NewECCStorageKeyTemplate())
+}
+
+func (s *templatesSuite) TestWithRestrictedDecryptSchemeInvalidType(c *C) {
+	pub := NewSymmetricKeyTemplate(UsageDecrypt)
+	c.Check(func() { WithRestrictedDecryptScheme(tpm2.SymObjectAlgorithmAES, 128)(pub) }, PanicMatches, "invalid object type")
+}
+
 func (s *templatesSuite) TestWithHMACDigestSHA256(c *C) {
 	pub := &tpm2.Public{
 		Type: tpm2.ObjectTypeKeyedHash,
@@ -812,6 +1005,21 @@ func (s *templatesSuite) TestNewSymmetricKeyTemplateWithOptions(c *C) {
 					Mode:      &tpm2.SymModeU{Sym: tpm2.SymModeCFB}}}}})
 }
 
+func (s *templatesSuite) TestNewSymmetricKeyTemplateCTR(c *C) {
+	template := NewSymmetricKeyTemplate(UsageEncrypt|UsageDecrypt,
+		WithSymmetricScheme(tpm2.SymObjectAlgorithmAES, 256, tpm2.SymModeCTR))
+	c.Check(template, testutil.TPMValueDeepEquals, &tpm2.Public{
+		Type:    tpm2.ObjectTypeSymCipher,
+		NameAlg: tpm2.HashAlgorithmSHA256,
+		Attrs:   tpm2.AttrFixedTPM | tpm2.AttrFixedParent | tpm2.AttrSensitiveDataOrigin | tpm2.AttrUserWithAuth | tpm2.AttrDecrypt | tpm2.AttrSign,
+		Params: &tpm2.PublicParamsU{
+			SymDetail: &tpm2.SymCipherParams{
+				Sym: tpm2.SymDefObject{
+					Algorithm: tpm2.SymObjectAlgorithmAES,
+					KeyBits:   &tpm2.SymKeyBitsU{Sym: 256},
+					Mode:      &tpm2.SymModeU{Sym: tpm2.SymModeCTR}}}}})
+}
+
 func (s *templatesSuite) TestNewSymmetricKeyTemplateDecrypt(c *C) {
 	template := NewSymmetricKeyTemplate(UsageDecrypt)
 	c.Check(template, testutil.TPMValueDeepEquals, &tpm2.Public{
@@ -916,3 +1124,71 @@ func (s *templatesSuite) TestNewSealedObjectTemplateWithOptions(c *C) {
 			KeyedHashDetail: &tpm2.KeyedHashParams{
 				Scheme: tpm2.KeyedHashScheme{Scheme: tpm2.KeyedHashSchemeNull}}}})
 }
+
+func (s *templatesSuite) TestProfile(c *C) {
+	profile := Profile(
+		WithNameAlg(tpm2.HashAlgorithmSHA384),
+		WithUserAuthMode(RequirePolicy),
+		WithoutDictionaryAttackProtection())
+
+	c.Check(NewRSAStorageKeyTemplate(profile), testutil.TPMValueDeepEquals, NewRSAStorageKeyTemplate(
+		WithNameAlg(tpm2.HashAlgorithmSHA384),
+		WithUserAuthMode(RequirePolicy),
+		WithoutDictionaryAttackProtection()))
+	c.Check(NewECCKeyTemplate(UsageSign, profile), testutil.TPMValueDeepEquals, NewECCKeyTemplate(UsageSign,
+		WithNameAlg(tpm2.HashAlgorithmSHA384),
+		WithUserAuthMode(RequirePolicy),
+		WithoutDictionaryAttackProtection()))
+	c.Check(NewSealedObjectTemplate(profile), testutil.TPMValueDeepEquals, &tpm2.Public{
+		Type:    tpm2.ObjectTypeKeyedHash,
+		NameAlg: tpm2.HashAlgorithmSHA384,
+		Attrs:   tpm2.AttrFixedTPM | tpm2.AttrFixedParent | tpm2.AttrNoDA,
+		Params: &tpm2.PublicParamsU{
+			KeyedHashDetail: &tpm2.KeyedHashParams{
+				Scheme: tpm2.KeyedHashScheme{Scheme: tpm2.KeyedHashSchemeNull}}}})
+}
+
+func (s *templatesSuite) TestProfileWithOtherOptions(c *C) {
+	profile := Profile(
+		WithNameAlg(tpm2.HashAlgorithmSHA384),
+		WithRSAKeyBits(3072))
+
+	// Options supplied after the profile take precedence.
+	c.Check(NewRSAAttestationKeyTemplate(profile, WithNameAlg(tpm2.HashAlgorithmSHA512)), testutil.TPMValueDeepEquals, NewRSAAttestationKeyTemplate(
+		WithRSAKeyBits(3072),
+		WithNameAlg(tpm2.HashAlgorithmSHA512)))
+}
+
+func (s *templatesSuite) TestProfileNested(c *C) {
+	profile := Profile(
+		Profile(WithNameAlg(tpm2.HashAlgorithmSHA1)),
+		WithUserAuthMode(RequirePolicy))
+	c.Check(NewHMACKeyTemplate(profile), testutil.TPMValueDeepEquals, NewHMACKeyTemplate(
+		WithNameAlg(tpm2.HashAlgorithmSHA1),
+		WithUserAuthMode(RequirePolicy)))
+}
+
+func (s *templatesTPMSuite) TestFitTemplateToTPMSupported(c *C) {
+	c.Check(FitTemplateToTPM(s.TPM, NewRSAStorageKeyTemplate()), IsNil)
+}
+
+func (s *templatesTPMSuite) TestFitTemplateToTPMSupportedECC(c *C) {
+	c.Check(FitTemplateToTPM(s.TPM, NewECCAttestationKeyTemplate()), IsNil)
+}
+
+func (s *templatesTPMSuite) TestFitTemplateToTPMUnsupportedRSAKeySize(c *C) {
+	err := FitTemplateToTPM(s.TPM, NewRSAStorageKeyTemplate(WithRSAKeyBits(1536)))
+	c.Check(err, ErrorMatches, `template is not supported by the TPM: RSA key size 1536`)
+}
+
+func (s *templatesTPMSuite) TestFitTemplateToTPMUnsupportedCurve(c *C) {
+	err := FitTemplateToTPM(s.TPM, NewECCKeyTemplate(UsageSign, WithECCCurve(tpm2.ECCCurve(0x1234))))
+	c.Check(err, ErrorMatches, `template is not supported by the TPM: ECC curve 0x1234`)
+}
+
+func (s *templatesTPMSuite) TestFitTemplateToTPMMultipleProblems(c *C) {
+	template := NewECCKeyTemplate(UsageSign, WithECCCurve(tpm2.ECCCurve(0x1234)))
+	template.NameAlg = tpm2.HashAlgorithmId(0x1234)
+	err := FitTemplateToTPM(s.TPM, template)
+	c.Check(err, ErrorMatches, `template is not supported by the TPM: name algorithm 0x1234, ECC curve 0x1234`)
+}
@@ -45,6 +45,47 @@ func (p *sessionParams) hasDecryptSession() bool {
 	return p.DecryptSessionIndex != -1
 }
 
+func (s *sessionParam) checkParameterEncryption() error {
+	var symmetric *SymDef
+	if data := s.Session.Data(); data != nil {
+		symmetric = data.Symmetric
+	}
+	if symmetric == nil || symmetric.Algorithm == SymAlgorithmNull {
+		return errors.New("no symmetric algorithm")
+	}
+
+	switch symmetric.Algorithm {
+	case SymAlgorithmAES:
+		if symmetric.Mode == nil || symmetric.Mode.Sym != SymModeCFB {
+			return errors.New("unsupported cipher mode")
+		}
+	case SymAlgorithmXOR:
+	default:
+		return fmt.Errorf("unsupported symmetric algorithm %v", symmetric.Algorithm)
+	}
+
+	return nil
+}
+
+// CheckParameterEncryption checks that the sessions with the AttrCommandEncrypt
+// and AttrResponseEncrypt attributes have a symmetric algorithm that can be used
+// for parameter encryption, so that a misconfigured session is detected before
+// the command is sent rather than when the parameters are encrypted or decrypted.
+func (p *sessionParams) CheckParameterEncryption() error {
+	decryptSession, _ := p.decryptSession()
+	encryptSession, _ := p.encryptSession()
+
+	for _, s := range []*sessionParam{decryptSession, encryptSession} {
+		if s == nil {
+			continue
+		}
+		if err := s.checkParameterEncryption(); err != nil {
+			return fmt.Errorf("session %v cannot be used for parameter encryption: %w", s.Session.Handle(), err)
+		}
+	}
+	return nil
+}
+
 func (p *sessionParams) ComputeEncryptNonce() {
 	s, i := p.encryptSession()
 	if s == nil || i == 0 || !p.Sessions[0].IsAuth() {
@@ -150,6 +150,99 @@ func (s *paramcryptSuite) TestSessionParamsComputeEncryptNonceWithEncryptAndDecr
 	c.Check(params[0].EncryptNonce, HasLen, 0)
 }
 
+func (s *paramcryptSuite) TestSessionParamsCheckParameterEncryptionNone(c *C) {
+	sessions := []*mockSessionContext{&mockSessionContext{data: &SessionContextData{}}}
+	params := []*SessionParam{newMockSessionParam(sessions[0], nil, false, nil, nil)}
+
+	c.Check(newMockSessionParams(0, params, -1, -1).CheckParameterEncryption(), IsNil)
+}
+
+func (s *paramcryptSuite) TestSessionParamsCheckParameterEncryptionAES(c *C) {
+	sessions := []*mockSessionContext{&mockSessionContext{
+		data: &SessionContextData{
+			Symmetric: &SymDef{
+				Algorithm: SymAlgorithmAES,
+				KeyBits:   &SymKeyBitsU{Sym: 128},
+				Mode:      &SymModeU{Sym: SymModeCFB}}}}}
+	params := []*SessionParam{newMockSessionParam(sessions[0], nil, false, nil, nil)}
+
+	c.Check(newMockSessionParams(0, params, 0, 0).CheckParameterEncryption(), IsNil)
+}
+
+func (s *paramcryptSuite) TestSessionParamsCheckParameterEncryptionXOR(c *C) {
+	sessions := []*mockSessionContext{&mockSessionContext{
+		data: &SessionContextData{
+			Symmetric: &SymDef{
+				Algorithm: SymAlgorithmXOR,
+				KeyBits:   &SymKeyBitsU{XOR: HashAlgorithmSHA256}}}}}
+	params := []*SessionParam{newMockSessionParam(sessions[0], nil, false, nil, nil)}
+
+	c.Check(newMockSessionParams(0, params, 0, 0).CheckParameterEncryption(), IsNil)
+}
+
+func (s *paramcryptSuite) TestSessionParamsCheckParameterEncryptionNoSymmetricDecrypt(c *C) {
+	sessions := []*mockSessionContext{&mockSessionContext{handle: 0x02000001, data: &SessionContextData{}}}
+	params := []*SessionParam{newMockSessionParam(sessions[0], nil, false, nil, nil)}
+
+	c.Check(newMockSessionParams(0, params, -1, 0).CheckParameterEncryption(), ErrorMatches,
+		`session 0x02000001 cannot be used for parameter encryption: no symmetric algorithm`)
+}
+
+func (s *paramcryptSuite) TestSessionParamsCheckParameterEncryptionNoSymmetricEncrypt(c *C) {
+	sessions := []*mockSessionContext{
+		&mockSessionContext{
+			handle: 0x02000000,
+			data: &SessionContextData{
+				Symmetric: &SymDef{
+					Algorithm: SymAlgorithmXOR,
+					KeyBits:   &SymKeyBitsU{XOR: HashAlgorithmSHA256}}}},
+		&mockSessionContext{handle: 0x02000002, data: &SessionContextData{}}}
+	params := []*SessionParam{
+		newMockSessionParam(sessions[0], nil, false, nil, nil),
+		newMockSessionParam(sessions[1], nil, false, nil, nil)}
+
+	c.Check(newMockSessionParams(0, params, 1, 0).CheckParameterEncryption(), ErrorMatches,
+		`session 0x02000002 cannot be used for parameter encryption: no symmetric algorithm`)
+}
+
+func (s *paramcryptSuite) TestSessionParamsCheckParameterEncryptionNullSymmetric(c *C) {
+	sessions := []*mockSessionContext{&mockSessionContext{
+		handle: 0x02000001,
+		data:   &SessionContextData{Symmetric: &SymDef{Algorithm: SymAlgorithmNull}}}}
+	params := []*SessionParam{newMockSessionParam(sessions[0], nil, false, nil, nil)}
+
+	c.Check(newMockSessionParams(0, params, 0, -1).CheckParameterEncryption(), ErrorMatches,
+		`session 0x02000001 cannot be used for parameter encryption: no symmetric algorithm`)
+}
+
+func (s *paramcryptSuite) TestSessionParamsCheckParameterEncryptionUnsupportedAlgorithm(c *C) {
+	sessions := []*mockSessionContext{&mockSessionContext{
+		handle: 0x02000001,
+		data: &SessionContextData{
+			Symmetric: &SymDef{
+				Algorithm: SymAlgorithmCamellia,
+				KeyBits:   &SymKeyBitsU{Sym: 128},
+				Mode:      &SymModeU{Sym: SymModeCFB}}}}}
+	params := []*SessionParam{newMockSessionParam(sessions[0], nil, false, nil, nil)}
+
+	c.Check(newMockSessionParams(0, params, 0, -1).CheckParameterEncryption(), ErrorMatches,
+		`session 0x02000001 cannot be used for parameter encryption: unsupported symmetric algorithm TPM_ALG_CAMELLIA`)
+}
+
+func (s *paramcryptSuite) TestSessionParamsCheckParameterEncryptionUnsupportedMode(c *C) {
+	sessions := []*mockSessionContext{&mockSessionContext{
+		handle: 0x02000001,
+		data: &SessionContextData{
+			Symmetric: &SymDef{
+				Algorithm: SymAlgorithmAES,
+				KeyBits:   &SymKeyBitsU{Sym: 128},
+				Mode:      &SymModeU{Sym: SymModeCBC}}}}}
+	params := []*SessionParam{newMockSessionParam(sessions[0], nil, false, nil, nil)}
+
+	c.Check(newMockSessionParams(0, params, -1, 0).CheckParameterEncryption(), ErrorMatches,
+		`session 0x02000001 cannot be used for parameter encryption: unsupported cipher mode`)
+}
+
 type testEncryptCommandParameterData struct {
 	sessions            []SessionContext
 	resources           []ResourceContext
@@ -0,0 +1,204 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package policyutil
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/canonical/go-tpm2"
+)
+
+// DigestAccumulator computes a policy digest incrementally from a sequence of assertions,
+// in the same way as a trial session on the TPM. Unlike [PolicyBuilder], it doesn't retain
+// any of the assertions, so it can be used to compute the digest of a large policy without
+// holding the whole policy in memory. The resulting digest can't be used to execute a
+// policy.
+//
+// Branches are computed by creating a separate DigestAccumulator for each branch with
+// [DigestAccumulator.Branch], and then supplying the resulting digests to
+// [DigestAccumulator.PolicyOR].
+type DigestAccumulator struct {
+	digest  taggedHash
+	session *computePolicySession
+}
+
+// NewDigestAccumulator returns a new DigestAccumulator for the specified algorithm, with
+// an initial digest of all zeros.
+func NewDigestAccumulator(alg tpm2.HashAlgorithmId) (*DigestAccumulator, error) {
+	if !alg.Available() {
+		return nil, errors.New("unavailable algorithm")
+	}
+	a := &DigestAccumulator{digest: taggedHash{HashAlg: alg, Digest: make(tpm2.Digest, alg.Size())}}
+	a.session = newComputePolicySession(&a.digest)
+	return a, nil
+}
+
+// Branch returns a new DigestAccumulator for computing the digest of a branch that
+// follows the assertions accumulated so far. Its initial digest is the current digest
+// of this accumulator, which is not modified.
+func (a *DigestAccumulator) Branch() *DigestAccumulator {
+	b := &DigestAccumulator{digest: taggedHash{HashAlg: a.digest.HashAlg, Digest: a.Digest()}}
+	b.session = newComputePolicySession(&b.digest)
+	return b
+}
+
+// PolicyNV updates the digest for a TPM2_PolicyNV assertion.
+func (a *DigestAccumulator) PolicyNV(nvIndex *tpm2.NVPublic, operandB tpm2.Operand, offset uint16, operation tpm2.ArithmeticOp) error {
+	if nvIndex == nil {
+		return errors.New("no nvIndex")
+	}
+	index := tpm2.NewLimitedResourceContext(nvIndex.Index, nvIndex.Name())
+	return a.session.PolicyNV(index, index, operandB, offset, operation, nil)
+}
+
+// PolicyAuthorizeNV updates the digest for a TPM2_PolicyAuthorizeNV assertion. This
+// resets the digest before it is updated.
+func (a *DigestAccumulator) PolicyAuthorizeNV(nvIndex *tpm2.NVPublic) error {
+	if nvIndex == nil {
+		return errors.New("no nvIndex")
+	}
+	index := tpm2.NewLimitedResourceContext(nvIndex.Index, nvIndex.Name())
+	return a.session.PolicyAuthorizeNV(index, index, nil)
+}
+
+// PolicySecret updates the digest for a TPM2_PolicySecret assertion.
+func (a *DigestAccumulator) PolicySecret(authObject Named, policyRef tpm2.Nonce) error {
+	if authObject == nil {
+		return errors.New("no authObject")
+	}
+	// the handle is not relevant here
+	_, _, err := a.session.PolicySecret(tpm2.NewLimitedResourceContext(0x80000000, authObject.Name()), nil, policyRef, 0, nil)
+	return err
+}
+
+// PolicySigned updates the digest for a TPM2_PolicySigned assertion.
+func (a *DigestAccumulator) PolicySigned(authKey *tpm2.Public, policyRef tpm2.Nonce) error {
+	if authKey == nil {
+		return errors.New("no authKey")
+	}
+	// the handle is not relevant here
+	_, _, err := a.session.PolicySigned(tpm2.NewLimitedResourceContext(0x80000000, authKey.Name()), false, nil, policyRef, 0, nil)
+	return err
+}
+
+// PolicyAuthorize updates the digest for a TPM2_PolicyAuthorize assertion.
+func (a *DigestAccumulator) PolicyAuthorize(policyRef tpm2.Nonce, keySign *tpm2.Public) error {
+	if keySign == nil {
+		return errors.New("no keySign")
+	}
+	keySignName := keySign.Name()
+	if !keySignName.IsValid() {
+		return errors.New("invalid keySign")
+	}
+	return a.session.PolicyAuthorize(nil, policyRef, keySignName, nil)
+}
+
+// PolicyAuthValue updates the digest for a TPM2_PolicyAuthValue assertion.
+func (a *DigestAccumulator) PolicyAuthValue() error {
+	return a.session.PolicyAuthValue()
+}
+
+// PolicyCommandCode updates the digest for a TPM2_PolicyCommandCode assertion.
+func (a *DigestAccumulator) PolicyCommandCode(code tpm2.CommandCode) error {
+	return a.session.PolicyCommandCode(code)
+}
+
+// PolicyCounterTimer updates the digest for a TPM2_PolicyCounterTimer assertion.
+func (a *DigestAccumulator) PolicyCounterTimer(operandB tpm2.Operand, offset uint16, operation tpm2.ArithmeticOp) error {
+	return a.session.PolicyCounterTimer(operandB, offset, operation)
+}
+
+// PolicyCpHash updates the digest for a TPM2_PolicyCpHash assertion with the supplied
+// command parameters.
+func (a *DigestAccumulator) PolicyCpHash(code tpm2.CommandCode, handles []Named, params ...interface{}) error {
+	cpHashA, err := ComputeCpHash(a.digest.HashAlg, code, handles, params...)
+	if err != nil {
+		return fmt.Errorf("cannot compute cpHashA: %w", err)
+	}
+	return a.session.PolicyCpHash(cpHashA)
+}
+
+// PolicyNameHash updates the digest for a TPM2_PolicyNameHash assertion with the supplied
+// command handles.
+func (a *DigestAccumulator) PolicyNameHash(handles ...Named) error {
+	nameHash, err := ComputeNameHash(a.digest.HashAlg, handles...)
+	if err != nil {
+		return fmt.Errorf("cannot compute nameHash: %w", err)
+	}
+	return a.session.PolicyNameHash(nameHash)
+}
+
+// PolicyPCR updates the digest for a TPM2_PolicyPCR assertion with the supplied PCR values.
+func (a *DigestAccumulator) PolicyPCR(values tpm2.PCRValues) error {
+	pcrs, pcrDigest, err := ComputePCRDigestFromAllValues(a.digest.HashAlg, values)
+	if err != nil {
+		return fmt.Errorf("cannot compute PCR digest: %w", err)
+	}
+	return a.session.PolicyPCR(pcrDigest, pcrs)
+}
+
+// PolicyDuplicationSelect updates the digest for a TPM2_PolicyDuplicationSelect assertion.
+func (a *DigestAccumulator) PolicyDuplicationSelect(object, newParent Named, includeObject bool) error {
+	var objectName tpm2.Name
+	if object != nil {
+		objectName = object.Name()
+	}
+	var newParentName tpm2.Name
+	if newParent != nil {
+		newParentName = newParent.Name()
+	}
+	return a.session.PolicyDuplicationSelect(objectName, newParentName, includeObject)
+}
+
+// PolicyPassword updates the digest for a TPM2_PolicyPassword assertion.
+func (a *DigestAccumulator) PolicyPassword() error {
+	return a.session.PolicyPassword()
+}
+
+// PolicyNvWritten updates the digest for a TPM2_PolicyNvWritten assertion.
+func (a *DigestAccumulator) PolicyNvWritten(writtenSet bool) error {
+	return a.session.PolicyNvWritten(writtenSet)
+}
+
+// PolicyTemplate updates the digest for a TPM2_PolicyTemplate assertion with the supplied
+// object template.
+func (a *DigestAccumulator) PolicyTemplate(template *tpm2.Public) error {
+	templateHash, err := ComputeTemplateHash(a.digest.HashAlg, template)
+	if err != nil {
+		return fmt.Errorf("cannot compute templateHash: %w", err)
+	}
+	return a.session.PolicyTemplate(templateHash)
+}
+
+// PolicyOR updates the digest for a set of branches with the supplied digests, in the
+// same way as a branch node created with [PolicyBuilderBranch.AddBranchNode]. The
+// digests must have been computed for the same algorithm as this accumulator, and are
+// normally obtained from accumulators returned from [DigestAccumulator.Branch]. If there
+// are more than 8 digests, the digest is updated for the tree of TPM2_PolicyOR assertions
+// that [Policy.Execute] uses to select one of them.
+func (a *DigestAccumulator) PolicyOR(digests ...tpm2.Digest) error {
+	for i, digest := range digests {
+		if len(digest) != a.digest.HashAlg.Size() {
+			return fmt.Errorf("invalid digest length at branch %d", i)
+		}
+	}
+
+	tree, err := newPolicyOrTree(a.digest.HashAlg, digests)
+	if err != nil {
+		return fmt.Errorf("cannot compute PolicyOR tree: %w", err)
+	}
+	for _, pHashList := range tree.selectBranch(0) {
+		if err := a.session.PolicyOR(pHashList); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Digest returns the current policy digest.
+func (a *DigestAccumulator) Digest() tpm2.Digest {
+	return append(tpm2.Digest(nil), a.digest.Digest...)
+}
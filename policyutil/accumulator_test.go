@@ -0,0 +1,250 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package policyutil_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"fmt"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/go-tpm2"
+	internal_testutil "github.com/canonical/go-tpm2/internal/testutil"
+	"github.com/canonical/go-tpm2/objectutil"
+	. "github.com/canonical/go-tpm2/policyutil"
+)
+
+type accumulatorSuiteNoTPM struct{}
+
+var _ = Suite(&accumulatorSuiteNoTPM{})
+
+func (s *accumulatorSuiteNoTPM) newECCPublicKey(c *C) *tpm2.Public {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+	pub, err := objectutil.NewECCPublicKey(&key.PublicKey)
+	c.Assert(err, IsNil)
+	return pub
+}
+
+func (s *accumulatorSuiteNoTPM) checkDigest(c *C, builder *PolicyBuilder, acc *DigestAccumulator) {
+	policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+	expected, err := policy.Compute(tpm2.HashAlgorithmSHA256)
+	c.Assert(err, IsNil)
+	validated, err := policy.Validate(tpm2.HashAlgorithmSHA256)
+	c.Assert(err, IsNil)
+	c.Check(validated, DeepEquals, expected)
+	c.Check(acc.Digest(), DeepEquals, expected)
+}
+
+func (s *accumulatorSuiteNoTPM) TestEmpty(c *C) {
+	acc, err := NewDigestAccumulator(tpm2.HashAlgorithmSHA256)
+	c.Assert(err, IsNil)
+	c.Check(acc.Digest(), DeepEquals, make(tpm2.Digest, 32))
+}
+
+func (s *accumulatorSuiteNoTPM) TestUnavailableAlgorithm(c *C) {
+	_, err := NewDigestAccumulator(tpm2.HashAlgorithmNull)
+	c.Check(err, ErrorMatches, `unavailable algorithm`)
+}
+
+func (s *accumulatorSuiteNoTPM) TestAssertions(c *C) {
+	nvPub := &tpm2.NVPublic{
+		Index:   0x0181f000,
+		NameAlg: tpm2.HashAlgorithmSHA256,
+		Attrs:   tpm2.NVTypeOrdinary.WithAttrs(tpm2.AttrNVAuthWrite | tpm2.AttrNVAuthRead | tpm2.AttrNVWritten),
+		Size:    8}
+	pcrValues := tpm2.PCRValues{tpm2.HashAlgorithmSHA256: {
+		7:  internal_testutil.DecodeHexString(c, "3d458cfe55cc03ea1f443f1562beec8df51c75e14a9fcf9a7234a13f198e7969"),
+		23: make(tpm2.Digest, 32)}}
+	authKey := s.newECCPublicKey(c)
+	handles := []Named{tpm2.MakeHandleName(tpm2.HandleOwner)}
+
+	builder := NewPolicyBuilder()
+	c.Check(builder.RootBranch().PolicyNvWritten(true), IsNil)
+	c.Check(builder.RootBranch().PolicyNV(nvPub, []byte{0, 1}, 2, tpm2.OpUnsignedLT), IsNil)
+	c.Check(builder.RootBranch().PolicySecret(tpm2.MakeHandleName(tpm2.HandleOwner), []byte("foo")), IsNil)
+	c.Check(builder.RootBranch().PolicySigned(authKey, []byte("bar")), IsNil)
+	c.Check(builder.RootBranch().PolicyAuthValue(), IsNil)
+	c.Check(builder.RootBranch().PolicyCounterTimer([]byte{0, 0, 0, 1}, 8, tpm2.OpUnsignedGE), IsNil)
+	c.Check(builder.RootBranch().PolicyPCR(pcrValues), IsNil)
+	c.Check(builder.RootBranch().PolicyCpHash(tpm2.CommandHierarchyChangeAuth, handles, tpm2.Auth("foo")), IsNil)
+	c.Check(builder.RootBranch().PolicyPassword(), IsNil)
+	c.Check(builder.RootBranch().PolicyCommandCode(tpm2.CommandHierarchyChangeAuth), IsNil)
+
+	acc, err := NewDigestAccumulator(tpm2.HashAlgorithmSHA256)
+	c.Assert(err, IsNil)
+	c.Check(acc.PolicyNvWritten(true), IsNil)
+	c.Check(acc.PolicyNV(nvPub, []byte{0, 1}, 2, tpm2.OpUnsignedLT), IsNil)
+	c.Check(acc.PolicySecret(tpm2.MakeHandleName(tpm2.HandleOwner), []byte("foo")), IsNil)
+	c.Check(acc.PolicySigned(authKey, []byte("bar")), IsNil)
+	c.Check(acc.PolicyAuthValue(), IsNil)
+	c.Check(acc.PolicyCounterTimer([]byte{0, 0, 0, 1}, 8, tpm2.OpUnsignedGE), IsNil)
+	c.Check(acc.PolicyPCR(pcrValues), IsNil)
+	c.Check(acc.PolicyCpHash(tpm2.CommandHierarchyChangeAuth, handles, tpm2.Auth("foo")), IsNil)
+	c.Check(acc.PolicyPassword(), IsNil)
+	c.Check(acc.PolicyCommandCode(tpm2.CommandHierarchyChangeAuth), IsNil)
+
+	s.checkDigest(c, builder, acc)
+}
+
+func (s *accumulatorSuiteNoTPM) TestTemplate(c *C) {
+	template := objectutil.NewRSAKeyTemplate(objectutil.UsageSign)
+	templateHash, err := ComputeTemplateHash(tpm2.HashAlgorithmSHA256, template)
+	c.Assert(err, IsNil)
+
+	builder := NewPolicyBuilder()
+	c.Check(builder.RootBranch().PolicyTemplate(templateHash), IsNil)
+	c.Check(builder.RootBranch().PolicyAuthValue(), IsNil)
+
+	acc, err := NewDigestAccumulator(tpm2.HashAlgorithmSHA256)
+	c.Assert(err, IsNil)
+	c.Check(acc.PolicyTemplate(template), IsNil)
+	c.Check(acc.PolicyAuthValue(), IsNil)
+
+	s.checkDigest(c, builder, acc)
+}
+
+func (s *accumulatorSuiteNoTPM) TestAuthorizeNV(c *C) {
+	nvPub := &tpm2.NVPublic{
+		Index:   0x0181f000,
+		NameAlg: tpm2.HashAlgorithmSHA256,
+		Attrs:   tpm2.NVTypeOrdinary.WithAttrs(tpm2.AttrNVAuthRead | tpm2.AttrNVAuthWrite | tpm2.AttrNVWritten),
+		Size:    34}
+
+	builder := NewPolicyBuilder()
+	c.Check(builder.RootBranch().PolicyAuthValue(), IsNil)
+	c.Check(builder.RootBranch().PolicyAuthorizeNV(nvPub), IsNil)
+	c.Check(builder.RootBranch().PolicyCommandCode(tpm2.CommandUnseal), IsNil)
+
+	acc, err := NewDigestAccumulator(tpm2.HashAlgorithmSHA256)
+	c.Assert(err, IsNil)
+	c.Check(acc.PolicyAuthValue(), IsNil)
+	c.Check(acc.PolicyAuthorizeNV(nvPub), IsNil)
+	c.Check(acc.PolicyCommandCode(tpm2.CommandUnseal), IsNil)
+
+	s.checkDigest(c, builder, acc)
+}
+
+func (s *accumulatorSuiteNoTPM) TestAuthorize(c *C) {
+	keySign := s.newECCPublicKey(c)
+
+	builder := NewPolicyBuilder()
+	c.Check(builder.RootBranch().PolicyAuthorize([]byte("foo"), keySign), IsNil)
+
+	acc, err := NewDigestAccumulator(tpm2.HashAlgorithmSHA256)
+	c.Assert(err, IsNil)
+	c.Check(acc.PolicyAuthorize([]byte("foo"), keySign), IsNil)
+
+	s.checkDigest(c, builder, acc)
+}
+
+func (s *accumulatorSuiteNoTPM) TestNameHashAndDuplicationSelect(c *C) {
+	object := tpm2.Name(internal_testutil.DecodeHexString(c, "000bdb0ea4e49b8f77d6dad4d4b7fa4f0ee93c3c1e24ce3b7ac66d9b2a2d0fa3c4c5"))
+	newParent := tpm2.Name(internal_testutil.DecodeHexString(c, "000b4be77f8ee1b42b0ddbcfbcd4f4a4a6bde38ae8e8f5e3b2e8e0a7a2a85aeca0bf"))
+
+	builder := NewPolicyBuilder()
+	node := builder.RootBranch().AddBranchNode()
+	c.Check(node.AddBranch("").PolicyNameHash(object, newParent), IsNil)
+	c.Check(node.AddBranch("").PolicyDuplicationSelect(object, newParent, true), IsNil)
+
+	acc, err := NewDigestAccumulator(tpm2.HashAlgorithmSHA256)
+	c.Assert(err, IsNil)
+	b1 := acc.Branch()
+	c.Check(b1.PolicyNameHash(object, newParent), IsNil)
+	b2 := acc.Branch()
+	c.Check(b2.PolicyDuplicationSelect(object, newParent, true), IsNil)
+	c.Check(acc.PolicyOR(b1.Digest(), b2.Digest()), IsNil)
+
+	s.checkDigest(c, builder, acc)
+}
+
+func (s *accumulatorSuiteNoTPM) TestBranches(c *C) {
+	builder := NewPolicyBuilder()
+	c.Check(builder.RootBranch().PolicyNvWritten(true), IsNil)
+	node := builder.RootBranch().AddBranchNode()
+	c.Check(node.AddBranch("").PolicyAuthValue(), IsNil)
+	c.Check(node.AddBranch("").PolicySecret(tpm2.MakeHandleName(tpm2.HandleOwner), []byte("foo")), IsNil)
+	c.Check(builder.RootBranch().PolicyCommandCode(tpm2.CommandNVChangeAuth), IsNil)
+
+	acc, err := NewDigestAccumulator(tpm2.HashAlgorithmSHA256)
+	c.Assert(err, IsNil)
+	c.Check(acc.PolicyNvWritten(true), IsNil)
+
+	b1 := acc.Branch()
+	c.Check(b1.PolicyAuthValue(), IsNil)
+	b2 := acc.Branch()
+	c.Check(b2.PolicySecret(tpm2.MakeHandleName(tpm2.HandleOwner), []byte("foo")), IsNil)
+
+	c.Check(acc.PolicyOR(b1.Digest(), b2.Digest()), IsNil)
+	c.Check(acc.PolicyCommandCode(tpm2.CommandNVChangeAuth), IsNil)
+
+	s.checkDigest(c, builder, acc)
+}
+
+func (s *accumulatorSuiteNoTPM) TestManyBranches(c *C) {
+	builder := NewPolicyBuilder()
+	node := builder.RootBranch().AddBranchNode()
+
+	acc, err := NewDigestAccumulator(tpm2.HashAlgorithmSHA256)
+	c.Assert(err, IsNil)
+	var digests tpm2.DigestList
+
+	for i := 0; i < 20; i++ {
+		ref := []byte(fmt.Sprintf("%d", i))
+		c.Check(node.AddBranch("").PolicySecret(tpm2.MakeHandleName(tpm2.HandleOwner), ref), IsNil)
+
+		branch := acc.Branch()
+		c.Check(branch.PolicySecret(tpm2.MakeHandleName(tpm2.HandleOwner), ref), IsNil)
+		digests = append(digests, branch.Digest())
+	}
+	c.Check(acc.PolicyOR(digests...), IsNil)
+
+	s.checkDigest(c, builder, acc)
+}
+
+func (s *accumulatorSuiteNoTPM) TestSingleBranch(c *C) {
+	builder := NewPolicyBuilder()
+	c.Check(builder.RootBranch().AddBranchNode().AddBranch("").PolicyAuthValue(), IsNil)
+
+	acc, err := NewDigestAccumulator(tpm2.HashAlgorithmSHA256)
+	c.Assert(err, IsNil)
+	branch := acc.Branch()
+	c.Check(branch.PolicyAuthValue(), IsNil)
+	c.Check(acc.PolicyOR(branch.Digest()), IsNil)
+
+	s.checkDigest(c, builder, acc)
+}
+
+func (s *accumulatorSuiteNoTPM) TestBranchDoesNotModifyParent(c *C) {
+	acc, err := NewDigestAccumulator(tpm2.HashAlgorithmSHA256)
+	c.Assert(err, IsNil)
+	c.Check(acc.PolicyAuthValue(), IsNil)
+	expected := acc.Digest()
+
+	branch := acc.Branch()
+	c.Check(branch.Digest(), DeepEquals, expected)
+	c.Check(branch.PolicyCommandCode(tpm2.CommandUnseal), IsNil)
+	c.Check(acc.Digest(), DeepEquals, expected)
+}
+
+func (s *accumulatorSuiteNoTPM) TestPolicyORInvalidDigest(c *C) {
+	acc, err := NewDigestAccumulator(tpm2.HashAlgorithmSHA256)
+	c.Assert(err, IsNil)
+	c.Check(acc.PolicyOR(make(tpm2.Digest, 32), make(tpm2.Digest, 20)), ErrorMatches, `invalid digest length at branch 1`)
+}
+
+func (s *accumulatorSuiteNoTPM) TestNilArguments(c *C) {
+	acc, err := NewDigestAccumulator(tpm2.HashAlgorithmSHA256)
+	c.Assert(err, IsNil)
+	c.Check(acc.PolicyNV(nil, nil, 0, tpm2.OpEq), ErrorMatches, `no nvIndex`)
+	c.Check(acc.PolicyAuthorizeNV(nil), ErrorMatches, `no nvIndex`)
+	c.Check(acc.PolicySecret(nil, nil), ErrorMatches, `no authObject`)
+	c.Check(acc.PolicySigned(nil, nil), ErrorMatches, `no authKey`)
+	c.Check(acc.PolicyAuthorize(nil, nil), ErrorMatches, `no keySign`)
+	c.Check(acc.Digest(), DeepEquals, make(tpm2.Digest, 32))
+}
@@ -156,6 +156,95 @@ func (a *PolicySignedAuthorization) Verify() (ok bool, err error) {
 	return a.Authorization.Verify(msg)
 }
 
+// VerifyAuthorizations verifies the signatures of each of the supplied signed
+// authorizations, so that a set of authorizations can be checked before they are
+// used to execute a policy. The result contains an entry for every supplied
+// authorization, which is nil if the authorization has a valid signature or an
+// error describing why verification failed otherwise.
+func VerifyAuthorizations(auths ...*PolicySignedAuthorization) map[*PolicySignedAuthorization]error {
+	results := make(map[*PolicySignedAuthorization]error)
+	for _, auth := range auths {
+		if auth == nil {
+			results[auth] = errors.New("no authorization")
+			continue
+		}
+		ok, err := auth.Verify()
+		switch {
+		case err != nil:
+			results[auth] = fmt.Errorf("cannot verify signature: %w", err)
+		case !ok:
+			results[auth] = errors.New("invalid signature")
+		default:
+			results[auth] = nil
+		}
+	}
+	return results
+}
+
+// ComputePolicySignedDigest computes the digest that must be signed in order to create a
+// signed authorization for a TPM2_PolicySigned assertion, using the specified digest
+// algorithm. This is the digest of nonceTPM || expiration || cpHashA || policyRef. It is
+// intended for callers that need to sign the authorization with a key that is not available
+// as a [crypto.Signer], such as a key stored in a HSM. The resulting signature must be
+// created with the same digest algorithm. See [SignPolicySignedAuthorization] for a
+// description of the other arguments.
+func ComputePolicySignedDigest(alg tpm2.HashAlgorithmId, nonceTPM tpm2.Nonce, expiration int32, cpHashA tpm2.Digest, policyRef tpm2.Nonce) ([]byte, error) {
+	if !alg.Available() {
+		return nil, errors.New("algorithm is not available")
+	}
+
+	h := alg.NewHash()
+	mu.MustMarshalToWriter(h, mu.Raw(nonceTPM), expiration, mu.Raw(cpHashA), mu.Raw(policyRef))
+	return h.Sum(nil), nil
+}
+
+// PendingSignedAuthorization begins the creation of a signed authorization for a
+// TPM2_PolicySigned assertion that is bound to the supplied session, for callers that
+// need to sign the authorization with a key that is not available as a [crypto.Signer],
+// such as a key stored in a HSM.
+//
+// It returns the digest that must be signed, which is computed with the sessionAlg
+// argument from the current TPM nonce of the session and the other arguments, as
+// described in [ComputePolicySignedDigest]. The resulting signature must be created
+// with the same digest algorithm. The sessionAlg argument is also used to compute the
+// digest of cpHashA if it is supplied. See [NewPolicySignedAuthorization] for a
+// description of the other arguments.
+//
+// Once the digest has been signed, the returned finalize function assembles the
+// authorization from the signature and the public key of the signer. The resulting
+// authorization is only valid whilst the session's TPM nonce is unchanged, which means
+// it must be used before any other command is executed with the session.
+func PendingSignedAuthorization(session tpm2.SessionContext, sessionAlg tpm2.HashAlgorithmId, cpHashA CpHash, policyRef tpm2.Nonce, expiration int32) (digestToSign []byte, finalize func(sig *tpm2.Signature, pub *tpm2.Public) *PolicySignedAuthorization, err error) {
+	if session == nil {
+		return nil, nil, errors.New("no session")
+	}
+
+	auth, err := NewPolicySignedAuthorization(sessionAlg, session.NonceTPM(), cpHashA, expiration)
+	if err != nil {
+		return nil, nil, err
+	}
+	auth.NonceTPM = append(tpm2.Nonce(nil), auth.NonceTPM...)
+
+	digestToSign, err = ComputePolicySignedDigest(sessionAlg, auth.NonceTPM, auth.Expiration, auth.CpHash, policyRef)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	finalize = func(sig *tpm2.Signature, pub *tpm2.Public) *PolicySignedAuthorization {
+		return &PolicySignedAuthorization{
+			NonceTPM:   auth.NonceTPM,
+			CpHash:     auth.CpHash,
+			Expiration: auth.Expiration,
+			Authorization: &PolicyAuthorization{
+				AuthKey:   pub,
+				PolicyRef: policyRef,
+				Signature: sig,
+			},
+		}
+	}
+	return digestToSign, finalize, nil
+}
+
 // SignPolicySignedAuthorization creates a signed authorization that can be used in a TPM2_PolicySigned
 // assertion by using the [tpm2.TPMContext.PolicySigned] function. Note that only RSA-SSA, RSA-PSS,
 // ECDSA and HMAC signatures can be created. The signer must be the owner of the key associated
@@ -13,11 +13,13 @@ import (
 	_ "crypto/sha1"
 	_ "crypto/sha256"
 	"io"
+	"math/big"
 
 	. "gopkg.in/check.v1"
 
 	"github.com/canonical/go-tpm2"
 	internal_testutil "github.com/canonical/go-tpm2/internal/testutil"
+	"github.com/canonical/go-tpm2/mu"
 	"github.com/canonical/go-tpm2/objectutil"
 	. "github.com/canonical/go-tpm2/policyutil"
 	"github.com/canonical/go-tpm2/testutil"
@@ -29,6 +31,10 @@ type authSuite struct {
 
 var _ = Suite(&authSuite{})
 
+type authSuiteNoTPM struct{}
+
+var _ = Suite(&authSuiteNoTPM{})
+
 type testPolicySignedAuthorizationData struct {
 	authKey         *tpm2.Public
 	policyRef       tpm2.Nonce
@@ -411,3 +417,246 @@ func (s *authSuite) TestSignPolicySignedAuthorizationWithAllRestrictions(c *C) {
 		expectedHash:    tpm2.HashAlgorithmSHA256,
 		authKey:         authKey})
 }
+
+type testComputePolicySignedDigestData struct {
+	alg        tpm2.HashAlgorithmId
+	nonceTPM   tpm2.Nonce
+	expiration int32
+	cpHashA    tpm2.Digest
+	policyRef  tpm2.Nonce
+
+	expected []byte
+}
+
+func (s *authSuiteNoTPM) testComputePolicySignedDigest(c *C, data *testComputePolicySignedDigestData) {
+	digest, err := ComputePolicySignedDigest(data.alg, data.nonceTPM, data.expiration, data.cpHashA, data.policyRef)
+	c.Check(err, IsNil)
+	c.Check(digest, DeepEquals, data.expected)
+}
+
+func (s *authSuiteNoTPM) TestComputePolicySignedDigest(c *C) {
+	s.testComputePolicySignedDigest(c, &testComputePolicySignedDigestData{
+		alg:      tpm2.HashAlgorithmSHA256,
+		expected: internal_testutil.DecodeHexString(c, "df3f619804a92fdb4057192dc43dd748ea778adc52bc498ce80524c014b81119")})
+}
+
+func (s *authSuiteNoTPM) TestComputePolicySignedDigestWithAllRestrictions(c *C) {
+	h := crypto.SHA256.New()
+	io.WriteString(h, "params")
+	cpHashA := h.Sum(nil)
+
+	nonceTPM := internal_testutil.DecodeHexString(c, "4d8a7ac6b8e3b1f6e9e8b4e4bcb7d6b1ab0fb30c3f0d2b5bcb8b4b7e4bf1d7c3")
+
+	h = crypto.SHA256.New()
+	h.Write(nonceTPM)
+	h.Write([]byte{0xff, 0xff, 0xff, 0x9c})
+	h.Write(cpHashA)
+	io.WriteString(h, "policy")
+
+	s.testComputePolicySignedDigest(c, &testComputePolicySignedDigestData{
+		alg:        tpm2.HashAlgorithmSHA256,
+		nonceTPM:   nonceTPM,
+		expiration: -100,
+		cpHashA:    cpHashA,
+		policyRef:  []byte("policy"),
+		expected:   h.Sum(nil)})
+}
+
+func (s *authSuiteNoTPM) TestComputePolicySignedDigestSHA1(c *C) {
+	h := crypto.SHA1.New()
+	h.Write([]byte{0x00, 0x00, 0x00, 0x64})
+	io.WriteString(h, "foo")
+
+	s.testComputePolicySignedDigest(c, &testComputePolicySignedDigestData{
+		alg:        tpm2.HashAlgorithmSHA1,
+		expiration: 100,
+		policyRef:  []byte("foo"),
+		expected:   h.Sum(nil)})
+}
+
+func (s *authSuiteNoTPM) TestComputePolicySignedDigestInvalidAlg(c *C) {
+	_, err := ComputePolicySignedDigest(tpm2.HashAlgorithmNull, nil, 0, nil, nil)
+	c.Check(err, ErrorMatches, `algorithm is not available`)
+}
+
+func (s *authSuiteNoTPM) TestComputePolicySignedDigestMatchesSignPolicySignedAuthorization(c *C) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+
+	policyRef := []byte("policy")
+	auth, err := SignPolicySignedAuthorization(rand.Reader, key, nil, nil, policyRef, -100, tpm2.HashAlgorithmSHA256)
+	c.Assert(err, IsNil)
+
+	digest, err := ComputePolicySignedDigest(tpm2.HashAlgorithmSHA256, nil, -100, nil, policyRef)
+	c.Assert(err, IsNil)
+
+	c.Check(ecdsa.Verify(&key.PublicKey, digest,
+		new(big.Int).SetBytes(auth.Signature.ECDSA.SignatureR),
+		new(big.Int).SetBytes(auth.Signature.ECDSA.SignatureS)), internal_testutil.IsTrue)
+}
+
+func (s *authSuite) TestComputePolicySignedDigestWithExternalSigner(c *C) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+
+	authKey, err := objectutil.NewECCPublicKey(&key.PublicKey)
+	c.Assert(err, IsNil)
+
+	session := s.StartAuthSession(c, nil, nil, tpm2.SessionTypePolicy, nil, tpm2.HashAlgorithmSHA256)
+
+	policyRef := []byte("policy")
+	digest, err := ComputePolicySignedDigest(tpm2.HashAlgorithmSHA256, session.NonceTPM(), -100, nil, policyRef)
+	c.Assert(err, IsNil)
+
+	// Sign the digest directly, as would be done by a signer that isn't a crypto.Signer.
+	r, sigS, err := ecdsa.Sign(rand.Reader, key, digest)
+	c.Assert(err, IsNil)
+	auth := &tpm2.Signature{
+		SigAlg: tpm2.SigSchemeAlgECDSA,
+		Signature: &tpm2.SignatureU{
+			ECDSA: &tpm2.SignatureECC{
+				Hash:       tpm2.HashAlgorithmSHA256,
+				SignatureR: r.Bytes(),
+				SignatureS: sigS.Bytes()}}}
+
+	key2, err := s.TPM.LoadExternal(nil, authKey, tpm2.HandleOwner)
+	c.Assert(err, IsNil)
+
+	_, _, err = s.TPM.PolicySigned(key2, session, true, nil, policyRef, -100, auth)
+	c.Check(err, IsNil)
+}
+
+func (s *authSuiteNoTPM) TestPendingSignedAuthorizationNoSession(c *C) {
+	_, _, err := PendingSignedAuthorization(nil, tpm2.HashAlgorithmSHA256, nil, nil, 0)
+	c.Check(err, ErrorMatches, `no session`)
+}
+
+func (s *authSuite) testPendingSignedAuthorization(c *C, cpHashA CpHash, expiration int32) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+
+	authKey, err := objectutil.NewECCPublicKey(&key.PublicKey)
+	c.Assert(err, IsNil)
+
+	policyRef := tpm2.Nonce("policy")
+
+	builder := NewPolicyBuilder()
+	c.Check(builder.RootBranch().PolicySigned(authKey, policyRef), IsNil)
+	policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+	expectedDigest, err := policy.Compute(tpm2.HashAlgorithmSHA256)
+	c.Check(err, IsNil)
+
+	session := s.StartAuthSession(c, nil, nil, tpm2.SessionTypePolicy, nil, tpm2.HashAlgorithmSHA256)
+
+	digest, finalize, err := PendingSignedAuthorization(session, tpm2.HashAlgorithmSHA256, cpHashA, policyRef, expiration)
+	c.Assert(err, IsNil)
+
+	// Sign the digest directly, as would be done by a HSM.
+	r, sigS, err := ecdsa.Sign(rand.Reader, key, digest)
+	c.Assert(err, IsNil)
+	sig := &tpm2.Signature{
+		SigAlg: tpm2.SigSchemeAlgECDSA,
+		Signature: &tpm2.SignatureU{
+			ECDSA: &tpm2.SignatureECC{
+				Hash:       tpm2.HashAlgorithmSHA256,
+				SignatureR: r.Bytes(),
+				SignatureS: sigS.Bytes()}}}
+
+	auth := finalize(sig, authKey)
+	c.Check(auth.NonceTPM, DeepEquals, session.NonceTPM())
+	c.Check(auth.Expiration, Equals, expiration)
+	c.Check(auth.Authorization.AuthKey, DeepEquals, authKey)
+	c.Check(auth.Authorization.PolicyRef, DeepEquals, policyRef)
+	ok, err := auth.Verify()
+	c.Check(err, IsNil)
+	c.Check(ok, internal_testutil.IsTrue)
+
+	authorizer := &mockAuthorizer{
+		signAuthorization: func(sessionNonce tpm2.Nonce, authKeyName tpm2.Name, ref tpm2.Nonce) (*PolicySignedAuthorization, error) {
+			c.Check(authKeyName, DeepEquals, authKey.Name())
+			c.Check(ref, DeepEquals, policyRef)
+			return auth, nil
+		},
+	}
+
+	_, err = policy.Execute(NewTPMConnection(s.TPM), session, NewTPMPolicyResourceLoader(s.TPM, nil, authorizer), nil)
+	c.Check(err, IsNil)
+
+	digest, err = s.TPM.PolicyGetDigest(session)
+	c.Check(err, IsNil)
+	c.Check(digest, DeepEquals, expectedDigest)
+}
+
+func (s *authSuite) TestPendingSignedAuthorization(c *C) {
+	s.testPendingSignedAuthorization(c, nil, 0)
+}
+
+func (s *authSuite) TestPendingSignedAuthorizationWithCpHashAndTicket(c *C) {
+	s.testPendingSignedAuthorization(c, CommandParameters(tpm2.CommandLoad, []Named{tpm2.Name{0x40, 0x00, 0x00, 0x01}}, tpm2.Private{1, 2, 3, 4}, mu.Sized(objectutil.NewRSAStorageKeyTemplate())), -100)
+}
+
+func (s *authSuiteNoTPM) newSignedAuthorization(c *C, key *ecdsa.PrivateKey, expiration int32) *PolicySignedAuthorization {
+	authKey, err := objectutil.NewECCPublicKey(&key.PublicKey)
+	c.Assert(err, IsNil)
+
+	auth, err := NewPolicySignedAuthorization(tpm2.HashAlgorithmSHA256, nil, nil, expiration)
+	c.Assert(err, IsNil)
+	c.Assert(auth.Sign(rand.Reader, authKey, []byte("foo"), key, tpm2.HashAlgorithmSHA256), IsNil)
+	return auth
+}
+
+func (s *authSuiteNoTPM) TestVerifyAuthorizationsAllValid(c *C) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+
+	auth1 := s.newSignedAuthorization(c, key, 0)
+	auth2 := s.newSignedAuthorization(c, key, -100)
+
+	results := VerifyAuthorizations(auth1, auth2)
+	c.Check(results, DeepEquals, map[*PolicySignedAuthorization]error{auth1: nil, auth2: nil})
+}
+
+func (s *authSuiteNoTPM) TestVerifyAuthorizationsMixed(c *C) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+
+	valid := s.newSignedAuthorization(c, key, 0)
+
+	// Modify the authorization after signing it.
+	tampered := s.newSignedAuthorization(c, key, 0)
+	tampered.Expiration = 100
+
+	// Sign the authorization with a different key to the one it claims to be signed by.
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+	wrongKey := s.newSignedAuthorization(c, otherKey, 0)
+	wrongKey.Authorization.AuthKey = valid.Authorization.AuthKey
+
+	unsigned, err := NewPolicySignedAuthorization(tpm2.HashAlgorithmSHA256, nil, nil, 0)
+	c.Assert(err, IsNil)
+
+	results := VerifyAuthorizations(valid, tampered, wrongKey, unsigned, nil)
+	c.Assert(results, internal_testutil.LenEquals, 5)
+	c.Check(results[valid], IsNil)
+	c.Check(results[tampered], ErrorMatches, `invalid signature`)
+	c.Check(results[wrongKey], ErrorMatches, `invalid signature`)
+	c.Check(results[unsigned], ErrorMatches, `cannot verify signature: authorization is not signed`)
+	c.Check(results[nil], ErrorMatches, `no authorization`)
+}
+
+func (s *authSuiteNoTPM) TestVerifyAuthorizationsInvalidSignatureAlgorithm(c *C) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+
+	auth := s.newSignedAuthorization(c, key, 0)
+	auth.Authorization.Signature.SigAlg = tpm2.SigSchemeAlgNull
+
+	results := VerifyAuthorizations(auth)
+	c.Check(results, internal_testutil.LenEquals, 1)
+	c.Check(results[auth], ErrorMatches, `cannot verify signature: invalid signature algorithm`)
+}
+
+func (s *authSuiteNoTPM) TestVerifyAuthorizationsNone(c *C) {
+	c.Check(VerifyAuthorizations(), internal_testutil.LenEquals, 0)
+}
@@ -7,6 +7,7 @@ package policyutil
 import (
 	"bytes"
 	"crypto"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"strings"
@@ -25,6 +26,11 @@ const (
 // This is because TPM2_PolicyOR assertions require more than one digest. This avoids
 // having a separate policy sequence when there is only a single digest, without having
 // to store duplicate digests on disk.
+//
+// This is also how a branch node with a single branch is handled - the TPM2_PolicyOR
+// assertion is not omitted, but is executed with the branch digest duplicated. This is
+// the case for computing, validating and executing a policy, so that they all agree on
+// the resulting digest.
 func ensureSufficientORDigests(digests tpm2.DigestList) tpm2.DigestList {
 	if len(digests) == 1 {
 		return tpm2.DigestList{digests[0], digests[0]}
@@ -106,6 +112,77 @@ func newPolicyOrTree(alg tpm2.HashAlgorithmId, digests tpm2.DigestList) (out *po
 	return out, nil
 }
 
+// MaxPolicyOrDigests returns the maximum number of branches supported by a single
+// branch node, which corresponds to the maximum number of digests supported by a
+// tree of TPM2_PolicyOR assertions.
+func MaxPolicyOrDigests() int {
+	return policyOrMaxDigests
+}
+
+// PolicyOrTreeDepth returns the depth of the tree of TPM2_PolicyOR assertions that
+// would be produced for a branch node with the specified number of branches. This is
+// the number of TPM2_PolicyOR assertions that are executed for any one branch. As the
+// TPM only supports 8 digests per assertion, each level of the tree multiplies the
+// number of supported branches by 8.
+//
+// An error is returned if n is not positive or exceeds the maximum number of branches
+// supported by a single branch node (see [MaxPolicyOrDigests]).
+func PolicyOrTreeDepth(n int) (depth int, err error) {
+	if n <= 0 {
+		return 0, errors.New("no digests")
+	}
+	if n > policyOrMaxDigests {
+		return 0, errors.New("too many digests")
+	}
+
+	for {
+		depth += 1
+		if n <= 8 {
+			return depth, nil
+		}
+		n = (n + 7) / 8
+	}
+}
+
+// DigestAfterPolicyOR computes the session digest that results from executing the
+// sequence of TPM2_PolicyOR assertions that selects the branch with the specified index
+// from the supplied branch digests, starting from a session with the digest of the
+// selected branch. The branch digests are arranged in to a tree of TPM2_PolicyOR
+// assertions in the same way as a branch node created with
+// [PolicyBuilderBranch.AddBranchNode], so this can be used to verify the behaviour of
+// branch nodes without a TPM.
+//
+// As each TPM2_PolicyOR assertion resets the session digest before updating it, the
+// result is the same for every branch.
+func DigestAfterPolicyOR(alg tpm2.HashAlgorithmId, branchDigests tpm2.DigestList, selected int) (tpm2.Digest, error) {
+	if !alg.Available() {
+		return nil, errors.New("unavailable algorithm")
+	}
+	if selected < 0 || selected >= len(branchDigests) {
+		return nil, fmt.Errorf("selected branch %d out of range", selected)
+	}
+	for i, digest := range branchDigests {
+		if len(digest) != alg.Size() {
+			return nil, fmt.Errorf("invalid digest length at branch %d", i)
+		}
+	}
+
+	tree, err := newPolicyOrTree(alg, branchDigests)
+	if err != nil {
+		return nil, fmt.Errorf("cannot compute PolicyOR tree: %w", err)
+	}
+
+	digest := &taggedHash{HashAlg: alg, Digest: append(tpm2.Digest(nil), branchDigests[selected]...)}
+	session := newComputePolicySession(digest)
+	for _, pHashList := range tree.selectBranch(selected) {
+		if err := session.PolicyOR(pHashList); err != nil {
+			return nil, err
+		}
+	}
+
+	return digest.Digest, nil
+}
+
 func (t *policyOrTree) selectBranch(i int) (out []tpm2.DigestList) {
 	node := t.leafNodes[i>>3]
 
@@ -119,10 +196,27 @@ func (t *policyOrTree) selectBranch(i int) (out []tpm2.DigestList) {
 
 type policyBranchSelectMixin struct{}
 
-func (*policyBranchSelectMixin) selectBranch(branches policyBranches, next policyBranchPath) (int, error) {
+func (*policyBranchSelectMixin) selectBranch(alg tpm2.HashAlgorithmId, branches policyBranches, next policyBranchPath) (int, error) {
 	switch {
 	case strings.HasPrefix(string(next), "…"):
 		return 0, fmt.Errorf("cannot select branch: invalid component \"%s\"", next)
+	case strings.HasPrefix(string(next), "$digest:"):
+		// select branch by digest
+		digest, err := hex.DecodeString(strings.TrimPrefix(string(next), "$digest:"))
+		if err != nil {
+			return 0, fmt.Errorf("cannot select branch: badly formatted path component \"%s\": %w", next, err)
+		}
+		if len(digest) != alg.Size() {
+			return 0, fmt.Errorf("cannot select branch: invalid digest length for path component \"%s\"", next)
+		}
+		for i, branch := range branches {
+			for _, branchDigest := range branch.PolicyDigests {
+				if branchDigest.HashAlg == alg && bytes.Equal(branchDigest.Digest, digest) {
+					return i, nil
+				}
+			}
+		}
+		return 0, fmt.Errorf("cannot select branch: no branch with digest %x", digest)
 	case next[0] == '$':
 		// select branch by index
 		var selected int
@@ -155,25 +249,34 @@ type policyBranchSelector struct {
 	controller           policyRunnerController
 	tpm                  TPMConnection
 	subPolicyRunner      subPolicyRunner
+	nvSessions           *policySessionPool
 	usage                *PolicySessionUsage
 	ignoreAuthorizations []PolicyAuthorizationID
 	ignoreNV             []Named
+	tickets              policyTickets
+	assumeAuthFailure    bool
+	maxPaths             int
+	verifyPath           policyBranchPath // the path of an explicitly selected branch that is being verified
 
 	paths      []policyBranchPath
 	detailsMap map[policyBranchPath]PolicyBranchDetails
 	nvOk       map[paramKey]struct{}
 }
 
-func newPolicyBranchSelector(sessionAlg tpm2.HashAlgorithmId, resources PolicyResourceLoader, controller policyRunnerController, subPolicyRunner subPolicyRunner, tpm TPMConnection, usage *PolicySessionUsage, ignoreAuthorizations []PolicyAuthorizationID, ignoreNV []Named) *policyBranchSelector {
+func newPolicyBranchSelector(sessionAlg tpm2.HashAlgorithmId, resources PolicyResourceLoader, tickets policyTickets, controller policyRunnerController, subPolicyRunner subPolicyRunner, nvSessions *policySessionPool, tpm TPMConnection, usage *PolicySessionUsage, ignoreAuthorizations []PolicyAuthorizationID, ignoreNV []Named, assumeAuthFailure bool, maxPaths int) *policyBranchSelector {
 	return &policyBranchSelector{
 		sessionAlg:           sessionAlg,
 		resources:            resources,
 		controller:           controller,
 		tpm:                  tpm,
 		subPolicyRunner:      subPolicyRunner,
+		nvSessions:           nvSessions,
 		usage:                usage,
 		ignoreAuthorizations: ignoreAuthorizations,
 		ignoreNV:             ignoreNV,
+		tickets:              tickets,
+		assumeAuthFailure:    assumeAuthFailure,
+		maxPaths:             maxPaths,
 	}
 }
 
@@ -192,7 +295,7 @@ func (s *policyBranchSelector) filterMissingResourceBranches() {
 	}
 
 	for p, d := range s.detailsMap {
-		if len(d.NV) > 0 || len(d.Secret) > 0 || len(d.Signed) > 0 || len(d.Authorize) > 0 {
+		if len(d.NV) > 0 || len(d.AuthorizeNV) > 0 || len(d.Secret) > 0 || len(d.Signed) > 0 || len(d.Authorize) > 0 {
 			delete(s.detailsMap, p)
 		}
 	}
@@ -241,47 +344,46 @@ func (s *policyBranchSelector) filterIgnoredResources() {
 					break
 				}
 			}
+			for _, nv := range d.AuthorizeNV {
+				if bytes.Equal(nv.Name, ignore.Name()) {
+					delete(s.detailsMap, p)
+					break
+				}
+			}
 		}
 	}
 }
 
-func (s *policyBranchSelector) filterUsageIncompatibleBranches() error {
-	if s.usage == nil {
-		return nil
+func (s *policyBranchSelector) filterUnverifiedAuthBranches() {
+	if !s.assumeAuthFailure {
+		return
 	}
 
 	for p, d := range s.detailsMap {
-		code, set := d.CommandCode()
-		if set && code != s.usage.commandCode {
-			delete(s.detailsMap, p)
-			continue
-		}
+		var auths []PolicyAuthorizationDetails
+		auths = append(auths, d.Secret...)
+		auths = append(auths, d.Signed...)
 
-		cpHash, set := d.CpHash()
-		if set {
-			usageCpHash, err := ComputeCpHash(s.sessionAlg, s.usage.commandCode, s.usage.handles, s.usage.params...)
-			if err != nil {
-				return fmt.Errorf("cannot obtain cpHash from usage parameters: %w", err)
-			}
-			if !bytes.Equal(usageCpHash, cpHash) {
+		for _, auth := range auths {
+			if s.tickets.ticket(auth.AuthName, auth.PolicyRef) == nil {
 				delete(s.detailsMap, p)
-				continue
+				break
 			}
 		}
+	}
+}
 
-		nameHash, set := d.NameHash()
-		if set {
-			usageNameHash, err := ComputeNameHash(s.sessionAlg, s.usage.handles...)
-			if err != nil {
-				return fmt.Errorf("cannot obtain nameHash from usage parameters: %w", err)
-			}
-			if !bytes.Equal(usageNameHash, nameHash) {
-				delete(s.detailsMap, p)
-				continue
-			}
-		}
+func (s *policyBranchSelector) filterUsageIncompatibleBranches() error {
+	if s.usage == nil {
+		return nil
+	}
 
-		if d.AuthValueNeeded && s.usage.noAuthValue {
+	for p, d := range s.detailsMap {
+		ok, err := s.usage.matchesBranch(s.sessionAlg, &d)
+		if err != nil {
+			return err
+		}
+		if !ok {
 			delete(s.detailsMap, p)
 			continue
 		}
@@ -320,6 +422,9 @@ func (s *policyBranchSelector) filterPcrIncompatibleBranches() error {
 		return nil
 	}
 
+	// A single read is sufficient here - TPMContext.PCRRead already issues
+	// as many TPM2_PCR_Read commands as are required for a large selection,
+	// and checks that the PCR update counter doesn't change between them.
 	pcrValues, err := s.tpm.PCRRead(pcrs)
 	if err != nil {
 		return fmt.Errorf("cannot obtain PCR values: %w", err)
@@ -431,6 +536,9 @@ func (s *policyBranchSelector) canAuthNV(pub *tpm2.NVPublic, policy *Policy, com
 		if len(d.NV) > 0 {
 			continue
 		}
+		if len(d.AuthorizeNV) > 0 {
+			continue
+		}
 		if len(d.Secret) > 0 {
 			continue
 		}
@@ -456,6 +564,9 @@ func (s *policyBranchSelector) canAuthNV(pub *tpm2.NVPublic, policy *Policy, com
 		if _, set := d.NameHash(); set {
 			continue
 		}
+		if _, set := d.TemplateHash(); set {
+			continue
+		}
 		if len(d.PCR) > 0 {
 			continue
 		}
@@ -521,6 +632,15 @@ func (s *policyBranchSelector) filterNVIncompatibleBranches(complete taskFn) err
 				nvInfo[nv.Index] = info
 			}
 
+			if info.pub.Attrs&tpm2.AttrNVWritten == 0 {
+				// TPM2_PolicyNV fails if the index hasn't been written.
+				// This is the case for a bit field index that has never
+				// had TPM2_NV_SetBits executed on it, even though all of
+				// its bits are considered to be clear.
+				incompatible = true
+				break
+			}
+
 			if !s.canAuthNV(info.pub, info.policy, tpm2.CommandNVRead) {
 				continue
 			}
@@ -536,8 +656,13 @@ func (s *policyBranchSelector) filterNVIncompatibleBranches(complete taskFn) err
 
 			// create a task to run the policy session and read the NV index
 			task := func() error {
-				session, err := s.tpm.StartAuthSession(tpm2.SessionTypePolicy, nv.Name.Algorithm())
-				if err != nil {
+				session, err := s.nvSessions.acquire(nv.Name.Algorithm())
+				switch {
+				case err == errNoSessionAvailable:
+					// we can't check this assertion
+					s.nvSessions.recordUnchecked(&nv)
+					return nil
+				case err != nil:
 					return err
 				}
 
@@ -550,20 +675,24 @@ func (s *policyBranchSelector) filterNVIncompatibleBranches(complete taskFn) err
 					new(nullTickets),
 					new(nullPolicyResourceLoader),
 					func(runner *policyRunner) policyRunnerHelper {
-						return newExecutePolicyHelper(runner, s.tpm, params, s.subPolicyRunner, false)
+						return newExecutePolicyHelper(runner, s.tpm, params, s.subPolicyRunner, s.nvSessions, false)
 					},
 				)
 				runner.pushElements(info.policy.policy.Policy)
 				s.subPolicyRunner.pushRunner(
 					runner,
 					func(err error) error {
-						defer s.tpm.FlushContext(session)
+						defer s.nvSessions.release(session)
 						if err != nil {
 							// ignore policy execution error
 							return nil
 						}
 
-						data, err := s.tpm.NVRead(info.resource, info.resource, uint16(len(nv.OperandB)), nv.Offset, session)
+						authSession := session
+						if s.nvSessions.responseEncrypt() {
+							authSession = session.IncludeAttrs(tpm2.AttrResponseEncrypt)
+						}
+						data, err := s.tpm.NVRead(info.resource, info.resource, uint16(len(nv.OperandB)), nv.Offset, authSession)
 						if err != nil {
 							// ignore NVRead error
 							return nil
@@ -583,12 +712,19 @@ func (s *policyBranchSelector) filterNVIncompatibleBranches(complete taskFn) err
 	}
 
 	s.controller.pushTasks(func() error {
+		// All of the NV indices have been read now.
+		s.nvSessions.flush()
+
 		for p, d := range s.detailsMap {
 			for _, nv := range d.NV {
 				key := nvAssertionKey(&nv)
 				data, exists := nvData[key]
 				if !exists {
 					// we can't check this assertion
+					if s.assumeAuthFailure {
+						delete(s.detailsMap, p)
+						break
+					}
 					continue
 				}
 
@@ -669,6 +805,7 @@ func (s *policyBranchSelector) selectPath(branches policyBranches, complete func
 	// reset state
 	s.paths = nil
 	s.detailsMap = make(map[policyBranchPath]PolicyBranchDetails)
+	s.nvOk = nil
 
 	var (
 		currentPath    policyBranchPath
@@ -679,6 +816,7 @@ func (s *policyBranchSelector) selectPath(branches policyBranches, complete func
 	walker = newTreeWalker(
 		newProxyPolicySession(newNullPolicySession(s.sessionAlg), &currentDetails),
 		s,
+		s.maxPaths,
 		func() (treeWalkerBeginBranchFn, treeWalkerEndBranchFn, error) {
 			details := currentDetails
 			path := currentPath
@@ -710,6 +848,7 @@ func (s *policyBranchSelector) selectPath(branches policyBranches, complete func
 	s.filterMissingResourceBranches()
 	s.filterMissingAuthBranches()
 	s.filterIgnoredResources()
+	s.filterUnverifiedAuthBranches()
 	if err := s.filterUsageIncompatibleBranches(); err != nil {
 		return fmt.Errorf("cannot filter branches incompatible with usage: %w", err)
 	}
@@ -729,7 +868,10 @@ func (s *policyBranchSelector) selectPath(branches policyBranches, complete func
 		}
 
 		if len(candidates) == 0 {
-			return errors.New("cannot select execution path: no appropriate paths found")
+			if len(s.verifyPath) > 0 {
+				return &StateChangedError{Path: string(s.verifyPath), err: errors.New("no appropriate paths found")}
+			}
+			return &branchSelectionError{err: errors.New("cannot select execution path: no appropriate paths found")}
 		}
 
 		path := candidates[0]
@@ -774,6 +916,18 @@ func (s *policyBranchSelector) LoadAuthorizedPolicies(keySign tpm2.Name, policyR
 
 var errTreeWalkerSkipBranch = errors.New("")
 
+// DefaultMaxBranchPaths is the default maximum number of complete execution paths
+// that will be walked when enumerating the branches of a policy or when selecting a
+// branch automatically. The number of paths grows with the product of the number of
+// branches in each branch node, so this protects against a pathological policy from
+// requiring an excessive amount of work. The limit for automatic branch selection
+// can be changed with [PolicyExecuteParams.MaxBranchPaths].
+const DefaultMaxBranchPaths = 16 * policyOrMaxDigests
+
+// treeWalkerMaxPaths is the maximum number of complete paths that a tree walk will
+// visit before failing when no other limit is supplied.
+var treeWalkerMaxPaths = DefaultMaxBranchPaths
+
 type (
 	treeWalkerBeginBranchNodeFn  func() (treeWalkerBeginBranchFn, treeWalkerEndBranchFn, error)
 	treeWalkerBeginBranchFn      func(policyBranchPath) error
@@ -788,16 +942,23 @@ type treeWalkerHelper struct {
 	beginBranchNodeFn  treeWalkerBeginBranchNodeFn
 	completeFullPathFn treeWalkerCompleteFullPathFn
 
+	maxPaths int
+	numPaths int
+
 	started          bool
 	beginBranchQueue []taskFn
 }
 
-func newTreeWalkerHelper(runner *policyRunner, beginBranchNode treeWalkerBeginBranchNodeFn, completeFullPath treeWalkerCompleteFullPathFn) *treeWalkerHelper {
+func newTreeWalkerHelper(runner *policyRunner, maxPaths int, beginBranchNode treeWalkerBeginBranchNodeFn, completeFullPath treeWalkerCompleteFullPathFn) *treeWalkerHelper {
+	if maxPaths <= 0 {
+		maxPaths = treeWalkerMaxPaths
+	}
 	return &treeWalkerHelper{
 		sessionAlg:         runner.session().HashAlg(),
 		controller:         runner,
 		beginBranchNodeFn:  beginBranchNode,
 		completeFullPathFn: completeFullPath,
+		maxPaths:           maxPaths,
 	}
 }
 
@@ -880,6 +1041,10 @@ func (h *treeWalkerHelper) handleBranches(branches policyBranches, complete func
 		}
 
 		h.controller.appendTask(func() error {
+			h.numPaths++
+			if h.numPaths > h.maxPaths {
+				return fmt.Errorf("too many paths to walk (the maximum is %d)", h.maxPaths)
+			}
 			if err := h.completeFullPathFn(); err != nil {
 				return fmt.Errorf("cannot complete walk full path: %w", err)
 			}
@@ -978,14 +1143,14 @@ type treeWalker struct {
 	runner *policyRunner
 }
 
-func newTreeWalker(session policySession, resources PolicyResourceLoader, beginBranchNode treeWalkerBeginBranchNodeFn, completeFullPath treeWalkerCompleteFullPathFn) *treeWalker {
+func newTreeWalker(session policySession, resources PolicyResourceLoader, maxPaths int, beginBranchNode treeWalkerBeginBranchNodeFn, completeFullPath treeWalkerCompleteFullPathFn) *treeWalker {
 	return &treeWalker{
 		runner: newPolicyRunner(
 			session,
 			new(nullTickets),
 			resources,
 			func(runner *policyRunner) policyRunnerHelper {
-				return newTreeWalkerHelper(runner, beginBranchNode, completeFullPath)
+				return newTreeWalkerHelper(runner, maxPaths, beginBranchNode, completeFullPath)
 			},
 		),
 	}
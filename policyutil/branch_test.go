@@ -176,6 +176,58 @@ func (s *branchSuite) TestNewPolicyOrTreeTooManyDigests(c *C) {
 	c.Check(err, ErrorMatches, "too many digests")
 }
 
+func (s *branchSuite) TestPolicyOrTreeDepth(c *C) {
+	for _, data := range []struct {
+		n     int
+		depth int
+	}{
+		{n: 1, depth: 1},
+		{n: 8, depth: 1},
+		{n: 9, depth: 2},
+		{n: 64, depth: 2},
+		{n: 65, depth: 3},
+		{n: 512, depth: 3},
+		{n: 513, depth: 4},
+		{n: 4096, depth: 4},
+	} {
+		depth, err := PolicyOrTreeDepth(data.n)
+		c.Check(err, IsNil, Commentf("n: %d", data.n))
+		c.Check(depth, Equals, data.depth, Commentf("n: %d", data.n))
+	}
+}
+
+func (s *branchSuite) TestPolicyOrTreeDepthMatchesTree(c *C) {
+	for _, n := range []int{1, 8, 9, 64, 65} {
+		tree, err := NewPolicyOrTree(tpm2.HashAlgorithmSHA256, make(tpm2.DigestList, n))
+		c.Assert(err, IsNil)
+
+		depth, err := PolicyOrTreeDepth(n)
+		c.Check(err, IsNil)
+		c.Check(tree.SelectBranch(n-1), internal_testutil.LenEquals, depth, Commentf("n: %d", n))
+	}
+}
+
+func (s *branchSuite) TestPolicyOrTreeDepthTooMany(c *C) {
+	_, err := PolicyOrTreeDepth(4097)
+	c.Check(err, ErrorMatches, "too many digests")
+}
+
+func (s *branchSuite) TestMaxPolicyOrDigests(c *C) {
+	c.Check(MaxPolicyOrDigests(), Equals, 4096)
+
+	depth, err := PolicyOrTreeDepth(MaxPolicyOrDigests())
+	c.Check(err, IsNil)
+	c.Check(depth, Equals, 4)
+
+	_, err = PolicyOrTreeDepth(MaxPolicyOrDigests() + 1)
+	c.Check(err, ErrorMatches, "too many digests")
+}
+
+func (s *branchSuite) TestPolicyOrTreeDepthNone(c *C) {
+	_, err := PolicyOrTreeDepth(0)
+	c.Check(err, ErrorMatches, "no digests")
+}
+
 type testPolicyOrTreeSelectBranchData struct {
 	alg      tpm2.HashAlgorithmId
 	digests  tpm2.DigestList
@@ -240,3 +292,55 @@ func (s *branchSuite) TestPolicyOrTreeSelectBranchDepth3(c *C) {
 		digests:  digests,
 		selected: 150})
 }
+
+func (s *branchSuite) testDigestAfterPolicyOR(c *C, alg tpm2.HashAlgorithmId, n int) {
+	var digests tpm2.DigestList
+	for i := 0; i < n; i++ {
+		digests = append(digests, hash(alg.GetHash(), strconv.Itoa(i)))
+	}
+
+	acc, err := NewDigestAccumulator(alg)
+	c.Assert(err, IsNil)
+	c.Check(acc.PolicyOR(digests...), IsNil)
+
+	for _, selected := range []int{0, n / 2, n - 1} {
+		digest, err := DigestAfterPolicyOR(alg, digests, selected)
+		c.Check(err, IsNil)
+		c.Check(digest, DeepEquals, acc.Digest(), Commentf("selected: %d", selected))
+	}
+}
+
+func (s *branchSuite) TestDigestAfterPolicyORSingleDigest(c *C) {
+	s.testDigestAfterPolicyOR(c, tpm2.HashAlgorithmSHA256, 1)
+}
+
+func (s *branchSuite) TestDigestAfterPolicyORDepth1(c *C) {
+	s.testDigestAfterPolicyOR(c, tpm2.HashAlgorithmSHA256, 5)
+}
+
+func (s *branchSuite) TestDigestAfterPolicyORDepth2(c *C) {
+	s.testDigestAfterPolicyOR(c, tpm2.HashAlgorithmSHA256, 20)
+}
+
+func (s *branchSuite) TestDigestAfterPolicyORDepth3(c *C) {
+	s.testDigestAfterPolicyOR(c, tpm2.HashAlgorithmSHA256, 100)
+}
+
+func (s *branchSuite) TestDigestAfterPolicyORSHA1(c *C) {
+	s.testDigestAfterPolicyOR(c, tpm2.HashAlgorithmSHA1, 20)
+}
+
+func (s *branchSuite) TestDigestAfterPolicyOROutOfRange(c *C) {
+	_, err := DigestAfterPolicyOR(tpm2.HashAlgorithmSHA256, make(tpm2.DigestList, 3), 3)
+	c.Check(err, ErrorMatches, `selected branch 3 out of range`)
+}
+
+func (s *branchSuite) TestDigestAfterPolicyORInvalidDigest(c *C) {
+	_, err := DigestAfterPolicyOR(tpm2.HashAlgorithmSHA256, tpm2.DigestList{make(tpm2.Digest, 32), make(tpm2.Digest, 20)}, 0)
+	c.Check(err, ErrorMatches, `invalid digest length at branch 1`)
+}
+
+func (s *branchSuite) TestDigestAfterPolicyORUnavailableAlgorithm(c *C) {
+	_, err := DigestAfterPolicyOR(tpm2.HashAlgorithmNull, tpm2.DigestList{nil}, 0)
+	c.Check(err, ErrorMatches, `unavailable algorithm`)
+}
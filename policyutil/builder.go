@@ -7,12 +7,38 @@ package policyutil
 import (
 	"errors"
 	"fmt"
+	"math"
 	"sort"
+	"unicode/utf8"
 
 	"github.com/canonical/go-tpm2"
 	"github.com/canonical/go-tpm2/mu"
 )
 
+// maxOperandSize is the maximum size of a TPM2B_OPERAND, which is the size of
+// the TPMU_HA union.
+const maxOperandSize = 64
+
+// timeInfoSize is the size of the marshalled TPMS_TIME_INFO structure that
+// TPM2_PolicyCounterTimer operates on.
+var timeInfoSize = len(mu.MustMarshalToBytes(tpm2.TimeInfo{}))
+
+// validateOperandWindow checks that an operand with the specified length can be
+// compared against data with the specified length, starting at the specified
+// offset, as used by the TPM2_PolicyNV and TPM2_PolicyCounterTimer assertions.
+func validateOperandWindow(dataLen int, offset uint16, operandLen int) error {
+	switch {
+	case operandLen > maxOperandSize:
+		return errors.New("operandB is too large")
+	case int(offset) > dataLen:
+		return errors.New("offset is past the end of the data")
+	case int(offset)+operandLen > dataLen:
+		return errors.New("operandB and offset exceed the end of the data")
+	default:
+		return nil
+	}
+}
+
 type PolicyBuilderBranchNode struct {
 	parentBranch  *PolicyBuilderBranch
 	childBranches []*PolicyBuilderBranch
@@ -61,7 +87,8 @@ func (n *PolicyBuilderBranchNode) commitBranchNode() error {
 }
 
 // AddBranch adds a new branch to this branch node. The branch can be created with
-// an optional name which can be used to select it during execution.
+// an optional name which can be used to select it during execution. The name can be
+// up to 128 bytes long.
 //
 // The returned branch will be locked from further modifications when the branches associated
 // with this node are committed to the parent branch (see [PolicyBuilderBranch.AddBranchNode]).
@@ -74,6 +101,9 @@ func (n *PolicyBuilderBranchNode) AddBranch(name string) *PolicyBuilderBranch {
 	}
 
 	pbn := policyBranchName(name)
+	if len(pbn) > policyBranchNameMaxLen {
+		n.policy().fail("AddBranch", fmt.Errorf("branch name too long (the maximum is %d bytes)", policyBranchNameMaxLen))
+	}
 	if !pbn.isValid() {
 		n.policy().fail("AddBranch", errors.New("invalid branch name"))
 	}
@@ -98,6 +128,28 @@ func newPolicyBuilderBranch(policy *PolicyBuilder, name policyBranchName) *Polic
 	}
 }
 
+// SetDescription sets a human-readable description for this branch, such as "normal boot"
+// or "recovery path". The description is serialized with the policy but doesn't affect the
+// policy digest, and can be obtained from the policy with [Policy.BranchDescriptions]. It
+// must be valid UTF-8.
+func (b *PolicyBuilderBranch) SetDescription(description string) error {
+	if b.policy.failed() {
+		return b.policy.fail("SetDescription", b.policy.err)
+	}
+	if b.locked {
+		return b.policy.fail("SetDescription", errors.New("cannot modify locked branch"))
+	}
+	if !utf8.ValidString(description) {
+		return b.policy.fail("SetDescription", errors.New("invalid description"))
+	}
+
+	if b.policy.descriptions == nil {
+		b.policy.descriptions = make(map[*policyBranch]policyBranchDescription)
+	}
+	b.policy.descriptions[b.policyBranch] = policyBranchDescription(description)
+	return nil
+}
+
 func (b *PolicyBuilderBranch) commitBranches(branches []*policyBranch) error {
 	b.currentBranchNode = nil
 	if err := b.prepareToModifyBranch(); err != nil {
@@ -154,6 +206,10 @@ func (b *PolicyBuilderBranch) lockBranch() error {
 // Where this assertion appears in a policy with multiple branches or a policy that is authorized,
 // the contents of the NV index will be tested in the process of automatic branch selection if
 // the index has a policy that permits the use of TPM2_NV_Read without any other conditions.
+//
+// An error will be returned if operandB is larger than the maximum operand size, or if the
+// comparison would extend beyond the end of the NV index data, as such a policy can never
+// be satisfied.
 func (b *PolicyBuilderBranch) PolicyNV(nvIndex *tpm2.NVPublic, operandB tpm2.Operand, offset uint16, operation tpm2.ArithmeticOp) error {
 	if err := b.prepareToModifyBranch(); err != nil {
 		return b.policy.fail("PolicyNV", err)
@@ -162,6 +218,14 @@ func (b *PolicyBuilderBranch) PolicyNV(nvIndex *tpm2.NVPublic, operandB tpm2.Ope
 	if !nvIndex.Name().IsValid() {
 		return b.policy.fail("PolicyNV", errors.New("invalid nvIndex"))
 	}
+	dataLen := int(nvIndex.Size)
+	if dataLen == 0 {
+		// The size of the index is not known.
+		dataLen = math.MaxUint16
+	}
+	if err := validateOperandWindow(dataLen, offset, len(operandB)); err != nil {
+		return b.policy.fail("PolicyNV", fmt.Errorf("invalid comparison with nvIndex: %w", err))
+	}
 
 	element := &policyElement{
 		Type: tpm2.CommandPolicyNV,
@@ -176,6 +240,91 @@ func (b *PolicyBuilderBranch) PolicyNV(nvIndex *tpm2.NVPublic, operandB tpm2.Ope
 	return nil
 }
 
+// NVBitsMask returns a mask with the specified bits set, for use with
+// [PolicyBuilderBranch.PolicyNVBitsSet] and [PolicyBuilderBranch.PolicyNVBitsClear] with
+// a bit field index (tpm2.NVTypeBits). The mask is returned as an 8 byte big-endian value,
+// which is how the TPM returns the contents of a bit field index. This will panic if any
+// bit is larger than 63.
+func NVBitsMask(bits ...uint) tpm2.Operand {
+	var mask uint64
+	for _, bit := range bits {
+		if bit > 63 {
+			panic("invalid bit")
+		}
+		mask |= 1 << bit
+	}
+	return mu.MustMarshalToBytes(mask)
+}
+
+func (b *PolicyBuilderBranch) policyNVBits(name string, nvIndex *tpm2.NVPublic, mask tpm2.Operand, operation tpm2.ArithmeticOp) error {
+	if nvIndex == nil {
+		return b.policy.fail(name, errors.New("no index"))
+	}
+	if len(mask) == 0 {
+		return b.policy.fail(name, errors.New("no mask"))
+	}
+	if nvIndex.Attrs.Type() == tpm2.NVTypeBits && len(mask) < 8 {
+		// Zero extend the mask so that it is compared against the least
+		// significant bytes of the index.
+		mask = append(make(tpm2.Operand, 8-len(mask)), mask...)
+	}
+	return b.PolicyNV(nvIndex, mask, 0, operation)
+}
+
+// PolicyNVBitsSet adds a TPM2_PolicyNV assertion to this branch so that the policy requires
+// that all of the bits in the supplied mask are set in the contents of the specified index,
+// using the [tpm2.OpBitset] operation. The mask is compared with the start of the index data.
+// For a bit field index (tpm2.NVTypeBits), the mask is a big-endian value that is zero
+// extended to 8 bytes if it is shorter, and can be created with [NVBitsMask].
+//
+// See [PolicyBuilderBranch.PolicyNV] for more details about how this assertion is handled
+// during automatic branch selection.
+func (b *PolicyBuilderBranch) PolicyNVBitsSet(nvIndex *tpm2.NVPublic, mask tpm2.Operand) error {
+	return b.policyNVBits("PolicyNVBitsSet", nvIndex, mask, tpm2.OpBitset)
+}
+
+// PolicyNVBitsClear adds a TPM2_PolicyNV assertion to this branch so that the policy requires
+// that all of the bits in the supplied mask are clear in the contents of the specified index,
+// using the [tpm2.OpBitclear] operation. The mask is compared with the start of the index
+// data. For a bit field index (tpm2.NVTypeBits), the mask is a big-endian value that is zero
+// extended to 8 bytes if it is shorter, and can be created with [NVBitsMask].
+//
+// See [PolicyBuilderBranch.PolicyNV] for more details about how this assertion is handled
+// during automatic branch selection.
+func (b *PolicyBuilderBranch) PolicyNVBitsClear(nvIndex *tpm2.NVPublic, mask tpm2.Operand) error {
+	return b.policyNVBits("PolicyNVBitsClear", nvIndex, mask, tpm2.OpBitclear)
+}
+
+// PolicyAuthorizeNV adds a TPM2_PolicyAuthorizeNV assertion to this branch so that the policy
+// can be satisfied by any policy with a digest that is stored in the specified index. The
+// assertions that precede this one in the same session must produce the digest stored in
+// the index when the policy is executed. As the TPM resets the session digest when
+// executing this assertion, the digest of the policy only depends on the name of the
+// index and the assertions that follow this one.
+//
+// Executing this assertion requires read authorization for the index, which is obtained
+// in the same way as for [PolicyBuilderBranch.PolicyNV].
+func (b *PolicyBuilderBranch) PolicyAuthorizeNV(nvIndex *tpm2.NVPublic) error {
+	if err := b.prepareToModifyBranch(); err != nil {
+		return b.policy.fail("PolicyAuthorizeNV", err)
+	}
+
+	if nvIndex == nil {
+		return b.policy.fail("PolicyAuthorizeNV", errors.New("no nvIndex"))
+	}
+	if !nvIndex.Name().IsValid() {
+		return b.policy.fail("PolicyAuthorizeNV", errors.New("invalid nvIndex"))
+	}
+
+	element := &policyElement{
+		Type: tpm2.CommandPolicyAuthorizeNV,
+		Details: &policyElementDetails{
+			AuthorizeNV: &policyAuthorizeNVElement{NvIndex: nvIndex}}}
+	b.policyBranch.Policy = append(b.policyBranch.Policy, element)
+
+	return nil
+}
+
 // PolicySecret adds a TPM2_PolicySecret assertion to this branch so that the policy requires
 // knowledge of the authorization value of the object associated with authObject.
 func (b *PolicyBuilderBranch) PolicySecret(authObject Named, policyRef tpm2.Nonce) error {
@@ -285,11 +434,19 @@ func (b *PolicyBuilderBranch) PolicyCommandCode(code tpm2.CommandCode) error {
 
 // PolicyCounterTimer adds a TPM2_PolicyCounterTimer assertion to this branch to bind the policy
 // to the contents of the [tpm2.TimeInfo] structure.
+//
+// An error will be returned if operandB is larger than the maximum operand size, or if the
+// comparison would extend beyond the end of the marshalled [tpm2.TimeInfo] structure, as
+// such a policy can never be satisfied.
 func (b *PolicyBuilderBranch) PolicyCounterTimer(operandB tpm2.Operand, offset uint16, operation tpm2.ArithmeticOp) error {
 	if err := b.prepareToModifyBranch(); err != nil {
 		return b.policy.fail("PolicyCounterTimer", err)
 	}
 
+	if err := validateOperandWindow(timeInfoSize, offset, len(operandB)); err != nil {
+		return b.policy.fail("PolicyCounterTimer", fmt.Errorf("invalid comparison with time info structure: %w", err))
+	}
+
 	element := &policyElement{
 		Type: tpm2.CommandPolicyCounterTimer,
 		Details: &policyElementDetails{
@@ -461,6 +618,10 @@ func (b *PolicyBuilderBranch) PolicyPassword() error {
 // PolicyNvWritten adds a TPM2_PolicyNvWritten assertion to this branch in order to bind the
 // policy to the status of the [tpm2.AttrNVWritten] attribute for the NV index on which the
 // session is used.
+//
+// Where this assertion appears in a policy with multiple branches, branches are automatically
+// selected during execution based on the current status of the [tpm2.AttrNVWritten] attribute
+// of the NV index supplied via [PolicySessionUsage.WithNVHandle].
 func (b *PolicyBuilderBranch) PolicyNvWritten(writtenSet bool) error {
 	if err := b.prepareToModifyBranch(); err != nil {
 		return b.policy.fail("PolicyNvWritten", err)
@@ -475,11 +636,39 @@ func (b *PolicyBuilderBranch) PolicyNvWritten(writtenSet bool) error {
 	return nil
 }
 
+// PolicyTemplate adds a TPM2_PolicyTemplate assertion to this branch in order to bind the
+// policy to the object template with the specified digest, so that the session can only be
+// used with TPM2_Create, TPM2_CreatePrimary or TPM2_CreateLoaded to create an object from that
+// template. The digest can be computed with [ComputeTemplateHash], and must be computed with the
+// same algorithm as the session that the policy is executed with.
+//
+// Where this assertion appears in a policy with multiple branches, branches are automatically
+// selected during execution based on the template supplied via
+// [PolicySessionUsage.WithTemplate].
+func (b *PolicyBuilderBranch) PolicyTemplate(templateHash tpm2.Digest) error {
+	if err := b.prepareToModifyBranch(); err != nil {
+		return b.policy.fail("PolicyTemplate", err)
+	}
+
+	element := &policyElement{
+		Type: tpm2.CommandPolicyTemplate,
+		Details: &policyElementDetails{
+			Template: &policyTemplateElement{TemplateHash: templateHash}}}
+	b.policyBranch.Policy = append(b.policyBranch.Policy, element)
+
+	return nil
+}
+
 // AddBranchNode adds a branch node to this branch from which sub-branches can be added.
 // This makes it possible to create policies that can be satisified with different sets of
 // conditions. One of the sub-branches will be selected during execution, and will be
 // executed before the remaining assertions in this branch.
 //
+// A branch node with a single branch still results in a TPM2_PolicyOR assertion, where
+// the digest of the single branch is duplicated in order to satisfy the TPM's requirement
+// for at least 2 digests. The resulting policy digest is therefore different to the digest
+// of an equivalent policy without the branch node.
+//
 // The branches added to the returned branch node will be committed to this branch and
 // the branch node will be locked from further modifications by subsequent additions to this
 // branch, or any ancestor branches, or by calling [PolicyBuilder.Policy].
@@ -503,8 +692,9 @@ func (b *PolicyBuilderBranch) AddBranchNode() *PolicyBuilderBranchNode {
 // Execution then resumes in the parent branch, with the assertion immediately following
 // the branch node.
 type PolicyBuilder struct {
-	root *PolicyBuilderBranch
-	err  error
+	root         *PolicyBuilderBranch
+	descriptions map[*policyBranch]policyBranchDescription
+	err          error
 }
 
 // NewPolicyBuilder returns a new PolicyBuilder.
@@ -542,5 +732,143 @@ func (b *PolicyBuilder) Policy() (*Policy, error) {
 		}
 	}
 
-	return &Policy{policy: policy{Policy: b.root.policyBranch.Policy}}, nil
+	return &Policy{policy: policy{
+		Policy:       b.root.policyBranch.Policy,
+		Descriptions: b.collectDescriptions()}}, nil
+}
+
+// collectDescriptions returns the descriptions set with
+// [PolicyBuilderBranch.SetDescription], keyed by the path of each branch.
+func (b *PolicyBuilder) collectDescriptions() policyBranchDescriptions {
+	if len(b.descriptions) == 0 {
+		return nil
+	}
+
+	var result policyBranchDescriptions
+	walkBranchPaths("", b.root.policyBranch.Policy, func(path policyBranchPath, branch *policyBranch) {
+		if description := b.descriptions[branch]; len(description) > 0 {
+			result = append(result, policyBranchDescriptionEntry{Path: path, Description: description})
+		}
+	})
+
+	return result
+}
+
+// PolicyWithDigests returns the finalized policy with the digests for the policy
+// and every branch computed and stored for exactly the specified algorithms. See
+// [Policy.WithComputedDigests].
+func (b *PolicyBuilder) PolicyWithDigests(algs ...tpm2.HashAlgorithmId) (*Policy, error) {
+	policy, err := b.Policy()
+	if err != nil {
+		return nil, err
+	}
+	return policy.WithComputedDigests(algs...)
+}
+
+// NewFirstBootPolicy returns a policy for the supplied NV index that only permits
+// it to be written with TPM2_NV_Write whilst it has not been written yet. This is
+// useful for provisioning workflows that need to detect or enforce that
+// provisioning only happens once, eg, on first boot. The returned policy has
+// already been computed for the specified algorithm, which must match the name
+// algorithm of the NV index because the digest is intended to be used as its
+// authorization policy. The NV index must have the TPMA_NV_POLICYWRITE attribute.
+//
+// Note that the TPM only permits a session that has executed TPM2_PolicyNvWritten
+// to authorize a command that operates on a NV index, so this can't be used as the
+// authorization policy of a sealed object.
+func NewFirstBootPolicy(nvIndex *tpm2.NVPublic, alg tpm2.HashAlgorithmId) (*Policy, error) {
+	if nvIndex == nil {
+		return nil, errors.New("no NV index")
+	}
+	if nvIndex.Index.Type() != tpm2.HandleTypeNVIndex {
+		return nil, errors.New("invalid NV index handle")
+	}
+	if nvIndex.NameAlg != alg {
+		return nil, errors.New("algorithm does not match the name algorithm of the NV index")
+	}
+	if nvIndex.Attrs&tpm2.AttrNVPolicyWrite == 0 {
+		return nil, errors.New("NV index does not have the TPMA_NV_POLICYWRITE attribute")
+	}
+
+	builder := NewPolicyBuilder()
+	builder.RootBranch().PolicyNvWritten(false)
+	builder.RootBranch().PolicyCommandCode(tpm2.CommandNVWrite)
+	policy, err := builder.Policy()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := policy.Compute(alg); err != nil {
+		return nil, fmt.Errorf("cannot compute policy: %w", err)
+	}
+
+	return policy, nil
+}
+
+// NewEKBoundPolicy returns a policy that can only be satisfied on the TPM that has
+// the endorsement key with the specified name, by way of a TPM2_PolicySecret
+// assertion that references the endorsement key. As the name of an endorsement key
+// is unique to a TPM, this is useful for binding a sealed object to a particular TPM.
+//
+// Executing this policy with [Policy.Execute] requires a [PolicyResourceLoader] that
+// can load the endorsement key and authorize its use. The authorization policy of an
+// endorsement key created from one of the TCG default templates consists of a
+// TPM2_PolicySecret assertion for the endorsement hierarchy. When using
+// [NewTPMPolicyResourceLoader], the endorsement key should be supplied as a
+// [PersistentResource] with the Policy field set to a policy containing this
+// assertion, and the supplied [Authorizer] must set the authorization value for
+// the endorsement hierarchy.
+func NewEKBoundPolicy(ekName tpm2.Name, policyRef tpm2.Nonce) (*Policy, error) {
+	if !ekName.IsValid() || ekName.Type() != tpm2.NameTypeDigest {
+		return nil, errors.New("invalid EK name")
+	}
+
+	builder := NewPolicyBuilder()
+	if err := builder.RootBranch().PolicySecret(ekName, policyRef); err != nil {
+		return nil, err
+	}
+	return builder.Policy()
+}
+
+// NewCommandCodePolicy returns a policy that restricts the use of a session to one of the
+// specified commands. A policy branch can only contain a single TPM2_PolicyCommandCode
+// assertion, so if more than one command is specified, the returned policy contains a
+// branch node with a branch for each command. Each branch is named after the command code
+// that it permits (eg, "TPM_CC_NV_Read"), so that it can be selected explicitly with
+// [PolicyExecuteParams.Path]. It is also selected automatically when executing the policy
+// with a session usage for the corresponding command. The returned policy has already been
+// computed for the specified algorithm.
+func NewCommandCodePolicy(alg tpm2.HashAlgorithmId, commands ...tpm2.CommandCode) (*Policy, error) {
+	if len(commands) == 0 {
+		return nil, errors.New("no commands")
+	}
+
+	builder := NewPolicyBuilder()
+	if len(commands) == 1 {
+		if err := builder.RootBranch().PolicyCommandCode(commands[0]); err != nil {
+			return nil, err
+		}
+	} else {
+		seen := make(map[tpm2.CommandCode]bool)
+		node := builder.RootBranch().AddBranchNode()
+		for _, code := range commands {
+			if seen[code] {
+				return nil, fmt.Errorf("duplicate command %v", code)
+			}
+			seen[code] = true
+
+			if err := node.AddBranch(code.String()).PolicyCommandCode(code); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	policy, err := builder.Policy()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := policy.Compute(alg); err != nil {
+		return nil, fmt.Errorf("cannot compute policy: %w", err)
+	}
+
+	return policy, nil
 }
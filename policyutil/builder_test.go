@@ -12,6 +12,7 @@ import (
 	"crypto/x509"
 	"encoding/pem"
 	"io"
+	"strings"
 
 	. "gopkg.in/check.v1"
 
@@ -105,6 +106,47 @@ func (s *builderSuite) TestPolicyNVDifferentOperation(c *C) {
 		operation: tpm2.OpUnsignedGE})
 }
 
+func (s *builderSuite) TestPolicyNVOperandTooLarge(c *C) {
+	builder := NewPolicyBuilder()
+	c.Check(builder.RootBranch().PolicyNV(&tpm2.NVPublic{
+		Index:   0x0181f000,
+		NameAlg: tpm2.HashAlgorithmSHA256,
+		Attrs:   tpm2.NVTypeOrdinary.WithAttrs(tpm2.AttrNVAuthRead | tpm2.AttrNVAuthWrite | tpm2.AttrNVWritten),
+		Size:    128}, make(tpm2.Operand, 65), 0, tpm2.OpEq), ErrorMatches, `invalid comparison with nvIndex: operandB is too large`)
+	_, err := builder.Policy()
+	c.Check(err, ErrorMatches,
+		`could not build policy: encountered an error when calling PolicyNV: invalid comparison with nvIndex: operandB is too large`)
+}
+
+func (s *builderSuite) TestPolicyNVOperandExceedsIndex(c *C) {
+	builder := NewPolicyBuilder()
+	c.Check(builder.RootBranch().PolicyNV(&tpm2.NVPublic{
+		Index:   0x0181f000,
+		NameAlg: tpm2.HashAlgorithmSHA256,
+		Attrs:   tpm2.NVTypeOrdinary.WithAttrs(tpm2.AttrNVAuthRead | tpm2.AttrNVAuthWrite | tpm2.AttrNVWritten),
+		Size:    8}, []byte{0x00, 0x00, 0x10}, 6, tpm2.OpEq), ErrorMatches, `invalid comparison with nvIndex: operandB and offset exceed the end of the data`)
+	_, err := builder.Policy()
+	c.Check(err, ErrorMatches,
+		`could not build policy: encountered an error when calling PolicyNV: invalid comparison with nvIndex: operandB and offset exceed the end of the data`)
+}
+
+func (s *builderSuite) TestPolicyNVOffsetPastEnd(c *C) {
+	builder := NewPolicyBuilder()
+	c.Check(builder.RootBranch().PolicyNV(&tpm2.NVPublic{
+		Index:   0x0181f000,
+		NameAlg: tpm2.HashAlgorithmSHA256,
+		Attrs:   tpm2.NVTypeOrdinary.WithAttrs(tpm2.AttrNVAuthRead | tpm2.AttrNVAuthWrite | tpm2.AttrNVWritten),
+		Size:    8}, []byte{0x10}, 9, tpm2.OpEq), ErrorMatches, `invalid comparison with nvIndex: offset is past the end of the data`)
+}
+
+func (s *builderSuite) TestPolicyNVUnknownSize(c *C) {
+	builder := NewPolicyBuilder()
+	c.Check(builder.RootBranch().PolicyNV(&tpm2.NVPublic{
+		Index:   0x0181f000,
+		NameAlg: tpm2.HashAlgorithmSHA256,
+		Attrs:   tpm2.NVTypeOrdinary.WithAttrs(tpm2.AttrNVAuthRead | tpm2.AttrNVAuthWrite | tpm2.AttrNVWritten)}, []byte{0x00, 0x00, 0x10}, 1000, tpm2.OpEq), IsNil)
+}
+
 type testBuildPolicySecretData struct {
 	authObjectName tpm2.Name
 	policyRef      tpm2.Nonce
@@ -361,6 +403,33 @@ func (s *builderSuite) TestPolicyCounterTimerDifferentOperation(c *C) {
 		operation: tpm2.OpUnsignedLE})
 }
 
+func (s *builderSuite) TestPolicyCounterTimerOperandTooLarge(c *C) {
+	builder := NewPolicyBuilder()
+	c.Check(builder.RootBranch().PolicyCounterTimer(make(tpm2.Operand, 26), 0, tpm2.OpEq), ErrorMatches,
+		`invalid comparison with time info structure: operandB and offset exceed the end of the data`)
+	_, err := builder.Policy()
+	c.Check(err, ErrorMatches,
+		`could not build policy: encountered an error when calling PolicyCounterTimer: invalid comparison with time info structure: operandB and offset exceed the end of the data`)
+}
+
+func (s *builderSuite) TestPolicyCounterTimerOperandExceedsMaxSize(c *C) {
+	builder := NewPolicyBuilder()
+	c.Check(builder.RootBranch().PolicyCounterTimer(make(tpm2.Operand, 65), 0, tpm2.OpEq), ErrorMatches,
+		`invalid comparison with time info structure: operandB is too large`)
+}
+
+func (s *builderSuite) TestPolicyCounterTimerOffsetTooLarge(c *C) {
+	builder := NewPolicyBuilder()
+	c.Check(builder.RootBranch().PolicyCounterTimer([]byte{0x00, 0x00, 0x00, 0x01}, 22, tpm2.OpEq), ErrorMatches,
+		`invalid comparison with time info structure: operandB and offset exceed the end of the data`)
+}
+
+func (s *builderSuite) TestPolicyCounterTimerOffsetPastEnd(c *C) {
+	builder := NewPolicyBuilder()
+	c.Check(builder.RootBranch().PolicyCounterTimer([]byte{0x01}, 26, tpm2.OpEq), ErrorMatches,
+		`invalid comparison with time info structure: offset is past the end of the data`)
+}
+
 type testBuildPolicyCpHashData struct {
 	code    tpm2.CommandCode
 	handles []Named
@@ -675,6 +744,48 @@ func (s *builderSuite) TestPolicyNvWrittenTrue(c *C) {
 	s.testPolicyNvWritten(c, true)
 }
 
+func (s *builderSuite) TestPolicyTemplate(c *C) {
+	templateHash := tpm2.Digest(internal_testutil.DecodeHexString(c, "fe1a7c2a8bd2bf8b2be5c0c2ee0f1e3d1c2b9d3ba8c0a3b0d54c46ef1ce4a0e1"))
+
+	builder := NewPolicyBuilder()
+	c.Check(builder.RootBranch().PolicyTemplate(templateHash), IsNil)
+
+	expectedPolicy := NewMockPolicy(nil, nil, NewMockPolicyTemplateElement(templateHash))
+
+	policy, err := builder.Policy()
+	c.Check(err, IsNil)
+	c.Check(policy, testutil.TPMValueDeepEquals, expectedPolicy)
+}
+
+func (s *builderSuite) TestPolicyAuthorizeNV(c *C) {
+	nvPub := &tpm2.NVPublic{
+		Index:   0x0181f000,
+		NameAlg: tpm2.HashAlgorithmSHA256,
+		Attrs:   tpm2.NVTypeOrdinary.WithAttrs(tpm2.AttrNVAuthRead | tpm2.AttrNVAuthWrite | tpm2.AttrNVWritten),
+		Size:    34}
+
+	builder := NewPolicyBuilder()
+	c.Check(builder.RootBranch().PolicyAuthorizeNV(nvPub), IsNil)
+
+	expectedPolicy := NewMockPolicy(nil, nil, NewMockPolicyAuthorizeNVElement(nvPub))
+
+	policy, err := builder.Policy()
+	c.Check(err, IsNil)
+	c.Check(policy, testutil.TPMValueDeepEquals, expectedPolicy)
+}
+
+func (s *builderSuite) TestPolicyAuthorizeNVInvalidName(c *C) {
+	builder := NewPolicyBuilder()
+	c.Check(builder.RootBranch().PolicyAuthorizeNV(&tpm2.NVPublic{Index: 0x0181f000, NameAlg: tpm2.HashAlgorithmNull}), ErrorMatches, `invalid nvIndex`)
+}
+
+func (s *builderSuite) TestPolicyAuthorizeNVNoIndex(c *C) {
+	builder := NewPolicyBuilder()
+	c.Check(builder.RootBranch().PolicyAuthorizeNV(nil), ErrorMatches, `no nvIndex`)
+	_, err := builder.Policy()
+	c.Check(err, ErrorMatches, `could not build policy: encountered an error when calling PolicyAuthorizeNV: no nvIndex`)
+}
+
 func (s *builderSuite) TestPolicyLocksRoot(c *C) {
 	builder := NewPolicyBuilder()
 	_, err := builder.Policy()
@@ -782,6 +893,49 @@ func (s *builderSuite) TestLockBranchCommitCurrentBranchNode(c *C) {
 	c.Check(policy, testutil.TPMValueDeepEquals, expectedPolicy)
 }
 
+func (s *builderSuite) TestSetDescription(c *C) {
+	builder := NewPolicyBuilder()
+	node := builder.RootBranch().AddBranchNode()
+
+	b1 := node.AddBranch("branch1")
+	c.Check(b1.PolicyAuthValue(), IsNil)
+	c.Check(b1.SetDescription("foo"), IsNil)
+
+	b2 := node.AddBranch("branch2")
+	c.Check(b2.PolicyPassword(), IsNil)
+
+	// The description doesn't commit b1's branch node.
+	node2 := b1.AddBranchNode()
+	c.Check(node2.AddBranch("").PolicyCommandCode(tpm2.CommandUnseal), IsNil)
+	c.Check(b1.SetDescription("bar"), IsNil)
+	c.Check(node2.AddBranch("").PolicyCommandCode(tpm2.CommandNVRead), IsNil)
+
+	policy, err := builder.Policy()
+	c.Check(err, IsNil)
+	c.Check(policy.BranchDescriptions(), DeepEquals, map[string]string{"branch1": "bar"})
+}
+
+func (s *builderSuite) TestSetDescriptionLockedBranch(c *C) {
+	builder := NewPolicyBuilder()
+	node := builder.RootBranch().AddBranchNode()
+
+	b1 := node.AddBranch("branch1")
+	c.Check(b1.PolicyAuthValue(), IsNil)
+
+	c.Check(builder.RootBranch().PolicyCommandCode(tpm2.CommandUnseal), IsNil)
+
+	c.Check(b1.SetDescription("foo"), ErrorMatches, `cannot modify locked branch`)
+	_, err := builder.Policy()
+	c.Check(err, ErrorMatches, `could not build policy: encountered an error when calling SetDescription: cannot modify locked branch`)
+}
+
+func (s *builderSuite) TestSetDescriptionInvalid(c *C) {
+	builder := NewPolicyBuilder()
+	c.Check(builder.RootBranch().SetDescription("\xc3\x28"), ErrorMatches, `invalid description`)
+	_, err := builder.Policy()
+	c.Check(err, ErrorMatches, `could not build policy: encountered an error when calling SetDescription: invalid description`)
+}
+
 func (s *builderSuite) TestEmptyBranchNodeIsElided(c *C) {
 	builder := NewPolicyBuilder()
 	c.Check(builder.RootBranch().PolicyNvWritten(true), IsNil)
@@ -932,3 +1086,301 @@ func (s *builderSuite) TestPolicyBranchesEmbeddedNodes(c *C) {
 	c.Check(err, IsNil)
 	c.Check(policy, testutil.TPMValueDeepEquals, expectedPolicy)
 }
+
+func (s *builderSuite) TestNewFirstBootPolicy(c *C) {
+	nvPub := &tpm2.NVPublic{
+		Index:   0x0181f000,
+		NameAlg: tpm2.HashAlgorithmSHA256,
+		Attrs:   tpm2.NVTypeOrdinary.WithAttrs(tpm2.AttrNVAuthRead | tpm2.AttrNVPolicyWrite | tpm2.AttrNVNoDA),
+		Size:    8}
+
+	policy, err := NewFirstBootPolicy(nvPub, tpm2.HashAlgorithmSHA256)
+	c.Assert(err, IsNil)
+
+	builder := NewPolicyBuilder()
+	c.Check(builder.RootBranch().PolicyNvWritten(false), IsNil)
+	c.Check(builder.RootBranch().PolicyCommandCode(tpm2.CommandNVWrite), IsNil)
+	expectedPolicy, err := builder.Policy()
+	c.Assert(err, IsNil)
+	expectedDigest, err := expectedPolicy.Compute(tpm2.HashAlgorithmSHA256)
+	c.Check(err, IsNil)
+
+	digest, err := policy.Compute(tpm2.HashAlgorithmSHA256)
+	c.Check(err, IsNil)
+	c.Check(digest, DeepEquals, expectedDigest)
+}
+
+func (s *builderSuite) TestNewFirstBootPolicyNoIndex(c *C) {
+	_, err := NewFirstBootPolicy(nil, tpm2.HashAlgorithmSHA256)
+	c.Check(err, ErrorMatches, `no NV index`)
+}
+
+func (s *builderSuite) TestNewFirstBootPolicyInvalidHandle(c *C) {
+	nvPub := &tpm2.NVPublic{
+		Index:   0x81000001,
+		NameAlg: tpm2.HashAlgorithmSHA256,
+		Attrs:   tpm2.NVTypeOrdinary.WithAttrs(tpm2.AttrNVAuthRead | tpm2.AttrNVPolicyWrite | tpm2.AttrNVNoDA),
+		Size:    8}
+	_, err := NewFirstBootPolicy(nvPub, tpm2.HashAlgorithmSHA256)
+	c.Check(err, ErrorMatches, `invalid NV index handle`)
+}
+
+func (s *builderSuite) TestNewFirstBootPolicyMismatchedAlg(c *C) {
+	nvPub := &tpm2.NVPublic{
+		Index:   0x0181f000,
+		NameAlg: tpm2.HashAlgorithmSHA1,
+		Attrs:   tpm2.NVTypeOrdinary.WithAttrs(tpm2.AttrNVAuthRead | tpm2.AttrNVPolicyWrite | tpm2.AttrNVNoDA),
+		Size:    8}
+	_, err := NewFirstBootPolicy(nvPub, tpm2.HashAlgorithmSHA256)
+	c.Check(err, ErrorMatches, `algorithm does not match the name algorithm of the NV index`)
+}
+
+func (s *builderSuite) TestNewFirstBootPolicyNoPolicyWrite(c *C) {
+	nvPub := &tpm2.NVPublic{
+		Index:   0x0181f000,
+		NameAlg: tpm2.HashAlgorithmSHA256,
+		Attrs:   tpm2.NVTypeOrdinary.WithAttrs(tpm2.AttrNVAuthRead | tpm2.AttrNVAuthWrite | tpm2.AttrNVNoDA),
+		Size:    8}
+	_, err := NewFirstBootPolicy(nvPub, tpm2.HashAlgorithmSHA256)
+	c.Check(err, ErrorMatches, `NV index does not have the TPMA_NV_POLICYWRITE attribute`)
+}
+
+func (s *builderSuite) TestNewEKBoundPolicy(c *C) {
+	ekName := tpm2.Name(internal_testutil.DecodeHexString(c, "000b6b5bd8c84e4b0ba6a4fbb8c0d2c0e6b5f8e5fa1b0bde6b1ffdb16bb1d11d6b3a"))
+
+	policy, err := NewEKBoundPolicy(ekName, []byte("foo"))
+	c.Assert(err, IsNil)
+
+	builder := NewPolicyBuilder()
+	c.Check(builder.RootBranch().PolicySecret(ekName, []byte("foo")), IsNil)
+	expectedPolicy, err := builder.Policy()
+	c.Assert(err, IsNil)
+	c.Check(policy, testutil.TPMValueDeepEquals, expectedPolicy)
+
+	expectedDigest, err := expectedPolicy.Compute(tpm2.HashAlgorithmSHA256)
+	c.Check(err, IsNil)
+	digest, err := policy.Compute(tpm2.HashAlgorithmSHA256)
+	c.Check(err, IsNil)
+	c.Check(digest, DeepEquals, expectedDigest)
+}
+
+func (s *builderSuite) TestNewEKBoundPolicyDifferentEK(c *C) {
+	policy1, err := NewEKBoundPolicy(tpm2.Name(internal_testutil.DecodeHexString(c, "000b6b5bd8c84e4b0ba6a4fbb8c0d2c0e6b5f8e5fa1b0bde6b1ffdb16bb1d11d6b3a")), nil)
+	c.Assert(err, IsNil)
+	digest1, err := policy1.Compute(tpm2.HashAlgorithmSHA256)
+	c.Check(err, IsNil)
+
+	policy2, err := NewEKBoundPolicy(tpm2.Name(internal_testutil.DecodeHexString(c, "000b0f5b1fc1a9d3e2d0e3fa8bd8f3dc7a9c6b1b2a7f8e1d4b8a0a0d6c9e7f2b1a3c")), nil)
+	c.Assert(err, IsNil)
+	digest2, err := policy2.Compute(tpm2.HashAlgorithmSHA256)
+	c.Check(err, IsNil)
+
+	c.Check(digest2, Not(DeepEquals), digest1)
+}
+
+func (s *builderSuite) TestNewEKBoundPolicyInvalidName(c *C) {
+	_, err := NewEKBoundPolicy(tpm2.MakeHandleName(tpm2.HandleEndorsement), nil)
+	c.Check(err, ErrorMatches, `invalid EK name`)
+}
+
+func (s *builderSuite) TestPolicyWithDigests(c *C) {
+	builder := NewPolicyBuilder()
+	c.Check(builder.RootBranch().PolicyAuthValue(), IsNil)
+
+	policy, err := builder.PolicyWithDigests(tpm2.HashAlgorithmSHA256)
+	c.Assert(err, IsNil)
+
+	expectedDigest, err := policy.WithComputedDigests(tpm2.HashAlgorithmSHA256)
+	c.Assert(err, IsNil)
+	c.Check(policy, DeepEquals, expectedDigest)
+
+	_, err = policy.Validate(tpm2.HashAlgorithmSHA256)
+	c.Check(err, IsNil)
+	_, err = policy.Validate(tpm2.HashAlgorithmSHA1)
+	c.Check(err, Equals, ErrMissingDigest)
+}
+
+func (s *builderSuite) TestNewCommandCodePolicy(c *C) {
+	policy, err := NewCommandCodePolicy(tpm2.HashAlgorithmSHA256, tpm2.CommandNVRead, tpm2.CommandNVChangeAuth)
+	c.Assert(err, IsNil)
+
+	builder := NewPolicyBuilder()
+	node := builder.RootBranch().AddBranchNode()
+	c.Check(node.AddBranch("TPM_CC_NV_Read").PolicyCommandCode(tpm2.CommandNVRead), IsNil)
+	c.Check(node.AddBranch("TPM_CC_NV_ChangeAuth").PolicyCommandCode(tpm2.CommandNVChangeAuth), IsNil)
+	expectedPolicy, err := builder.PolicyWithDigests(tpm2.HashAlgorithmSHA256)
+	c.Assert(err, IsNil)
+	c.Check(policy, testutil.TPMValueDeepEquals, expectedPolicy)
+
+	expectedDigest, err := expectedPolicy.Validate(tpm2.HashAlgorithmSHA256)
+	c.Check(err, IsNil)
+	digest, err := policy.Validate(tpm2.HashAlgorithmSHA256)
+	c.Check(err, IsNil)
+	c.Check(digest, DeepEquals, expectedDigest)
+
+	branches, err := policy.Branches()
+	c.Check(err, IsNil)
+	c.Check(branches, DeepEquals, []string{"TPM_CC_NV_Read", "TPM_CC_NV_ChangeAuth"})
+}
+
+func (s *builderSuite) TestNewCommandCodePolicySingleCommand(c *C) {
+	policy, err := NewCommandCodePolicy(tpm2.HashAlgorithmSHA256, tpm2.CommandUnseal)
+	c.Assert(err, IsNil)
+
+	builder := NewPolicyBuilder()
+	c.Check(builder.RootBranch().PolicyCommandCode(tpm2.CommandUnseal), IsNil)
+	expectedPolicy, err := builder.PolicyWithDigests(tpm2.HashAlgorithmSHA256)
+	c.Assert(err, IsNil)
+	c.Check(policy, testutil.TPMValueDeepEquals, expectedPolicy)
+}
+
+func (s *builderSuite) TestNewCommandCodePolicyNoCommands(c *C) {
+	_, err := NewCommandCodePolicy(tpm2.HashAlgorithmSHA256)
+	c.Check(err, ErrorMatches, `no commands`)
+}
+
+func (s *builderSuite) TestNewCommandCodePolicyDuplicateCommand(c *C) {
+	_, err := NewCommandCodePolicy(tpm2.HashAlgorithmSHA256, tpm2.CommandNVRead, tpm2.CommandNVWrite, tpm2.CommandNVRead)
+	c.Check(err, ErrorMatches, `duplicate command TPM_CC_NV_Read`)
+}
+
+func (s *builderSuite) TestNewCommandCodePolicyInvalidAlg(c *C) {
+	_, err := NewCommandCodePolicy(tpm2.HashAlgorithmNull, tpm2.CommandNVRead, tpm2.CommandNVWrite)
+	c.Check(err, ErrorMatches, `cannot compute policy: invalid algorithm`)
+}
+
+func (s *builderSuite) TestNVBitsMask(c *C) {
+	c.Check(NVBitsMask(), DeepEquals, tpm2.Operand{0, 0, 0, 0, 0, 0, 0, 0})
+	c.Check(NVBitsMask(0, 3), DeepEquals, tpm2.Operand{0, 0, 0, 0, 0, 0, 0, 0x09})
+	c.Check(NVBitsMask(8, 63), DeepEquals, tpm2.Operand{0x80, 0, 0, 0, 0, 0, 0x01, 0})
+}
+
+func (s *builderSuite) TestNVBitsMaskInvalidBit(c *C) {
+	c.Check(func() { NVBitsMask(64) }, PanicMatches, `invalid bit`)
+}
+
+func (s *builderSuite) TestPolicyNVBitsSet(c *C) {
+	nvPub := &tpm2.NVPublic{
+		Index:   0x0181f000,
+		NameAlg: tpm2.HashAlgorithmSHA256,
+		Attrs:   tpm2.NVTypeBits.WithAttrs(tpm2.AttrNVAuthRead | tpm2.AttrNVAuthWrite | tpm2.AttrNVWritten),
+		Size:    8}
+
+	builder := NewPolicyBuilder()
+	c.Check(builder.RootBranch().PolicyNVBitsSet(nvPub, NVBitsMask(1, 4)), IsNil)
+
+	expectedPolicy := NewMockPolicy(nil, nil, NewMockPolicyNVElement(nvPub, tpm2.Operand{0, 0, 0, 0, 0, 0, 0, 0x12}, 0, tpm2.OpBitset))
+
+	policy, err := builder.Policy()
+	c.Check(err, IsNil)
+	c.Check(policy, testutil.TPMValueDeepEquals, expectedPolicy)
+}
+
+func (s *builderSuite) TestPolicyNVBitsClear(c *C) {
+	nvPub := &tpm2.NVPublic{
+		Index:   0x0181f000,
+		NameAlg: tpm2.HashAlgorithmSHA256,
+		Attrs:   tpm2.NVTypeBits.WithAttrs(tpm2.AttrNVAuthRead | tpm2.AttrNVAuthWrite | tpm2.AttrNVWritten),
+		Size:    8}
+
+	builder := NewPolicyBuilder()
+	c.Check(builder.RootBranch().PolicyNVBitsClear(nvPub, NVBitsMask(2)), IsNil)
+
+	expectedPolicy := NewMockPolicy(nil, nil, NewMockPolicyNVElement(nvPub, tpm2.Operand{0, 0, 0, 0, 0, 0, 0, 0x04}, 0, tpm2.OpBitclear))
+
+	policy, err := builder.Policy()
+	c.Check(err, IsNil)
+	c.Check(policy, testutil.TPMValueDeepEquals, expectedPolicy)
+}
+
+func (s *builderSuite) TestPolicyNVBitsSetShortMask(c *C) {
+	nvPub := &tpm2.NVPublic{
+		Index:   0x0181f000,
+		NameAlg: tpm2.HashAlgorithmSHA256,
+		Attrs:   tpm2.NVTypeBits.WithAttrs(tpm2.AttrNVAuthRead | tpm2.AttrNVAuthWrite | tpm2.AttrNVWritten),
+		Size:    8}
+
+	builder := NewPolicyBuilder()
+	c.Check(builder.RootBranch().PolicyNVBitsSet(nvPub, tpm2.Operand{0x01, 0x00}), IsNil)
+
+	// The mask is zero extended for a bit field index.
+	expectedPolicy := NewMockPolicy(nil, nil, NewMockPolicyNVElement(nvPub, tpm2.Operand{0, 0, 0, 0, 0, 0, 0x01, 0}, 0, tpm2.OpBitset))
+
+	policy, err := builder.Policy()
+	c.Check(err, IsNil)
+	c.Check(policy, testutil.TPMValueDeepEquals, expectedPolicy)
+}
+
+func (s *builderSuite) TestPolicyNVBitsSetOrdinaryIndex(c *C) {
+	nvPub := &tpm2.NVPublic{
+		Index:   0x0181f000,
+		NameAlg: tpm2.HashAlgorithmSHA256,
+		Attrs:   tpm2.NVTypeOrdinary.WithAttrs(tpm2.AttrNVAuthRead | tpm2.AttrNVAuthWrite | tpm2.AttrNVWritten),
+		Size:    16}
+
+	builder := NewPolicyBuilder()
+	c.Check(builder.RootBranch().PolicyNVBitsSet(nvPub, tpm2.Operand{0x80, 0x01}), IsNil)
+
+	// The mask is not extended for an ordinary index.
+	expectedPolicy := NewMockPolicy(nil, nil, NewMockPolicyNVElement(nvPub, tpm2.Operand{0x80, 0x01}, 0, tpm2.OpBitset))
+
+	policy, err := builder.Policy()
+	c.Check(err, IsNil)
+	c.Check(policy, testutil.TPMValueDeepEquals, expectedPolicy)
+}
+
+func (s *builderSuite) TestPolicyNVBitsSetNoMask(c *C) {
+	builder := NewPolicyBuilder()
+	c.Check(builder.RootBranch().PolicyNVBitsSet(&tpm2.NVPublic{
+		Index:   0x0181f000,
+		NameAlg: tpm2.HashAlgorithmSHA256,
+		Attrs:   tpm2.NVTypeBits.WithAttrs(tpm2.AttrNVAuthRead | tpm2.AttrNVAuthWrite | tpm2.AttrNVWritten),
+		Size:    8}, nil), ErrorMatches, `no mask`)
+	_, err := builder.Policy()
+	c.Check(err, ErrorMatches, `could not build policy: encountered an error when calling PolicyNVBitsSet: no mask`)
+}
+
+func (s *builderSuite) TestPolicyNVBitsSetNoIndex(c *C) {
+	builder := NewPolicyBuilder()
+	c.Check(builder.RootBranch().PolicyNVBitsSet(nil, NVBitsMask(1)), ErrorMatches, `no index`)
+	_, err := builder.Policy()
+	c.Check(err, ErrorMatches, `could not build policy: encountered an error when calling PolicyNVBitsSet: no index`)
+}
+
+func (s *builderSuite) TestPolicyNVBitsClearNoIndex(c *C) {
+	builder := NewPolicyBuilder()
+	c.Check(builder.RootBranch().PolicyNVBitsClear(nil, NVBitsMask(1)), ErrorMatches, `no index`)
+	_, err := builder.Policy()
+	c.Check(err, ErrorMatches, `could not build policy: encountered an error when calling PolicyNVBitsClear: no index`)
+}
+
+func (s *builderSuite) TestPolicyNVBitsClearMaskTooLarge(c *C) {
+	builder := NewPolicyBuilder()
+	c.Check(builder.RootBranch().PolicyNVBitsClear(&tpm2.NVPublic{
+		Index:   0x0181f000,
+		NameAlg: tpm2.HashAlgorithmSHA256,
+		Attrs:   tpm2.NVTypeBits.WithAttrs(tpm2.AttrNVAuthRead | tpm2.AttrNVAuthWrite | tpm2.AttrNVWritten),
+		Size:    8}, make(tpm2.Operand, 9)), ErrorMatches, `invalid comparison with nvIndex: operandB and offset exceed the end of the data`)
+}
+
+func (s *builderSuite) TestAddBranchNameMaxLength(c *C) {
+	builder := NewPolicyBuilder()
+	node := builder.RootBranch().AddBranchNode()
+	c.Check(node.AddBranch(strings.Repeat("a", 128)).PolicyAuthValue(), IsNil)
+
+	policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+
+	branches, err := policy.Branches()
+	c.Check(err, IsNil)
+	c.Check(branches, DeepEquals, []string{strings.Repeat("a", 128)})
+}
+
+func (s *builderSuite) TestAddBranchNameTooLong(c *C) {
+	builder := NewPolicyBuilder()
+	node := builder.RootBranch().AddBranchNode()
+	node.AddBranch(strings.Repeat("a", 129))
+
+	_, err := builder.Policy()
+	c.Check(err, ErrorMatches, `could not build policy: encountered an error when calling AddBranch: branch name too long \(the maximum is 128 bytes\)`)
+}
@@ -0,0 +1,184 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package policyutil
+
+import (
+	"bytes"
+	"crypto"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/mu"
+)
+
+// AuthorizedPolicy is a policy and the signed authorization that approves it, as
+// contained in an [AuthorizedPolicyBundle].
+type AuthorizedPolicy struct {
+	Policy        *Policy
+	Authorization *PolicyAuthorization
+}
+
+// AuthorizedPolicyBundle is a set of policies that have been approved by the same key
+// for a TPM2_PolicyAuthorize assertion with the same policy ref. It can be used to
+// distribute the policies approved by a key, and to check them before they are used.
+type AuthorizedPolicyBundle struct {
+	AuthKey   *tpm2.Public // The public key that signs the authorizations
+	PolicyRef tpm2.Nonce   // The policy ref of the corresponding TPM2_PolicyAuthorize assertion
+	Policies  []AuthorizedPolicy
+}
+
+// NewAuthorizedPolicyBundle returns a new empty bundle of policies approved by the
+// supplied key for use with a TPM2_PolicyAuthorize assertion with the supplied policy
+// ref.
+func NewAuthorizedPolicyBundle(authKey *tpm2.Public, policyRef tpm2.Nonce) *AuthorizedPolicyBundle {
+	return &AuthorizedPolicyBundle{
+		AuthKey:   authKey,
+		PolicyRef: policyRef,
+	}
+}
+
+// Add signs the supplied policy with the supplied signer and adds it to this bundle. The
+// policy digest is computed for the name algorithm of the bundle's key, which must match
+// the algorithm supplied through the opts argument. The supplied policy is not modified
+// other than having its digest computed if it hasn't been computed already.
+func (b *AuthorizedPolicyBundle) Add(rand io.Reader, policy *Policy, signer crypto.Signer, opts crypto.SignerOpts) error {
+	if err := b.checkAuthKey(); err != nil {
+		return err
+	}
+	if policy == nil {
+		return errors.New("no policy")
+	}
+	// ReauthorizePolicy doesn't modify the supplied policy, so compute the digest
+	// here so that the policy can be verified and executed with the stored digest.
+	if _, err := policy.Compute(b.AuthKey.Name().Algorithm()); err != nil {
+		return fmt.Errorf("cannot compute digest: %w", err)
+	}
+	auth, err := ReauthorizePolicy(rand, &PolicyAuthorization{AuthKey: b.AuthKey, PolicyRef: b.PolicyRef}, policy, signer, opts)
+	if err != nil {
+		return err
+	}
+	b.Policies = append(b.Policies, AuthorizedPolicy{Policy: policy, Authorization: auth})
+	return nil
+}
+
+// checkAuthKey checks that the key associated with this bundle is valid.
+func (b *AuthorizedPolicyBundle) checkAuthKey() error {
+	if b.AuthKey == nil {
+		return errors.New("no authKey")
+	}
+	authName := b.AuthKey.Name()
+	if !authName.IsValid() || authName.Type() != tpm2.NameTypeDigest {
+		return errors.New("invalid authKey")
+	}
+	if !authName.Algorithm().Available() {
+		return fmt.Errorf("unavailable authKey name algorithm %v", authName.Algorithm())
+	}
+	return nil
+}
+
+// policyDigest validates the supplied policy and returns its digest for the name
+// algorithm of the key associated with this bundle.
+func (b *AuthorizedPolicyBundle) policyDigest(policy *AuthorizedPolicy) (tpm2.Digest, error) {
+	if policy.Policy == nil {
+		return nil, errors.New("no policy")
+	}
+	digest, err := policy.Policy.Validate(b.AuthKey.Name().Algorithm())
+	if err != nil {
+		return nil, fmt.Errorf("cannot validate policy: %w", err)
+	}
+	return digest, nil
+}
+
+// verifyAuthorization checks that the supplied policy with the supplied digest is
+// approved by the key associated with this bundle.
+func (b *AuthorizedPolicyBundle) verifyAuthorization(policy *AuthorizedPolicy, digest tpm2.Digest) error {
+	auth := policy.Authorization
+	if auth == nil || auth.AuthKey == nil || auth.Signature == nil {
+		return errors.New("no authorization")
+	}
+	authName := b.AuthKey.Name()
+	if !bytes.Equal(auth.AuthKey.Name(), authName) {
+		return errors.New("authorization is for a different key")
+	}
+	if !bytes.Equal(auth.PolicyRef, b.PolicyRef) {
+		return errors.New("authorization is for a different policy ref")
+	}
+	if !auth.Signature.SigAlg.IsValid() || auth.Signature.HashAlg() != authName.Algorithm() {
+		return errors.New("authorization signature digest algorithm does not match the key's name algorithm")
+	}
+
+	ok, err := auth.Verify(digest)
+	if err != nil {
+		return fmt.Errorf("cannot verify authorization: %w", err)
+	}
+	if !ok {
+		return errors.New("invalid authorization signature")
+	}
+	return nil
+}
+
+// Verify checks that every policy in this bundle is valid and is approved by a valid
+// signed authorization from the key associated with this bundle, for the policy ref
+// associated with this bundle.
+func (b *AuthorizedPolicyBundle) Verify() error {
+	if err := b.checkAuthKey(); err != nil {
+		return err
+	}
+
+	for i := range b.Policies {
+		policy := &b.Policies[i]
+		digest, err := b.policyDigest(policy)
+		if err == nil {
+			err = b.verifyAuthorization(policy, digest)
+		}
+		if err != nil {
+			return fmt.Errorf("cannot verify policy %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// Select returns the policy in this bundle with the supplied digest for the name
+// algorithm of the key associated with this bundle, after verifying its authorization.
+// The returned policy is a copy that contains the authorization, so that it can be
+// supplied to [Policy.Execute] as an authorized policy via [PolicyResources].
+func (b *AuthorizedPolicyBundle) Select(digest tpm2.Digest) (*Policy, error) {
+	if err := b.checkAuthKey(); err != nil {
+		return nil, err
+	}
+
+	for i := range b.Policies {
+		policy := &b.Policies[i]
+		policyDigest, err := b.policyDigest(policy)
+		if err != nil || !bytes.Equal(policyDigest, digest) {
+			continue
+		}
+		if err := b.verifyAuthorization(policy, policyDigest); err != nil {
+			return nil, fmt.Errorf("cannot verify policy %d: %w", i, err)
+		}
+
+		var out *Policy
+		if err := mu.CopyValue(&out, policy.Policy); err != nil {
+			return nil, fmt.Errorf("cannot copy policy: %w", err)
+		}
+
+		added := false
+		for j, auth := range out.policy.PolicyAuthorizations {
+			if bytes.Equal(auth.AuthKey.Name(), b.AuthKey.Name()) && bytes.Equal(auth.PolicyRef, b.PolicyRef) {
+				out.policy.PolicyAuthorizations[j] = *policy.Authorization
+				added = true
+				break
+			}
+		}
+		if !added {
+			out.policy.PolicyAuthorizations = append(out.policy.PolicyAuthorizations, *policy.Authorization)
+		}
+		return out, nil
+	}
+
+	return nil, fmt.Errorf("no policy with digest %x", digest)
+}
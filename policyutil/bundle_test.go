@@ -0,0 +1,250 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package policyutil_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/go-tpm2"
+	internal_testutil "github.com/canonical/go-tpm2/internal/testutil"
+	"github.com/canonical/go-tpm2/objectutil"
+	. "github.com/canonical/go-tpm2/policyutil"
+	"github.com/canonical/go-tpm2/testutil"
+)
+
+type bundleSuite struct {
+	testutil.TPMTest
+}
+
+var _ = Suite(&bundleSuite{})
+
+type bundleSuiteNoTPM struct{}
+
+var _ = Suite(&bundleSuiteNoTPM{})
+
+type testBundle struct {
+	key      *ecdsa.PrivateKey
+	bundle   *AuthorizedPolicyBundle
+	policies []*Policy
+}
+
+func newTestBundle(c *C) *testBundle {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+	authKey, err := objectutil.NewECCPublicKey(&key.PublicKey)
+	c.Assert(err, IsNil)
+
+	bundle := NewAuthorizedPolicyBundle(authKey, []byte("foo"))
+
+	var policies []*Policy
+	for _, code := range []tpm2.CommandCode{tpm2.CommandUnseal, tpm2.CommandNVChangeAuth} {
+		builder := NewPolicyBuilder()
+		c.Check(builder.RootBranch().PolicyCommandCode(code), IsNil)
+		c.Check(builder.RootBranch().PolicyAuthValue(), IsNil)
+		policy, err := builder.Policy()
+		c.Assert(err, IsNil)
+
+		c.Check(bundle.Add(rand.Reader, policy, key, crypto.SHA256), IsNil)
+		policies = append(policies, policy)
+	}
+
+	return &testBundle{key: key, bundle: bundle, policies: policies}
+}
+
+func (s *bundleSuiteNoTPM) TestAdd(c *C) {
+	b := newTestBundle(c)
+	c.Assert(b.bundle.Policies, internal_testutil.LenEquals, 2)
+
+	for i, policy := range b.bundle.Policies {
+		c.Check(policy.Policy, Equals, b.policies[i])
+		c.Check(policy.Authorization.AuthKey, DeepEquals, b.bundle.AuthKey)
+		c.Check(policy.Authorization.PolicyRef, DeepEquals, tpm2.Nonce("foo"))
+
+		digest, err := b.policies[i].Compute(tpm2.HashAlgorithmSHA256)
+		c.Check(err, IsNil)
+		ok, err := policy.Authorization.Verify(digest)
+		c.Check(err, IsNil)
+		c.Check(ok, internal_testutil.IsTrue)
+	}
+}
+
+func (s *bundleSuiteNoTPM) TestAddMismatchedOpts(c *C) {
+	b := newTestBundle(c)
+
+	builder := NewPolicyBuilder()
+	c.Check(builder.RootBranch().PolicyAuthValue(), IsNil)
+	policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+
+	c.Check(b.bundle.Add(rand.Reader, policy, b.key, crypto.SHA1), ErrorMatches, `mismatched authKey name and opts`)
+	c.Check(b.bundle.Policies, internal_testutil.LenEquals, 2)
+}
+
+func (s *bundleSuiteNoTPM) TestAddNoPolicy(c *C) {
+	b := newTestBundle(c)
+	c.Check(b.bundle.Add(rand.Reader, nil, b.key, crypto.SHA256), ErrorMatches, `no policy`)
+	c.Check(b.bundle.Policies, internal_testutil.LenEquals, 2)
+}
+
+func (s *bundleSuiteNoTPM) TestVerify(c *C) {
+	b := newTestBundle(c)
+	c.Check(b.bundle.Verify(), IsNil)
+}
+
+func (s *bundleSuiteNoTPM) TestVerifyEmpty(c *C) {
+	b := newTestBundle(c)
+	b.bundle.Policies = nil
+	c.Check(b.bundle.Verify(), IsNil)
+}
+
+func (s *bundleSuiteNoTPM) TestVerifyNoAuthKey(c *C) {
+	bundle := NewAuthorizedPolicyBundle(nil, nil)
+	c.Check(bundle.Verify(), ErrorMatches, `no authKey`)
+}
+
+func (s *bundleSuiteNoTPM) TestVerifyTamperedAuthorization(c *C) {
+	b := newTestBundle(c)
+
+	// Swap the authorizations so that each one signs the other policy.
+	b.bundle.Policies[0].Authorization, b.bundle.Policies[1].Authorization = b.bundle.Policies[1].Authorization, b.bundle.Policies[0].Authorization
+	c.Check(b.bundle.Verify(), ErrorMatches, `cannot verify policy 0: invalid authorization signature`)
+}
+
+func (s *bundleSuiteNoTPM) TestVerifyTamperedSignature(c *C) {
+	b := newTestBundle(c)
+
+	sig := b.bundle.Policies[1].Authorization.Signature.Signature.ECDSA
+	sig.SignatureS[0] ^= 0xff
+	c.Check(b.bundle.Verify(), ErrorMatches, `cannot verify policy 1: invalid authorization signature`)
+}
+
+func (s *bundleSuiteNoTPM) TestVerifyTamperedPolicy(c *C) {
+	b := newTestBundle(c)
+
+	// Replace a policy with one that has a different digest.
+	builder := NewPolicyBuilder()
+	c.Check(builder.RootBranch().PolicyAuthValue(), IsNil)
+	policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+	_, err = policy.Compute(tpm2.HashAlgorithmSHA256)
+	c.Check(err, IsNil)
+	b.bundle.Policies[1].Policy = policy
+
+	c.Check(b.bundle.Verify(), ErrorMatches, `cannot verify policy 1: invalid authorization signature`)
+}
+
+func (s *bundleSuiteNoTPM) TestVerifyDifferentKey(c *C) {
+	b := newTestBundle(c)
+	other := newTestBundle(c)
+
+	b.bundle.Policies[1] = other.bundle.Policies[1]
+	c.Check(b.bundle.Verify(), ErrorMatches, `cannot verify policy 1: authorization is for a different key`)
+}
+
+func (s *bundleSuiteNoTPM) TestVerifyDifferentPolicyRef(c *C) {
+	b := newTestBundle(c)
+	b.bundle.PolicyRef = []byte("bar")
+	c.Check(b.bundle.Verify(), ErrorMatches, `cannot verify policy 0: authorization is for a different policy ref`)
+}
+
+func (s *bundleSuiteNoTPM) TestVerifyMissingAuthorization(c *C) {
+	b := newTestBundle(c)
+	b.bundle.Policies[0].Authorization = nil
+	c.Check(b.bundle.Verify(), ErrorMatches, `cannot verify policy 0: no authorization`)
+}
+
+func (s *bundleSuiteNoTPM) TestVerifyMissingDigest(c *C) {
+	b := newTestBundle(c)
+
+	builder := NewPolicyBuilder()
+	c.Check(builder.RootBranch().PolicyCommandCode(tpm2.CommandUnseal), IsNil)
+	c.Check(builder.RootBranch().PolicyAuthValue(), IsNil)
+	policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+	b.bundle.Policies[0].Policy = policy
+
+	err = b.bundle.Verify()
+	c.Check(err, ErrorMatches, `cannot verify policy 0: cannot validate policy: missing digest for session algorithm`)
+	c.Check(err, internal_testutil.ErrorIs, ErrMissingDigest)
+}
+
+func (s *bundleSuiteNoTPM) TestSelect(c *C) {
+	b := newTestBundle(c)
+
+	digest, err := b.policies[1].Compute(tpm2.HashAlgorithmSHA256)
+	c.Check(err, IsNil)
+
+	policy, err := b.bundle.Select(digest)
+	c.Assert(err, IsNil)
+	c.Check(policy, Not(Equals), b.policies[1])
+
+	selectedDigest, err := policy.Validate(tpm2.HashAlgorithmSHA256)
+	c.Check(err, IsNil)
+	c.Check(selectedDigest, DeepEquals, digest)
+}
+
+func (s *bundleSuiteNoTPM) TestSelectNotFound(c *C) {
+	b := newTestBundle(c)
+
+	_, err := b.bundle.Select(make(tpm2.Digest, 32))
+	c.Check(err, ErrorMatches, `no policy with digest 0000000000000000000000000000000000000000000000000000000000000000`)
+}
+
+func (s *bundleSuiteNoTPM) TestSelectTamperedAuthorization(c *C) {
+	b := newTestBundle(c)
+	b.bundle.Policies[0].Authorization, b.bundle.Policies[1].Authorization = b.bundle.Policies[1].Authorization, b.bundle.Policies[0].Authorization
+
+	digest, err := b.policies[1].Compute(tpm2.HashAlgorithmSHA256)
+	c.Check(err, IsNil)
+
+	_, err = b.bundle.Select(digest)
+	c.Check(err, ErrorMatches, `cannot verify policy 1: invalid authorization signature`)
+}
+
+func (s *bundleSuiteNoTPM) TestSelectIgnoresOtherInvalidPolicies(c *C) {
+	b := newTestBundle(c)
+	b.bundle.Policies[0].Authorization = nil
+
+	digest, err := b.policies[1].Compute(tpm2.HashAlgorithmSHA256)
+	c.Check(err, IsNil)
+
+	_, err = b.bundle.Select(digest)
+	c.Check(err, IsNil)
+}
+
+func (s *bundleSuite) TestSelectAndExecute(c *C) {
+	b := newTestBundle(c)
+
+	builder := NewPolicyBuilder()
+	c.Check(builder.RootBranch().PolicyAuthorize(b.bundle.PolicyRef, b.bundle.AuthKey), IsNil)
+	policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+	expectedDigest, err := policy.Compute(tpm2.HashAlgorithmSHA256)
+	c.Check(err, IsNil)
+
+	approvedPolicy, err := b.policies[1].Compute(tpm2.HashAlgorithmSHA256)
+	c.Check(err, IsNil)
+
+	authorizedPolicy, err := b.bundle.Select(approvedPolicy)
+	c.Assert(err, IsNil)
+
+	session := s.StartAuthSession(c, nil, nil, tpm2.SessionTypePolicy, nil, tpm2.HashAlgorithmSHA256)
+
+	resources := &PolicyResources{
+		AuthorizedPolicies: []*Policy{authorizedPolicy},
+	}
+	result, err := policy.Execute(NewTPMConnection(s.TPM), session, NewTPMPolicyResourceLoader(s.TPM, resources, nil), nil)
+	c.Assert(err, IsNil)
+	c.Check(result.AuthValueNeeded, internal_testutil.IsTrue)
+
+	digest, err := s.TPM.PolicyGetDigest(session)
+	c.Check(err, IsNil)
+	c.Check(digest, DeepEquals, expectedDigest)
+}
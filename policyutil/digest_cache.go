@@ -0,0 +1,137 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package policyutil
+
+import (
+	"container/list"
+	"crypto"
+	_ "crypto/sha256"
+	"fmt"
+	"sync"
+
+	"github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/mu"
+)
+
+type policyDigestCacheKey [32]byte
+
+type policyDigestCacheEntry struct {
+	key    policyDigestCacheKey
+	digest tpm2.Digest
+}
+
+// PolicyDigestCache is a least-recently-used cache of computed branch digests. It can be
+// supplied to [Policy.Execute] via [PolicyExecuteParams] so that the digests of branches
+// that don't have a stored digest for the session algorithm are computed once and then
+// reused by subsequent executions, rather than causing [ErrMissingDigest] to be returned.
+//
+// Entries are keyed by the session algorithm, the session digest at the start of the
+// branch node and the contents of the branch, so a single cache can be shared between
+// executions of different policies and with different sessions. It is safe to use from
+// multiple goroutines.
+type PolicyDigestCache struct {
+	mu      sync.Mutex
+	maxSize int
+	entries map[policyDigestCacheKey]*list.Element
+	lru     *list.List // front is the most recently used entry
+}
+
+// NewPolicyDigestCache returns a new cache of computed branch digests which holds up to
+// the specified number of entries. This will panic if maxSize is less than 1.
+func NewPolicyDigestCache(maxSize int) *PolicyDigestCache {
+	if maxSize < 1 {
+		panic("invalid cache size")
+	}
+	return &PolicyDigestCache{
+		maxSize: maxSize,
+		entries: make(map[policyDigestCacheKey]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// Len returns the number of digests currently held by this cache.
+func (c *PolicyDigestCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+func (c *PolicyDigestCache) get(key policyDigestCacheKey) (tpm2.Digest, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(e)
+	return append(tpm2.Digest(nil), e.Value.(*policyDigestCacheEntry).digest...), true
+}
+
+func (c *PolicyDigestCache) add(key policyDigestCacheKey, digest tpm2.Digest) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[key]; ok {
+		c.lru.MoveToFront(e)
+		return
+	}
+
+	c.entries[key] = c.lru.PushFront(&policyDigestCacheEntry{
+		key:    key,
+		digest: append(tpm2.Digest(nil), digest...)})
+	for c.lru.Len() > c.maxSize {
+		e := c.lru.Back()
+		c.lru.Remove(e)
+		delete(c.entries, e.Value.(*policyDigestCacheEntry).key)
+	}
+}
+
+// branchDigest returns the digest for the supplied branch elements for the specified
+// algorithm, starting from the supplied session digest. The digest is obtained from
+// the cache if it is present, else it is computed and added to the cache.
+func (c *PolicyDigestCache) branchDigest(alg tpm2.HashAlgorithmId, startDigest tpm2.Digest, elements policyElements) (tpm2.Digest, error) {
+	h := crypto.SHA256.New()
+	if _, err := mu.MarshalToWriter(h, alg, startDigest, elements); err != nil {
+		return nil, fmt.Errorf("cannot compute cache key: %w", err)
+	}
+	var key policyDigestCacheKey
+	copy(key[:], h.Sum(nil))
+
+	if digest, ok := c.get(key); ok {
+		return digest, nil
+	}
+
+	digest, err := computeBranchDigest(alg, startDigest, elements)
+	if err != nil {
+		return nil, err
+	}
+	c.add(key, digest)
+	return digest, nil
+}
+
+// computeBranchDigest computes the digest for the supplied branch elements for the
+// specified algorithm, starting from the supplied session digest. The supplied elements
+// are not modified.
+func computeBranchDigest(alg tpm2.HashAlgorithmId, startDigest tpm2.Digest, elements policyElements) (tpm2.Digest, error) {
+	var elementsCopy policyElements
+	if err := mu.CopyValue(&elementsCopy, elements); err != nil {
+		return nil, fmt.Errorf("cannot make temporary copy of branch: %w", err)
+	}
+
+	digest := &taggedHash{HashAlg: alg, Digest: append(tpm2.Digest(nil), startDigest...)}
+
+	runner := newPolicyRunner(
+		newComputePolicySession(digest),
+		new(nullTickets),
+		new(mockPolicyResourceLoader),
+		func(runner *policyRunner) policyRunnerHelper { return newComputePolicyHelper(runner, nil) },
+	)
+	if err := runner.run(elementsCopy); err != nil {
+		return nil, err
+	}
+
+	return digest.Digest, nil
+}
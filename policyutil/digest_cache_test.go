@@ -0,0 +1,209 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package policyutil_test
+
+import (
+	_ "crypto/sha1"
+	_ "crypto/sha256"
+	"testing"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/go-tpm2"
+	internal_testutil "github.com/canonical/go-tpm2/internal/testutil"
+	"github.com/canonical/go-tpm2/mu"
+	. "github.com/canonical/go-tpm2/policyutil"
+)
+
+type digestCacheSuite struct{}
+
+var _ = Suite(&digestCacheSuite{})
+
+func newDigestCacheTestPolicy(c *C, code tpm2.CommandCode) *Policy {
+	builder := NewPolicyBuilder()
+	c.Check(builder.RootBranch().PolicyAuthValue(), IsNil)
+
+	node := builder.RootBranch().AddBranchNode()
+	c.Check(node.AddBranch("").PolicyCpHash(code, []Named{tpm2.MakeHandleName(tpm2.HandleOwner)}), IsNil)
+	c.Check(node.AddBranch("").PolicySecret(tpm2.MakeHandleName(tpm2.HandleOwner), []byte("foo")), IsNil)
+
+	c.Check(builder.RootBranch().PolicyCommandCode(code), IsNil)
+
+	policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+	return policy
+}
+
+func (s *digestCacheSuite) TestNewPolicyDigestCacheInvalidSize(c *C) {
+	c.Check(func() { NewPolicyDigestCache(0) }, PanicMatches, `invalid cache size`)
+}
+
+func (s *digestCacheSuite) testBranchDigest(c *C, alg tpm2.HashAlgorithmId) {
+	policy := newDigestCacheTestPolicy(c, tpm2.CommandNVChangeAuth)
+	expectedDigest, err := policy.Compute(alg)
+	c.Assert(err, IsNil)
+
+	startDigest := make(tpm2.Digest, alg.Size())
+
+	fresh, err := ComputeBranchDigest(alg, startDigest, policy)
+	c.Check(err, IsNil)
+	c.Check(fresh, DeepEquals, expectedDigest)
+
+	cache := NewPolicyDigestCache(8)
+
+	digest, err := cache.BranchDigest(alg, startDigest, policy)
+	c.Check(err, IsNil)
+	c.Check(digest, DeepEquals, fresh)
+	c.Check(cache.Len(), Equals, 1)
+
+	digest, err = cache.BranchDigest(alg, startDigest, policy)
+	c.Check(err, IsNil)
+	c.Check(digest, DeepEquals, fresh)
+	c.Check(cache.Len(), Equals, 1)
+}
+
+func (s *digestCacheSuite) TestBranchDigestSHA256(c *C) {
+	s.testBranchDigest(c, tpm2.HashAlgorithmSHA256)
+}
+
+func (s *digestCacheSuite) TestBranchDigestSHA1(c *C) {
+	s.testBranchDigest(c, tpm2.HashAlgorithmSHA1)
+}
+
+func (s *digestCacheSuite) TestBranchDigestDifferentAlgorithms(c *C) {
+	policy := newDigestCacheTestPolicy(c, tpm2.CommandNVChangeAuth)
+
+	cache := NewPolicyDigestCache(8)
+
+	digest, err := cache.BranchDigest(tpm2.HashAlgorithmSHA1, make(tpm2.Digest, 20), policy)
+	c.Check(err, IsNil)
+	c.Check(digest, internal_testutil.LenEquals, 20)
+
+	digest, err = cache.BranchDigest(tpm2.HashAlgorithmSHA256, make(tpm2.Digest, 32), policy)
+	c.Check(err, IsNil)
+	c.Check(digest, internal_testutil.LenEquals, 32)
+
+	c.Check(cache.Len(), Equals, 2)
+}
+
+func (s *digestCacheSuite) TestBranchDigestDifferentStartDigests(c *C) {
+	policy := newDigestCacheTestPolicy(c, tpm2.CommandNVChangeAuth)
+
+	cache := NewPolicyDigestCache(8)
+
+	startDigest1 := make(tpm2.Digest, 32)
+	digest1, err := cache.BranchDigest(tpm2.HashAlgorithmSHA256, startDigest1, policy)
+	c.Check(err, IsNil)
+
+	startDigest2 := make(tpm2.Digest, 32)
+	startDigest2[0] = 1
+	digest2, err := cache.BranchDigest(tpm2.HashAlgorithmSHA256, startDigest2, policy)
+	c.Check(err, IsNil)
+	c.Check(digest2, Not(DeepEquals), digest1)
+
+	expectedDigest2, err := ComputeBranchDigest(tpm2.HashAlgorithmSHA256, startDigest2, policy)
+	c.Check(err, IsNil)
+	c.Check(digest2, DeepEquals, expectedDigest2)
+
+	c.Check(cache.Len(), Equals, 2)
+}
+
+func (s *digestCacheSuite) TestBranchDigestEviction(c *C) {
+	policies := []*Policy{
+		newDigestCacheTestPolicy(c, tpm2.CommandNVChangeAuth),
+		newDigestCacheTestPolicy(c, tpm2.CommandObjectChangeAuth),
+		newDigestCacheTestPolicy(c, tpm2.CommandUnseal),
+	}
+
+	cache := NewPolicyDigestCache(2)
+	startDigest := make(tpm2.Digest, 32)
+
+	for _, policy := range policies {
+		_, err := cache.BranchDigest(tpm2.HashAlgorithmSHA256, startDigest, policy)
+		c.Check(err, IsNil)
+	}
+	c.Check(cache.Len(), Equals, 2)
+
+	for _, policy := range policies {
+		expectedDigest, err := policy.Compute(tpm2.HashAlgorithmSHA256)
+		c.Check(err, IsNil)
+
+		digest, err := cache.BranchDigest(tpm2.HashAlgorithmSHA256, startDigest, policy)
+		c.Check(err, IsNil)
+		c.Check(digest, DeepEquals, expectedDigest)
+		c.Check(cache.Len(), Equals, 2)
+	}
+}
+
+func (s *digestCacheSuite) TestBranchDigestDoesNotModifyPolicy(c *C) {
+	policy := newDigestCacheTestPolicy(c, tpm2.CommandNVChangeAuth)
+	expected := mu.MustMarshalToBytes(policy)
+
+	cache := NewPolicyDigestCache(8)
+	_, err := cache.BranchDigest(tpm2.HashAlgorithmSHA256, make(tpm2.Digest, 32), policy)
+	c.Check(err, IsNil)
+
+	c.Check(mu.MustMarshalToBytes(policy), DeepEquals, expected)
+}
+
+func (s *digestCacheSuite) TestBranchDigestReturnsCopy(c *C) {
+	policy := newDigestCacheTestPolicy(c, tpm2.CommandNVChangeAuth)
+
+	cache := NewPolicyDigestCache(8)
+	startDigest := make(tpm2.Digest, 32)
+
+	digest, err := cache.BranchDigest(tpm2.HashAlgorithmSHA256, startDigest, policy)
+	c.Check(err, IsNil)
+	expected := append(tpm2.Digest(nil), digest...)
+	digest[0] ^= 0xff
+
+	digest, err = cache.BranchDigest(tpm2.HashAlgorithmSHA256, startDigest, policy)
+	c.Check(err, IsNil)
+	c.Check(digest, DeepEquals, expected)
+}
+
+func newDigestCacheBenchmarkPolicy(b *testing.B) *Policy {
+	builder := NewPolicyBuilder()
+	node := builder.RootBranch().AddBranchNode()
+	for i := 0; i < 8; i++ {
+		branch := node.AddBranch("")
+		if err := branch.PolicyPCR(tpm2.PCRValues{tpm2.HashAlgorithmSHA256: {i: make(tpm2.Digest, 32)}}); err != nil {
+			b.Fatal(err)
+		}
+		if err := branch.PolicyCommandCode(tpm2.CommandUnseal); err != nil {
+			b.Fatal(err)
+		}
+	}
+	policy, err := builder.Policy()
+	if err != nil {
+		b.Fatal(err)
+	}
+	return policy
+}
+
+func BenchmarkBranchDigestUncached(b *testing.B) {
+	policy := newDigestCacheBenchmarkPolicy(b)
+	startDigest := make(tpm2.Digest, 32)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := ComputeBranchDigest(tpm2.HashAlgorithmSHA256, startDigest, policy); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkBranchDigestCached(b *testing.B) {
+	policy := newDigestCacheBenchmarkPolicy(b)
+	startDigest := make(tpm2.Digest, 32)
+	cache := NewPolicyDigestCache(8)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := cache.BranchDigest(tpm2.HashAlgorithmSHA256, startDigest, policy); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package policyutil
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/canonical/go-tpm2"
+)
+
+// CanDuplicate indicates whether the object with the supplied public area can be
+// duplicated to the new parent with the supplied name using TPM2_Duplicate, with
+// a session that executes the supplied policy. The policy must be the authorization
+// policy of the object.
+//
+// The object can't be duplicated if it has the AttrFixedTPM or AttrFixedParent
+// attributes set. TPM2_Duplicate always requires authorization with a policy session
+// that has executed TPM2_PolicyCommandCode or TPM2_PolicyDuplicationSelect, so this
+// also checks that the policy has at least one branch that permits TPM2_Duplicate
+// and that doesn't restrict the new parent to a different object with
+// TPM2_PolicyDuplicationSelect or TPM2_PolicyNameHash.
+//
+// Other conditions in the policy, such as TPM2_PolicyPCR or TPM2_PolicySecret
+// assertions, are not checked. Authorized policies are not inspected either, so a
+// branch that relies on an authorized policy to permit TPM2_Duplicate is not
+// considered.
+func CanDuplicate(pub *tpm2.Public, policy *Policy, newParent tpm2.Name) (bool, error) {
+	if pub == nil {
+		return false, errors.New("no public area")
+	}
+	if policy == nil {
+		return false, errors.New("no policy")
+	}
+	if !pub.NameAlg.Available() {
+		return false, fmt.Errorf("name algorithm %v is not available", pub.NameAlg)
+	}
+
+	if pub.Attrs&(tpm2.AttrFixedTPM|tpm2.AttrFixedParent) != 0 {
+		return false, nil
+	}
+
+	computed, err := policy.WithComputedDigests(pub.NameAlg)
+	if err != nil {
+		return false, fmt.Errorf("cannot compute policy: %w", err)
+	}
+	digest, err := computed.Compute(pub.NameAlg)
+	if err != nil {
+		return false, fmt.Errorf("cannot compute policy: %w", err)
+	}
+	if !bytes.Equal(digest, pub.AuthPolicy) {
+		return false, errors.New("policy is not the authorization policy of the object")
+	}
+
+	expectedNameHash, err := ComputeNameHash(pub.NameAlg, pub.Name(), newParent)
+	if err != nil {
+		return false, fmt.Errorf("cannot compute nameHash: %w", err)
+	}
+
+	details, err := computed.Details(pub.NameAlg, "")
+	if err != nil {
+		return false, fmt.Errorf("cannot obtain policy details: %w", err)
+	}
+
+	for _, d := range details {
+		if !d.IsValid() {
+			continue
+		}
+		// The branch details record TPM_CC_PolicyDuplicationSelect as the command
+		// code for a TPM2_PolicyDuplicationSelect assertion, although it permits
+		// TPM2_Duplicate in the same way as TPM2_PolicyCommandCode does.
+		code, set := d.CommandCode()
+		if !set || (code != tpm2.CommandDuplicate && code != tpm2.CommandPolicyDuplicationSelect) {
+			continue
+		}
+		if nameHash, set := d.NameHash(); set && !bytes.Equal(nameHash, expectedNameHash) {
+			continue
+		}
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// DuplicationSelectDigest computes the policy digest for a policy that consists of a
+// single TPM2_PolicyDuplicationSelect assertion with the supplied object and new parent
+// names, using the specified digest algorithm. The object name is only required if
+// includeObject is true. This can be used to compute the authorization policy for an
+// object that can only be duplicated to a specific new parent without having to load
+// the new parent.
+func DuplicationSelectDigest(alg tpm2.HashAlgorithmId, objectName, newParentName tpm2.Name, includeObject bool) (tpm2.Digest, error) {
+	a, err := NewDigestAccumulator(alg)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.PolicyDuplicationSelect(objectName, newParentName, includeObject); err != nil {
+		return nil, err
+	}
+	return a.Digest(), nil
+}
@@ -0,0 +1,210 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package policyutil_test
+
+import (
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/go-tpm2"
+	internal_testutil "github.com/canonical/go-tpm2/internal/testutil"
+	"github.com/canonical/go-tpm2/mu"
+	"github.com/canonical/go-tpm2/objectutil"
+	. "github.com/canonical/go-tpm2/policyutil"
+	"github.com/canonical/go-tpm2/testutil"
+)
+
+type duplicationSuite struct {
+	testutil.TPMTest
+}
+
+var _ = Suite(&duplicationSuite{})
+
+type duplicationSuiteNoTPM struct{}
+
+var _ = Suite(&duplicationSuiteNoTPM{})
+
+type testCanDuplicateData struct {
+	mode      objectutil.DuplicationMode
+	build     func(*PolicyBuilderBranch, tpm2.Name)
+	newParent tpm2.Name
+
+	expected bool
+}
+
+func (s *duplicationSuiteNoTPM) testCanDuplicate(c *C, data *testCanDuplicateData) {
+	object := objectutil.NewECCKeyTemplate(objectutil.UsageSign, objectutil.WithDuplicationMode(data.mode))
+
+	// The object name depends on the policy digest, so compute this first
+	// with a placeholder name. This doesn't affect the policy digest because
+	// TPM2_PolicyDuplicationSelect assertions don't include the object name.
+	builder := NewPolicyBuilder()
+	data.build(builder.RootBranch(), object.Name())
+	policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+	object.AuthPolicy, err = policy.Compute(object.NameAlg)
+	c.Assert(err, IsNil)
+
+	builder = NewPolicyBuilder()
+	data.build(builder.RootBranch(), object.Name())
+	policy, err = builder.Policy()
+	c.Assert(err, IsNil)
+	digest, err := policy.Compute(object.NameAlg)
+	c.Assert(err, IsNil)
+	c.Assert(digest, DeepEquals, object.AuthPolicy)
+
+	ok, err := CanDuplicate(object, policy, data.newParent)
+	c.Check(err, IsNil)
+	c.Check(ok, Equals, data.expected)
+}
+
+func (s *duplicationSuiteNoTPM) TestCanDuplicateDuplicationSelect(c *C) {
+	newParent := objectutil.NewRSAStorageKeyTemplate().Name()
+	s.testCanDuplicate(c, &testCanDuplicateData{
+		mode: objectutil.DuplicationRoot,
+		build: func(branch *PolicyBuilderBranch, name tpm2.Name) {
+			c.Check(branch.PolicyDuplicationSelect(name, newParent, false), IsNil)
+		},
+		newParent: newParent,
+		expected:  true})
+}
+
+func (s *duplicationSuiteNoTPM) TestCanDuplicateCommandCode(c *C) {
+	s.testCanDuplicate(c, &testCanDuplicateData{
+		mode: objectutil.DuplicationRoot,
+		build: func(branch *PolicyBuilderBranch, _ tpm2.Name) {
+			c.Check(branch.PolicyCommandCode(tpm2.CommandDuplicate), IsNil)
+		},
+		newParent: objectutil.NewRSAStorageKeyTemplate().Name(),
+		expected:  true})
+}
+
+func (s *duplicationSuiteNoTPM) TestCanDuplicateBranches(c *C) {
+	newParent := objectutil.NewRSAStorageKeyTemplate().Name()
+	s.testCanDuplicate(c, &testCanDuplicateData{
+		mode: objectutil.DuplicationRoot,
+		build: func(branch *PolicyBuilderBranch, name tpm2.Name) {
+			node := branch.AddBranchNode()
+			b1 := node.AddBranch("sign")
+			c.Check(b1.PolicyCommandCode(tpm2.CommandSign), IsNil)
+			b2 := node.AddBranch("duplicate")
+			c.Check(b2.PolicyDuplicationSelect(name, newParent, false), IsNil)
+		},
+		newParent: newParent,
+		expected:  true})
+}
+
+func (s *duplicationSuiteNoTPM) TestCanDuplicateDifferentParent(c *C) {
+	newParent := objectutil.NewRSAStorageKeyTemplate().Name()
+	s.testCanDuplicate(c, &testCanDuplicateData{
+		mode: objectutil.DuplicationRoot,
+		build: func(branch *PolicyBuilderBranch, name tpm2.Name) {
+			c.Check(branch.PolicyDuplicationSelect(name, newParent, false), IsNil)
+		},
+		newParent: objectutil.NewECCStorageKeyTemplate().Name(),
+		expected:  false})
+}
+
+func (s *duplicationSuiteNoTPM) TestCanDuplicateNoDuplicateBranch(c *C) {
+	s.testCanDuplicate(c, &testCanDuplicateData{
+		mode: objectutil.DuplicationRoot,
+		build: func(branch *PolicyBuilderBranch, _ tpm2.Name) {
+			c.Check(branch.PolicyCommandCode(tpm2.CommandSign), IsNil)
+		},
+		newParent: objectutil.NewRSAStorageKeyTemplate().Name(),
+		expected:  false})
+}
+
+func (s *duplicationSuiteNoTPM) TestCanDuplicateNoCommandCode(c *C) {
+	// TPM2_Duplicate requires the session to have a command code.
+	s.testCanDuplicate(c, &testCanDuplicateData{
+		mode: objectutil.DuplicationRoot,
+		build: func(branch *PolicyBuilderBranch, _ tpm2.Name) {
+			c.Check(branch.PolicyAuthValue(), IsNil)
+		},
+		newParent: objectutil.NewRSAStorageKeyTemplate().Name(),
+		expected:  false})
+}
+
+func (s *duplicationSuiteNoTPM) TestCanDuplicateFixedParent(c *C) {
+	s.testCanDuplicate(c, &testCanDuplicateData{
+		mode: objectutil.FixedParent,
+		build: func(branch *PolicyBuilderBranch, _ tpm2.Name) {
+			c.Check(branch.PolicyCommandCode(tpm2.CommandDuplicate), IsNil)
+		},
+		newParent: objectutil.NewRSAStorageKeyTemplate().Name(),
+		expected:  false})
+}
+
+func (s *duplicationSuiteNoTPM) TestCanDuplicateWrongPolicy(c *C) {
+	object := objectutil.NewECCKeyTemplate(objectutil.UsageSign, objectutil.WithDuplicationMode(objectutil.DuplicationRoot))
+
+	builder := NewPolicyBuilder()
+	c.Check(builder.RootBranch().PolicyCommandCode(tpm2.CommandDuplicate), IsNil)
+	policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+
+	ok, err := CanDuplicate(object, policy, objectutil.NewRSAStorageKeyTemplate().Name())
+	c.Check(err, ErrorMatches, `policy is not the authorization policy of the object`)
+	c.Check(ok, internal_testutil.IsFalse)
+}
+
+type testDuplicationSelectDigestData struct {
+	alg           tpm2.HashAlgorithmId
+	objectName    tpm2.Name
+	newParentName tpm2.Name
+	includeObject bool
+}
+
+func (s *duplicationSuite) testDuplicationSelectDigest(c *C, data *testDuplicationSelectDigestData) {
+	digest, err := DuplicationSelectDigest(data.alg, data.objectName, data.newParentName, data.includeObject)
+	c.Assert(err, IsNil)
+
+	session := s.StartAuthSession(c, nil, nil, tpm2.SessionTypeTrial, nil, data.alg)
+	c.Check(s.TPM.PolicyDuplicationSelect(session, data.objectName, data.newParentName, data.includeObject), IsNil)
+	expected, err := s.TPM.PolicyGetDigest(session)
+	c.Check(err, IsNil)
+	c.Check(digest, DeepEquals, expected)
+}
+
+func (s *duplicationSuite) TestDuplicationSelectDigest(c *C) {
+	s.testDuplicationSelectDigest(c, &testDuplicationSelectDigestData{
+		alg:           tpm2.HashAlgorithmSHA256,
+		objectName:    objectutil.NewECCKeyTemplate(objectutil.UsageSign).Name(),
+		newParentName: objectutil.NewRSAStorageKeyTemplate().Name()})
+}
+
+func (s *duplicationSuite) TestDuplicationSelectDigestIncludeObject(c *C) {
+	s.testDuplicationSelectDigest(c, &testDuplicationSelectDigestData{
+		alg:           tpm2.HashAlgorithmSHA256,
+		objectName:    objectutil.NewECCKeyTemplate(objectutil.UsageSign).Name(),
+		newParentName: objectutil.NewRSAStorageKeyTemplate().Name(),
+		includeObject: true})
+}
+
+func (s *duplicationSuite) TestDuplicationSelectDigestSHA1(c *C) {
+	s.testDuplicationSelectDigest(c, &testDuplicationSelectDigestData{
+		alg:           tpm2.HashAlgorithmSHA1,
+		objectName:    objectutil.NewECCKeyTemplate(objectutil.UsageSign).Name(),
+		newParentName: objectutil.NewRSAStorageKeyTemplate().Name(),
+		includeObject: true})
+}
+
+func (s *duplicationSuiteNoTPM) TestDuplicationSelectDigest(c *C) {
+	objectName := objectutil.NewECCKeyTemplate(objectutil.UsageSign).Name()
+	newParentName := objectutil.NewRSAStorageKeyTemplate().Name()
+
+	digest, err := DuplicationSelectDigest(tpm2.HashAlgorithmSHA256, objectName, newParentName, true)
+	c.Check(err, IsNil)
+
+	h := tpm2.HashAlgorithmSHA256.NewHash()
+	h.Write(make([]byte, 32))
+	mu.MustMarshalToWriter(h, tpm2.CommandPolicyDuplicationSelect, mu.Raw(objectName), mu.Raw(newParentName), true)
+	c.Check(digest, DeepEquals, tpm2.Digest(h.Sum(nil)))
+}
+
+func (s *duplicationSuiteNoTPM) TestDuplicationSelectDigestInvalidNewParent(c *C) {
+	_, err := DuplicationSelectDigest(tpm2.HashAlgorithmSHA256, nil, tpm2.Name{0x00, 0x0b, 0x01}, false)
+	c.Check(err, ErrorMatches, `invalid newParent name`)
+}
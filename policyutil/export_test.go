@@ -7,15 +7,22 @@ package policyutil
 import "github.com/canonical/go-tpm2"
 
 var (
-	NewPolicyOrTree         = newPolicyOrTree
-	NewComputePolicySession = newComputePolicySession
+	NewPolicyOrTree          = newPolicyOrTree
+	NewComputePolicySession  = newComputePolicySession
+	NewPcrCacheTpmConnection = newPcrCacheTpmConnection
+	NewPolicySessionPool     = newPolicySessionPool
+	NewTpmPolicySession      = newTpmPolicySession
+	ValidatePCRSelection     = validatePCRSelection
 )
 
 type PcrValue = pcrValue
 type PcrValueList = pcrValueList
+type PolicyBranchDescription = policyBranchDescription
 type PolicyBranchName = policyBranchName
 type PolicyBranchPath = policyBranchPath
 type PolicyOrTree = policyOrTree
+type PolicySession = policySession
+type PolicySessionPool = policySessionPool
 type PolicyTask = policyTask
 type TaggedHash = taggedHash
 type TaggedHashList = taggedHashList
@@ -36,10 +43,34 @@ func (t *PolicyOrTree) SelectBranch(i int) []tpm2.DigestList {
 	return t.selectBranch(i)
 }
 
+func (p *PolicySessionPool) Acquire(alg tpm2.HashAlgorithmId) (tpm2.SessionContext, error) {
+	return p.acquire(alg)
+}
+
+func (p *PolicySessionPool) Release(session tpm2.SessionContext) {
+	p.release(session)
+}
+
+func (p *PolicySessionPool) Flush() {
+	p.flush()
+}
+
+func (u *PolicySessionUsage) MatchesBranch(alg tpm2.HashAlgorithmId, d *PolicyBranchDetails) (bool, error) {
+	return u.matchesBranch(alg, d)
+}
+
 func (p *Policy) ComputeForDigest(digest *TaggedHash) error {
 	return p.computeForDigest(digest)
 }
 
+func (c *PolicyDigestCache) BranchDigest(alg tpm2.HashAlgorithmId, startDigest tpm2.Digest, policy *Policy) (tpm2.Digest, error) {
+	return c.branchDigest(alg, startDigest, policy.policy.Policy)
+}
+
+func ComputeBranchDigest(alg tpm2.HashAlgorithmId, startDigest tpm2.Digest, policy *Policy) (tpm2.Digest, error) {
+	return computeBranchDigest(alg, startDigest, policy.policy.Policy)
+}
+
 func NewMockPolicyNVElement(nvIndex *tpm2.NVPublic, operandB tpm2.Operand, offset uint16, operation tpm2.ArithmeticOp) *policyElement {
 	return &policyElement{
 		Type: tpm2.CommandPolicyNV,
@@ -165,6 +196,20 @@ func NewMockPolicyNvWrittenElement(writtenSet bool) *policyElement {
 			NvWritten: &policyNvWrittenElement{WrittenSet: writtenSet}}}
 }
 
+func NewMockPolicyTemplateElement(templateHash tpm2.Digest) *policyElement {
+	return &policyElement{
+		Type: tpm2.CommandPolicyTemplate,
+		Details: &policyElementDetails{
+			Template: &policyTemplateElement{TemplateHash: templateHash}}}
+}
+
+func NewMockPolicyAuthorizeNVElement(nvIndex *tpm2.NVPublic) *policyElement {
+	return &policyElement{
+		Type: tpm2.CommandPolicyAuthorizeNV,
+		Details: &policyElementDetails{
+			AuthorizeNV: &policyAuthorizeNVElement{NvIndex: nvIndex}}}
+}
+
 func NewMockPolicy(digests taggedHashList, authorizations []PolicyAuthorization, elements ...*policyElement) *Policy {
 	return &Policy{
 		policy: policy{
@@ -174,3 +219,11 @@ func NewMockPolicy(digests taggedHashList, authorizations []PolicyAuthorization,
 		},
 	}
 }
+
+func MockTreeWalkerMaxPaths(n int) (restore func()) {
+	orig := treeWalkerMaxPaths
+	treeWalkerMaxPaths = n
+	return func() {
+		treeWalkerMaxPaths = orig
+	}
+}
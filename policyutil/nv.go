@@ -0,0 +1,115 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package policyutil
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/canonical/go-tpm2"
+)
+
+// NVReadWithPolicy reads size bytes from the specified offset of the NV index with the
+// supplied public area, using a policy session to authorize the read. The index must have
+// the AttrNVPolicyRead attribute set, and indexPolicy must be the authorization policy of
+// the index.
+//
+// This starts a policy session with the name algorithm of the index, executes the supplied
+// policy in it with [Policy.Execute] using the supplied resources and params, and then
+// executes TPM2_NV_Read with the session. The session is flushed before this function
+// returns. If params doesn't specify a usage, one is created for TPM2_NV_Read on the index
+// with the supplied size and offset so that command context-specific branches are selected
+// automatically.
+//
+// As the index is only identified by its public area, its authorization value is not
+// available. The default usage excludes branches that contain TPM2_PolicyAuthValue or
+// TPM2_PolicyPassword assertions, and an error is returned if the executed branch contains
+// either of these.
+func NVReadWithPolicy(tpm TPMConnection, index *tpm2.NVPublic, indexPolicy *Policy, size, offset uint16, resources PolicyResourceLoader, params *PolicyExecuteParams) ([]byte, error) {
+	if tpm == nil {
+		return nil, errors.New("no TPM")
+	}
+	if index == nil {
+		return nil, errors.New("no NV index public area")
+	}
+	if indexPolicy == nil {
+		return nil, errors.New("no policy")
+	}
+	if index.Attrs&tpm2.AttrNVPolicyRead == 0 {
+		return nil, errors.New("NV index cannot be read with a policy session")
+	}
+
+	resource, err := tpm2.NewNVIndexResourceContextFromPub(index)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create resource context for NV index: %w", err)
+	}
+
+	var p PolicyExecuteParams
+	if params != nil {
+		p = *params
+	}
+	if p.Usage == nil {
+		p.Usage = NewPolicySessionUsage(tpm2.CommandNVRead, []Named{resource, resource}, size, offset).NoAuthValue()
+	}
+
+	session, err := tpm.StartAuthSession(tpm2.SessionTypePolicy, index.NameAlg)
+	if err != nil {
+		return nil, fmt.Errorf("cannot start policy session: %w", err)
+	}
+	defer tpm.FlushContext(session)
+
+	result, err := indexPolicy.Execute(tpm, session, resources, &p)
+	if err != nil {
+		return nil, fmt.Errorf("cannot execute policy: %w", err)
+	}
+	if result.AuthValueNeeded {
+		return nil, errors.New("policy requires the authorization value of the NV index")
+	}
+
+	data, err := tpm.NVRead(resource, resource, size, offset, session)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// NewNVPublicForReadPolicy returns a public area for defining a NV index with the
+// specified handle, name algorithm and size, that can only be read with a policy
+// session that satisfies the supplied policy. The returned public area has the
+// AttrNVPolicyRead attribute set and its authorization policy is computed from the
+// supplied policy, which is updated with the computed digest.
+//
+// The supplied attributes are added to the public area, and should specify the
+// type of the index and how it can be written. They must not include any of the
+// other read attributes. The index can be read with [NVReadWithPolicy], and
+// [Policy.Execute] can check TPM2_PolicyNV conditions on it during automatic branch
+// selection if the policy has a branch that only requires TPM2_PolicyCommandCode
+// with TPM2_NV_Read or TPM2_PolicyNV.
+func NewNVPublicForReadPolicy(index tpm2.Handle, policy *Policy, alg tpm2.HashAlgorithmId, size uint16, attrs tpm2.NVAttributes) (*tpm2.NVPublic, error) {
+	if index.Type() != tpm2.HandleTypeNVIndex {
+		return nil, errors.New("invalid NV index handle")
+	}
+	if policy == nil {
+		return nil, errors.New("no policy")
+	}
+	if !alg.Available() {
+		return nil, errors.New("algorithm is not available")
+	}
+	if attrs&(tpm2.AttrNVPPRead|tpm2.AttrNVOwnerRead|tpm2.AttrNVAuthRead) != 0 {
+		return nil, errors.New("attributes permit the NV index to be read without the policy")
+	}
+
+	authPolicy, err := policy.Compute(alg)
+	if err != nil {
+		return nil, fmt.Errorf("cannot compute policy: %w", err)
+	}
+
+	return &tpm2.NVPublic{
+		Index:      index,
+		NameAlg:    alg,
+		Attrs:      attrs | tpm2.AttrNVPolicyRead,
+		AuthPolicy: authPolicy,
+		Size:       size}, nil
+}
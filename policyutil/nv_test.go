@@ -0,0 +1,182 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package policyutil_test
+
+import (
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/go-tpm2"
+	internal_testutil "github.com/canonical/go-tpm2/internal/testutil"
+	. "github.com/canonical/go-tpm2/policyutil"
+	"github.com/canonical/go-tpm2/testutil"
+)
+
+type nvSuiteNoTPM struct{}
+
+var _ = Suite(&nvSuiteNoTPM{})
+
+type nvSuite struct {
+	testutil.TPMTest
+}
+
+func (s *nvSuite) SetUpSuite(c *C) {
+	s.TPMFeatures = testutil.TPMFeatureOwnerHierarchy | testutil.TPMFeatureNV
+}
+
+var _ = Suite(&nvSuite{})
+
+func (s *nvSuite) newNVReadPolicy(c *C) *Policy {
+	builder := NewPolicyBuilder()
+	node := builder.RootBranch().AddBranchNode()
+
+	b1 := node.AddBranch("change-auth")
+	c.Check(b1.PolicyCommandCode(tpm2.CommandNVChangeAuth), IsNil)
+	c.Check(b1.PolicyAuthValue(), IsNil)
+
+	b2 := node.AddBranch("read")
+	c.Check(b2.PolicyCommandCode(tpm2.CommandNVRead), IsNil)
+
+	policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+	return policy
+}
+
+func (s *nvSuite) defineAndWriteNV(c *C, policy *Policy, data []byte) *tpm2.NVPublic {
+	policyDigest, err := policy.Compute(tpm2.HashAlgorithmSHA256)
+	c.Assert(err, IsNil)
+
+	pub := &tpm2.NVPublic{
+		Index:      s.NextAvailableHandle(c, 0x0181f000),
+		NameAlg:    tpm2.HashAlgorithmSHA256,
+		Attrs:      tpm2.NVTypeOrdinary.WithAttrs(tpm2.AttrNVPolicyRead | tpm2.AttrNVAuthWrite | tpm2.AttrNVNoDA),
+		AuthPolicy: policyDigest,
+		Size:       uint16(len(data))}
+	index := s.NVDefineSpace(c, tpm2.HandleOwner, nil, pub)
+	c.Assert(s.TPM.NVWrite(index, index, data, 0, nil), IsNil)
+
+	pub.Attrs |= tpm2.AttrNVWritten
+	return pub
+}
+
+func (s *nvSuite) testNVReadWithPolicy(c *C, size, offset uint16) {
+	contents := internal_testutil.DecodeHexString(c, "0102030405060708")
+	policy := s.newNVReadPolicy(c)
+	pub := s.defineAndWriteNV(c, policy, contents)
+
+	s.ForgetCommands()
+
+	data, err := NVReadWithPolicy(NewTPMConnection(s.TPM), pub, policy, size, offset, nil, nil)
+	c.Check(err, IsNil)
+	c.Check(data, DeepEquals, contents[offset:offset+size])
+
+	// Make sure that the session was flushed.
+	log := s.CommandLog()
+	c.Assert(log, Not(internal_testutil.LenEquals), 0)
+	c.Check(log[0].GetCommandCode(c), Equals, tpm2.CommandStartAuthSession)
+	c.Check(log[len(log)-2].GetCommandCode(c), Equals, tpm2.CommandNVRead)
+	c.Check(log[len(log)-1].GetCommandCode(c), Equals, tpm2.CommandFlushContext)
+}
+
+func (s *nvSuite) TestNVReadWithPolicy(c *C) {
+	s.testNVReadWithPolicy(c, 8, 0)
+}
+
+func (s *nvSuite) TestNVReadWithPolicyOffset(c *C) {
+	s.testNVReadWithPolicy(c, 4, 2)
+}
+
+func (s *nvSuite) TestNVReadWithPolicyExplicitPath(c *C) {
+	contents := internal_testutil.DecodeHexString(c, "0102030405060708")
+	policy := s.newNVReadPolicy(c)
+	pub := s.defineAndWriteNV(c, policy, contents)
+
+	data, err := NVReadWithPolicy(NewTPMConnection(s.TPM), pub, policy, 8, 0, nil, &PolicyExecuteParams{Path: "read"})
+	c.Check(err, IsNil)
+	c.Check(data, DeepEquals, contents)
+}
+
+func (s *nvSuite) TestNVReadWithPolicyAuthValueNeeded(c *C) {
+	contents := internal_testutil.DecodeHexString(c, "0102030405060708")
+	policy := s.newNVReadPolicy(c)
+	pub := s.defineAndWriteNV(c, policy, contents)
+
+	_, err := NVReadWithPolicy(NewTPMConnection(s.TPM), pub, policy, 8, 0, nil, &PolicyExecuteParams{Path: "change-auth"})
+	c.Check(err, ErrorMatches, `policy requires the authorization value of the NV index`)
+}
+
+func (s *nvSuiteNoTPM) TestNVReadWithPolicyNoPolicyRead(c *C) {
+	builder := NewPolicyBuilder()
+	c.Check(builder.RootBranch().PolicyCommandCode(tpm2.CommandNVRead), IsNil)
+	policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+
+	pub := &tpm2.NVPublic{
+		Index:   0x0181f000,
+		NameAlg: tpm2.HashAlgorithmSHA256,
+		Attrs:   tpm2.NVTypeOrdinary.WithAttrs(tpm2.AttrNVAuthRead | tpm2.AttrNVAuthWrite | tpm2.AttrNVNoDA),
+		Size:    8}
+
+	_, err = NVReadWithPolicy(NewTPMConnection(nil), pub, policy, 8, 0, nil, nil)
+	c.Check(err, ErrorMatches, `NV index cannot be read with a policy session`)
+}
+
+func (s *nvSuite) TestNewNVPublicForReadPolicy(c *C) {
+	policy := s.newNVReadPolicy(c)
+
+	pub, err := NewNVPublicForReadPolicy(s.NextAvailableHandle(c, 0x0181f000), policy, tpm2.HashAlgorithmSHA256, 8, tpm2.NVTypeOrdinary.WithAttrs(tpm2.AttrNVAuthWrite|tpm2.AttrNVNoDA))
+	c.Assert(err, IsNil)
+
+	contents := internal_testutil.DecodeHexString(c, "0102030405060708")
+	index := s.NVDefineSpace(c, tpm2.HandleOwner, nil, pub)
+	c.Assert(s.TPM.NVWrite(index, index, contents, 0, nil), IsNil)
+	pub.Attrs |= tpm2.AttrNVWritten
+
+	data, err := NVReadWithPolicy(NewTPMConnection(s.TPM), pub, policy, 8, 0, nil, nil)
+	c.Check(err, IsNil)
+	c.Check(data, DeepEquals, contents)
+
+	// The index can't be read with its authorization value.
+	_, err = s.TPM.NVRead(index, index, 8, 0, nil)
+	c.Check(tpm2.IsTPMError(err, tpm2.ErrorNVAuthorization, tpm2.CommandNVRead), internal_testutil.IsTrue)
+}
+
+func (s *nvSuiteNoTPM) TestNewNVPublicForReadPolicy(c *C) {
+	builder := NewPolicyBuilder()
+	c.Check(builder.RootBranch().PolicyCommandCode(tpm2.CommandNVRead), IsNil)
+	policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+
+	pub, err := NewNVPublicForReadPolicy(0x0181f000, policy, tpm2.HashAlgorithmSHA256, 8, tpm2.NVTypeOrdinary.WithAttrs(tpm2.AttrNVAuthWrite|tpm2.AttrNVNoDA))
+	c.Assert(err, IsNil)
+
+	expectedDigest, err := policy.Compute(tpm2.HashAlgorithmSHA256)
+	c.Check(err, IsNil)
+	c.Check(pub, DeepEquals, &tpm2.NVPublic{
+		Index:      0x0181f000,
+		NameAlg:    tpm2.HashAlgorithmSHA256,
+		Attrs:      tpm2.NVTypeOrdinary.WithAttrs(tpm2.AttrNVPolicyRead | tpm2.AttrNVAuthWrite | tpm2.AttrNVNoDA),
+		AuthPolicy: expectedDigest,
+		Size:       8})
+}
+
+func (s *nvSuiteNoTPM) TestNewNVPublicForReadPolicyOtherReadAttrs(c *C) {
+	builder := NewPolicyBuilder()
+	c.Check(builder.RootBranch().PolicyCommandCode(tpm2.CommandNVRead), IsNil)
+	policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+
+	_, err = NewNVPublicForReadPolicy(0x0181f000, policy, tpm2.HashAlgorithmSHA256, 8, tpm2.NVTypeOrdinary.WithAttrs(tpm2.AttrNVAuthRead|tpm2.AttrNVAuthWrite))
+	c.Check(err, ErrorMatches, `attributes permit the NV index to be read without the policy`)
+}
+
+func (s *nvSuiteNoTPM) TestNewNVPublicForReadPolicyInvalidHandle(c *C) {
+	builder := NewPolicyBuilder()
+	c.Check(builder.RootBranch().PolicyCommandCode(tpm2.CommandNVRead), IsNil)
+	policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+
+	_, err = NewNVPublicForReadPolicy(0x81000001, policy, tpm2.HashAlgorithmSHA256, 8, tpm2.AttrNVAuthWrite)
+	c.Check(err, ErrorMatches, `invalid NV index handle`)
+}
@@ -0,0 +1,101 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package policyutil
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/canonical/go-tpm2"
+)
+
+// validatePCRSelection checks that every PCR in the supplied selection is present
+// in the supplied allocation.
+func validatePCRSelection(allocated, selection tpm2.PCRSelectionList) error {
+	allocatedPCRs := make(map[tpm2.HashAlgorithmId]map[int]struct{})
+	for _, s := range allocated {
+		if _, exists := allocatedPCRs[s.Hash]; !exists {
+			allocatedPCRs[s.Hash] = make(map[int]struct{})
+		}
+		for _, pcr := range s.Select {
+			allocatedPCRs[s.Hash][pcr] = struct{}{}
+		}
+	}
+
+	var unsupportedBanks []tpm2.HashAlgorithmId
+	unallocatedPCRs := make(map[tpm2.HashAlgorithmId][]int)
+	var unallocatedBanks []tpm2.HashAlgorithmId
+
+	for _, s := range selection {
+		pcrs, exists := allocatedPCRs[s.Hash]
+		if !exists || len(pcrs) == 0 {
+			found := false
+			for _, alg := range unsupportedBanks {
+				if alg == s.Hash {
+					found = true
+					break
+				}
+			}
+			if !found {
+				unsupportedBanks = append(unsupportedBanks, s.Hash)
+			}
+			continue
+		}
+
+		for _, pcr := range s.Select {
+			if _, ok := pcrs[pcr]; ok {
+				continue
+			}
+			if _, exists := unallocatedPCRs[s.Hash]; !exists {
+				unallocatedBanks = append(unallocatedBanks, s.Hash)
+			}
+			unallocatedPCRs[s.Hash] = append(unallocatedPCRs[s.Hash], pcr)
+		}
+	}
+
+	if len(unsupportedBanks) == 0 && len(unallocatedBanks) == 0 {
+		return nil
+	}
+
+	var msgs []string
+	if len(unsupportedBanks) > 0 {
+		var banks []string
+		for _, alg := range unsupportedBanks {
+			banks = append(banks, fmt.Sprintf("%v", alg))
+		}
+		msgs = append(msgs, fmt.Sprintf("unsupported PCR banks: %s", strings.Join(banks, ", ")))
+	}
+	if len(unallocatedBanks) > 0 {
+		var pcrs []string
+		for _, alg := range unallocatedBanks {
+			sort.Ints(unallocatedPCRs[alg])
+			pcrs = append(pcrs, fmt.Sprintf("%v:%v", alg, unallocatedPCRs[alg]))
+		}
+		msgs = append(msgs, fmt.Sprintf("unallocated PCRs: %s", strings.Join(pcrs, ", ")))
+	}
+
+	return errors.New(strings.Join(msgs, "; "))
+}
+
+// ValidatePCRSelectionAgainstTPM checks that every PCR in the supplied selection is
+// allocated on the TPM, by comparing it against the current PCR allocation obtained
+// with [tpm2.TPMContext.GetCapabilityPCRs]. This is useful for detecting a policy
+// created with [PolicyBuilderBranch.PolicyPCR] that could never be satisfied on the
+// TPM before it is used to seal an object.
+//
+// If any of the selected PCR banks are not allocated, or any of the selected PCRs
+// are not allocated in a bank, an error is returned that lists them.
+func ValidatePCRSelectionAgainstTPM(tpm *tpm2.TPMContext, selection tpm2.PCRSelectionList, sessions ...tpm2.SessionContext) error {
+	allocated, err := tpm.GetCapabilityPCRs(sessions...)
+	if err != nil {
+		return fmt.Errorf("cannot obtain current PCR allocation: %w", err)
+	}
+	if err := validatePCRSelection(allocated, selection); err != nil {
+		return fmt.Errorf("invalid PCR selection: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package policyutil_test
+
+import (
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/go-tpm2"
+	. "github.com/canonical/go-tpm2/policyutil"
+	"github.com/canonical/go-tpm2/testutil"
+)
+
+type pcrSuiteNoTPM struct{}
+
+var _ = Suite(&pcrSuiteNoTPM{})
+
+var testPCRAllocation = tpm2.PCRSelectionList{
+	{Hash: tpm2.HashAlgorithmSHA1, Select: []int{}},
+	{Hash: tpm2.HashAlgorithmSHA256, Select: []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23}},
+	{Hash: tpm2.HashAlgorithmSHA384, Select: []int{0, 1, 2, 3, 4, 5, 6, 7}}}
+
+func (s *pcrSuiteNoTPM) TestValidatePCRSelection(c *C) {
+	c.Check(ValidatePCRSelection(testPCRAllocation, tpm2.PCRSelectionList{
+		{Hash: tpm2.HashAlgorithmSHA256, Select: []int{4, 7, 23}},
+		{Hash: tpm2.HashAlgorithmSHA384, Select: []int{7}}}), IsNil)
+}
+
+func (s *pcrSuiteNoTPM) TestValidatePCRSelectionEmpty(c *C) {
+	c.Check(ValidatePCRSelection(testPCRAllocation, nil), IsNil)
+}
+
+func (s *pcrSuiteNoTPM) TestValidatePCRSelectionUnsupportedBank(c *C) {
+	err := ValidatePCRSelection(testPCRAllocation, tpm2.PCRSelectionList{
+		{Hash: tpm2.HashAlgorithmSHA256, Select: []int{7}},
+		{Hash: tpm2.HashAlgorithmSHA512, Select: []int{7}}})
+	c.Check(err, ErrorMatches, `unsupported PCR banks: TPM_ALG_SHA512`)
+}
+
+func (s *pcrSuiteNoTPM) TestValidatePCRSelectionEmptyBank(c *C) {
+	err := ValidatePCRSelection(testPCRAllocation, tpm2.PCRSelectionList{
+		{Hash: tpm2.HashAlgorithmSHA1, Select: []int{7}},
+		{Hash: tpm2.HashAlgorithmSHA512, Select: []int{7}}})
+	c.Check(err, ErrorMatches, `unsupported PCR banks: TPM_ALG_SHA1, TPM_ALG_SHA512`)
+}
+
+func (s *pcrSuiteNoTPM) TestValidatePCRSelectionUnallocatedPCRs(c *C) {
+	err := ValidatePCRSelection(testPCRAllocation, tpm2.PCRSelectionList{
+		{Hash: tpm2.HashAlgorithmSHA256, Select: []int{7}},
+		{Hash: tpm2.HashAlgorithmSHA384, Select: []int{12, 4, 8}}})
+	c.Check(err, ErrorMatches, `unallocated PCRs: TPM_ALG_SHA384:\[8 12\]`)
+}
+
+func (s *pcrSuiteNoTPM) TestValidatePCRSelectionMultipleErrors(c *C) {
+	err := ValidatePCRSelection(testPCRAllocation, tpm2.PCRSelectionList{
+		{Hash: tpm2.HashAlgorithmSHA256, Select: []int{24}},
+		{Hash: tpm2.HashAlgorithmSHA384, Select: []int{8}},
+		{Hash: tpm2.HashAlgorithmSHA512, Select: []int{7}}})
+	c.Check(err, ErrorMatches, `unsupported PCR banks: TPM_ALG_SHA512; unallocated PCRs: TPM_ALG_SHA256:\[24\], TPM_ALG_SHA384:\[8\]`)
+}
+
+type pcrSuite struct {
+	testutil.TPMTest
+}
+
+func (s *pcrSuite) SetUpSuite(c *C) {
+	s.TPMFeatures = testutil.TPMFeaturePCR
+}
+
+var _ = Suite(&pcrSuite{})
+
+func (s *pcrSuite) TestValidatePCRSelectionAgainstTPM(c *C) {
+	allocated, err := s.TPM.GetCapabilityPCRs()
+	c.Assert(err, IsNil)
+
+	var selection tpm2.PCRSelectionList
+	for _, bank := range allocated {
+		if len(bank.Select) == 0 {
+			continue
+		}
+		selection = append(selection, tpm2.PCRSelection{Hash: bank.Hash, Select: []int{bank.Select[0]}})
+	}
+	c.Assert(selection, Not(HasLen), 0)
+
+	c.Check(ValidatePCRSelectionAgainstTPM(s.TPM, selection), IsNil)
+}
+
+func (s *pcrSuite) TestValidatePCRSelectionAgainstTPMUnsupportedBank(c *C) {
+	allocated, err := s.TPM.GetCapabilityPCRs()
+	c.Assert(err, IsNil)
+
+	alg := tpm2.HashAlgorithmSHA3_512
+	for _, bank := range allocated {
+		if bank.Hash == alg && len(bank.Select) > 0 {
+			c.Skip("TPM has a SHA3-512 PCR bank")
+		}
+	}
+
+	err = ValidatePCRSelectionAgainstTPM(s.TPM, tpm2.PCRSelectionList{{Hash: alg, Select: []int{7}}})
+	c.Check(err, ErrorMatches, `invalid PCR selection: unsupported PCR banks: TPM_ALG_SHA3_512`)
+}
+
+func (s *pcrSuite) TestValidatePCRSelectionAgainstTPMUnallocatedPCR(c *C) {
+	err := ValidatePCRSelectionAgainstTPM(s.TPM, tpm2.PCRSelectionList{{Hash: tpm2.HashAlgorithmSHA256, Select: []int{7, 100}}})
+	c.Check(err, ErrorMatches, `invalid PCR selection: unallocated PCRs: TPM_ALG_SHA256:\[100\]`)
+}
@@ -11,12 +11,15 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"reflect"
+	"sort"
 	"strings"
 	"unicode/utf8"
 
 	"github.com/canonical/go-tpm2"
 	"github.com/canonical/go-tpm2/mu"
+	"github.com/canonical/go-tpm2/objectutil"
 )
 
 var (
@@ -54,6 +57,37 @@ type PolicyTicket struct {
 	Ticket *tpm2.TkAuth
 }
 
+// Marshal implements [mu.CustomMarshaller.Marshal]. This makes it possible for
+// tickets to be persisted and supplied to [Policy.Execute] in another process.
+func (t PolicyTicket) Marshal(w io.Writer) error {
+	if t.Ticket == nil {
+		return errors.New("no ticket")
+	}
+	_, err := mu.MarshalToWriter(w, t.AuthName, t.PolicyRef, t.CpHash, t.Timeout, t.Ticket)
+	return err
+}
+
+// Unmarshal implements [mu.CustomMarshaller.Unmarshal].
+func (t *PolicyTicket) Unmarshal(r io.Reader) error {
+	var ticket PolicyTicket
+	if _, err := mu.UnmarshalFromReader(r, &ticket.AuthName, &ticket.PolicyRef, &ticket.CpHash, &ticket.Timeout, &ticket.Ticket); err != nil {
+		return err
+	}
+
+	if !ticket.AuthName.IsValid() {
+		return errors.New("invalid auth name")
+	}
+	switch ticket.Ticket.Tag {
+	case tpm2.TagAuthSecret, tpm2.TagAuthSigned:
+		// ok
+	default:
+		return errors.New("invalid ticket tag")
+	}
+
+	*t = ticket
+	return nil
+}
+
 // PolicyError is returned from [Policy.Execute] and other methods when an error
 // is encountered during some processing of a policy. It provides an indication of
 // where an error occurred.
@@ -126,6 +160,38 @@ func (e *PolicyAuthorizationError) Unwrap() error {
 	return e.err
 }
 
+// SelectedBranchError is returned from [Policy.Execute] if an error is encountered whilst
+// executing a path that was explicitly selected via the Path field of [PolicyExecuteParams],
+// rather than one that was selected automatically. This makes it possible to distinguish
+// between a failure of a branch that the caller asked for and a failure to find a suitable
+// branch. It wraps a [PolicyError].
+type SelectedBranchError struct {
+	Path string // the explicitly selected path
+
+	err error
+}
+
+func (e *SelectedBranchError) Error() string {
+	return fmt.Sprintf("cannot execute explicitly selected path \"%s\": %v", e.Path, e.err)
+}
+
+func (e *SelectedBranchError) Unwrap() error {
+	return e.err
+}
+
+// branchSelectionError is returned when a branch or authorized policy cannot be selected.
+type branchSelectionError struct {
+	err error
+}
+
+func (e *branchSelectionError) Error() string {
+	return e.err.Error()
+}
+
+func (e *branchSelectionError) Unwrap() error {
+	return e.err
+}
+
 // ResourceLoadError is returned from [Policy.Execute] if the policy required a resource that
 // could not be loaded.
 type ResourceLoadError struct {
@@ -141,8 +207,43 @@ func (e *ResourceLoadError) Unwrap() error {
 	return e.err
 }
 
+// UnsupportedAssertionsError is returned from [Policy.CheckTPMSupport] if a policy
+// contains assertions that are not supported by the TPM.
+type UnsupportedAssertionsError struct {
+	// Commands contains the command codes of the unsupported assertions, in the
+	// order in which they first appear in the policy.
+	Commands []tpm2.CommandCode
+
+	names []string
+}
+
+func (e *UnsupportedAssertionsError) Error() string {
+	return fmt.Sprintf("policy contains assertions that are not supported by the TPM: %s", strings.Join(e.names, ", "))
+}
+
+// StateChangedError is returned from [Policy.Execute] if the VerifyPath field of
+// [PolicyExecuteParams] is set and the current state no longer satisfies a branch
+// that was selected explicitly.
+type StateChangedError struct {
+	Path string // The path of the branch that is no longer satisfied
+	err  error
+}
+
+func (e *StateChangedError) Error() string {
+	return fmt.Sprintf("the current state no longer satisfies branch %q: %v", e.Path, e.err)
+}
+
+func (e *StateChangedError) Unwrap() error {
+	return e.err
+}
+
 type policyBranchName string
 
+// policyBranchNameMaxLen is the maximum length of a branch name in bytes. This is
+// large enough to contain a hex encoded SHA-512 digest, and bounds the size of names
+// decoded from untrusted policies.
+const policyBranchNameMaxLen = 128
+
 func (n policyBranchName) isValid() bool {
 	if !utf8.ValidString(string(n)) {
 		return false
@@ -154,6 +255,9 @@ func (n policyBranchName) isValid() bool {
 }
 
 func (n policyBranchName) Marshal(w io.Writer) error {
+	if len(n) > policyBranchNameMaxLen {
+		return fmt.Errorf("name too long (%d bytes, the maximum is %d)", len(n), policyBranchNameMaxLen)
+	}
 	if !n.isValid() {
 		return errors.New("invalid name")
 	}
@@ -166,6 +270,9 @@ func (n *policyBranchName) Unmarshal(r io.Reader) error {
 	if _, err := mu.UnmarshalFromReader(r, &b); err != nil {
 		return err
 	}
+	if len(b) > policyBranchNameMaxLen {
+		return fmt.Errorf("name too long (%d bytes, the maximum is %d)", len(b), policyBranchNameMaxLen)
+	}
 	name := policyBranchName(b)
 	if !name.isValid() {
 		return errors.New("invalid name")
@@ -174,6 +281,125 @@ func (n *policyBranchName) Unmarshal(r io.Reader) error {
 	return nil
 }
 
+// policyBranchDescription is a human-readable description of a branch. It is
+// serialized with the policy but doesn't contribute to the policy digest.
+type policyBranchDescription string
+
+func (d policyBranchDescription) Marshal(w io.Writer) error {
+	if !utf8.ValidString(string(d)) {
+		return errors.New("invalid description")
+	}
+	_, err := mu.MarshalToWriter(w, []byte(d))
+	return err
+}
+
+func (d *policyBranchDescription) Unmarshal(r io.Reader) error {
+	var b []byte
+	if _, err := mu.UnmarshalFromReader(r, &b); err != nil {
+		return err
+	}
+	if !utf8.Valid(b) {
+		return errors.New("invalid description")
+	}
+	*d = policyBranchDescription(b)
+	return nil
+}
+
+// policyBranchDescriptionEntry associates a description with the path of a branch.
+type policyBranchDescriptionEntry struct {
+	Path        policyBranchPath
+	Description policyBranchDescription
+}
+
+func (e policyBranchDescriptionEntry) Marshal(w io.Writer) error {
+	_, err := mu.MarshalToWriter(w, []byte(e.Path), e.Description)
+	return err
+}
+
+func (e *policyBranchDescriptionEntry) Unmarshal(r io.Reader) error {
+	var path []byte
+	if _, err := mu.UnmarshalFromReader(r, &path, &e.Description); err != nil {
+		return err
+	}
+	e.Path = policyBranchPath(path)
+	return nil
+}
+
+// policyMaxBranchDescriptions is the maximum number of branch descriptions that
+// will be decoded.
+const policyMaxBranchDescriptions = policyOrMaxDigests
+
+type policyBranchDescriptions []policyBranchDescriptionEntry
+
+func (d policyBranchDescriptions) Marshal(w io.Writer) error {
+	_, err := mu.MarshalToWriter(w, []policyBranchDescriptionEntry(d))
+	return err
+}
+
+func (d *policyBranchDescriptions) Unmarshal(r io.Reader) error {
+	var n uint32
+	if _, err := mu.UnmarshalFromReader(r, &n); err != nil {
+		return err
+	}
+	if n > policyMaxBranchDescriptions {
+		return fmt.Errorf("too many descriptions (%d)", n)
+	}
+
+	*d = nil
+	for i := uint32(0); i < n; i++ {
+		var entry policyBranchDescriptionEntry
+		if _, err := mu.UnmarshalFromReader(r, &entry); err != nil {
+			return fmt.Errorf("cannot unmarshal description %d: %w", i, err)
+		}
+		*d = append(*d, entry)
+	}
+	return nil
+}
+
+// validate checks that every description is associated with a branch in the
+// supplied elements, and that no branch has more than one description.
+func (d policyBranchDescriptions) validate(elements policyElements) error {
+	described := make(map[policyBranchPath]bool)
+	walkBranchPaths("", elements, func(path policyBranchPath, _ *policyBranch) {
+		described[path] = false
+	})
+
+	for _, entry := range d {
+		seen, exists := described[entry.Path]
+		switch {
+		case !exists:
+			return fmt.Errorf("description for non-existent branch \"%s\"", entry.Path)
+		case seen:
+			return fmt.Errorf("multiple descriptions for branch \"%s\"", entry.Path)
+		}
+		described[entry.Path] = true
+	}
+
+	return nil
+}
+
+// walkBranchPaths calls fn for every branch in the supplied elements and their
+// descendants, along with the path of the branch. Where a branch contains more
+// than one branch node, branches in the second and subsequent nodes have a "**"
+// component in their path in place of the branches selected by preceding nodes.
+func walkBranchPaths(parentPath policyBranchPath, elements policyElements, fn func(policyBranchPath, *policyBranch)) {
+	for _, element := range elements {
+		if element.Type != tpm2.CommandPolicyOR || element.Details == nil || element.Details.OR == nil {
+			continue
+		}
+		for i, branch := range element.Details.OR.Branches {
+			name := policyBranchPath(branch.Name)
+			if len(name) == 0 {
+				name = policyBranchPath(fmt.Sprintf("$[%d]", i))
+			}
+			path := parentPath.Concat(name)
+			fn(path, branch)
+			walkBranchPaths(path, branch.Policy, fn)
+		}
+		parentPath = parentPath.Concat("**")
+	}
+}
+
 type policyBranchPath string
 
 func (p policyBranchPath) PopNextComponent() (next policyBranchPath, remaining policyBranchPath) {
@@ -193,6 +419,34 @@ func (p policyBranchPath) PopNextComponent() (next policyBranchPath, remaining p
 	return "", ""
 }
 
+// Validate checks that this path doesn't contain any empty components. Whilst
+// these are ignored during execution, they may indicate a typo in the path.
+func (p policyBranchPath) Validate() error {
+	if len(p) == 0 {
+		return nil
+	}
+	switch {
+	case strings.HasPrefix(string(p), "/"):
+		return fmt.Errorf("path %q has a leading '/'", p)
+	case strings.HasSuffix(string(p), "/"):
+		return fmt.Errorf("path %q has a trailing '/'", p)
+	case strings.Contains(string(p), "//"):
+		return fmt.Errorf("path %q has consecutive '/' characters", p)
+	}
+	return nil
+}
+
+func (p policyBranchPath) NumComponents() (n int) {
+	for len(p) > 0 {
+		var next policyBranchPath
+		next, p = p.PopNextComponent()
+		if len(next) > 0 {
+			n++
+		}
+	}
+	return n
+}
+
 func (p policyBranchPath) Concat(path policyBranchPath) policyBranchPath {
 	var pathElements []string
 	if p != "" {
@@ -281,8 +535,19 @@ type policyNVElement struct {
 
 func (*policyNVElement) name() string { return "TPM2_PolicyNV assertion" }
 
-func (e *policyNVElement) run(context policySessionContext) (err error) {
-	nvIndex, err := tpm2.NewNVIndexResourceContextFromPub(e.NvIndex)
+func (e *policyNVElement) run(context policySessionContext) error {
+	return runNVReadAssertion(context, e.NvIndex, tpm2.CommandPolicyNV, []interface{}{e.OperandB, e.Offset, e.Operation}, func(auth, nvIndex tpm2.ResourceContext, authAuthSession tpm2.SessionContext) error {
+		return context.session().PolicyNV(auth, nvIndex, e.OperandB, e.Offset, e.Operation, authAuthSession)
+	})
+}
+
+// runNVReadAssertion runs an assertion that requires read authorization for the
+// supplied NV index, such as TPM2_PolicyNV or TPM2_PolicyAuthorizeNV. The supplied
+// command and params are used to construct the session usage for the authorization,
+// and the assertion is performed by the supplied function once the authorization
+// has been satisfied.
+func runNVReadAssertion(context policySessionContext, pub *tpm2.NVPublic, command tpm2.CommandCode, params []interface{}, assert func(auth, nvIndex tpm2.ResourceContext, authAuthSession tpm2.SessionContext) error) (err error) {
+	nvIndex, err := tpm2.NewNVIndexResourceContextFromPub(pub)
 	if err != nil {
 		return fmt.Errorf("cannot create nvIndex context: %w", err)
 	}
@@ -293,13 +558,13 @@ func (e *policyNVElement) run(context policySessionContext) (err error) {
 
 	var auth ResourceContext = newResourceContextFlushable(nvIndex, nil)
 	switch {
-	case e.NvIndex.Attrs&tpm2.AttrNVPolicyRead != 0:
+	case pub.Attrs&tpm2.AttrNVPolicyRead != 0:
 		// use NV index for auth
-	case e.NvIndex.Attrs&tpm2.AttrNVAuthRead != 0:
+	case pub.Attrs&tpm2.AttrNVAuthRead != 0:
 		// use NV index for auth
-	case e.NvIndex.Attrs&tpm2.AttrNVOwnerRead != 0:
+	case pub.Attrs&tpm2.AttrNVOwnerRead != 0:
 		auth, policy, err = context.resources().LoadName(tpm2.MakeHandleName(tpm2.HandleOwner))
-	case e.NvIndex.Attrs&tpm2.AttrNVPPRead != 0:
+	case pub.Attrs&tpm2.AttrNVPPRead != 0:
 		auth, policy, err = context.resources().LoadName(tpm2.MakeHandleName(tpm2.HandlePlatform))
 	default:
 		return errors.New("invalid nvIndex read auth mode")
@@ -309,9 +574,9 @@ func (e *policyNVElement) run(context policySessionContext) (err error) {
 	}
 
 	usage := NewPolicySessionUsage(
-		tpm2.CommandPolicyNV,
+		command,
 		[]Named{auth.Resource(), nvIndex, context.session().Name()},
-		e.OperandB, e.Offset, e.Operation,
+		params...,
 	)
 
 	restore, err := context.session().Save()
@@ -332,7 +597,7 @@ func (e *policyNVElement) run(context policySessionContext) (err error) {
 		if sessionErr != nil {
 			return &PolicyNVError{Index: nvIndex.Handle(), Name: nvIndex.Name(), err: sessionErr}
 		}
-		if err := context.session().PolicyNV(auth.Resource(), nvIndex, e.OperandB, e.Offset, e.Operation, session); err != nil {
+		if err := assert(auth.Resource(), nvIndex, session); err != nil {
 			return &PolicyNVError{Index: nvIndex.Handle(), Name: nvIndex.Name(), err: err}
 		}
 		return nil
@@ -343,6 +608,18 @@ func (e *policyNVElement) run(context policySessionContext) (err error) {
 	return nil
 }
 
+type policyAuthorizeNVElement struct {
+	NvIndex *tpm2.NVPublic
+}
+
+func (*policyAuthorizeNVElement) name() string { return "TPM2_PolicyAuthorizeNV assertion" }
+
+func (e *policyAuthorizeNVElement) run(context policySessionContext) error {
+	return runNVReadAssertion(context, e.NvIndex, tpm2.CommandPolicyAuthorizeNV, nil, func(auth, nvIndex tpm2.ResourceContext, authAuthSession tpm2.SessionContext) error {
+		return context.session().PolicyAuthorizeNV(auth, nvIndex, authAuthSession)
+	})
+}
+
 type policySecretElement struct {
 	AuthObjectName tpm2.Name
 	PolicyRef      tpm2.Nonce
@@ -441,6 +718,33 @@ type policySignedElement struct {
 
 func (*policySignedElement) name() string { return "TPM2_PolicySigned assertion" }
 
+// policySignedIncludeNonceTPM determines whether the session's TPM nonce should be
+// included in a TPM2_PolicySigned assertion for the supplied authorization. The TPM
+// verifies the signature against the nonce that is included, so this is dictated by
+// whether the authorizing party signed a nonce, and not by the expiration.
+//
+// If the authorization includes a nonce, it is bound to the session and any expiration
+// is measured from the time that the nonce was generated. The timeout of a ticket
+// requested with a negative expiration is then relative to the time that the session
+// was started.
+//
+// If the authorization doesn't include a nonce, it can be used with any session and
+// any expiration is measured from the time that the assertion is executed. A ticket
+// requested with a negative expiration expires on the next TPM reset if this occurs
+// before the expiration time.
+//
+// An error is returned if the authorization includes a nonce that doesn't match the
+// session's current nonce, as the TPM would otherwise reject the signature.
+func policySignedIncludeNonceTPM(auth *PolicySignedAuthorization, sessionNonce tpm2.Nonce) (bool, error) {
+	if len(auth.NonceTPM) == 0 {
+		return false, nil
+	}
+	if len(sessionNonce) > 0 && !bytes.Equal(auth.NonceTPM, sessionNonce) {
+		return false, errors.New("signed authorization is bound to a different session nonce")
+	}
+	return true, nil
+}
+
 func (e *policySignedElement) run(context policySessionContext) error {
 	authKeyName := e.AuthKey.Name()
 	if !authKeyName.IsValid() {
@@ -479,9 +783,9 @@ func (e *policySignedElement) run(context policySessionContext) error {
 	}
 	defer authKey.Flush()
 
-	includeNonceTPM := false
-	if len(auth.NonceTPM) > 0 {
-		includeNonceTPM = true
+	includeNonceTPM, err := policySignedIncludeNonceTPM(auth, context.session().NonceTPM())
+	if err != nil {
+		return &PolicyAuthorizationError{AuthName: authKeyName, PolicyRef: e.PolicyRef, err: err}
 	}
 
 	timeout, ticket, err := context.session().PolicySigned(authKey.Resource(), includeNonceTPM, auth.CpHash, e.PolicyRef, auth.Expiration, auth.Authorization.Signature)
@@ -687,6 +991,16 @@ func (e *policyNvWrittenElement) run(context policySessionContext) error {
 	return context.session().PolicyNvWritten(e.WrittenSet)
 }
 
+type policyTemplateElement struct {
+	TemplateHash tpm2.Digest
+}
+
+func (*policyTemplateElement) name() string { return "TPM2_PolicyTemplate assertion" }
+
+func (e *policyTemplateElement) run(context policySessionContext) error {
+	return context.session().PolicyTemplate(e.TemplateHash)
+}
+
 type policyElementDetails struct {
 	NV                *policyNVElement
 	Secret            *policySecretElement
@@ -702,6 +1016,8 @@ type policyElementDetails struct {
 	DuplicationSelect *policyDuplicationSelectElement
 	Password          *policyPasswordElement
 	NvWritten         *policyNvWrittenElement
+	Template          *policyTemplateElement
+	AuthorizeNV       *policyAuthorizeNVElement
 }
 
 func (d *policyElementDetails) Select(selector reflect.Value) interface{} {
@@ -734,6 +1050,10 @@ func (d *policyElementDetails) Select(selector reflect.Value) interface{} {
 		return &d.Password
 	case tpm2.CommandPolicyNvWritten:
 		return &d.NvWritten
+	case tpm2.CommandPolicyTemplate:
+		return &d.Template
+	case tpm2.CommandPolicyAuthorizeNV:
+		return &d.AuthorizeNV
 	default:
 		return nil
 	}
@@ -779,6 +1099,10 @@ func (e *policyElement) runner() policyElementRunner {
 		return e.Details.Password
 	case tpm2.CommandPolicyNvWritten:
 		return e.Details.NvWritten
+	case tpm2.CommandPolicyTemplate:
+		return e.Details.Template
+	case tpm2.CommandPolicyAuthorizeNV:
+		return e.Details.AuthorizeNV
 	default:
 		panic("invalid type")
 	}
@@ -786,10 +1110,102 @@ func (e *policyElement) runner() policyElementRunner {
 
 type policyElements []*policyElement
 
+const (
+	// policyExtendedEncodingMarker is used in place of the number of policy digests
+	// at the start of the serialized form of a policy to indicate that it uses an
+	// encoding that contains fields that aren't part of the original encoding.
+	policyExtendedEncodingMarker uint32 = 0xffffffff
+
+	// policyExtendedEncodingVersion is the version of the extended encoding.
+	policyExtendedEncodingVersion uint8 = 1
+)
+
 type policy struct {
 	PolicyDigests        taggedHashList
 	PolicyAuthorizations policyAuthorizations
 	Policy               policyElements
+
+	// Descriptions contains the descriptions of branches, keyed by path. These
+	// aren't part of the original encoding, so a policy with descriptions is
+	// serialized with the extended encoding.
+	Descriptions policyBranchDescriptions
+}
+
+func (p policy) Marshal(w io.Writer) error {
+	if len(p.Descriptions) == 0 {
+		// Use the original encoding so that policies that don't use any of the
+		// newer features can still be decoded by older versions of this package.
+		_, err := mu.MarshalToWriter(w, p.PolicyDigests, p.PolicyAuthorizations, p.Policy)
+		return err
+	}
+
+	_, err := mu.MarshalToWriter(w, policyExtendedEncodingMarker, policyExtendedEncodingVersion, p.PolicyDigests, p.PolicyAuthorizations, p.Policy, p.Descriptions)
+	return err
+}
+
+func (p *policy) Unmarshal(r io.Reader) error {
+	var marker uint32
+	if _, err := mu.UnmarshalFromReader(r, &marker); err != nil {
+		return err
+	}
+
+	if marker != policyExtendedEncodingMarker {
+		// This is the original encoding, where the first field is the number
+		// of policy digests.
+		r = io.MultiReader(bytes.NewReader(mu.MustMarshalToBytes(marker)), r)
+		if _, err := mu.UnmarshalFromReader(r, &p.PolicyDigests, &p.PolicyAuthorizations, &p.Policy); err != nil {
+			return err
+		}
+		p.Descriptions = nil
+		return nil
+	}
+
+	var version uint8
+	if _, err := mu.UnmarshalFromReader(r, &version); err != nil {
+		return err
+	}
+	if version != policyExtendedEncodingVersion {
+		return fmt.Errorf("unsupported encoding version %d", version)
+	}
+	if _, err := mu.UnmarshalFromReader(r, &p.PolicyDigests, &p.PolicyAuthorizations, &p.Policy, &p.Descriptions); err != nil {
+		return err
+	}
+	if err := p.Descriptions.validate(p.Policy); err != nil {
+		return fmt.Errorf("invalid descriptions: %w", err)
+	}
+	return nil
+}
+
+func stripTaggedHashes(digests taggedHashList, keep []tpm2.HashAlgorithmId) taggedHashList {
+	var out taggedHashList
+	for _, digest := range digests {
+		for _, alg := range keep {
+			if digest.HashAlg == alg {
+				out = append(out, digest)
+				break
+			}
+		}
+	}
+	return out
+}
+
+func (e policyElements) stripDigests(keep []tpm2.HashAlgorithmId) {
+	for _, element := range e {
+		if element.Type != tpm2.CommandPolicyOR {
+			continue
+		}
+		for _, branch := range element.Details.OR.Branches {
+			branch.PolicyDigests = stripTaggedHashes(branch.PolicyDigests, keep)
+			branch.Policy.stripDigests(keep)
+		}
+	}
+}
+
+// stripDigests removes the stored digests for the policy and every branch,
+// except for those for the specified algorithms.
+func (p *policy) stripDigests(keep []tpm2.HashAlgorithmId) {
+	p.PolicyDigests = stripTaggedHashes(p.PolicyDigests, keep)
+	p.Policy.stripDigests(keep)
 }
 
 // Policy corresponds to an authorization policy. It can be serialized with
@@ -1058,14 +1474,22 @@ type executePolicyHelper struct {
 	controller           policyRunnerController
 	tpm                  TPMConnection
 	remaining            policyBranchPath
+	autoComponents       int              // the number of leading components of remaining that were selected automatically
+	selectedPath         policyBranchPath // the longest path that was selected explicitly
 	usage                *PolicySessionUsage
 	ignoreAuthorizations []PolicyAuthorizationID
 	ignoreNV             []Named
+	assumeAuthFailure    bool
+	maxPaths             int
+	approver             func(string) error
 	subPolicyRunner      subPolicyRunner
+	nvSessions           *policySessionPool
 	hasResources         bool
+	verifyPath           bool
+	digestCache          *PolicyDigestCache
 }
 
-func newExecutePolicyHelper(runner *policyRunner, tpm TPMConnection, params *PolicyExecuteParams, subPolicyRunner subPolicyRunner, hasResources bool) *executePolicyHelper {
+func newExecutePolicyHelper(runner *policyRunner, tpm TPMConnection, params *PolicyExecuteParams, subPolicyRunner subPolicyRunner, nvSessions *policySessionPool, hasResources bool) *executePolicyHelper {
 	return &executePolicyHelper{
 		sessionAlg:           runner.session().HashAlg(),
 		tickets:              runner.tickets(),
@@ -1076,8 +1500,14 @@ func newExecutePolicyHelper(runner *policyRunner, tpm TPMConnection, params *Pol
 		usage:                params.Usage,
 		ignoreAuthorizations: params.IgnoreAuthorizations,
 		ignoreNV:             params.IgnoreNV,
+		assumeAuthFailure:    params.AssumeAuthorizationFailure,
+		maxPaths:             params.MaxBranchPaths,
+		approver:             params.Approver,
 		subPolicyRunner:      subPolicyRunner,
+		nvSessions:           nvSessions,
 		hasResources:         hasResources,
+		verifyPath:           params.VerifyPath,
+		digestCache:          params.DigestCache,
 	}
 }
 
@@ -1133,15 +1563,31 @@ func (h *executePolicyHelper) authorize(auth tpm2.ResourceContext, policy *Polic
 		sessionType = tpm2.SessionTypeHMAC
 	}
 
-	session, err := h.tpm.StartAuthSession(sessionType, alg)
-	if err != nil {
-		return fmt.Errorf("cannot create session to authorize auth object: %w", err)
+	var session tpm2.SessionContext
+	if provider, ok := h.resources.(AuthorizationSessionProvider); ok && sessionType == tpm2.SessionTypeHMAC {
+		session, err = provider.AuthorizationSession(auth)
+		if err != nil {
+			return fmt.Errorf("cannot obtain session to authorize auth object: %w", err)
+		}
+	}
+
+	// Only flush sessions that we start. Sessions supplied by the resource
+	// loader are owned by the caller.
+	flushSession := func() {}
+	if session == nil {
+		session, err = h.tpm.StartAuthSession(sessionType, alg)
+		if err != nil {
+			return fmt.Errorf("cannot create session to authorize auth object: %w", err)
+		}
+		flushSession = func() {
+			h.tpm.FlushContext(session)
+		}
 	}
 	defer func() {
 		if err == nil {
 			return
 		}
-		h.tpm.FlushContext(session)
+		flushSession()
 	}()
 
 	if sessionType == tpm2.SessionTypePolicy {
@@ -1151,24 +1597,33 @@ func (h *executePolicyHelper) authorize(auth tpm2.ResourceContext, policy *Polic
 
 		var details PolicyBranchDetails
 		params := &PolicyExecuteParams{
-			Usage:                usage,
-			IgnoreAuthorizations: h.ignoreAuthorizations,
-			IgnoreNV:             h.ignoreNV,
+			Usage:                      usage,
+			IgnoreAuthorizations:       h.ignoreAuthorizations,
+			IgnoreNV:                   h.ignoreNV,
+			AssumeAuthorizationFailure: h.assumeAuthFailure,
+			MaxBranchPaths:             h.maxPaths,
+			Approver:                   h.approver,
+			DigestCache:                h.digestCache,
+		}
+
+		tpmSession := newTpmPolicySession(h.tpm, session)
+		if h.approver != nil {
+			tpmSession = newApprovingPolicySession(tpmSession, h.approver)
 		}
 
 		runner := newPolicyRunner(
-			newProxyPolicySession(newTpmPolicySession(h.tpm, session), &details),
+			newProxyPolicySession(tpmSession, &details),
 			h.tickets,
 			h.resources,
 			func(runner *policyRunner) policyRunnerHelper {
-				return newExecutePolicyHelper(runner, h.tpm, params, h.subPolicyRunner, h.hasResources)
+				return newExecutePolicyHelper(runner, h.tpm, params, h.subPolicyRunner, h.nvSessions, h.hasResources)
 			})
 		runner.pushElements(policy.policy.Policy)
 
 		h.subPolicyRunner.pushRunner(
 			runner,
 			func(err error) error {
-				defer h.tpm.FlushContext(session)
+				defer flushSession()
 				if err != nil {
 					return complete(&SubPolicyError{err: err}, nil)
 				}
@@ -1189,12 +1644,103 @@ func (h *executePolicyHelper) authorize(auth tpm2.ResourceContext, policy *Polic
 	}
 
 	h.controller.pushTasks(func() error {
-		defer h.tpm.FlushContext(session)
+		defer flushSession()
 		return complete(nil, session)
 	})
 	return nil
 }
 
+// setAutoSelectedPath updates the remaining path components from the automatically
+// selected path for a subtree, in a way that is consistent with the original component.
+func (h *executePolicyHelper) setAutoSelectedPath(next, path, remaining policyBranchPath) {
+	switch next {
+	case "":
+		// We have a path for this whole subtree
+		h.remaining = path
+		h.autoComponents = path.NumComponents()
+	case "**":
+		// Prepend the path for this whole subtree to the remaining components
+		h.remaining = path.Concat(remaining)
+		h.autoComponents = path.NumComponents()
+	case "*":
+		// Prepend the first component of the path for this subtree to the remaining components
+		component, _ := path.PopNextComponent()
+		h.remaining = component.Concat(remaining)
+		h.autoComponents = 1
+	default:
+		panic("not reached")
+	}
+}
+
+// consumeComponent is called when a path component is consumed, and indicates
+// whether it was supplied explicitly by the caller.
+func (h *executePolicyHelper) consumeComponent() (explicit bool) {
+	if h.autoComponents > 0 {
+		h.autoComponents--
+		return false
+	}
+	return true
+}
+
+// enterPath updates the current path when a branch or authorized policy is selected.
+func (h *executePolicyHelper) enterPath(name policyBranchPath, explicit bool) {
+	currentPath := h.controller.currentPath()
+	path := currentPath.Concat(name)
+	if explicit && currentPath == h.selectedPath {
+		h.selectedPath = path
+	}
+	h.controller.setCurrentPath(path)
+}
+
+// branchDigests returns the digests of the supplied branches for the session
+// algorithm. If a branch has no stored digest for the session algorithm, it is
+// computed if computeMissing is true (using the digest cache if one was supplied),
+// else ErrMissingDigest is returned.
+func (h *executePolicyHelper) branchDigests(branches policyBranches, computeMissing bool) (tpm2.DigestList, error) {
+	var digests tpm2.DigestList
+	var startDigest tpm2.Digest
+	for i, branch := range branches {
+		found := false
+		for _, digest := range branch.PolicyDigests {
+			if digest.HashAlg != h.sessionAlg {
+				continue
+			}
+
+			digests = append(digests, digest.Digest)
+			found = true
+			break
+		}
+		if found {
+			continue
+		}
+		if !computeMissing {
+			return nil, ErrMissingDigest
+		}
+
+		if startDigest == nil {
+			var err error
+			startDigest, err = h.controller.session().PolicyGetDigest()
+			if err != nil {
+				return nil, fmt.Errorf("cannot obtain current session digest: %w", err)
+			}
+		}
+
+		var digest tpm2.Digest
+		var err error
+		if h.digestCache != nil {
+			digest, err = h.digestCache.branchDigest(h.sessionAlg, startDigest, branch.Policy)
+		} else {
+			digest, err = computeBranchDigest(h.sessionAlg, startDigest, branch.Policy)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot compute digest for branch %d: %w", i, err)
+		}
+		digests = append(digests, digest)
+	}
+
+	return digests, nil
+}
+
 func (h *executePolicyHelper) handleBranches(branches policyBranches, complete func(tpm2.DigestList, int) error) error {
 	if len(branches) == 0 {
 		return errors.New("no branches")
@@ -1208,22 +1754,9 @@ func (h *executePolicyHelper) handleBranches(branches policyBranches, complete f
 		if !h.hasResources {
 			resources = nil
 		}
-		selector := newPolicyBranchSelector(h.sessionAlg, resources, h.controller, h.subPolicyRunner, h.tpm, h.usage, h.ignoreAuthorizations, h.ignoreNV)
+		selector := newPolicyBranchSelector(h.sessionAlg, resources, h.tickets, h.controller, h.subPolicyRunner, h.nvSessions, h.tpm, h.usage, h.ignoreAuthorizations, h.ignoreNV, h.assumeAuthFailure, h.maxPaths)
 		if err := selector.selectPath(branches, func(path policyBranchPath) error {
-			switch next {
-			case "":
-				// We have a path for this whole subtree
-				h.remaining = path
-			case "**":
-				// Prepend the path for this whole subtree to the remaining components
-				h.remaining = path.Concat(remaining)
-			case "*":
-				// Prepend the first component of the path for this subtree to the remaining components
-				component, _ := path.PopNextComponent()
-				h.remaining = component.Concat(remaining)
-			default:
-				panic("not reached")
-			}
+			h.setAutoSelectedPath(next, path, remaining)
 
 			// rerun branch node
 			h.controller.pushElements(policyElements{&policyElement{
@@ -1239,45 +1772,78 @@ func (h *executePolicyHelper) handleBranches(branches policyBranches, complete f
 
 	// We have a branch selector
 	h.remaining = remaining
-	selected, err := h.selectBranch(branches, next)
-	if err != nil {
-		return err
-	}
+	explicit := h.consumeComponent()
 
-	// Obtain the branch digests
 	var digests tpm2.DigestList
-	for _, branch := range branches {
-		found := false
-		for _, digest := range branch.PolicyDigests {
-			if digest.HashAlg != h.sessionAlg {
-				continue
-			}
-
-			digests = append(digests, digest.Digest)
-			found = true
-			break
+	if strings.HasPrefix(string(next), "$digest:") {
+		// Selecting a branch by digest doesn't depend on the policy having
+		// stored digests for the session algorithm, so compute any that are
+		// missing and select from those.
+		var err error
+		digests, err = h.branchDigests(branches, true)
+		if err != nil {
+			return err
 		}
-		if !found {
-			return ErrMissingDigest
+		withDigests := make(policyBranches, 0, len(branches))
+		for i, branch := range branches {
+			withDigests = append(withDigests, &policyBranch{
+				Name:          branch.Name,
+				PolicyDigests: taggedHashList{{HashAlg: h.sessionAlg, Digest: digests[i]}},
+				Policy:        branch.Policy,
+			})
 		}
+		branches = withDigests
 	}
 
-	// Run it!
-	h.controller.pushTasks(func() error {
-		if err := complete(digests, selected); err != nil {
-			return fmt.Errorf("cannot complete: %w", err)
+	selected, err := h.selectBranch(h.sessionAlg, branches, next)
+	if err != nil {
+		return &branchSelectionError{err: err}
+	}
+
+	if digests == nil {
+		digests, err = h.branchDigests(branches, h.digestCache != nil)
+		if err != nil {
+			return err
 		}
-		return nil
-	})
-	h.controller.pushElements(branches[selected].Policy)
+	}
 
 	name := policyBranchPath(branches[selected].Name)
 	if len(name) == 0 {
 		name = next
 	}
-	h.controller.setCurrentPath(h.controller.currentPath().Concat(name))
 
-	return nil
+	// Run it!
+	run := func() {
+		h.controller.pushTasks(func() error {
+			if err := complete(digests, selected); err != nil {
+				return fmt.Errorf("cannot complete: %w", err)
+			}
+			return nil
+		})
+		h.controller.pushElements(branches[selected].Policy)
+		h.enterPath(name, explicit)
+	}
+
+	if !explicit || !h.verifyPath {
+		run()
+		return nil
+	}
+
+	// Check that the explicitly selected branch is still appropriate in the same
+	// way as if it had been selected automatically.
+	resources := h.resources
+	if !h.hasResources {
+		resources = nil
+	}
+	selector := newPolicyBranchSelector(h.sessionAlg, resources, h.tickets, h.controller, h.subPolicyRunner, h.nvSessions, h.tpm, h.usage, h.ignoreAuthorizations, h.ignoreNV, h.assumeAuthFailure, h.maxPaths)
+	selector.verifyPath = h.controller.currentPath().Concat(name)
+	if err := selector.selectPath(branches[selected:selected+1], func(policyBranchPath) error {
+		run()
+		return nil
+	}); err != nil {
+		return fmt.Errorf("cannot verify selected branch: %w", err)
+	}
+	return nil
 }
 
 func (h *executePolicyHelper) handleAuthorizedPolicy(keySign *tpm2.Public, policyRef tpm2.Nonce, policies []*Policy, complete func(tpm2.Digest, *tpm2.TkVerified) error) error {
@@ -1292,21 +1858,22 @@ func (h *executePolicyHelper) handleAuthorizedPolicy(keySign *tpm2.Public, polic
 
 			candidatePolicies = append(candidatePolicies, policy)
 			branches = append(branches, &policyBranch{
-				Name:   policyBranchName(fmt.Sprintf("%x", digest.Digest)),
-				Policy: policy.policy.Policy,
+				Name:          policyBranchName(fmt.Sprintf("%x", digest.Digest)),
+				PolicyDigests: taggedHashList{digest},
+				Policy:        policy.policy.Policy,
 			})
 			break
 		}
 	}
 	if len(candidatePolicies) == 0 {
-		return errors.New("no valid candidate policies")
+		return &branchSelectionError{err: errors.New("no valid candidate policies")}
 	}
 
 	next, remaining := h.remaining.PopNextComponent()
 	switch {
-	case len(next) > 0 && next[0] == '$':
+	case len(next) > 0 && next[0] == '$' && !strings.HasPrefix(string(next), "$digest:"):
 		// Don't permit numeric selectors for authorized policies.
-		return fmt.Errorf("invalid path component \"%s\" for authorized policy selector", next)
+		return &branchSelectionError{err: fmt.Errorf("invalid path component \"%s\" for authorized policy selector", next)}
 	case len(next) == 0 || next[0] == '*':
 		// There are no more components or the next component is a wildcard match - build a
 		// list of candidate paths for this subtree
@@ -1314,22 +1881,9 @@ func (h *executePolicyHelper) handleAuthorizedPolicy(keySign *tpm2.Public, polic
 		if !h.hasResources {
 			resources = nil
 		}
-		selector := newPolicyBranchSelector(h.sessionAlg, resources, h.controller, h.subPolicyRunner, h.tpm, h.usage, h.ignoreAuthorizations, h.ignoreNV)
+		selector := newPolicyBranchSelector(h.sessionAlg, resources, h.tickets, h.controller, h.subPolicyRunner, h.nvSessions, h.tpm, h.usage, h.ignoreAuthorizations, h.ignoreNV, h.assumeAuthFailure, h.maxPaths)
 		if err := selector.selectPath(branches, func(path policyBranchPath) error {
-			switch next {
-			case "":
-				// We have a path for this whole subtree
-				h.remaining = path
-			case "**":
-				// Prepend the path for this whole subtree to the remaining components
-				h.remaining = path.Concat(remaining)
-			case "*":
-				// Prepend the first component of the path for this subtree to the remaining components
-				component, _ := path.PopNextComponent()
-				h.remaining = component.Concat(remaining)
-			default:
-				panic("not reached")
-			}
+			h.setAutoSelectedPath(next, path, remaining)
 
 			// rerun
 			h.controller.pushTasks(func() error {
@@ -1347,12 +1901,13 @@ func (h *executePolicyHelper) handleAuthorizedPolicy(keySign *tpm2.Public, polic
 
 	// We have a policy selector
 	h.remaining = remaining
-	selected, err := h.selectBranch(branches, next)
+	explicit := h.consumeComponent()
+	selected, err := h.selectBranch(h.sessionAlg, branches, next)
 	if err != nil {
-		return err
+		return &branchSelectionError{err: err}
 	}
 
-	h.controller.setCurrentPath(h.controller.currentPath().Concat(next))
+	h.enterPath(next, explicit)
 
 	policy := candidatePolicies[selected]
 
@@ -1421,7 +1976,10 @@ type PolicySessionUsage struct {
 	commandCode tpm2.CommandCode
 	handles     []Named
 	params      []interface{}
+	cpHash      tpm2.Digest
+	nameHash    tpm2.Digest
 	nvHandle    tpm2.Handle
+	template    *tpm2.Public
 	noAuthValue bool
 }
 
@@ -1434,6 +1992,21 @@ func NewPolicySessionUsage(command tpm2.CommandCode, handles []Named, params ...
 	}
 }
 
+// NewUsageFromHashes creates a new PolicySessionUsage from a precomputed command
+// parameter digest and name digest, for cases where the caller doesn't have access
+// to the command handles and parameters. Either digest may be nil. The digests must
+// be computed with the same algorithm as the session that the policy is executed
+// with. When a digest is supplied, it is used for selecting branches containing
+// TPM2_PolicyCpHash or TPM2_PolicyNameHash assertions instead of computing it from
+// the handles and parameters.
+func NewUsageFromHashes(command tpm2.CommandCode, cpHash, nameHash tpm2.Digest) *PolicySessionUsage {
+	return &PolicySessionUsage{
+		commandCode: command,
+		cpHash:      cpHash,
+		nameHash:    nameHash,
+	}
+}
+
 // WithNVHandle indicates that the policy session is being used to authorize a NV
 // index with the specified handle. This will panic if handle is not a NV index.
 func (u *PolicySessionUsage) WithNVHandle(handle tpm2.Handle) *PolicySessionUsage {
@@ -1444,6 +2017,16 @@ func (u *PolicySessionUsage) WithNVHandle(handle tpm2.Handle) *PolicySessionUsag
 	return u
 }
 
+// WithTemplate indicates that the policy session is being used to authorize the
+// creation of an object from the supplied template, for use with policies that
+// contain TPM2_PolicyTemplate assertions. Automatic branch selection excludes
+// branches that contain TPM2_PolicyTemplate assertions unless a template is supplied
+// for TPM2_Create, TPM2_CreatePrimary or TPM2_CreateLoaded.
+func (u *PolicySessionUsage) WithTemplate(template *tpm2.Public) *PolicySessionUsage {
+	u.template = template
+	return u
+}
+
 // NoAuthValue indicates that the policy session is being used to authorize a
 // resource that the authorization value cannot be determined for.
 func (u *PolicySessionUsage) NoAuthValue() *PolicySessionUsage {
@@ -1451,6 +2034,73 @@ func (u *PolicySessionUsage) NoAuthValue() *PolicySessionUsage {
 	return u
 }
 
+// matchesBranch indicates whether this usage is compatible with the policy
+// branch with the supplied details. This doesn't consider TPM2_PolicyNvWritten
+// assertions, which require access to the TPM.
+func (u *PolicySessionUsage) matchesBranch(alg tpm2.HashAlgorithmId, d *PolicyBranchDetails) (bool, error) {
+	code, set := d.CommandCode()
+	if set && code != u.commandCode {
+		return false, nil
+	}
+
+	cpHash, set := d.CpHash()
+	if set {
+		usageCpHash := u.cpHash
+		if usageCpHash == nil {
+			var err error
+			usageCpHash, err = ComputeCpHash(alg, u.commandCode, u.handles, u.params...)
+			if err != nil {
+				return false, fmt.Errorf("cannot obtain cpHash from usage parameters: %w", err)
+			}
+		}
+		if !bytes.Equal(usageCpHash, cpHash) {
+			return false, nil
+		}
+	}
+
+	nameHash, set := d.NameHash()
+	if set {
+		usageNameHash := u.nameHash
+		if usageNameHash == nil {
+			var err error
+			usageNameHash, err = ComputeNameHash(alg, u.handles...)
+			if err != nil {
+				return false, fmt.Errorf("cannot obtain nameHash from usage parameters: %w", err)
+			}
+		}
+		if !bytes.Equal(usageNameHash, nameHash) {
+			return false, nil
+		}
+	}
+
+	templateHash, set := d.TemplateHash()
+	if set {
+		// TPM2_PolicyTemplate can only be satisfied when creating an object
+		// from a template with a matching templateHash.
+		switch u.commandCode {
+		case tpm2.CommandCreate, tpm2.CommandCreatePrimary, tpm2.CommandCreateLoaded:
+		default:
+			return false, nil
+		}
+		if u.template == nil {
+			return false, nil
+		}
+		usageTemplateHash, err := ComputeTemplateHash(alg, u.template)
+		if err != nil {
+			return false, fmt.Errorf("cannot obtain templateHash from usage template: %w", err)
+		}
+		if !bytes.Equal(usageTemplateHash, templateHash) {
+			return false, nil
+		}
+	}
+
+	if d.AuthValueNeeded && u.noAuthValue {
+		return false, nil
+	}
+
+	return true, nil
+}
+
 type PolicyAuthorizationID = PolicyAuthorizationDetails
 
 // PolicyExecuteParams contains parameters that are useful for executing a policy.
@@ -1472,10 +2122,15 @@ type PolicyExecuteParams struct {
 	//
 	// When selecting a branch, a component can either identify a branch by its
 	// name (if it has one), or it can be a numeric identifier of the form "$[n]"
-	// which selects the branch at index n.
+	// which selects the branch at index n. A branch can also be selected by its
+	// digest for the current session algorithm with a component of the form
+	// "$digest:<hex>", which is independent of the order of the branches. Branch
+	// digests that aren't stored in the policy for the current session algorithm are
+	// computed in order to select a branch this way.
 	//
 	// When selecting an authorized policy, a component identifies the policy by
-	// specifying the digest of the policy for the current session algorithm.
+	// specifying the digest of the policy for the current session algorithm,
+	// either on its own or with the "$digest:" prefix.
 	//
 	// If a component is "**", then Policy.Execute will attempt to automatically
 	// select an execution path for the entire sub-tree associated with the current
@@ -1494,6 +2149,28 @@ type PolicyExecuteParams struct {
 	// execution path for the remainder of the policy automatically.
 	Path string
 
+	// StrictPath indicates that Path should be checked for empty components before
+	// execution, so that a path with a leading or trailing '/' character or with
+	// consecutive '/' characters is rejected with an error rather than having the
+	// empty components ignored. This can be used to catch typos in paths.
+	StrictPath bool
+
+	// VerifyPath indicates that Path is an execution path that was recorded previously,
+	// eg, from the Path field of PolicyExecuteResult, and that each branch that it
+	// selects explicitly should be checked against the current state in the same way
+	// as branches are checked when they are selected automatically. This makes it
+	// possible to pin an automatically selected path and detect when the state that
+	// it depends on (such as PCR values, NV index contents or the TPM's clock) has
+	// changed. If a selected branch is no longer appropriate, a *StateChangedError
+	// error is returned. Explicitly selected authorized policies are not checked.
+	VerifyPath bool
+
+	// DigestCache can be used to supply a cache of computed branch digests. If this
+	// is set, the digests of branches that don't have a stored digest for the session
+	// algorithm are computed and cached rather than ErrMissingDigest being returned,
+	// so that subsequent executions with the same cache can reuse them.
+	DigestCache *PolicyDigestCache
+
 	// IgnoreAuthorizations can be used to indicate that branches containing TPM2_PolicySigned,
 	// TPM2_PolicySecret or TPM2_PolicyAuthorize assertions matching the specified ID should
 	// be ignored. This can be used where these assertions have failed on previous runs.
@@ -1505,6 +2182,84 @@ type PolicyExecuteParams struct {
 	// these assertions have failed due to an authorization issue on previous runs. This
 	// propagates to sub-policies.
 	IgnoreNV []Named
+
+	// AssumeAuthorizationFailure changes how automatic branch selection treats
+	// conditions that it can't verify in advance. By default, branch selection
+	// assumes that TPM2_PolicySecret and TPM2_PolicySigned assertions will succeed,
+	// and that TPM2_PolicyNV assertions will succeed if their conditions can't be
+	// checked. If this is set, these assertions are assumed to fail instead, so
+	// that a branch is only selected if a ticket has been supplied for each of its
+	// TPM2_PolicySecret and TPM2_PolicySigned assertions, and the conditions of each
+	// of its TPM2_PolicyNV assertions have been verified against the current NV index
+	// contents. This propagates to sub-policies.
+	AssumeAuthorizationFailure bool
+
+	// MaxBranchPaths limits the number of complete execution paths that will be
+	// considered during automatic branch selection. If a policy has more paths than
+	// this, execution fails with an error. The default of zero means that
+	// DefaultMaxBranchPaths is used. This propagates to sub-policies.
+	MaxBranchPaths int
+
+	// NVCheckSessionLimit limits the number of sessions that will be loaded at
+	// any one time for reading NV indices in order to check TPM2_PolicyNV
+	// conditions during automatic branch selection. These sessions are reused
+	// for indices with the same name algorithm and are flushed once branch
+	// selection has completed. If a session can't be obtained because this limit
+	// has been reached or because the TPM has no more session slots available,
+	// the affected conditions are not checked and are returned in the UncheckedNV
+	// field of PolicyExecuteResult. The default of zero means no limit.
+	NVCheckSessionLimit int
+
+	// NVCheckSessionSymmetric specifies the symmetric algorithm for the sessions
+	// used to read NV indices in order to check TPM2_PolicyNV conditions during
+	// automatic branch selection. If this is set to an algorithm other than
+	// tpm2.SymAlgorithmNull, these sessions are used with response parameter
+	// encryption so that the NV index contents are not sent from the TPM in
+	// the clear. Both tpm2.SymAlgorithmXOR and tpm2.SymAlgorithmAES in CFB mode
+	// are supported. This requires NVCheckSessionTPMKey to be set, and the supplied
+	// TPMConnection to implement [SaltedSessionTPMConnection]. The default of nil
+	// means that response parameter encryption is not used.
+	NVCheckSessionSymmetric *tpm2.SymDef
+
+	// NVCheckSessionTPMKey is a loaded key that is used to salt the sessions used to
+	// read NV indices when NVCheckSessionSymmetric is set. Without a salt, the session
+	// key would be derived only from nonces that are visible on the TPM interface, and
+	// response parameter encryption would provide no confidentiality.
+	NVCheckSessionTPMKey tpm2.ResourceContext
+
+	// RecordTranscript indicates that the TPM commands issued during execution
+	// should be recorded and returned in the Transcript field of PolicyExecuteResult.
+	// This includes commands issued for automatic branch selection, and doesn't
+	// affect the session.
+	RecordTranscript bool
+
+	// ReturnDigest indicates that the digest of the session should be read from
+	// the TPM with TPM2_PolicyGetDigest once execution has completed, and returned
+	// in the Digest field of PolicyExecuteResult. This is useful for diagnostics,
+	// such as comparing the digest against the authorization policy of a resource
+	// when a session fails to authorize it.
+	ReturnDigest bool
+
+	// ValidateParams indicates that the parameters for the TPM2_PolicySecret and
+	// TPM2_PolicySigned assertions in the branches selected by Path should be checked
+	// before anything is sent to the TPM. If no PolicyResourceLoader is supplied, each
+	// of these assertions requires a ticket in Tickets. If none of the branches selected
+	// by Path have all of the parameters that they require, an error is returned before
+	// the policy is partially executed. If a PolicyResourceLoader is supplied, assertions
+	// without a ticket are checked with it, which requires it to implement
+	// [AuthorizationChecker]. Assertions in authorized policies are not checked.
+	ValidateParams bool
+
+	// Approver is called with a description of each assertion before it is issued
+	// to the TPM, eg, "TPM2_PolicyCommandCode(TPM_CC_Unseal)". This can be used to
+	// log assertions or to require confirmation for each of them. If it returns an
+	// error, the assertion is not issued and execution is aborted with an error that
+	// wraps it. This includes assertions in the policies of objects that are used to
+	// authorize TPM2_PolicySecret and TPM2_PolicyNV assertions. Commands issued for
+	// automatic branch selection and for loading resources are not subject to
+	// approval. An aborted session is left partially executed, and can be reused
+	// once it has been restarted with TPM2_PolicyRestart.
+	Approver func(nextAssertion string) error
 }
 
 // PolicyExecuteResult is returned from [Policy.Execute].
@@ -1518,8 +2273,27 @@ type PolicyExecuteResult struct {
 	// TPM2_PolicyPassword assertion.
 	AuthValueNeeded bool
 
-	// Path indicates the executed path.
+	// Path indicates the executed path. This includes branches and authorized
+	// policies that were selected automatically, with unnamed branches identified
+	// by a component of the form "$[n]", and it can be supplied as the Path field of
+	// PolicyExecuteParams in order to execute the same path again.
 	Path string
+
+	// Transcript contains the TPM commands issued during execution, in order, if
+	// the RecordTranscript field of PolicyExecuteParams was set.
+	Transcript []*PolicyTranscriptEntry
+
+	// Digest contains the digest of the session after execution, if the
+	// ReturnDigest field of PolicyExecuteParams was set.
+	Digest tpm2.Digest
+
+	// UncheckedNV contains the TPM2_PolicyNV assertions whose conditions couldn't
+	// be checked during automatic branch selection because a session wasn't
+	// available for reading the NV index, either because the NVCheckSessionLimit
+	// field of PolicyExecuteParams was reached or because the TPM ran out of
+	// session slots. Branches containing these assertions were not verified
+	// against the current NV index contents before being selected.
+	UncheckedNV []PolicyNVDetails
 }
 
 // Execute runs this policy using the supplied TPM context and on the supplied policy session.
@@ -1553,8 +2327,12 @@ type PolicyExecuteResult struct {
 //   - It uses TPM2_PolicyNV with conditions that will fail against the current NV index contents,
 //     if the index has an authorization policy that permits the use of TPM2_NV_Read without any
 //     other conditions, else the condition isn't checked.
-//   - It uses TPM2_PolicyPCR with values that don't match the current PCR values.
+//   - It uses TPM2_PolicyPCR with values that don't match the current PCR values. Each PCR is
+//     read from the TPM at most once during a single execution.
 //   - It uses TPM2_PolicyCounterTimer with conditions that will fail.
+//   - It uses TPM2_PolicySecret or TPM2_PolicySigned without a corresponding ticket, or
+//     TPM2_PolicyNV with conditions that can't be verified, and the AssumeAuthorizationFailure
+//     field of [PolicyExecuteParams] is set.
 //
 // On success, the supplied policy session may be used for authorization in a context that requires
 // that this policy is satisfied.
@@ -1565,25 +2343,62 @@ func (p *Policy) Execute(tpm TPMConnection, session tpm2.SessionContext, resourc
 	if session == nil {
 		return nil, errors.New("no session")
 	}
+	if params == nil {
+		params = new(PolicyExecuteParams)
+	}
+	if params.StrictPath {
+		if err := policyBranchPath(params.Path).Validate(); err != nil {
+			return nil, fmt.Errorf("invalid path: %w", err)
+		}
+	}
+	if params.ValidateParams {
+		if err := p.validateExecuteParams(session.HashAlg(), resources, params); err != nil {
+			return nil, fmt.Errorf("invalid parameters: %w", err)
+		}
+	}
 	hasResources := resources != nil
 	if resources == nil {
 		resources = new(nullPolicyResourceLoader)
 	}
-	if params == nil {
-		params = new(PolicyExecuteParams)
+
+	if params.NVCheckSessionSymmetric != nil && params.NVCheckSessionSymmetric.Algorithm != tpm2.SymAlgorithmNull {
+		if params.NVCheckSessionTPMKey == nil {
+			return nil, errors.New("NVCheckSessionSymmetric requires NVCheckSessionTPMKey")
+		}
+		if _, ok := tpm.(SaltedSessionTPMConnection); !ok {
+			return nil, errors.New("NVCheckSessionSymmetric requires a TPMConnection that implements SaltedSessionTPMConnection")
+		}
 	}
 
+	var transcript *transcriptTpmConnection
+	if params.RecordTranscript {
+		transcript = newTranscriptTpmConnection(tpm)
+		tpm = transcript
+	}
+	// PCR values are read at most once during execution.
+	tpm = newPcrCacheTpmConnection(tpm)
+
 	executor := new(policyExecutor)
 
+	nvSessions := newPolicySessionPool(tpm, params.NVCheckSessionLimit, params.NVCheckSessionSymmetric, params.NVCheckSessionTPMKey)
+	defer nvSessions.flush()
+
 	var details PolicyBranchDetails
 	ticketMap := makeExecutePolicyTickets()
 
+	tpmSession := newTpmPolicySession(tpm, session)
+	if params.Approver != nil {
+		tpmSession = newApprovingPolicySession(tpmSession, params.Approver)
+	}
+
+	var helper *executePolicyHelper
 	runner := newPolicyRunner(
-		newProxyPolicySession(newTpmPolicySession(tpm, session), &details),
+		newProxyPolicySession(tpmSession, &details),
 		ticketMap,
 		resources,
 		func(runner *policyRunner) policyRunnerHelper {
-			return newExecutePolicyHelper(runner, tpm, params, executor, hasResources)
+			helper = newExecutePolicyHelper(runner, tpm, params, executor, nvSessions, hasResources)
+			return helper
 		},
 	)
 	for _, ticket := range params.Tickets {
@@ -1591,21 +2406,193 @@ func (p *Policy) Execute(tpm TPMConnection, session tpm2.SessionContext, resourc
 	}
 
 	if err := executor.run(runner, p.policy.Policy); err != nil {
+		var pe *PolicyError
+		var bse *branchSelectionError
+		if errors.As(err, &pe) && len(pe.Path) > 0 && policyBranchPath(pe.Path) == helper.selectedPath && !errors.As(err, &bse) {
+			// The error occurred on a path that the caller asked for.
+			return nil, &SelectedBranchError{Path: pe.Path, err: err}
+		}
 		return nil, err
 	}
 
 	result = &PolicyExecuteResult{
 		AuthValueNeeded: details.AuthValueNeeded,
 		Path:            string(runner.policyCurrentPath),
+		UncheckedNV:     nvSessions.unchecked,
 	}
 
 	for _, ticket := range ticketMap {
 		result.Tickets = append(result.Tickets, ticket)
 	}
 
+	if params.ReturnDigest {
+		digest, err := tpm.PolicyGetDigest(session)
+		if err != nil {
+			return nil, fmt.Errorf("cannot obtain session digest: %w", err)
+		}
+		result.Digest = digest
+	}
+
+	if transcript != nil {
+		// Flush the NV sessions now so that this is included in the transcript.
+		nvSessions.flush()
+		result.Transcript = transcript.transcript
+	}
+
 	return result, nil
 }
 
+// validateExecuteParams checks that at least one of the branches selected by the path
+// in the supplied params has the parameters required for each of its TPM2_PolicySecret
+// and TPM2_PolicySigned assertions, either as a ticket or from the supplied resources.
+func (p *Policy) validateExecuteParams(alg tpm2.HashAlgorithmId, resources PolicyResourceLoader, params *PolicyExecuteParams) error {
+	var checker AuthorizationChecker
+	missingErr := errors.New("no ticket or PolicyResourceLoader")
+	if resources != nil {
+		var ok bool
+		checker, ok = resources.(AuthorizationChecker)
+		if !ok {
+			return errors.New("the supplied PolicyResourceLoader does not implement AuthorizationChecker")
+		}
+		missingErr = errors.New("no ticket and the PolicyResourceLoader cannot provide the authorization")
+	}
+
+	details, err := p.Details(alg, params.Path)
+	if err != nil {
+		return fmt.Errorf("cannot obtain branch details: %w", err)
+	}
+
+	tickets := make(map[paramKey]struct{})
+	for _, ticket := range params.Tickets {
+		tickets[policyParamKey(ticket.AuthName, ticket.PolicyRef)] = struct{}{}
+	}
+
+	var paths []string
+	for path := range details {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var firstErr error
+	for _, path := range paths {
+		d := details[path]
+
+		var auths []PolicyAuthorizationDetails
+		auths = append(auths, d.Secret...)
+		auths = append(auths, d.Signed...)
+
+		var branchErr error
+		for i, auth := range auths {
+			if _, ok := tickets[policyParamKey(auth.AuthName, auth.PolicyRef)]; ok {
+				continue
+			}
+			if checker != nil {
+				if i < len(d.Secret) && checker.CanAuthorizeSecret(auth.AuthName) {
+					continue
+				}
+				if i >= len(d.Secret) && checker.CanSignAuthorization(auth.AuthName, auth.PolicyRef) {
+					continue
+				}
+			}
+			branchErr = &PolicyAuthorizationError{AuthName: auth.AuthName, PolicyRef: auth.PolicyRef, err: missingErr}
+			break
+		}
+		if branchErr == nil {
+			return nil
+		}
+		if firstErr == nil {
+			branch := "root branch"
+			if len(path) > 0 {
+				branch = "branch " + path
+			}
+			firstErr = fmt.Errorf("%s: %w", branch, branchErr)
+		}
+	}
+
+	return firstErr
+}
+
+// AssertSessionSatisfies checks that the digest of the supplied policy session matches
+// the supplied expected authorization policy, which is normally the authorization policy
+// of the resource that the session is going to be used to authorize. This is intended to
+// be called after executing this policy with [Policy.Execute], as a pre-flight check that
+// provides a descriptive error instead of the TPM_RC_POLICY_FAIL error that the TPM would
+// return from the command that uses the session.
+//
+// If the session digest doesn't match, the returned error also indicates whether the digest
+// of this policy matches the expected authorization policy, which helps to distinguish
+// between executing the wrong policy and an execution that left the session in an
+// unexpected state.
+func (p *Policy) AssertSessionSatisfies(tpm TPMConnection, session tpm2.SessionContext, expectedAuthPolicy tpm2.Digest) error {
+	if tpm == nil {
+		return errors.New("no TPM")
+	}
+	if session == nil {
+		return errors.New("no session")
+	}
+
+	digest, err := tpm.PolicyGetDigest(session)
+	if err != nil {
+		return fmt.Errorf("cannot obtain session digest: %w", err)
+	}
+	if bytes.Equal(digest, expectedAuthPolicy) {
+		return nil
+	}
+
+	alg := session.HashAlg()
+	computed, err := p.WithComputedDigests(alg)
+	if err != nil {
+		return fmt.Errorf("session digest %x does not match the expected authorization policy %x (cannot compute policy digest: %v)", digest, expectedAuthPolicy, err)
+	}
+	policyDigest, err := computed.Compute(alg)
+	if err != nil {
+		return fmt.Errorf("session digest %x does not match the expected authorization policy %x (cannot compute policy digest: %v)", digest, expectedAuthPolicy, err)
+	}
+	if !bytes.Equal(policyDigest, expectedAuthPolicy) {
+		return fmt.Errorf("session digest %x does not match the expected authorization policy %x, and the policy digest is %x", digest, expectedAuthPolicy, policyDigest)
+	}
+	return fmt.Errorf("session digest %x does not match the expected authorization policy %x", digest, expectedAuthPolicy)
+}
+
+// ResolveAutoPath returns the execution path that would be selected by [Policy.Execute]
+// for the supplied partial path and a policy session with the specified algorithm, without
+// satisfying this policy. Path components that are omitted from the partial path, or that
+// contain wildcards, are resolved to concrete branch names or indexes in the same way that
+// [Policy.Execute] selects them automatically. The Path field of the supplied params is
+// ignored. The result is the same as the Path field of [PolicyExecuteResult].
+//
+// This works by executing this policy with a trial session. As no [PolicyResourceLoader] is
+// supplied, paths that contain TPM2_PolicyNV, TPM2_PolicySecret, TPM2_PolicySigned or
+// TPM2_PolicyAuthorize assertions are not considered as candidates for automatic selection,
+// and an error will be returned if one of these is selected explicitly.
+func (p *Policy) ResolveAutoPath(tpm TPMConnection, alg tpm2.HashAlgorithmId, partial string, params *PolicyExecuteParams) (string, error) {
+	if tpm == nil {
+		return "", errors.New("no TPM")
+	}
+	if !alg.IsValid() {
+		return "", errors.New("invalid algorithm")
+	}
+
+	var execParams PolicyExecuteParams
+	if params != nil {
+		execParams = *params
+	}
+	execParams.Path = partial
+
+	session, err := tpm.StartAuthSession(tpm2.SessionTypeTrial, alg)
+	if err != nil {
+		return "", fmt.Errorf("cannot start trial session: %w", err)
+	}
+	defer tpm.FlushContext(session)
+
+	result, err := p.Execute(tpm, session, nil, &execParams)
+	if err != nil {
+		return "", err
+	}
+
+	return result.Path, nil
+}
+
 type nullTickets struct{}
 
 func (*nullTickets) ticket(authName tpm2.Name, policyRef tpm2.Nonce) *PolicyTicket {
@@ -1792,6 +2779,26 @@ func (p *Policy) computeForDigest(digest *taggedHash) error {
 	return nil
 }
 
+// EmptyPolicyDigest returns the digest of an empty policy for the specified algorithm,
+// which is a digest containing only zeros. This is the initial digest of a policy
+// session, so an object or NV index with this as its authorization policy can be
+// authorized with a policy session that hasn't been modified by any assertions. An
+// object or NV index only has no policy if its authorization policy is zero length.
+// This returns nil if the algorithm is not valid.
+func EmptyPolicyDigest(alg tpm2.HashAlgorithmId) tpm2.Digest {
+	if !alg.IsValid() {
+		return nil
+	}
+	return make(tpm2.Digest, alg.Size())
+}
+
+// IsEmpty indicates whether this policy contains no assertions, in which case its
+// digest is the same as the one returned from [EmptyPolicyDigest]. Executing an empty
+// policy has no effect on a policy session.
+func (p *Policy) IsEmpty() bool {
+	return len(p.policy.Policy) == 0
+}
+
 // Compute computes the digest for this policy for the specified algorithm. This also
 // updates stored digests within the policy, so the policy should be persisted after
 // calling this. On success, it returns the computed digest.
@@ -1818,6 +2825,138 @@ func (p *Policy) Compute(alg tpm2.HashAlgorithmId) (tpm2.Digest, error) {
 	return digest.Digest, nil
 }
 
+// WithComputedDigests returns a copy of this policy with the digests for the policy
+// and every branch computed and stored for each of the specified algorithms, so that
+// the serialized form of the returned policy is self-contained and can be executed
+// with a session for any of these algorithms. Any previously stored digests for the
+// specified algorithms are recomputed, and stored digests for any other algorithm are
+// removed, so the caller chooses exactly which algorithms are stored. This policy is
+// not modified.
+//
+// Policies that contain TPM2_PolicyCpHash or TPM2_PolicyNameHash assertions can only
+// be computed for a single digest algorithm.
+func (p *Policy) WithComputedDigests(algs ...tpm2.HashAlgorithmId) (*Policy, error) {
+	var policy *policy
+	if err := mu.CopyValue(&policy, p.policy); err != nil {
+		return nil, fmt.Errorf("cannot make copy of policy: %w", err)
+	}
+	policy.stripDigests(algs)
+	result := &Policy{policy: *policy}
+
+	for _, alg := range algs {
+		if !alg.IsValid() {
+			return nil, fmt.Errorf("invalid algorithm %v", alg)
+		}
+
+		digest := taggedHash{HashAlg: alg, Digest: make(tpm2.Digest, alg.Size())}
+		if err := result.computeForDigest(&digest); err != nil {
+			return nil, fmt.Errorf("cannot compute digest for %v: %w", alg, err)
+		}
+	}
+
+	return result, nil
+}
+
+// StripDigests returns a copy of this policy with the stored digests for the policy
+// and every branch removed, except for those for the specified algorithms. This can
+// be used to keep the serialized form of a policy small, or to limit it to the
+// algorithms supported by a particular TPM. The stripped digests can be computed
+// again with [Policy.Compute]. This policy is not modified.
+func (p *Policy) StripDigests(keep ...tpm2.HashAlgorithmId) *Policy {
+	var policy *policy
+	mu.MustCopyValue(&policy, p.policy)
+	policy.stripDigests(keep)
+	return &Policy{policy: *policy}
+}
+
+// mergeTaggedHashes returns dst with any digests from src for algorithms that are
+// missing from dst appended to it. An error is returned if both lists contain
+// different digests for the same algorithm.
+func mergeTaggedHashes(dst, src taggedHashList) (taggedHashList, error) {
+	for _, digest := range src {
+		found := false
+		for _, d := range dst {
+			if d.HashAlg != digest.HashAlg {
+				continue
+			}
+			if !bytes.Equal(d.Digest, digest.Digest) {
+				return nil, fmt.Errorf("conflicting digests for %v", digest.HashAlg)
+			}
+			found = true
+			break
+		}
+		if !found {
+			dst = append(dst, digest)
+		}
+	}
+	return dst, nil
+}
+
+// mergeDigestsFrom merges the stored digests for every branch from other, which must
+// be structurally identical.
+func (e policyElements) mergeDigestsFrom(other policyElements) error {
+	for i, element := range e {
+		if element.Type != tpm2.CommandPolicyOR {
+			continue
+		}
+		for j, branch := range element.Details.OR.Branches {
+			otherBranch := other[i].Details.OR.Branches[j]
+
+			digests, err := mergeTaggedHashes(branch.PolicyDigests, otherBranch.PolicyDigests)
+			if err != nil {
+				return fmt.Errorf("cannot merge digests for branch %d: %w", j, err)
+			}
+			branch.PolicyDigests = digests
+
+			if err := branch.Policy.mergeDigestsFrom(otherBranch.Policy); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// MergeDigestsFrom copies the stored digests for the policy and every branch from
+// other into this policy, for any algorithm that this policy doesn't already have
+// a stored digest for. This is useful for combining the digests of the same policy
+// that has been computed for different algorithms, eg, on different systems. The
+// policy should be persisted after calling this.
+//
+// The two policies must be structurally identical, ignoring their stored digests,
+// else an error is returned. An error is also returned if both policies have
+// different stored digests for the same algorithm. Policy authorizations are not
+// copied. This policy is not modified if an error is returned.
+//
+// Policies that contain TPM2_PolicyCpHash or TPM2_PolicyNameHash assertions can only
+// be computed for a single digest algorithm, so policies containing these that have
+// been computed for different algorithms are not structurally identical.
+func (p *Policy) MergeDigestsFrom(other *Policy) error {
+	if !mu.DeepEqual(p.StripDigests().policy.Policy, other.StripDigests().policy.Policy) {
+		return errors.New("policies are not structurally identical")
+	}
+
+	var src *policy
+	if err := mu.CopyValue(&src, other.policy); err != nil {
+		return fmt.Errorf("cannot make copy of other policy: %w", err)
+	}
+	var policy *policy
+	if err := mu.CopyValue(&policy, p.policy); err != nil {
+		return fmt.Errorf("cannot make copy of policy: %w", err)
+	}
+
+	digests, err := mergeTaggedHashes(policy.PolicyDigests, src.PolicyDigests)
+	if err != nil {
+		return err
+	}
+	policy.PolicyDigests = digests
+	if err := policy.Policy.mergeDigestsFrom(src.Policy); err != nil {
+		return err
+	}
+
+	p.policy = *policy
+	return nil
+}
+
 // Authorize signs this policy with the supplied signer so that it can be used as an
 // authorized policy for a TPM2_PolicyAuthorize assertion with the supplied authKey and
 // policyRef. Calling this updates the policy, so it should be persisted afterwards.
@@ -1862,12 +3001,69 @@ func (p *Policy) Authorize(rand io.Reader, authKey *tpm2.Public, policyRef tpm2.
 	return nil
 }
 
+// ReauthorizePolicy creates a new signed authorization for the supplied policy, for use
+// in a TPM2_PolicyAuthorize assertion, using the same key and policy ref as the supplied
+// existing authorization. This is useful when an approved policy changes and needs to be
+// signed again. The supplied signer must correspond to the public key of the existing
+// authorization. The digest of the supplied policy is computed for the name algorithm of
+// that public key, and the digest algorithm specified by opts must match it.
+//
+// If opts is nil, the digest algorithm is the name algorithm of the public key.
+//
+// The supplied policy is not modified, and the returned authorization is not added to
+// it. Use [Policy.Authorize] for that instead.
+func ReauthorizePolicy(rand io.Reader, old *PolicyAuthorization, newPolicy *Policy, signer crypto.Signer, opts crypto.SignerOpts) (*PolicyAuthorization, error) {
+	if old == nil || old.AuthKey == nil {
+		return nil, errors.New("no existing authorization")
+	}
+	if newPolicy == nil {
+		return nil, errors.New("no policy")
+	}
+
+	authName := old.AuthKey.Name()
+	if !authName.IsValid() || authName.Type() != tpm2.NameTypeDigest {
+		return nil, errors.New("invalid authKey")
+	}
+	hashAlg := authName.Algorithm()
+	if opts == nil {
+		opts = hashAlg.GetHash()
+	}
+	if opts.HashFunc() != hashAlg.GetHash() {
+		return nil, errors.New("mismatched authKey name and opts")
+	}
+
+	if old.AuthKey.IsAsymmetric() {
+		pub, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool })
+		if ok && !pub.Equal(old.AuthKey.Public()) {
+			return nil, errors.New("signer does not correspond to the authKey of the existing authorization")
+		}
+	}
+
+	// Compute the digest from a copy so that the supplied policy isn't updated
+	// with digests for a new algorithm.
+	var policyCopy *Policy
+	if err := mu.CopyValue(&policyCopy, newPolicy); err != nil {
+		return nil, fmt.Errorf("cannot make temporary copy of policy: %w", err)
+	}
+	approvedPolicy, err := policyCopy.Compute(hashAlg)
+	if err != nil {
+		return nil, fmt.Errorf("cannot compute digest: %w", err)
+	}
+
+	auth, err := SignPolicyAuthorization(rand, approvedPolicy, old.AuthKey, old.PolicyRef, signer, opts)
+	if err != nil {
+		return nil, fmt.Errorf("cannot sign authorization: %w", err)
+	}
+	return auth, nil
+}
+
 type validatePolicyHelper struct {
 	controller policyRunnerController
+	strict     bool
 }
 
-func newValidatePolicyHelper(runner *policyRunner) *validatePolicyHelper {
-	return &validatePolicyHelper{controller: runner}
+func newValidatePolicyHelper(runner *policyRunner, strict bool) *validatePolicyHelper {
+	return &validatePolicyHelper{controller: runner, strict: strict}
 }
 
 func (h *validatePolicyHelper) loadExternal(public *tpm2.Public) (ResourceContext, error) {
@@ -1925,6 +3121,16 @@ func (h *validatePolicyHelper) handleBranches(branches policyBranches, complete
 			}
 		}
 
+		if h.strict {
+			for i := range digests {
+				for j := 0; j < i; j++ {
+					if bytes.Equal(digests[i], digests[j]) {
+						return fmt.Errorf("branches %d and %d have the same digest (%x)", j, i, digests[i])
+					}
+				}
+			}
+		}
+
 		h.controller.pushTasks(func() error {
 			if err := complete(digests, 0); err != nil {
 				return fmt.Errorf("cannot complete: %w", err)
@@ -1954,6 +3160,18 @@ func (h *validatePolicyHelper) handleAuthorizedPolicy(keySign *tpm2.Public, poli
 // success, it returns the digest correpsonding to this policy for the
 // specified digest algorithm.
 func (p *Policy) Validate(alg tpm2.HashAlgorithmId) (tpm2.Digest, error) {
+	return p.validate(alg, false)
+}
+
+// ValidateStrict performs the same checks as [Policy.Validate], but additionally
+// returns an error if any branch node contains more than one branch with the same
+// digest for the specified algorithm. Such branches are redundant and are likely to
+// indicate an error when the policy was authored.
+func (p *Policy) ValidateStrict(alg tpm2.HashAlgorithmId) (tpm2.Digest, error) {
+	return p.validate(alg, true)
+}
+
+func (p *Policy) validate(alg tpm2.HashAlgorithmId, strict bool) (tpm2.Digest, error) {
 	var expectedDigest tpm2.Digest
 	for _, digest := range p.policy.PolicyDigests {
 		if digest.HashAlg != alg {
@@ -1973,7 +3191,7 @@ func (p *Policy) Validate(alg tpm2.HashAlgorithmId) (tpm2.Digest, error) {
 		newComputePolicySession(digest),
 		new(nullTickets),
 		new(mockPolicyResourceLoader),
-		func(runner *policyRunner) policyRunnerHelper { return newValidatePolicyHelper(runner) },
+		func(runner *policyRunner) policyRunnerHelper { return newValidatePolicyHelper(runner, strict) },
 	)
 	if err := runner.run(p.policy.Policy); err != nil {
 		return nil, err
@@ -2000,16 +3218,124 @@ func (p *Policy) Validate(alg tpm2.HashAlgorithmId) (tpm2.Digest, error) {
 	return expectedDigest, nil
 }
 
-// Branches returns the path of every branch in this policy. A TPM2_PolicyAuthorize assertion
-// is represented by a "…" component in a path.
-func (p *Policy) Branches() ([]string, error) {
-	var result []string
+// ValidateAll performs the same checks as [Policy.Validate] for each of the
+// specified digest algorithms, and returns the digests corresponding to this
+// policy for each of them. It returns an error identifying the algorithm for the
+// first algorithm that fails validation. If the policy doesn't have a stored
+// digest for one of the algorithms, the returned error wraps [ErrMissingDigest].
+func (p *Policy) ValidateAll(algs []tpm2.HashAlgorithmId) (map[tpm2.HashAlgorithmId]tpm2.Digest, error) {
+	if len(algs) == 0 {
+		return nil, errors.New("no algorithms")
+	}
 
-	var currentPath policyBranchPath
+	digests := make(map[tpm2.HashAlgorithmId]tpm2.Digest)
+	for _, alg := range algs {
+		if _, exists := digests[alg]; exists {
+			continue
+		}
+		digest, err := p.Validate(alg)
+		if err != nil {
+			return nil, fmt.Errorf("cannot validate policy for %v: %w", alg, err)
+		}
+		digests[alg] = digest
+	}
 
-	walker := newTreeWalker(
+	return digests, nil
+}
+
+// PolicyMatchesObject determines whether the supplied policy is the authorization
+// policy of the object with the supplied public area. The policy is validated with
+// [Policy.Validate] for the name algorithm of the object, and the resulting digest is
+// compared with the object's authorization policy digest. If the policy doesn't have
+// a stored digest for the object's name algorithm, an error that wraps
+// [ErrMissingDigest] is returned.
+func PolicyMatchesObject(policy *Policy, pub *tpm2.Public) (bool, error) {
+	if policy == nil {
+		return false, errors.New("no policy")
+	}
+	if pub == nil {
+		return false, errors.New("no public area")
+	}
+
+	alg, expected := objectutil.AuthPolicyDigest(pub)
+	if !alg.Available() {
+		return false, fmt.Errorf("unavailable name algorithm %v", alg)
+	}
+	digest, err := policy.Validate(alg)
+	if err != nil {
+		return false, fmt.Errorf("cannot validate policy: %w", err)
+	}
+	return bytes.Equal(digest, expected), nil
+}
+
+// NeedsPolicySession indicates whether the object with the supplied public area's
+// authorization policy must be executed in a policy session in order to authorize the
+// use of the object in the way described by usage, or whether the object's
+// authorization value could be used directly with a passphrase or HMAC session instead.
+// This only depends on the object's attributes and the intended usage.
+//
+// Commands that require the admin role for the object (TPM2_ActivateCredential,
+// TPM2_Certify and TPM2_ObjectChangeAuth) require a policy session if the object has
+// the [tpm2.AttrAdminWithPolicy] attribute set. TPM2_Duplicate requires the
+// duplication role, which always requires a policy session. Other commands require
+// the user role, which requires a policy session if the object does not have the
+// [tpm2.AttrUserWithAuth] attribute set.
+//
+// The object is identified in usage by its name. If usage doesn't contain any
+// handles, the object is assumed to be the first handle of the command. If usage
+// contains handles but none of them correspond to the object, or if usage indicates
+// that the authorization value is not available (see [PolicySessionUsage.NoAuthValue]),
+// this returns true. If usage is nil, the user role is assumed. If pub is nil, this
+// returns false.
+func NeedsPolicySession(pub *tpm2.Public, usage *PolicySessionUsage) bool {
+	if pub == nil {
+		return false
+	}
+	if usage == nil {
+		return pub.Attrs&tpm2.AttrUserWithAuth == 0
+	}
+	if usage.noAuthValue {
+		return true
+	}
+
+	index := 0
+	if len(usage.handles) > 0 {
+		index = -1
+		name := pub.Name()
+		for i, handle := range usage.handles {
+			if bytes.Equal(handle.Name(), name) {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			return true
+		}
+	}
+
+	switch {
+	case usage.commandCode == tpm2.CommandDuplicate && index == 0:
+		return true
+	case usage.commandCode == tpm2.CommandActivateCredential && index == 0,
+		usage.commandCode == tpm2.CommandCertify && index == 0,
+		usage.commandCode == tpm2.CommandObjectChangeAuth && index == 0:
+		return pub.Attrs&tpm2.AttrAdminWithPolicy != 0
+	default:
+		return pub.Attrs&tpm2.AttrUserWithAuth == 0
+	}
+}
+
+// Branches returns the path of every branch in this policy. A TPM2_PolicyAuthorize assertion
+// is represented by a "…" component in a path.
+func (p *Policy) Branches() ([]string, error) {
+	var result []string
+
+	var currentPath policyBranchPath
+
+	walker := newTreeWalker(
 		newNullPolicySession(tpm2.HashAlgorithmSHA256),
 		new(mockPolicyResourceLoader),
+		0,
 		func() (treeWalkerBeginBranchFn, treeWalkerEndBranchFn, error) {
 			path := currentPath
 
@@ -2031,6 +3357,125 @@ func (p *Policy) Branches() ([]string, error) {
 	return result, nil
 }
 
+// BranchDescriptions returns the descriptions of the branches in this policy that
+// have one (see [PolicyBuilderBranch.SetDescription]), keyed by the path of each
+// branch. Where a branch contains more than one branch node, the paths of branches
+// in the second and subsequent nodes have a "**" component in place of the branches
+// selected by preceding nodes, as with [Policy.BranchForDigest]. Descriptions don't
+// contribute to the policy digest. Branches in authorized policies are not included,
+// as these are not part of this policy.
+func (p *Policy) BranchDescriptions() map[string]string {
+	result := make(map[string]string)
+	for _, entry := range p.policy.Descriptions {
+		result[string(entry.Path)] = string(entry.Description)
+	}
+	return result
+}
+
+// BranchForDigest determines which branch of this policy produces the supplied session
+// digest for the specified algorithm, which is useful for debugging a policy session
+// that failed. On success, it returns a path that selects the matching branch, in the
+// form described in the documentation for [PolicyExecuteParams], and true.
+//
+// A branch matches if the supplied digest is the session digest obtained immediately
+// after executing the assertions in the branch and before the TPM2_PolicyOR assertion
+// for its branch node. Because a TPM2_PolicyOR assertion resets the session digest, the
+// session digest doesn't depend on the branches selected by preceding branch nodes, so
+// these are represented by a "**" component in the returned path. If the supplied digest
+// is the digest of the whole policy, an empty path is returned.
+//
+// If no branch matches, this returns false. Branches in authorized policies are not
+// considered, as these are not part of this policy.
+func (p *Policy) BranchForDigest(alg tpm2.HashAlgorithmId, sessionDigest tpm2.Digest) (string, bool, error) {
+	if !alg.Available() {
+		return "", false, errors.New("unavailable algorithm")
+	}
+
+	policy, err := p.WithComputedDigests(alg)
+	if err != nil {
+		return "", false, fmt.Errorf("cannot compute digests: %w", err)
+	}
+	if bytes.Equal(policy.policy.PolicyDigests[0].Digest, sessionDigest) {
+		return "", true, nil
+	}
+
+	var walkElements func(parentPath policyBranchPath, elements policyElements) (policyBranchPath, bool)
+	walkElements = func(parentPath policyBranchPath, elements policyElements) (policyBranchPath, bool) {
+		for _, element := range elements {
+			if element.Type != tpm2.CommandPolicyOR || element.Details == nil || element.Details.OR == nil {
+				continue
+			}
+			for i, branch := range element.Details.OR.Branches {
+				name := policyBranchPath(branch.Name)
+				if len(name) == 0 {
+					name = policyBranchPath(fmt.Sprintf("$[%d]", i))
+				}
+				path := parentPath.Concat(name)
+				for _, digest := range branch.PolicyDigests {
+					if digest.HashAlg == alg && bytes.Equal(digest.Digest, sessionDigest) {
+						return path, true
+					}
+				}
+				if path, ok := walkElements(path, branch.Policy); ok {
+					return path, true
+				}
+			}
+			parentPath = parentPath.Concat("**")
+		}
+		return "", false
+	}
+
+	path, ok := walkElements("", policy.policy.Policy)
+	return string(path), ok, nil
+}
+
+// SignerKeys returns the distinct names of the keys referenced by the
+// TPM2_PolicySigned and TPM2_PolicyAuthorize assertions in this policy, for
+// the specified algorithm. All branches are included. This can be used to
+// pre-load the keys required to execute this policy or to verify that this
+// policy only trusts the expected signing keys. An error is returned if the
+// policy is invalid.
+func (p *Policy) SignerKeys(alg tpm2.HashAlgorithmId) ([]tpm2.Name, error) {
+	var details PolicyBranchDetails
+	var result []tpm2.Name
+
+	addKeys := func(auths []PolicyAuthorizationDetails) {
+		for _, auth := range auths {
+			found := false
+			for _, name := range result {
+				if bytes.Equal(name, auth.AuthName) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				result = append(result, auth.AuthName)
+			}
+		}
+	}
+
+	walker := newTreeWalker(
+		newProxyPolicySession(newNullPolicySession(alg), &details),
+		new(mockPolicyResourceLoader),
+		0,
+		func() (treeWalkerBeginBranchFn, treeWalkerEndBranchFn, error) {
+			return nil, nil, nil
+		},
+		func() error {
+			addKeys(details.Signed)
+			addKeys(details.Authorize)
+			details = PolicyBranchDetails{}
+			return nil
+		},
+	)
+
+	if err := walker.run(p.policy.Policy); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
 // PolicyNVDetails contains the properties of a TPM2_PolicyNV assertion.
 type PolicyNVDetails struct {
 	Auth      tpm2.Handle
@@ -2041,6 +3486,14 @@ type PolicyNVDetails struct {
 	Operation tpm2.ArithmeticOp
 }
 
+// PolicyAuthorizeNVDetails contains the properties of a TPM2_PolicyAuthorizeNV
+// assertion.
+type PolicyAuthorizeNVDetails struct {
+	Auth  tpm2.Handle
+	Index tpm2.Handle
+	Name  tpm2.Name
+}
+
 // PolicyAuthorizationDetails contains the properties of a TPM2_PolicySecret,
 // TPM2_PolicySigned or TPM2_PolicyAuthorize assertion.
 type PolicyAuthorizationDetails struct {
@@ -2064,17 +3517,19 @@ type PolicyPCRDetails struct {
 
 // PolicyBranchDetails contains the properties of a single policy branch.
 type PolicyBranchDetails struct {
-	NV                []PolicyNVDetails            // TPM2_PolicyNV assertions
-	Secret            []PolicyAuthorizationDetails // TPM2_PolicySecret assertions
-	Signed            []PolicyAuthorizationDetails // TPM2_PolicySigned assertions
-	Authorize         []PolicyAuthorizationDetails // TPM2_PolicyAuthorize assertions
-	AuthValueNeeded   bool                         // The branch contains a TPM2_PolicyAuthValue or TPM2_PolicyPassword assertion
-	policyCommandCode tpm2.CommandCodeList
-	CounterTimer      []PolicyCounterTimerDetails // TPM2_PolicyCounterTimer assertions
-	policyCpHash      tpm2.DigestList
-	policyNameHash    tpm2.DigestList
-	PCR               []PolicyPCRDetails // TPM2_PolicyPCR assertions
-	policyNvWritten   []bool
+	NV                 []PolicyNVDetails            // TPM2_PolicyNV assertions
+	Secret             []PolicyAuthorizationDetails // TPM2_PolicySecret assertions
+	Signed             []PolicyAuthorizationDetails // TPM2_PolicySigned assertions
+	Authorize          []PolicyAuthorizationDetails // TPM2_PolicyAuthorize assertions
+	AuthValueNeeded    bool                         // The branch contains a TPM2_PolicyAuthValue or TPM2_PolicyPassword assertion
+	policyCommandCode  tpm2.CommandCodeList
+	CounterTimer       []PolicyCounterTimerDetails // TPM2_PolicyCounterTimer assertions
+	policyCpHash       tpm2.DigestList
+	policyNameHash     tpm2.DigestList
+	PCR                []PolicyPCRDetails // TPM2_PolicyPCR assertions
+	policyNvWritten    []bool
+	policyTemplateHash tpm2.DigestList
+	AuthorizeNV        []PolicyAuthorizeNVDetails // TPM2_PolicyAuthorizeNV assertions
 }
 
 // IsValid indicates whether the corresponding policy branch is valid.
@@ -2104,6 +3559,16 @@ func (r *PolicyBranchDetails) IsValid() bool {
 		}
 		cpHashNum += 1
 	}
+	if len(r.policyTemplateHash) > 0 {
+		if len(r.policyTemplateHash) > 1 {
+			for _, templateHash := range r.policyTemplateHash[1:] {
+				if !bytes.Equal(templateHash, r.policyTemplateHash[0]) {
+					return false
+				}
+			}
+		}
+		cpHashNum += 1
+	}
 	if cpHashNum > 1 {
 		return false
 	}
@@ -2145,6 +3610,14 @@ func (r *PolicyBranchDetails) NameHash() (nameHash tpm2.Digest, set bool) {
 	return r.policyNameHash[0], true
 }
 
+// The templateHash associated with a branch if set by the TPM2_PolicyTemplate assertion.
+func (r *PolicyBranchDetails) TemplateHash() (templateHash tpm2.Digest, set bool) {
+	if len(r.policyTemplateHash) == 0 {
+		return nil, false
+	}
+	return r.policyTemplateHash[0], true
+}
+
 // The nvWrittenSet value associated with a branch if set.
 func (r *PolicyBranchDetails) NvWritten() (nvWrittenSet bool, set bool) {
 	if len(r.policyNvWritten) == 0 {
@@ -2153,6 +3626,79 @@ func (r *PolicyBranchDetails) NvWritten() (nvWrittenSet bool, set bool) {
 	return r.policyNvWritten[0], true
 }
 
+// String returns a human-readable summary of the requirements of the
+// corresponding policy branch, eg, "PCR: TPM_ALG_SHA256:7,8; Secret: 2 auth(s);
+// CommandCode: TPM_CC_Unseal".
+func (r PolicyBranchDetails) String() string {
+	var parts []string
+
+	if len(r.NV) > 0 {
+		var indices []string
+		for _, nv := range r.NV {
+			indices = append(indices, nv.Index.String())
+		}
+		parts = append(parts, "NV: "+strings.Join(indices, ","))
+	}
+	if len(r.AuthorizeNV) > 0 {
+		var indices []string
+		for _, nv := range r.AuthorizeNV {
+			indices = append(indices, nv.Index.String())
+		}
+		parts = append(parts, "AuthorizeNV: "+strings.Join(indices, ","))
+	}
+	if len(r.Secret) > 0 {
+		parts = append(parts, fmt.Sprintf("Secret: %d auth(s)", len(r.Secret)))
+	}
+	if len(r.Signed) > 0 {
+		parts = append(parts, fmt.Sprintf("Signed: %d auth(s)", len(r.Signed)))
+	}
+	if len(r.Authorize) > 0 {
+		parts = append(parts, fmt.Sprintf("Authorize: %d auth(s)", len(r.Authorize)))
+	}
+	if r.AuthValueNeeded {
+		parts = append(parts, "AuthValue: needed")
+	}
+	if code, set := r.CommandCode(); set {
+		parts = append(parts, fmt.Sprintf("CommandCode: %v", code))
+	}
+	if len(r.CounterTimer) > 0 {
+		parts = append(parts, fmt.Sprintf("CounterTimer: %d assertion(s)", len(r.CounterTimer)))
+	}
+	if cpHash, set := r.CpHash(); set {
+		parts = append(parts, fmt.Sprintf("CpHash: %x", cpHash))
+	}
+	if nameHash, set := r.NameHash(); set {
+		parts = append(parts, fmt.Sprintf("NameHash: %x", nameHash))
+	}
+	if len(r.PCR) > 0 {
+		var selections []string
+		for _, pcr := range r.PCR {
+			for _, selection := range pcr.PCRs {
+				var pcrs []string
+				for _, p := range selection.Select {
+					pcrs = append(pcrs, fmt.Sprintf("%d", p))
+				}
+				selections = append(selections, fmt.Sprintf("%v:%s", selection.Hash, strings.Join(pcrs, ",")))
+			}
+		}
+		parts = append(parts, "PCR: "+strings.Join(selections, " "))
+	}
+	if nvWritten, set := r.NvWritten(); set {
+		parts = append(parts, fmt.Sprintf("NvWritten: %t", nvWritten))
+	}
+	if templateHash, set := r.TemplateHash(); set {
+		parts = append(parts, fmt.Sprintf("TemplateHash: %x", templateHash))
+	}
+	if !r.IsValid() {
+		parts = append(parts, "invalid")
+	}
+
+	if len(parts) == 0 {
+		return "no requirements"
+	}
+	return strings.Join(parts, "; ")
+}
+
 // Details returns details of all branches with the supplied path prefix, for
 // the specified algorithm.
 func (p *Policy) Details(alg tpm2.HashAlgorithmId, path string) (map[string]PolicyBranchDetails, error) {
@@ -2169,6 +3715,7 @@ func (p *Policy) Details(alg tpm2.HashAlgorithmId, path string) (map[string]Poli
 	walker = newTreeWalker(
 		newProxyPolicySession(newNullPolicySession(alg), &currentDetails),
 		new(mockPolicyResourceLoader),
+		0,
 		func() (treeWalkerBeginBranchFn, treeWalkerEndBranchFn, error) {
 			details := currentDetails
 			path := currentPath
@@ -2231,3 +3778,384 @@ func (p *Policy) Details(alg tpm2.HashAlgorithmId, path string) (map[string]Poli
 
 	return result, nil
 }
+
+// GraphViz returns a representation of the branch structure of this policy in the
+// Graphviz DOT language, for the specified algorithm. This is intended to help with
+// documenting and reviewing complex policies.
+//
+// Each vertex in the graph corresponds to a partial path through the policy and is
+// labelled with a summary of the assertions executed for that path until the next
+// branch node is encountered (see [PolicyBranchDetails.String]). Each edge corresponds
+// to the selection of a branch and is labelled with the path component that selects
+// it. A TPM2_PolicyAuthorize assertion is represented in the same way as a branch
+// node, with an edge for each of the candidate policies for the specified algorithm
+// or a single edge labelled "…" if there are none.
+func (p *Policy) GraphViz(alg tpm2.HashAlgorithmId) (string, error) {
+	if !alg.Available() {
+		return "", errors.New("unavailable algorithm")
+	}
+
+	var (
+		labels         []string
+		edges          []string
+		currentNode    int
+		currentDetails PolicyBranchDetails
+	)
+
+	newNode := func() int {
+		labels = append(labels, "")
+		return len(labels) - 1
+	}
+	currentNode = newNode()
+
+	var walker *treeWalker
+	walker = newTreeWalker(
+		newProxyPolicySession(newNullPolicySession(alg), &currentDetails),
+		new(mockPolicyResourceLoader),
+		0,
+		func() (treeWalkerBeginBranchFn, treeWalkerEndBranchFn, error) {
+			parent := currentNode
+			labels[parent] = currentDetails.String()
+
+			return func(name policyBranchPath) error {
+				currentNode = newNode()
+				edges = append(edges, fmt.Sprintf("\tn%d -> n%d [label=%q];\n", parent, currentNode, string(name)))
+
+				currentDetails = PolicyBranchDetails{}
+				walker.runner.setSession(newProxyPolicySession(
+					newNullPolicySession(alg),
+					&currentDetails,
+				))
+				return nil
+			}, nil, nil
+		},
+		func() error {
+			labels[currentNode] = currentDetails.String()
+			return nil
+		},
+	)
+
+	if err := walker.run(p.policy.Policy); err != nil {
+		return "", err
+	}
+
+	w := new(strings.Builder)
+	io.WriteString(w, "digraph policy {\n")
+	io.WriteString(w, "\tnode [shape=box];\n")
+	for i, label := range labels {
+		fmt.Fprintf(w, "\tn%d [label=%q];\n", i, label)
+	}
+	for _, edge := range edges {
+		io.WriteString(w, edge)
+	}
+	io.WriteString(w, "}\n")
+
+	return w.String(), nil
+}
+
+// String implements [fmt.Stringer]. It returns a human-readable representation of the
+// tree of assertions in this policy for debugging purposes, eg:
+//
+//	Policy {
+//	  # digest TPM_ALG_SHA256:0x...
+//	  BranchNode {
+//	    Branch 0 (pcr) {
+//	      # digest TPM_ALG_SHA256:0x...
+//	      TPM2_PolicyPCR(TPM_ALG_SHA256:7=0x...)
+//	    }
+//	    Branch 1 ($[1]) {
+//	      TPM2_PolicyAuthValue()
+//	    }
+//	  }
+//	  TPM2_PolicyCommandCode(TPM_CC_Unseal)
+//	}
+//
+// Each branch is identified by its name, or by a "$[n]" index if it doesn't have one,
+// in the same way as branches are selected by the Path field of [PolicyExecuteParams].
+// The stored digests of the policy and each branch are included where present. Policies
+// that are authorized by a TPM2_PolicyAuthorize assertion are not part of this policy and
+// are not included.
+func (p *Policy) String() string {
+	w := new(strings.Builder)
+	io.WriteString(w, "Policy {\n")
+	writePolicyDigests(w, 1, p.policy.PolicyDigests)
+	writePolicyElements(w, 1, p.policy.Policy)
+	io.WriteString(w, "}")
+	return w.String()
+}
+
+func writePolicyIndent(w io.Writer, depth int) {
+	io.WriteString(w, strings.Repeat("  ", depth))
+}
+
+func writePolicyDigests(w io.Writer, depth int, digests taggedHashList) {
+	for _, digest := range digests {
+		writePolicyIndent(w, depth)
+		fmt.Fprintf(w, "# digest %v:%#x\n", digest.HashAlg, digest.Digest)
+	}
+}
+
+func writePolicyElements(w io.Writer, depth int, elements policyElements) {
+	for _, element := range elements {
+		if element.Type == tpm2.CommandPolicyOR && element.Details != nil && element.Details.OR != nil {
+			writePolicyIndent(w, depth)
+			io.WriteString(w, "BranchNode {\n")
+			for i, branch := range element.Details.OR.Branches {
+				name := string(branch.Name)
+				if len(name) == 0 {
+					name = fmt.Sprintf("$[%d]", i)
+				}
+				writePolicyIndent(w, depth+1)
+				fmt.Fprintf(w, "Branch %d (%s) {\n", i, name)
+				writePolicyDigests(w, depth+2, branch.PolicyDigests)
+				writePolicyElements(w, depth+2, branch.Policy)
+				writePolicyIndent(w, depth+1)
+				io.WriteString(w, "}\n")
+			}
+			writePolicyIndent(w, depth)
+			io.WriteString(w, "}\n")
+			continue
+		}
+
+		writePolicyIndent(w, depth)
+		io.WriteString(w, element.String())
+		io.WriteString(w, "\n")
+	}
+}
+
+func nvIndexString(pub *tpm2.NVPublic) string {
+	if pub == nil {
+		return "<nil>"
+	}
+	return pub.Index.String()
+}
+
+func publicName(pub *tpm2.Public) tpm2.Name {
+	if pub == nil {
+		return nil
+	}
+	return pub.Name()
+}
+
+// String returns a human-readable representation of this element, for use by
+// [Policy.String].
+func (e *policyElement) String() string {
+	if e.Details == nil || e.runner() == nil || reflect.ValueOf(e.runner()).IsNil() {
+		return fmt.Sprintf("%v(<invalid>)", e.Type)
+	}
+
+	d := e.Details
+	switch e.Type {
+	case tpm2.CommandPolicyNV:
+		return fmt.Sprintf("TPM2_PolicyNV(index:%s, operandB:%#x, offset:%d, operation:%s)",
+			nvIndexString(d.NV.NvIndex), d.NV.OperandB, d.NV.Offset, d.NV.Operation)
+	case tpm2.CommandPolicySecret:
+		return fmt.Sprintf("TPM2_PolicySecret(authObject:%#x, policyRef:%#x)", d.Secret.AuthObjectName, d.Secret.PolicyRef)
+	case tpm2.CommandPolicySigned:
+		return fmt.Sprintf("TPM2_PolicySigned(authKey:%#x, policyRef:%#x)", publicName(d.Signed.AuthKey), d.Signed.PolicyRef)
+	case tpm2.CommandPolicyAuthorize:
+		return fmt.Sprintf("TPM2_PolicyAuthorize(policyRef:%#x, keySign:%#x)", d.Authorize.PolicyRef, publicName(d.Authorize.KeySign))
+	case tpm2.CommandPolicyAuthValue:
+		return "TPM2_PolicyAuthValue()"
+	case tpm2.CommandPolicyCommandCode:
+		return fmt.Sprintf("TPM2_PolicyCommandCode(%v)", d.CommandCode.CommandCode)
+	case tpm2.CommandPolicyCounterTimer:
+		return fmt.Sprintf("TPM2_PolicyCounterTimer(operandB:%#x, offset:%d, operation:%s)",
+			d.CounterTimer.OperandB, d.CounterTimer.Offset, d.CounterTimer.Operation)
+	case tpm2.CommandPolicyCpHash:
+		if len(d.CpHash.Digest) > 0 {
+			return fmt.Sprintf("TPM2_PolicyCpHash(cpHash:%#x)", d.CpHash.Digest)
+		}
+		var handles []string
+		for _, name := range d.CpHash.Handles {
+			handles = append(handles, fmt.Sprintf("%#x", name))
+		}
+		return fmt.Sprintf("TPM2_PolicyCpHash(command:%v, handles:[%s], cpBytes:%#x)", d.CpHash.CommandCode, strings.Join(handles, ", "), d.CpHash.CpBytes)
+	case tpm2.CommandPolicyNameHash:
+		if len(d.NameHash.Digest) > 0 {
+			return fmt.Sprintf("TPM2_PolicyNameHash(nameHash:%#x)", d.NameHash.Digest)
+		}
+		var handles []string
+		for _, name := range d.NameHash.Handles {
+			handles = append(handles, fmt.Sprintf("%#x", name))
+		}
+		return fmt.Sprintf("TPM2_PolicyNameHash(handles:[%s])", strings.Join(handles, ", "))
+	case tpm2.CommandPolicyPCR:
+		var values []string
+		for _, value := range d.PCR.PCRs {
+			values = append(values, fmt.Sprintf("%v:%d=%#x", value.Digest.HashAlg, value.PCR, value.Digest.Digest))
+		}
+		return fmt.Sprintf("TPM2_PolicyPCR(%s)", strings.Join(values, ", "))
+	case tpm2.CommandPolicyDuplicationSelect:
+		return fmt.Sprintf("TPM2_PolicyDuplicationSelect(object:%#x, newParent:%#x, includeObject:%t)",
+			d.DuplicationSelect.Object, d.DuplicationSelect.NewParent, d.DuplicationSelect.IncludeObject)
+	case tpm2.CommandPolicyPassword:
+		return "TPM2_PolicyPassword()"
+	case tpm2.CommandPolicyNvWritten:
+		return fmt.Sprintf("TPM2_PolicyNvWritten(%t)", d.NvWritten.WrittenSet)
+	case tpm2.CommandPolicyTemplate:
+		return fmt.Sprintf("TPM2_PolicyTemplate(templateHash:%#x)", d.Template.TemplateHash)
+	case tpm2.CommandPolicyAuthorizeNV:
+		return fmt.Sprintf("TPM2_PolicyAuthorizeNV(index:%s)", nvIndexString(d.AuthorizeNV.NvIndex))
+	default:
+		return fmt.Sprintf("%v()", e.Type)
+	}
+}
+
+// MinimalUsageForBranch returns a [PolicySessionUsage] that causes the branch
+// with the supplied path to be selected when [Policy.Execute] automatically
+// selects branches for a session with the specified algorithm, or an error if
+// the branch cannot be distinguished from the other branches by how the session
+// is used. The path must identify a single complete branch, as described in the
+// documentation for [PolicyExecuteParams].
+//
+// The returned usage contains the command code, cpHash and nameHash required by
+// the branch, where these are set. If the branch has no TPM2_PolicyCommandCode
+// or TPM2_PolicyDuplicationSelect assertion, the command code is zero so that
+// branches which require a specific command are not selected. The usage only
+// indicates that the authorization value is unavailable (see
+// [PolicySessionUsage.NoAuthValue]) if this is required to exclude other
+// branches. The cpHash and nameHash are specific to the supplied algorithm.
+//
+// Branches that can only be distinguished by conditions that don't depend on
+// the session usage, such as TPM2_PolicyPCR or TPM2_PolicyNvWritten assertions,
+// are considered ambiguous.
+func (p *Policy) MinimalUsageForBranch(alg tpm2.HashAlgorithmId, path string) (*PolicySessionUsage, error) {
+	if !alg.Available() {
+		return nil, errors.New("unavailable algorithm")
+	}
+
+	target, err := p.Details(alg, path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot obtain details for path: %w", err)
+	}
+	if len(target) != 1 {
+		return nil, fmt.Errorf("path %q does not identify a single branch", path)
+	}
+
+	var (
+		targetPath    string
+		targetDetails PolicyBranchDetails
+	)
+	for branchPath, d := range target {
+		targetPath = branchPath
+		targetDetails = d
+	}
+	if !targetDetails.IsValid() {
+		return nil, fmt.Errorf("branch %q is invalid", targetPath)
+	}
+
+	all, err := p.Details(alg, "")
+	if err != nil {
+		return nil, fmt.Errorf("cannot obtain details for all branches: %w", err)
+	}
+
+	countOthers := func(usage *PolicySessionUsage) (n int, err error) {
+		for branchPath, d := range all {
+			if branchPath == targetPath || !d.IsValid() {
+				continue
+			}
+			ok, err := usage.matchesBranch(alg, &d)
+			if err != nil {
+				return 0, err
+			}
+			if ok {
+				n += 1
+			}
+		}
+		return n, nil
+	}
+
+	code, _ := targetDetails.CommandCode()
+	cpHash, _ := targetDetails.CpHash()
+	nameHash, _ := targetDetails.NameHash()
+	usage := NewUsageFromHashes(code, cpHash, nameHash)
+
+	n, err := countOthers(usage)
+	if err != nil {
+		return nil, err
+	}
+	if n > 0 && !targetDetails.AuthValueNeeded {
+		usage.NoAuthValue()
+		if n, err = countOthers(usage); err != nil {
+			return nil, err
+		}
+	}
+	if n > 0 {
+		return nil, fmt.Errorf("branch %q cannot be distinguished from %d other branch(es) by session usage", targetPath, n)
+	}
+
+	return usage, nil
+}
+
+func (e policyElements) collectCommands(commands map[tpm2.CommandCode]string, order *[]tpm2.CommandCode) {
+	for _, element := range e {
+		if _, exists := commands[element.Type]; !exists {
+			commands[element.Type] = element.runner().name()
+			*order = append(*order, element.Type)
+		}
+		if element.Type != tpm2.CommandPolicyOR {
+			continue
+		}
+		for _, branch := range element.Details.OR.Branches {
+			branch.Policy.collectCommands(commands, order)
+		}
+	}
+}
+
+// CheckTPMSupport checks that the supplied TPM supports the commands required by every
+// assertion in this policy, including those in every branch. If any assertion isn't
+// supported, a *[UnsupportedAssertionsError] error is returned. This can be used to
+// detect a policy that can't be executed on the connected TPM before attempting to
+// execute it, eg, for a policy that was created for a newer TPM. The supplied
+// TPMConnection must implement [CommandsTPMConnection].
+//
+// Assertions in authorized policies that are loaded during execution are not checked.
+func (p *Policy) CheckTPMSupport(tpm TPMConnection) error {
+	if tpm == nil {
+		return errors.New("no TPM")
+	}
+
+	required := make(map[tpm2.CommandCode]string)
+	var order []tpm2.CommandCode
+	p.policy.Policy.collectCommands(required, &order)
+	if len(order) == 0 {
+		return nil
+	}
+
+	supported := make(map[tpm2.CommandCode]bool)
+	next := tpm2.CommandFirst
+	for {
+		commands, err := getCapabilityCommands(tpm, next, tpm2.CapabilityMaxProperties)
+		if err != nil {
+			return fmt.Errorf("cannot obtain supported commands: %w", err)
+		}
+		if len(commands) == 0 {
+			break
+		}
+		for _, attrs := range commands {
+			supported[attrs.CommandCode()] = true
+		}
+		last := commands[len(commands)-1].CommandCode()
+		if last == math.MaxUint32 {
+			break
+		}
+		next = last + 1
+	}
+
+	var e *UnsupportedAssertionsError
+	for _, code := range order {
+		if supported[code] {
+			continue
+		}
+		if e == nil {
+			e = new(UnsupportedAssertionsError)
+		}
+		e.Commands = append(e.Commands, code)
+		e.names = append(e.names, required[code])
+	}
+	if e != nil {
+		return e
+	}
+	return nil
+}
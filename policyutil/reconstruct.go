@@ -0,0 +1,138 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package policyutil
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/canonical/go-tpm2"
+)
+
+// maxReconstructCandidates is the maximum number of candidate assertions accepted by
+// ReconstructPolicy. Every ordering of every subset of the candidates may be tried, so
+// this bounds the search to 109,601 orderings.
+const maxReconstructCandidates = 8
+
+// PolicyAssertion adds one or more assertions to the supplied branch. It is used to supply
+// candidate assertions to [ReconstructPolicy], eg:
+//
+//	func(branch *PolicyBuilderBranch) error { return branch.PolicyAuthValue() }
+type PolicyAssertion func(branch *PolicyBuilderBranch) error
+
+// extendReconstructDigest returns the digest obtained by extending the supplied digest with
+// the assertions of a single candidate.
+func extendReconstructDigest(alg tpm2.HashAlgorithmId, digest tpm2.Digest, elements policyElements) (tpm2.Digest, error) {
+	result := &taggedHash{HashAlg: alg, Digest: make(tpm2.Digest, len(digest))}
+	copy(result.Digest, digest)
+
+	var hasCpHash bool
+	runner := newPolicyRunner(
+		newComputePolicySession(result),
+		new(nullTickets),
+		new(mockPolicyResourceLoader),
+		func(runner *policyRunner) policyRunnerHelper { return newComputePolicyHelper(runner, &hasCpHash) },
+	)
+	if err := runner.run(elements); err != nil {
+		return nil, err
+	}
+	return result.Digest, nil
+}
+
+func buildReconstructCandidate(alg tpm2.HashAlgorithmId, candidates []PolicyAssertion, order []int) (*Policy, error) {
+	builder := NewPolicyBuilder()
+	for _, i := range order {
+		if err := candidates[i](builder.RootBranch()); err != nil {
+			return nil, err
+		}
+	}
+	return builder.PolicyWithDigests(alg)
+}
+
+// ReconstructPolicy performs a best-effort search for a policy that produces the supplied
+// target digest for the specified algorithm, using the supplied candidate assertions. This is
+// useful for recovering the source of an authorization policy when only its digest is known,
+// such as the authorization policy of an existing object.
+//
+// Each candidate is used at most once, and every ordering of every subset of the candidates is
+// tried in order of increasing size, so the returned policy is the one with the fewest candidates
+// that produces the target digest. Orderings for which a candidate returns an error or the
+// resulting policy cannot be computed are skipped. The returned policy has already been computed
+// for the specified algorithm.
+//
+// As the search is exhaustive, no more than 8 candidates can be supplied. An error is returned
+// if no combination of the candidates produces the target digest.
+func ReconstructPolicy(alg tpm2.HashAlgorithmId, target tpm2.Digest, candidates ...PolicyAssertion) (*Policy, error) {
+	if !alg.Available() {
+		return nil, errors.New("unavailable algorithm")
+	}
+	if len(target) != alg.Size() {
+		return nil, errors.New("invalid target digest length")
+	}
+	if len(candidates) > maxReconstructCandidates {
+		return nil, fmt.Errorf("too many candidates (maximum is %d)", maxReconstructCandidates)
+	}
+
+	// Build each candidate once so that the search only has to extend the digest
+	// of the current prefix with the assertions of the next candidate.
+	elements := make([]policyElements, len(candidates))
+	for i, candidate := range candidates {
+		builder := NewPolicyBuilder()
+		if err := candidate(builder.RootBranch()); err != nil {
+			continue
+		}
+		policy, err := builder.Policy()
+		if err != nil {
+			continue
+		}
+		elements[i] = policy.policy.Policy
+	}
+
+	used := make([]bool, len(candidates))
+	order := make([]int, 0, len(candidates))
+
+	var search func(size int, digest tpm2.Digest) *Policy
+	search = func(size int, digest tpm2.Digest) *Policy {
+		if len(order) == size {
+			if !bytes.Equal(digest, target) {
+				return nil
+			}
+			policy, err := buildReconstructCandidate(alg, candidates, order)
+			if err != nil {
+				return nil
+			}
+			return policy
+		}
+
+		for i := range candidates {
+			if used[i] || elements[i] == nil {
+				continue
+			}
+			next, err := extendReconstructDigest(alg, digest, elements[i])
+			if err != nil {
+				continue
+			}
+
+			used[i] = true
+			order = append(order, i)
+			policy := search(size, next)
+			order = order[:len(order)-1]
+			used[i] = false
+			if policy != nil {
+				return policy
+			}
+		}
+		return nil
+	}
+
+	for size := 0; size <= len(candidates); size++ {
+		if policy := search(size, make(tpm2.Digest, alg.Size())); policy != nil {
+			return policy, nil
+		}
+	}
+
+	return nil, errors.New("no combination of candidates produces the target digest")
+}
@@ -0,0 +1,87 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package policyutil_test
+
+import (
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/go-tpm2"
+	internal_testutil "github.com/canonical/go-tpm2/internal/testutil"
+	. "github.com/canonical/go-tpm2/policyutil"
+)
+
+type reconstructSuite struct{}
+
+var _ = Suite(&reconstructSuite{})
+
+func (s *reconstructSuite) TestReconstructPolicy(c *C) {
+	builder := NewPolicyBuilder()
+	c.Check(builder.RootBranch().PolicySecret(tpm2.MakeHandleName(tpm2.HandleOwner), nil), IsNil)
+	c.Check(builder.RootBranch().PolicyAuthValue(), IsNil)
+	c.Check(builder.RootBranch().PolicyCommandCode(tpm2.CommandNVChangeAuth), IsNil)
+	expected, err := builder.Policy()
+	c.Assert(err, IsNil)
+	target, err := expected.Compute(tpm2.HashAlgorithmSHA256)
+	c.Assert(err, IsNil)
+
+	policy, err := ReconstructPolicy(tpm2.HashAlgorithmSHA256, target,
+		func(branch *PolicyBuilderBranch) error { return branch.PolicyCommandCode(tpm2.CommandNVChangeAuth) },
+		func(branch *PolicyBuilderBranch) error { return branch.PolicyNvWritten(true) },
+		func(branch *PolicyBuilderBranch) error { return branch.PolicyAuthValue() },
+		func(branch *PolicyBuilderBranch) error {
+			return branch.PolicySecret(tpm2.MakeHandleName(tpm2.HandleOwner), nil)
+		})
+	c.Assert(err, IsNil)
+	c.Check(policy, DeepEquals, expected)
+
+	digest, err := policy.Validate(tpm2.HashAlgorithmSHA256)
+	c.Check(err, IsNil)
+	c.Check(digest, DeepEquals, target)
+}
+
+func (s *reconstructSuite) TestReconstructPolicyEmpty(c *C) {
+	policy, err := ReconstructPolicy(tpm2.HashAlgorithmSHA256, make(tpm2.Digest, 32),
+		func(branch *PolicyBuilderBranch) error { return branch.PolicyAuthValue() })
+	c.Assert(err, IsNil)
+	c.Check(policy.IsEmpty(), Equals, true)
+}
+
+func (s *reconstructSuite) TestReconstructPolicySkipsErrors(c *C) {
+	builder := NewPolicyBuilder()
+	c.Check(builder.RootBranch().PolicyAuthValue(), IsNil)
+	expected, err := builder.Policy()
+	c.Assert(err, IsNil)
+	target, err := expected.Compute(tpm2.HashAlgorithmSHA1)
+	c.Assert(err, IsNil)
+
+	policy, err := ReconstructPolicy(tpm2.HashAlgorithmSHA1, target,
+		func(branch *PolicyBuilderBranch) error {
+			return branch.PolicyNV(&tpm2.NVPublic{Index: 0x01800000}, nil, 0, tpm2.OpEq)
+		},
+		func(branch *PolicyBuilderBranch) error { return branch.PolicyAuthValue() })
+	c.Assert(err, IsNil)
+	c.Check(policy, DeepEquals, expected)
+}
+
+func (s *reconstructSuite) TestReconstructPolicyNoMatch(c *C) {
+	_, err := ReconstructPolicy(tpm2.HashAlgorithmSHA256, internal_testutil.DecodeHexString(c, "0000000000000000000000000000000000000000000000000000000000000001"),
+		func(branch *PolicyBuilderBranch) error { return branch.PolicyAuthValue() },
+		func(branch *PolicyBuilderBranch) error { return branch.PolicyCommandCode(tpm2.CommandUnseal) })
+	c.Check(err, ErrorMatches, `no combination of candidates produces the target digest`)
+}
+
+func (s *reconstructSuite) TestReconstructPolicyTooManyCandidates(c *C) {
+	candidates := make([]PolicyAssertion, 9)
+	for i := range candidates {
+		candidates[i] = func(branch *PolicyBuilderBranch) error { return branch.PolicyAuthValue() }
+	}
+	_, err := ReconstructPolicy(tpm2.HashAlgorithmSHA256, make(tpm2.Digest, 32), candidates...)
+	c.Check(err, ErrorMatches, `too many candidates \(maximum is 8\)`)
+}
+
+func (s *reconstructSuite) TestReconstructPolicyInvalidTarget(c *C) {
+	_, err := ReconstructPolicy(tpm2.HashAlgorithmSHA256, make(tpm2.Digest, 20))
+	c.Check(err, ErrorMatches, `invalid target digest length`)
+}
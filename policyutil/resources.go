@@ -9,6 +9,7 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"sort"
 
 	"github.com/canonical/go-tpm2"
 )
@@ -35,7 +36,11 @@ type PolicyResourceLoader interface {
 	// specified reference.
 	LoadAuthorizedPolicies(keySign tpm2.Name, policyRef tpm2.Nonce) ([]*Policy, error)
 
-	// Authorize sets the authorization value of the specified resource context.
+	// Authorize sets the authorization value of the specified resource context. This
+	// is also called for permanent resources such as the owner hierarchy, eg, when
+	// executing a TPM2_PolicyNV assertion for a NV index with the TPMA_NV_OWNERREAD
+	// attribute. See [AuthorizationSessionProvider] for a way to supply the session
+	// used for the authorization.
 	Authorize(resource tpm2.ResourceContext) error
 
 	// SignAuthorization signs a TPM2_PolicySigned authorization for the specified key, policy ref
@@ -54,6 +59,39 @@ type Authorizer interface {
 	SignAuthorization(sessionNonce tpm2.Nonce, authKey tpm2.Name, policyRef tpm2.Nonce) (*PolicySignedAuthorization, error)
 }
 
+// AuthorizationSessionProvider is an optional interface that can be implemented by a
+// [PolicyResourceLoader], or by an [Authorizer] supplied to [NewTPMPolicyResourceLoader],
+// in order to supply the HMAC session used to authorize a resource with its authorization
+// value during policy execution. By default, [Policy.Execute] starts an unbound, unsalted
+// HMAC session for this. Implementing this makes it possible to supply a salted or bound
+// session, eg, to authorize the owner hierarchy when executing a TPM2_PolicyNV assertion
+// for a NV index with the TPMA_NV_OWNERREAD attribute.
+//
+// The Authorize method is still called for the resource before the session is used, so that
+// its authorization value can be set.
+type AuthorizationSessionProvider interface {
+	// AuthorizationSession returns a HMAC session that will be used to authorize the
+	// specified resource, or nil if a new session should be started. The returned session
+	// is not flushed once it has been used, so it is the responsibility of the caller to
+	// flush it. If the session doesn't have the tpm2.AttrContinueSession attribute set,
+	// the TPM will flush it after it has been used.
+	AuthorizationSession(resource tpm2.ResourceContext) (tpm2.SessionContext, error)
+}
+
+// AuthorizationChecker is an optional interface that can be implemented by a
+// [PolicyResourceLoader] in order to support [PolicyExecuteParams.ValidateParams] when
+// a PolicyResourceLoader is supplied. Implementations must not communicate with the TPM.
+// The PolicyResourceLoader returned from [NewTPMPolicyResourceLoader] implements this.
+type AuthorizationChecker interface {
+	// CanAuthorizeSecret indicates whether the resource with the specified name can
+	// be authorized for a TPM2_PolicySecret assertion.
+	CanAuthorizeSecret(authObjectName tpm2.Name) bool
+
+	// CanSignAuthorization indicates whether a TPM2_PolicySigned authorization can be
+	// signed for the specified key and policy ref.
+	CanSignAuthorization(authKey tpm2.Name, policyRef tpm2.Nonce) bool
+}
+
 type nullAuthorizer struct{}
 
 func (*nullAuthorizer) Authorize(resource tpm2.ResourceContext) error {
@@ -64,6 +102,44 @@ func (*nullAuthorizer) SignAuthorization(sessionNonce tpm2.Nonce, authKey tpm2.N
 	return nil, errors.New("no Authorizer")
 }
 
+type permanentHandleAuthorizer struct {
+	auths map[tpm2.Handle]tpm2.Auth
+}
+
+// NewPermanentHandleAuthorizer returns a new Authorizer that authorizes permanent resources
+// such as the owner, endorsement and platform hierarchies with the supplied authorization
+// values, which are keyed by handle. It can be supplied to [NewTPMPolicyResourceLoader] or
+// [NewKeyStoreResourceLoader] in order to execute TPM2_PolicySecret assertions for a
+// hierarchy, or TPM2_PolicyNV assertions for a NV index with the TPMA_NV_OWNERREAD or
+// TPMA_NV_PPREAD attributes. The authorization is performed with a HMAC session.
+//
+// An error is returned when authorizing any other resource, and TPM2_PolicySigned
+// authorizations can't be signed.
+func NewPermanentHandleAuthorizer(auths map[tpm2.Handle]tpm2.Auth) Authorizer {
+	a := &permanentHandleAuthorizer{auths: make(map[tpm2.Handle]tpm2.Auth)}
+	for handle, auth := range auths {
+		a.auths[handle] = auth
+	}
+	return a
+}
+
+func (a *permanentHandleAuthorizer) Authorize(resource tpm2.ResourceContext) error {
+	handle := resource.Handle()
+	if handle.Type() != tpm2.HandleTypePermanent {
+		return fmt.Errorf("cannot authorize non-permanent resource %v", handle)
+	}
+	auth, exists := a.auths[handle]
+	if !exists {
+		return fmt.Errorf("no authorization value for %v", handle)
+	}
+	resource.SetAuthValue(auth)
+	return nil
+}
+
+func (*permanentHandleAuthorizer) SignAuthorization(sessionNonce tpm2.Nonce, authKey tpm2.Name, policyRef tpm2.Nonce) (*PolicySignedAuthorization, error) {
+	return nil, errors.New("cannot sign TPM2_PolicySigned authorizations")
+}
+
 // PersistentResource contains details associated with a persistent object or
 // NV index.
 type PersistentResource struct {
@@ -281,6 +357,43 @@ func (l *tpmPolicyResourceLoader) LoadName(name tpm2.Name) (ResourceContext, *Po
 	return nil, nil, errors.New("cannot find resource")
 }
 
+func (l *tpmPolicyResourceLoader) CanAuthorizeSecret(authObjectName tpm2.Name) bool {
+	if !authObjectName.IsValid() {
+		return false
+	}
+	switch a := l.Authorizer.(type) {
+	case *nullAuthorizer:
+		return false
+	case *permanentHandleAuthorizer:
+		if authObjectName.Type() != tpm2.NameTypeHandle {
+			return false
+		}
+		_, exists := a.auths[authObjectName.Handle()]
+		return exists
+	default:
+		// Resources can be found on the TPM by name, so we have to
+		// assume that the authorizer can authorize any of them.
+		return true
+	}
+}
+
+func (l *tpmPolicyResourceLoader) CanSignAuthorization(authKey tpm2.Name, policyRef tpm2.Nonce) bool {
+	switch l.Authorizer.(type) {
+	case *nullAuthorizer, *permanentHandleAuthorizer:
+		return false
+	default:
+		return true
+	}
+}
+
+func (l *tpmPolicyResourceLoader) AuthorizationSession(resource tpm2.ResourceContext) (tpm2.SessionContext, error) {
+	provider, ok := l.Authorizer.(AuthorizationSessionProvider)
+	if !ok {
+		return nil, nil
+	}
+	return provider.AuthorizationSession(resource)
+}
+
 func (l *tpmPolicyResourceLoader) LoadNVPolicy(name tpm2.Name) (*Policy, error) {
 	for _, resource := range l.resources.Persistent {
 		if !bytes.Equal(resource.Name, name) {
@@ -311,6 +424,80 @@ func (l *tpmPolicyResourceLoader) LoadAuthorizedPolicies(keySign tpm2.Name, poli
 	return out, nil
 }
 
+// StoredKey contains the details of a key in a key store supplied to
+// [NewKeyStoreResourceLoader].
+type StoredKey struct {
+	// Public is the public area of the key.
+	Public *tpm2.Public
+
+	// Private is the private area of the key, which is required if the key is
+	// not persistent.
+	Private tpm2.Private
+
+	// Parent is the identifier of the parent key in the store, which is
+	// required if the key is not persistent.
+	Parent string
+
+	// Handle is the persistent handle of the key if it is persistent. If this
+	// is set, Private and Parent are ignored.
+	Handle tpm2.Handle
+
+	// Policy is the authorization policy for the key, if there is one.
+	Policy *Policy
+}
+
+// NewKeyStoreResourceLoader returns a new PolicyResourceLoader that loads keys from
+// the supplied key store, which maps an identifier to each key. Keys that aren't
+// persistent are loaded into the TPM on demand using their parent keys, which are
+// referenced by their identifier in the store, and are flushed from the TPM once they
+// are no longer needed. This decouples policy execution from how keys are persisted.
+//
+// The supplied authorizer is used to authorize the use of keys, including the parents
+// of keys that need to be loaded.
+func NewKeyStoreResourceLoader(tpm *tpm2.TPMContext, store map[string]StoredKey, authorizer Authorizer, sessions ...tpm2.SessionContext) (PolicyResourceLoader, error) {
+	var ids []string
+	for id := range store {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	resources := new(PolicyResources)
+	for _, id := range ids {
+		key := store[id]
+		if key.Public == nil {
+			return nil, fmt.Errorf("key %q has no public area", id)
+		}
+
+		if key.Handle != 0 {
+			if key.Handle.Type() != tpm2.HandleTypePersistent {
+				return nil, fmt.Errorf("key %q has an invalid persistent handle", id)
+			}
+			resources.Persistent = append(resources.Persistent, PersistentResource{
+				Name:   key.Public.Name(),
+				Handle: key.Handle,
+				Policy: key.Policy,
+			})
+			continue
+		}
+
+		if len(key.Private) == 0 {
+			return nil, fmt.Errorf("key %q has no private area", id)
+		}
+		parent, exists := store[key.Parent]
+		if !exists || parent.Public == nil {
+			return nil, fmt.Errorf("cannot find parent %q for key %q", key.Parent, id)
+		}
+		resources.Transient = append(resources.Transient, TransientResource{
+			ParentName: parent.Public.Name(),
+			Public:     key.Public,
+			Private:    key.Private,
+			Policy:     key.Policy,
+		})
+	}
+
+	return NewTPMPolicyResourceLoader(tpm, resources, authorizer, sessions...), nil
+}
+
 type mockPolicyResourceLoader struct{}
 
 func (*mockPolicyResourceLoader) LoadName(name tpm2.Name) (ResourceContext, *Policy, error) {
@@ -359,3 +546,11 @@ func (*nullPolicyResourceLoader) Authorize(resource tpm2.ResourceContext) error
 func (*nullPolicyResourceLoader) SignAuthorization(sessionNonce tpm2.Nonce, authKey tpm2.Name, policyRef tpm2.Nonce) (*PolicySignedAuthorization, error) {
 	return nil, errors.New("no PolicyResourceLoader")
 }
+
+func (*nullPolicyResourceLoader) CanAuthorizeSecret(authObjectName tpm2.Name) bool {
+	return false
+}
+
+func (*nullPolicyResourceLoader) CanSignAuthorization(authKey tpm2.Name, policyRef tpm2.Nonce) bool {
+	return false
+}
@@ -0,0 +1,238 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package policyutil_test
+
+import (
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/go-tpm2"
+	internal_testutil "github.com/canonical/go-tpm2/internal/testutil"
+	. "github.com/canonical/go-tpm2/policyutil"
+	"github.com/canonical/go-tpm2/testutil"
+)
+
+type resourcesSuite struct {
+	testutil.TPMTest
+}
+
+func (s *resourcesSuite) SetUpSuite(c *C) {
+	s.TPMFeatures = testutil.TPMFeatureOwnerHierarchy | testutil.TPMFeatureNV
+}
+
+var _ = Suite(&resourcesSuite{})
+
+type resourcesSuiteNoTPM struct{}
+
+var _ = Suite(&resourcesSuiteNoTPM{})
+
+func (s *resourcesSuite) TestKeyStoreResourceLoaderPolicySecret(c *C) {
+	parent := s.CreateStoragePrimaryKeyRSA(c)
+	persistent := s.NextAvailableHandle(c, 0x81000008)
+	parent = s.EvictControl(c, tpm2.HandleOwner, parent, persistent)
+	parentPub, _, _, err := s.TPM.ReadPublic(parent)
+	c.Assert(err, IsNil)
+
+	template := testutil.NewRSAStorageKeyTemplate()
+	priv, pub, _, _, _, err := s.TPM.Create(parent, &tpm2.SensitiveCreate{UserAuth: []byte("foo")}, template, nil, nil, nil)
+	c.Assert(err, IsNil)
+
+	store := map[string]StoredKey{
+		"srk": {
+			Public: parentPub,
+			Handle: persistent,
+		},
+		"key": {
+			Public:  pub,
+			Private: priv,
+			Parent:  "srk",
+		},
+	}
+
+	var authObjectHandle tpm2.Handle
+	authorizer := &mockAuthorizer{
+		authorizeFn: func(resource tpm2.ResourceContext) error {
+			if resource.Handle() == persistent {
+				return nil
+			}
+			c.Check(resource.Name(), DeepEquals, pub.Name())
+			authObjectHandle = resource.Handle()
+			resource.SetAuthValue([]byte("foo"))
+			return nil
+		},
+	}
+
+	loader, err := NewKeyStoreResourceLoader(s.TPM, store, authorizer)
+	c.Assert(err, IsNil)
+
+	builder := NewPolicyBuilder()
+	c.Check(builder.RootBranch().PolicySecret(pub, []byte("bar")), IsNil)
+	policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+	expectedDigest, err := policy.Compute(tpm2.HashAlgorithmSHA256)
+	c.Check(err, IsNil)
+
+	session := s.StartAuthSession(c, nil, nil, tpm2.SessionTypePolicy, nil, tpm2.HashAlgorithmSHA256)
+
+	_, err = policy.Execute(NewTPMConnection(s.TPM), session, loader, nil)
+	c.Check(err, IsNil)
+
+	c.Check(authObjectHandle, Not(Equals), tpm2.Handle(0))
+	c.Check(s.TPM.DoesHandleExist(authObjectHandle), internal_testutil.IsFalse)
+
+	digest, err := s.TPM.PolicyGetDigest(session)
+	c.Check(err, IsNil)
+	c.Check(digest, DeepEquals, expectedDigest)
+}
+
+func (s *resourcesSuiteNoTPM) TestNewKeyStoreResourceLoaderNoPublic(c *C) {
+	_, err := NewKeyStoreResourceLoader(nil, map[string]StoredKey{"key": {Handle: 0x81000001}}, nil)
+	c.Check(err, ErrorMatches, `key "key" has no public area`)
+}
+
+func (s *resourcesSuiteNoTPM) TestNewKeyStoreResourceLoaderInvalidHandle(c *C) {
+	_, err := NewKeyStoreResourceLoader(nil, map[string]StoredKey{
+		"key": {Public: testutil.NewRSAStorageKeyTemplate(), Handle: 0x01000001},
+	}, nil)
+	c.Check(err, ErrorMatches, `key "key" has an invalid persistent handle`)
+}
+
+func (s *resourcesSuiteNoTPM) TestNewKeyStoreResourceLoaderNoPrivate(c *C) {
+	_, err := NewKeyStoreResourceLoader(nil, map[string]StoredKey{
+		"key": {Public: testutil.NewRSAStorageKeyTemplate(), Parent: "srk"},
+	}, nil)
+	c.Check(err, ErrorMatches, `key "key" has no private area`)
+}
+
+func (s *resourcesSuiteNoTPM) TestNewKeyStoreResourceLoaderMissingParent(c *C) {
+	_, err := NewKeyStoreResourceLoader(nil, map[string]StoredKey{
+		"key": {Public: testutil.NewRSAStorageKeyTemplate(), Private: tpm2.Private{1, 2, 3}, Parent: "srk"},
+	}, nil)
+	c.Check(err, ErrorMatches, `cannot find parent "srk" for key "key"`)
+}
+
+func (s *resourcesSuite) TestPermanentHandleAuthorizerPolicyNVOwnerRead(c *C) {
+	s.HierarchyChangeAuth(c, tpm2.HandleOwner, []byte("owner"))
+
+	index := s.NVDefineSpace(c, tpm2.HandleOwner, nil, &tpm2.NVPublic{
+		Index:   s.NextAvailableHandle(c, 0x0181f000),
+		NameAlg: tpm2.HashAlgorithmSHA256,
+		Attrs:   tpm2.NVTypeOrdinary.WithAttrs(tpm2.AttrNVOwnerRead | tpm2.AttrNVAuthWrite | tpm2.AttrNVNoDA),
+		Size:    8})
+	c.Assert(s.TPM.NVWrite(index, index, internal_testutil.DecodeHexString(c, "0000000000001000"), 0, nil), IsNil)
+
+	nvPub, _, err := s.TPM.NVReadPublic(index)
+	c.Assert(err, IsNil)
+
+	builder := NewPolicyBuilder()
+	c.Check(builder.RootBranch().PolicyNV(nvPub, internal_testutil.DecodeHexString(c, "00001000"), 4, tpm2.OpEq), IsNil)
+	policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+	expectedDigest, err := policy.Compute(tpm2.HashAlgorithmSHA256)
+	c.Check(err, IsNil)
+
+	session := s.StartAuthSession(c, nil, nil, tpm2.SessionTypePolicy, nil, tpm2.HashAlgorithmSHA256)
+
+	authorizer := NewPermanentHandleAuthorizer(map[tpm2.Handle]tpm2.Auth{tpm2.HandleOwner: []byte("owner")})
+	_, err = policy.Execute(NewTPMConnection(s.TPM), session, NewTPMPolicyResourceLoader(s.TPM, nil, authorizer), nil)
+	c.Check(err, IsNil)
+
+	digest, err := s.TPM.PolicyGetDigest(session)
+	c.Check(err, IsNil)
+	c.Check(digest, DeepEquals, expectedDigest)
+}
+
+func (s *resourcesSuite) TestPermanentHandleAuthorizerPolicySecret(c *C) {
+	s.HierarchyChangeAuth(c, tpm2.HandleOwner, []byte("owner"))
+
+	builder := NewPolicyBuilder()
+	c.Check(builder.RootBranch().PolicySecret(s.TPM.OwnerHandleContext(), []byte("foo")), IsNil)
+	policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+	expectedDigest, err := policy.Compute(tpm2.HashAlgorithmSHA256)
+	c.Check(err, IsNil)
+
+	session := s.StartAuthSession(c, nil, nil, tpm2.SessionTypePolicy, nil, tpm2.HashAlgorithmSHA256)
+
+	authorizer := NewPermanentHandleAuthorizer(map[tpm2.Handle]tpm2.Auth{tpm2.HandleOwner: []byte("owner")})
+	_, err = policy.Execute(NewTPMConnection(s.TPM), session, NewTPMPolicyResourceLoader(s.TPM, nil, authorizer), nil)
+	c.Check(err, IsNil)
+
+	digest, err := s.TPM.PolicyGetDigest(session)
+	c.Check(err, IsNil)
+	c.Check(digest, DeepEquals, expectedDigest)
+}
+
+func (s *resourcesSuite) TestPermanentHandleAuthorizerMissingAuth(c *C) {
+	s.HierarchyChangeAuth(c, tpm2.HandleOwner, []byte("owner"))
+
+	builder := NewPolicyBuilder()
+	c.Check(builder.RootBranch().PolicySecret(s.TPM.OwnerHandleContext(), []byte("foo")), IsNil)
+	policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+
+	session := s.StartAuthSession(c, nil, nil, tpm2.SessionTypePolicy, nil, tpm2.HashAlgorithmSHA256)
+
+	authorizer := NewPermanentHandleAuthorizer(map[tpm2.Handle]tpm2.Auth{tpm2.HandleEndorsement: []byte("endorsement")})
+	_, err = policy.Execute(NewTPMConnection(s.TPM), session, NewTPMPolicyResourceLoader(s.TPM, nil, authorizer), nil)
+	c.Check(err, ErrorMatches, `.*no authorization value for TPM_RH_OWNER`)
+}
+
+type recordAuthValueResourceContext struct {
+	tpm2.ResourceContext
+	handle    tpm2.Handle
+	authValue []byte
+}
+
+func newRecordAuthValueResourceContext(handle tpm2.Handle) *recordAuthValueResourceContext {
+	return &recordAuthValueResourceContext{handle: handle}
+}
+
+func (r *recordAuthValueResourceContext) Handle() tpm2.Handle {
+	return r.handle
+}
+
+func (r *recordAuthValueResourceContext) SetAuthValue(authValue []byte) {
+	r.authValue = authValue
+}
+
+func (s *resourcesSuiteNoTPM) TestPermanentHandleAuthorizer(c *C) {
+	auths := map[tpm2.Handle]tpm2.Auth{
+		tpm2.HandleOwner:       []byte("owner"),
+		tpm2.HandleEndorsement: []byte("endorsement"),
+	}
+	authorizer := NewPermanentHandleAuthorizer(auths)
+
+	// Modifying the supplied map should have no effect.
+	auths[tpm2.HandleOwner] = []byte("foo")
+
+	owner := newRecordAuthValueResourceContext(tpm2.HandleOwner)
+	c.Check(authorizer.Authorize(owner), IsNil)
+	c.Check(owner.authValue, DeepEquals, []byte("owner"))
+
+	endorsement := newRecordAuthValueResourceContext(tpm2.HandleEndorsement)
+	c.Check(authorizer.Authorize(endorsement), IsNil)
+	c.Check(endorsement.authValue, DeepEquals, []byte("endorsement"))
+}
+
+func (s *resourcesSuiteNoTPM) TestPermanentHandleAuthorizerMissingAuth(c *C) {
+	authorizer := NewPermanentHandleAuthorizer(map[tpm2.Handle]tpm2.Auth{tpm2.HandleOwner: []byte("owner")})
+
+	platform := newRecordAuthValueResourceContext(tpm2.HandlePlatform)
+	c.Check(authorizer.Authorize(platform), ErrorMatches, `no authorization value for TPM_RH_PLATFORM`)
+	c.Check(platform.authValue, IsNil)
+}
+
+func (s *resourcesSuiteNoTPM) TestPermanentHandleAuthorizerNonPermanent(c *C) {
+	authorizer := NewPermanentHandleAuthorizer(map[tpm2.Handle]tpm2.Auth{tpm2.HandleOwner: []byte("owner")})
+
+	object := tpm2.NewLimitedResourceContext(0x80000001, tpm2.Name(internal_testutil.DecodeHexString(c, "000bdb0ea4e49b8f77d6dad4d4b7fa4f0ee93c3c1e24ce3b7ac66d9b2a2d0fa3c4c5")))
+	c.Check(authorizer.Authorize(object), ErrorMatches, `cannot authorize non-permanent resource 0x80000001`)
+}
+
+func (s *resourcesSuiteNoTPM) TestPermanentHandleAuthorizerSignAuthorization(c *C) {
+	authorizer := NewPermanentHandleAuthorizer(nil)
+	_, err := authorizer.SignAuthorization(nil, nil, nil)
+	c.Check(err, ErrorMatches, `cannot sign TPM2_PolicySigned authorizations`)
+}
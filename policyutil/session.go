@@ -8,6 +8,7 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/canonical/go-tpm2"
 	"github.com/canonical/go-tpm2/mu"
@@ -35,6 +36,12 @@ type policySession interface {
 	PolicyPassword() error
 	PolicyGetDigest() (tpm2.Digest, error)
 	PolicyNvWritten(writtenSet bool) error
+	PolicyTemplate(templateHash tpm2.Digest) error
+	PolicyAuthorizeNV(auth, index tpm2.ResourceContext, authAuthSession tpm2.SessionContext) error
+
+	// Reset restores the session to its initial state so that it can be
+	// reused for executing another policy.
+	Reset() error
 
 	Save() (restore func() error, err error)
 }
@@ -128,6 +135,18 @@ func (s *tpmPolicySession) PolicyNvWritten(writtenSet bool) error {
 	return s.tpm.PolicyNvWritten(s.session, writtenSet)
 }
 
+func (s *tpmPolicySession) PolicyTemplate(templateHash tpm2.Digest) error {
+	return policyTemplate(s.tpm, s.session, templateHash)
+}
+
+func (s *tpmPolicySession) PolicyAuthorizeNV(auth, index tpm2.ResourceContext, authAuthSession tpm2.SessionContext) error {
+	return policyAuthorizeNV(s.tpm, auth, index, s.session, authAuthSession)
+}
+
+func (s *tpmPolicySession) Reset() error {
+	return policyRestart(s.tpm, s.session)
+}
+
 func (c *tpmPolicySession) Save() (restore func() error, err error) {
 	context, err := c.tpm.ContextSave(c.session)
 	if err != nil {
@@ -323,6 +342,25 @@ func (s *computePolicySession) PolicyNvWritten(writtenSet bool) error {
 	return nil
 }
 
+func (s *computePolicySession) PolicyTemplate(templateHash tpm2.Digest) error {
+	s.mustUpdateForCommand(tpm2.CommandPolicyTemplate, mu.Raw(templateHash))
+	return nil
+}
+
+func (s *computePolicySession) PolicyAuthorizeNV(auth, index tpm2.ResourceContext, authAuthSession tpm2.SessionContext) error {
+	if !index.Name().IsValid() {
+		return errors.New("invalid index name")
+	}
+	s.reset()
+	s.mustUpdateForCommand(tpm2.CommandPolicyAuthorizeNV, mu.Raw(index.Name()))
+	return nil
+}
+
+func (s *computePolicySession) Reset() error {
+	s.reset()
+	return nil
+}
+
 func (*computePolicySession) Save() (restore func() error, err error) {
 	return func() error { return nil }, nil
 }
@@ -411,6 +449,18 @@ func (*nullPolicySession) PolicyNvWritten(writtenSet bool) error {
 	return nil
 }
 
+func (*nullPolicySession) PolicyTemplate(templateHash tpm2.Digest) error {
+	return nil
+}
+
+func (*nullPolicySession) PolicyAuthorizeNV(auth, index tpm2.ResourceContext, authAuthSession tpm2.SessionContext) error {
+	return nil
+}
+
+func (*nullPolicySession) Reset() error {
+	return nil
+}
+
 func (*nullPolicySession) Save() (restore func() error, err error) {
 	return func() error { return nil }, nil
 }
@@ -553,6 +603,330 @@ func (s *proxyPolicySession) PolicyNvWritten(writtenSet bool) error {
 	return s.session.PolicyNvWritten(writtenSet)
 }
 
+func (s *proxyPolicySession) PolicyTemplate(templateHash tpm2.Digest) error {
+	s.details.policyTemplateHash = append(s.details.policyTemplateHash, templateHash)
+	return s.session.PolicyTemplate(templateHash)
+}
+
+func (s *proxyPolicySession) PolicyAuthorizeNV(auth, index tpm2.ResourceContext, authAuthSession tpm2.SessionContext) error {
+	s.details.AuthorizeNV = append(s.details.AuthorizeNV, PolicyAuthorizeNVDetails{
+		Auth:  auth.Handle(),
+		Index: index.Handle(),
+		Name:  index.Name(),
+	})
+	return s.session.PolicyAuthorizeNV(auth, index, authAuthSession)
+}
+
+func (s *proxyPolicySession) Reset() error {
+	if err := s.session.Reset(); err != nil {
+		return err
+	}
+	*s.details = PolicyBranchDetails{}
+	return nil
+}
+
 func (s *proxyPolicySession) Save() (restore func() error, err error) {
 	return s.session.Save()
 }
+
+// approvingPolicySession is an implementation of policySession that calls an
+// approver function before each assertion is passed to the wrapped session. If
+// the approver returns an error, the assertion isn't issued.
+type approvingPolicySession struct {
+	session  policySession
+	approver func(string) error
+}
+
+func newApprovingPolicySession(session policySession, approver func(string) error) *approvingPolicySession {
+	return &approvingPolicySession{
+		session:  session,
+		approver: approver,
+	}
+}
+
+func (s *approvingPolicySession) approve(format string, args ...interface{}) error {
+	assertion := fmt.Sprintf(format, args...)
+	if err := s.approver(assertion); err != nil {
+		return fmt.Errorf("%s was not approved: %w", assertion, err)
+	}
+	return nil
+}
+
+func (s *approvingPolicySession) Name() tpm2.Name {
+	return s.session.Name()
+}
+
+func (s *approvingPolicySession) HashAlg() tpm2.HashAlgorithmId {
+	return s.session.HashAlg()
+}
+
+func (s *approvingPolicySession) NonceTPM() tpm2.Nonce {
+	return s.session.NonceTPM()
+}
+
+func (s *approvingPolicySession) PolicySigned(authKey tpm2.ResourceContext, includeNonceTPM bool, cpHashA tpm2.Digest, policyRef tpm2.Nonce, expiration int32, auth *tpm2.Signature) (tpm2.Timeout, *tpm2.TkAuth, error) {
+	if err := s.approve("TPM2_PolicySigned(authKey:%#x, policyRef:%#x)", authKey.Name(), policyRef); err != nil {
+		return nil, nil, err
+	}
+	return s.session.PolicySigned(authKey, includeNonceTPM, cpHashA, policyRef, expiration, auth)
+}
+
+func (s *approvingPolicySession) PolicySecret(authObject tpm2.ResourceContext, cpHashA tpm2.Digest, policyRef tpm2.Nonce, expiration int32, authObjectAuthSession tpm2.SessionContext) (tpm2.Timeout, *tpm2.TkAuth, error) {
+	if err := s.approve("TPM2_PolicySecret(authObject:%#x, policyRef:%#x)", authObject.Name(), policyRef); err != nil {
+		return nil, nil, err
+	}
+	return s.session.PolicySecret(authObject, cpHashA, policyRef, expiration, authObjectAuthSession)
+}
+
+func (s *approvingPolicySession) PolicyTicket(timeout tpm2.Timeout, cpHashA tpm2.Digest, policyRef tpm2.Nonce, authName tpm2.Name, ticket *tpm2.TkAuth) error {
+	if err := s.approve("TPM2_PolicyTicket(authName:%#x, policyRef:%#x)", authName, policyRef); err != nil {
+		return err
+	}
+	return s.session.PolicyTicket(timeout, cpHashA, policyRef, authName, ticket)
+}
+
+func (s *approvingPolicySession) PolicyOR(pHashList tpm2.DigestList) error {
+	var digests []string
+	for _, digest := range pHashList {
+		digests = append(digests, fmt.Sprintf("%#x", digest))
+	}
+	if err := s.approve("TPM2_PolicyOR(pHashList:[%s])", strings.Join(digests, ", ")); err != nil {
+		return err
+	}
+	return s.session.PolicyOR(pHashList)
+}
+
+func (s *approvingPolicySession) PolicyPCR(pcrDigest tpm2.Digest, pcrs tpm2.PCRSelectionList) error {
+	var selections []string
+	for _, selection := range pcrs {
+		selections = append(selections, fmt.Sprintf("%v:%v", selection.Hash, selection.Select))
+	}
+	if err := s.approve("TPM2_PolicyPCR(pcrDigest:%#x, pcrs:[%s])", pcrDigest, strings.Join(selections, ", ")); err != nil {
+		return err
+	}
+	return s.session.PolicyPCR(pcrDigest, pcrs)
+}
+
+func (s *approvingPolicySession) PolicyNV(auth, index tpm2.ResourceContext, operandB tpm2.Operand, offset uint16, operation tpm2.ArithmeticOp, authAuthSession tpm2.SessionContext) error {
+	if err := s.approve("TPM2_PolicyNV(index:%v, operandB:%#x, offset:%d, operation:%s)", index.Handle(), operandB, offset, operation); err != nil {
+		return err
+	}
+	return s.session.PolicyNV(auth, index, operandB, offset, operation, authAuthSession)
+}
+
+func (s *approvingPolicySession) PolicyCounterTimer(operandB tpm2.Operand, offset uint16, operation tpm2.ArithmeticOp) error {
+	if err := s.approve("TPM2_PolicyCounterTimer(operandB:%#x, offset:%d, operation:%s)", operandB, offset, operation); err != nil {
+		return err
+	}
+	return s.session.PolicyCounterTimer(operandB, offset, operation)
+}
+
+func (s *approvingPolicySession) PolicyCommandCode(code tpm2.CommandCode) error {
+	if err := s.approve("TPM2_PolicyCommandCode(%v)", code); err != nil {
+		return err
+	}
+	return s.session.PolicyCommandCode(code)
+}
+
+func (s *approvingPolicySession) PolicyCpHash(cpHashA tpm2.Digest) error {
+	if err := s.approve("TPM2_PolicyCpHash(cpHash:%#x)", cpHashA); err != nil {
+		return err
+	}
+	return s.session.PolicyCpHash(cpHashA)
+}
+
+func (s *approvingPolicySession) PolicyNameHash(nameHash tpm2.Digest) error {
+	if err := s.approve("TPM2_PolicyNameHash(nameHash:%#x)", nameHash); err != nil {
+		return err
+	}
+	return s.session.PolicyNameHash(nameHash)
+}
+
+func (s *approvingPolicySession) PolicyDuplicationSelect(objectName, newParentName tpm2.Name, includeObject bool) error {
+	if err := s.approve("TPM2_PolicyDuplicationSelect(object:%#x, newParent:%#x, includeObject:%t)", objectName, newParentName, includeObject); err != nil {
+		return err
+	}
+	return s.session.PolicyDuplicationSelect(objectName, newParentName, includeObject)
+}
+
+func (s *approvingPolicySession) PolicyAuthorize(approvedPolicy tpm2.Digest, policyRef tpm2.Nonce, keySign tpm2.Name, verified *tpm2.TkVerified) error {
+	if err := s.approve("TPM2_PolicyAuthorize(approvedPolicy:%#x, policyRef:%#x, keySign:%#x)", approvedPolicy, policyRef, keySign); err != nil {
+		return err
+	}
+	return s.session.PolicyAuthorize(approvedPolicy, policyRef, keySign, verified)
+}
+
+func (s *approvingPolicySession) PolicyAuthValue() error {
+	if err := s.approve("TPM2_PolicyAuthValue()"); err != nil {
+		return err
+	}
+	return s.session.PolicyAuthValue()
+}
+
+func (s *approvingPolicySession) PolicyPassword() error {
+	if err := s.approve("TPM2_PolicyPassword()"); err != nil {
+		return err
+	}
+	return s.session.PolicyPassword()
+}
+
+func (s *approvingPolicySession) PolicyGetDigest() (tpm2.Digest, error) {
+	return s.session.PolicyGetDigest()
+}
+
+func (s *approvingPolicySession) PolicyNvWritten(writtenSet bool) error {
+	if err := s.approve("TPM2_PolicyNvWritten(%t)", writtenSet); err != nil {
+		return err
+	}
+	return s.session.PolicyNvWritten(writtenSet)
+}
+
+func (s *approvingPolicySession) PolicyTemplate(templateHash tpm2.Digest) error {
+	if err := s.approve("TPM2_PolicyTemplate(templateHash:%#x)", templateHash); err != nil {
+		return err
+	}
+	return s.session.PolicyTemplate(templateHash)
+}
+
+func (s *approvingPolicySession) PolicyAuthorizeNV(auth, index tpm2.ResourceContext, authAuthSession tpm2.SessionContext) error {
+	if err := s.approve("TPM2_PolicyAuthorizeNV(index:%v)", index.Handle()); err != nil {
+		return err
+	}
+	return s.session.PolicyAuthorizeNV(auth, index, authAuthSession)
+}
+
+func (s *approvingPolicySession) Reset() error {
+	return s.session.Reset()
+}
+
+func (s *approvingPolicySession) Save() (restore func() error, err error) {
+	return s.session.Save()
+}
+
+// errNoSessionAvailable is returned from policySessionPool.acquire when a
+// session can't be obtained because the pool's limit has been reached or
+// the TPM has run out of session slots.
+var errNoSessionAvailable = errors.New("no session available")
+
+// policySessionPool is a bounded pool of policy sessions. It is used for
+// reading NV indices during automatic branch selection, where sessions are
+// only needed briefly. Sessions that are released back to the pool are
+// reused after being reset, if the TPMConnection supports TPM2_PolicyRestart.
+type policySessionPool struct {
+	tpm       TPMConnection
+	limit     int                  // the maximum number of sessions that can be loaded at once, or 0 for no limit
+	symmetric *tpm2.SymDef         // the symmetric algorithm for response parameter encryption, or nil
+	tpmKey    tpm2.ResourceContext // the key used to salt sessions that use response parameter encryption
+	idle      []tpm2.SessionContext
+	inUse     []tpm2.SessionContext
+
+	// unchecked contains the TPM2_PolicyNV assertions that couldn't be checked
+	// because a session wasn't available.
+	unchecked     []PolicyNVDetails
+	uncheckedKeys map[paramKey]struct{}
+}
+
+func newPolicySessionPool(tpm TPMConnection, limit int, symmetric *tpm2.SymDef, tpmKey tpm2.ResourceContext) *policySessionPool {
+	return &policySessionPool{
+		tpm:       tpm,
+		limit:     limit,
+		symmetric: symmetric,
+		tpmKey:    tpmKey,
+	}
+}
+
+// responseEncrypt indicates whether sessions from this pool should be used
+// for response parameter encryption.
+func (p *policySessionPool) responseEncrypt() bool {
+	return p.symmetric != nil && p.symmetric.Algorithm != tpm2.SymAlgorithmNull
+}
+
+// acquire returns a policy session with the specified digest algorithm,
+// either by restarting an idle session or by starting a new one.
+func (p *policySessionPool) acquire(alg tpm2.HashAlgorithmId) (tpm2.SessionContext, error) {
+	for i, session := range p.idle {
+		if session.HashAlg() != alg {
+			continue
+		}
+
+		p.idle = append(p.idle[:i], p.idle[i+1:]...)
+		if err := newTpmPolicySession(p.tpm, session).Reset(); err != nil {
+			p.tpm.FlushContext(session)
+			break
+		}
+
+		p.inUse = append(p.inUse, session)
+		return session, nil
+	}
+
+	if p.limit > 0 {
+		if len(p.inUse) >= p.limit {
+			return nil, errNoSessionAvailable
+		}
+		for len(p.idle) > 0 && len(p.inUse)+len(p.idle) >= p.limit {
+			// Make room by evicting an idle session with a different algorithm.
+			p.tpm.FlushContext(p.idle[0])
+			p.idle = p.idle[1:]
+		}
+	}
+
+	var session tpm2.SessionContext
+	var err error
+	if p.responseEncrypt() {
+		session, err = startSaltedAuthSession(p.tpm, p.tpmKey, tpm2.SessionTypePolicy, p.symmetric, alg)
+	} else {
+		session, err = p.tpm.StartAuthSession(tpm2.SessionTypePolicy, alg)
+	}
+	switch {
+	case tpm2.IsTPMWarning(err, tpm2.WarningSessionMemory, tpm2.CommandStartAuthSession) ||
+		tpm2.IsTPMWarning(err, tpm2.WarningSessionHandles, tpm2.CommandStartAuthSession):
+		return nil, errNoSessionAvailable
+	case err != nil:
+		return nil, err
+	}
+
+	p.inUse = append(p.inUse, session)
+	return session, nil
+}
+
+// recordUnchecked records that the supplied TPM2_PolicyNV assertion couldn't be
+// checked because acquire returned errNoSessionAvailable.
+func (p *policySessionPool) recordUnchecked(nv *PolicyNVDetails) {
+	key := nvAssertionKey(nv)
+	if _, exists := p.uncheckedKeys[key]; exists {
+		return
+	}
+	if p.uncheckedKeys == nil {
+		p.uncheckedKeys = make(map[paramKey]struct{})
+	}
+	p.uncheckedKeys[key] = struct{}{}
+	p.unchecked = append(p.unchecked, *nv)
+}
+
+// release returns the supplied session, which must have been obtained
+// from acquire, to the pool.
+func (p *policySessionPool) release(session tpm2.SessionContext) {
+	for i, s := range p.inUse {
+		if s == session {
+			p.inUse = append(p.inUse[:i], p.inUse[i+1:]...)
+			p.idle = append(p.idle, session)
+			return
+		}
+	}
+}
+
+// flush flushes all sessions obtained from this pool from the TPM and resets
+// the pool to its initial state. This includes sessions that were acquired
+// but never released, such as when execution was abandoned because of an
+// error. The record of unchecked assertions is retained so that it can be
+// reported once execution has completed.
+func (p *policySessionPool) flush() {
+	for _, session := range p.idle {
+		p.tpm.FlushContext(session)
+	}
+	for _, session := range p.inUse {
+		p.tpm.FlushContext(session)
+	}
+	p.idle = nil
+	p.inUse = nil
+}
@@ -0,0 +1,149 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package policyutil_test
+
+import (
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/go-tpm2"
+	. "github.com/canonical/go-tpm2/policyutil"
+	"github.com/canonical/go-tpm2/testutil"
+)
+
+type sessionSuiteNoTPM struct{}
+
+type sessionSuite struct {
+	testutil.TPMTest
+}
+
+var _ = Suite(&sessionSuiteNoTPM{})
+var _ = Suite(&sessionSuite{})
+
+func (s *sessionSuiteNoTPM) TestComputePolicySessionReset(c *C) {
+	digest := &TaggedHash{HashAlg: tpm2.HashAlgorithmSHA256, Digest: make(tpm2.Digest, 32)}
+	session := NewComputePolicySession(digest)
+	c.Check(session.PolicyAuthValue(), IsNil)
+	c.Check(digest.Digest, Not(DeepEquals), make(tpm2.Digest, 32))
+
+	c.Check(session.Reset(), IsNil)
+	c.Check(digest.Digest, DeepEquals, make(tpm2.Digest, 32))
+
+	builder := NewPolicyBuilder()
+	c.Check(builder.RootBranch().PolicyCommandCode(tpm2.CommandNVChangeAuth), IsNil)
+	policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+	expectedDigest, err := policy.Compute(tpm2.HashAlgorithmSHA256)
+	c.Check(err, IsNil)
+
+	c.Check(session.PolicyCommandCode(tpm2.CommandNVChangeAuth), IsNil)
+	c.Check(digest.Digest, DeepEquals, expectedDigest)
+}
+
+func (s *sessionSuite) TestTpmPolicySessionReset(c *C) {
+	builder := NewPolicyBuilder()
+	c.Check(builder.RootBranch().PolicyAuthValue(), IsNil)
+	policy1, err := builder.Policy()
+	c.Assert(err, IsNil)
+	_, err = policy1.Compute(tpm2.HashAlgorithmSHA256)
+	c.Check(err, IsNil)
+
+	builder = NewPolicyBuilder()
+	c.Check(builder.RootBranch().PolicyCommandCode(tpm2.CommandNVChangeAuth), IsNil)
+	policy2, err := builder.Policy()
+	c.Assert(err, IsNil)
+	expectedDigest, err := policy2.Compute(tpm2.HashAlgorithmSHA256)
+	c.Check(err, IsNil)
+
+	session := s.StartAuthSession(c, nil, nil, tpm2.SessionTypePolicy, nil, tpm2.HashAlgorithmSHA256)
+	tpm := NewTPMConnection(s.TPM)
+
+	_, err = policy1.Execute(tpm, session, nil, nil)
+	c.Check(err, IsNil)
+
+	c.Check(NewTpmPolicySession(tpm, session).Reset(), IsNil)
+
+	digest, err := s.TPM.PolicyGetDigest(session)
+	c.Check(err, IsNil)
+	c.Check(digest, DeepEquals, make(tpm2.Digest, 32))
+
+	_, err = policy2.Execute(tpm, session, nil, nil)
+	c.Check(err, IsNil)
+
+	digest, err = s.TPM.PolicyGetDigest(session)
+	c.Check(err, IsNil)
+	c.Check(digest, DeepEquals, expectedDigest)
+}
+
+func (s *sessionSuiteNoTPM) TestTpmPolicySessionPolicyTemplateUnsupported(c *C) {
+	tpm := struct{ TPMConnection }{NewTPMConnection(nil)}
+	session := NewTpmPolicySession(tpm, nil)
+	c.Check(session.PolicyTemplate(make(tpm2.Digest, 32)), ErrorMatches, `TPMConnection does not support TPM_CC_PolicyTemplate`)
+}
+
+func (s *sessionSuiteNoTPM) TestTpmPolicySessionPolicyAuthorizeNVUnsupported(c *C) {
+	tpm := struct{ TPMConnection }{NewTPMConnection(nil)}
+	session := NewTpmPolicySession(tpm, nil)
+	c.Check(session.PolicyAuthorizeNV(nil, nil, nil), ErrorMatches, `TPMConnection does not support TPM_CC_PolicyAuthorizeNV`)
+}
+
+type mockPoolSession struct {
+	tpm2.SessionContext
+	handle tpm2.Handle
+}
+
+func (s *mockPoolSession) Handle() tpm2.Handle {
+	return s.handle
+}
+
+func (s *mockPoolSession) HashAlg() tpm2.HashAlgorithmId {
+	return tpm2.HashAlgorithmSHA256
+}
+
+type mockPoolTPMConnection struct {
+	TPMConnection
+	next   tpm2.Handle
+	loaded map[tpm2.Handle]struct{}
+}
+
+func (c *mockPoolTPMConnection) StartAuthSession(sessionType tpm2.SessionType, alg tpm2.HashAlgorithmId) (tpm2.SessionContext, error) {
+	session := &mockPoolSession{handle: tpm2.HandleTypePolicySession.BaseHandle() + c.next}
+	c.next++
+	c.loaded[session.Handle()] = struct{}{}
+	return session, nil
+}
+
+func (c *mockPoolTPMConnection) FlushContext(handle tpm2.HandleContext) error {
+	delete(c.loaded, handle.Handle())
+	return nil
+}
+
+func (s *sessionSuiteNoTPM) TestPolicySessionPoolFlushResetsState(c *C) {
+	tpm := &mockPoolTPMConnection{loaded: make(map[tpm2.Handle]struct{})}
+	pool := NewPolicySessionPool(tpm, 2, nil, nil)
+
+	session1, err := pool.Acquire(tpm2.HashAlgorithmSHA256)
+	c.Assert(err, IsNil)
+	_, err = pool.Acquire(tpm2.HashAlgorithmSHA256)
+	c.Assert(err, IsNil)
+	_, err = pool.Acquire(tpm2.HashAlgorithmSHA256)
+	c.Check(err, ErrorMatches, `no session available`)
+
+	// Only release one of the sessions, as if execution of the other was
+	// abandoned.
+	pool.Release(session1)
+
+	pool.Flush()
+	c.Check(tpm.loaded, HasLen, 0)
+
+	// The pool should have its full limit available again.
+	_, err = pool.Acquire(tpm2.HashAlgorithmSHA256)
+	c.Check(err, IsNil)
+	_, err = pool.Acquire(tpm2.HashAlgorithmSHA256)
+	c.Check(err, IsNil)
+	c.Check(tpm.loaded, HasLen, 2)
+
+	pool.Flush()
+	c.Check(tpm.loaded, HasLen, 0)
+}
@@ -0,0 +1,129 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package policyutil
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+
+	"github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/objectutil"
+)
+
+// signerPolicyResourceLoader is a PolicyResourceLoader that signs authorizations for
+// TPM2_PolicySigned assertions associated with a specific key and policy ref, and
+// delegates everything else to another PolicyResourceLoader.
+type signerPolicyResourceLoader struct {
+	PolicyResourceLoader
+	sessionAlg tpm2.HashAlgorithmId
+	signer     crypto.Signer
+	authKey    *tpm2.Public
+	policyRef  tpm2.Nonce
+}
+
+func (l *signerPolicyResourceLoader) CanAuthorizeSecret(authObjectName tpm2.Name) bool {
+	c, ok := l.PolicyResourceLoader.(AuthorizationChecker)
+	if !ok {
+		return false
+	}
+	return c.CanAuthorizeSecret(authObjectName)
+}
+
+func (l *signerPolicyResourceLoader) CanSignAuthorization(authKey tpm2.Name, policyRef tpm2.Nonce) bool {
+	if bytes.Equal(authKey, l.authKey.Name()) && bytes.Equal(policyRef, l.policyRef) {
+		return true
+	}
+	c, ok := l.PolicyResourceLoader.(AuthorizationChecker)
+	if !ok {
+		return false
+	}
+	return c.CanSignAuthorization(authKey, policyRef)
+}
+
+func (l *signerPolicyResourceLoader) SignAuthorization(sessionNonce tpm2.Nonce, authKey tpm2.Name, policyRef tpm2.Nonce) (*PolicySignedAuthorization, error) {
+	if !bytes.Equal(authKey, l.authKey.Name()) || !bytes.Equal(policyRef, l.policyRef) {
+		return l.PolicyResourceLoader.SignAuthorization(sessionNonce, authKey, policyRef)
+	}
+
+	auth, err := NewPolicySignedAuthorization(l.sessionAlg, sessionNonce, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := auth.Sign(rand.Reader, l.authKey, policyRef, l.signer, l.sessionAlg.GetHash()); err != nil {
+		return nil, err
+	}
+	return auth, nil
+}
+
+func (l *signerPolicyResourceLoader) AuthorizationSession(resource tpm2.ResourceContext) (tpm2.SessionContext, error) {
+	provider, ok := l.PolicyResourceLoader.(AuthorizationSessionProvider)
+	if !ok {
+		return nil, nil
+	}
+	return provider.AuthorizationSession(resource)
+}
+
+// ExecuteWithSigner runs the supplied policy using the supplied TPM context and on the
+// supplied policy session, in the same way as [Policy.Execute]. Authorizations for
+// TPM2_PolicySigned assertions associated with the supplied public key and policy ref
+// are signed by the supplied signer, bound to the session's nonce and using the
+// session's digest algorithm. This is convenient for the case where the caller has an
+// offline signing key and wants to satisfy a TPM2_PolicySigned assertion without
+// having to implement [Authorizer]. The public key is loaded in to the TPM by
+// [Policy.Execute] when the assertion is executed, and flushed afterwards.
+//
+// If pub is not supplied, it is created from the public key associated with the
+// signer, which must be a RSA or ECDSA key. In this case, the assertion must have been
+// created with a public key that has the default attributes and parameters (see
+// [objectutil.NewRSAPublicKey] and [objectutil.NewECCPublicKey]).
+//
+// Other resources required by the policy are obtained from the supplied
+// PolicyResourceLoader, which is optional. Authorizations for TPM2_PolicySigned
+// assertions associated with other keys are also obtained from this. If
+// [PolicyExecuteParams.ValidateParams] is set, the supplied PolicyResourceLoader must
+// implement [AuthorizationChecker] in order to be able to validate these.
+func ExecuteWithSigner(tpm TPMConnection, policy *Policy, session tpm2.SessionContext, signer crypto.Signer, pub *tpm2.Public, policyRef tpm2.Nonce, resources PolicyResourceLoader, params *PolicyExecuteParams) (*PolicyExecuteResult, error) {
+	if session == nil {
+		return nil, errors.New("no session")
+	}
+	if signer == nil {
+		return nil, errors.New("no signer")
+	}
+
+	if pub == nil {
+		var err error
+		switch k := signer.Public().(type) {
+		case *rsa.PublicKey:
+			pub, err = objectutil.NewRSAPublicKey(k)
+		case *ecdsa.PublicKey:
+			pub, err = objectutil.NewECCPublicKey(k)
+		default:
+			return nil, errors.New("unsupported signer key type")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot create public key: %w", err)
+		}
+	}
+	if !pub.IsAsymmetric() {
+		return nil, errors.New("public key is not asymmetric")
+	}
+
+	if resources == nil {
+		resources = new(nullPolicyResourceLoader)
+	}
+
+	return policy.Execute(tpm, session, &signerPolicyResourceLoader{
+		PolicyResourceLoader: resources,
+		sessionAlg:           session.HashAlg(),
+		signer:               signer,
+		authKey:              pub,
+		policyRef:            policyRef,
+	}, params)
+}
@@ -0,0 +1,186 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package policyutil_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/go-tpm2"
+	internal_testutil "github.com/canonical/go-tpm2/internal/testutil"
+	"github.com/canonical/go-tpm2/objectutil"
+	. "github.com/canonical/go-tpm2/policyutil"
+	"github.com/canonical/go-tpm2/testutil"
+)
+
+type signerSuite struct {
+	testutil.TPMTest
+}
+
+func (s *signerSuite) SetUpSuite(c *C) {
+	s.TPMFeatures = testutil.TPMFeatureOwnerHierarchy
+}
+
+var _ = Suite(&signerSuite{})
+
+func (s *signerSuite) TestExecuteWithSignerRSA(c *C) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	c.Assert(err, IsNil)
+
+	authKey, err := objectutil.NewRSAPublicKey(&key.PublicKey)
+	c.Assert(err, IsNil)
+
+	builder := NewPolicyBuilder()
+	c.Check(builder.RootBranch().PolicySigned(authKey, nil), IsNil)
+	policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+	expectedDigest, err := policy.Compute(tpm2.HashAlgorithmSHA256)
+	c.Check(err, IsNil)
+
+	session := s.StartAuthSession(c, nil, nil, tpm2.SessionTypePolicy, nil, tpm2.HashAlgorithmSHA256)
+
+	s.ForgetCommands()
+
+	result, err := ExecuteWithSigner(NewTPMConnection(s.TPM), policy, session, key, nil, nil, nil, nil)
+	c.Check(err, IsNil)
+	c.Check(result.Tickets, internal_testutil.LenEquals, 0)
+	c.Check(result.AuthValueNeeded, internal_testutil.IsFalse)
+	c.Check(result.Path, Equals, "")
+
+	commands := s.CommandLog()
+	c.Assert(commands, internal_testutil.LenEquals, 3)
+	c.Check(commands[0].GetCommandCode(c), Equals, tpm2.CommandLoadExternal)
+	c.Check(commands[1].GetCommandCode(c), Equals, tpm2.CommandPolicySigned)
+	c.Check(commands[2].GetCommandCode(c), Equals, tpm2.CommandFlushContext)
+
+	digest, err := s.TPM.PolicyGetDigest(session)
+	c.Check(err, IsNil)
+	c.Check(digest, DeepEquals, expectedDigest)
+}
+
+func (s *signerSuite) TestExecuteWithSignerECCWithPublicKeyAndPolicyRef(c *C) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+
+	authKey, err := objectutil.NewECCPublicKey(&key.PublicKey, objectutil.WithNameAlg(tpm2.HashAlgorithmSHA1))
+	c.Assert(err, IsNil)
+
+	builder := NewPolicyBuilder()
+	c.Check(builder.RootBranch().PolicySigned(authKey, []byte("foo")), IsNil)
+	policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+	expectedDigest, err := policy.Compute(tpm2.HashAlgorithmSHA256)
+	c.Check(err, IsNil)
+
+	session := s.StartAuthSession(c, nil, nil, tpm2.SessionTypePolicy, nil, tpm2.HashAlgorithmSHA256)
+
+	result, err := ExecuteWithSigner(NewTPMConnection(s.TPM), policy, session, key, authKey, []byte("foo"), nil, nil)
+	c.Check(err, IsNil)
+	c.Check(result.Tickets, internal_testutil.LenEquals, 0)
+	c.Check(result.AuthValueNeeded, internal_testutil.IsFalse)
+
+	digest, err := s.TPM.PolicyGetDigest(session)
+	c.Check(err, IsNil)
+	c.Check(digest, DeepEquals, expectedDigest)
+}
+
+func (s *signerSuite) TestExecuteWithSignerDifferentPolicyRef(c *C) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+
+	authKey, err := objectutil.NewECCPublicKey(&key.PublicKey)
+	c.Assert(err, IsNil)
+
+	builder := NewPolicyBuilder()
+	c.Check(builder.RootBranch().PolicySigned(authKey, []byte("foo")), IsNil)
+	policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+
+	session := s.StartAuthSession(c, nil, nil, tpm2.SessionTypePolicy, nil, tpm2.HashAlgorithmSHA256)
+
+	_, err = ExecuteWithSigner(NewTPMConnection(s.TPM), policy, session, key, nil, []byte("bar"), nil, nil)
+	c.Check(err, ErrorMatches, `cannot run 'TPM2_PolicySigned assertion' task in root branch: cannot complete authorization with authName=0x[[:xdigit:]]+, policyRef=0x666f6f: cannot obtain signed authorization: no PolicyResourceLoader`)
+}
+
+func (s *signerSuite) TestExecuteWithSignerNoSigner(c *C) {
+	builder := NewPolicyBuilder()
+	policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+
+	session := s.StartAuthSession(c, nil, nil, tpm2.SessionTypePolicy, nil, tpm2.HashAlgorithmSHA256)
+
+	_, err = ExecuteWithSigner(NewTPMConnection(s.TPM), policy, session, nil, nil, nil, nil, nil)
+	c.Check(err, ErrorMatches, `no signer`)
+}
+
+func (s *signerSuite) TestExecuteWithSignerUnsupportedKey(c *C) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	c.Assert(err, IsNil)
+
+	builder := NewPolicyBuilder()
+	policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+
+	session := s.StartAuthSession(c, nil, nil, tpm2.SessionTypePolicy, nil, tpm2.HashAlgorithmSHA256)
+
+	_, err = ExecuteWithSigner(NewTPMConnection(s.TPM), policy, session, key, nil, nil, nil, nil)
+	c.Check(err, ErrorMatches, `unsupported signer key type`)
+}
+
+func (s *signerSuite) TestExecuteWithSignerValidateParams(c *C) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+
+	authKey, err := objectutil.NewECCPublicKey(&key.PublicKey)
+	c.Assert(err, IsNil)
+
+	builder := NewPolicyBuilder()
+	c.Check(builder.RootBranch().PolicySigned(authKey, []byte("foo")), IsNil)
+	policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+	expectedDigest, err := policy.Compute(tpm2.HashAlgorithmSHA256)
+	c.Check(err, IsNil)
+
+	session := s.StartAuthSession(c, nil, nil, tpm2.SessionTypePolicy, nil, tpm2.HashAlgorithmSHA256)
+
+	_, err = ExecuteWithSigner(NewTPMConnection(s.TPM), policy, session, key, nil, []byte("foo"), nil, &PolicyExecuteParams{ValidateParams: true})
+	c.Check(err, IsNil)
+
+	digest, err := s.TPM.PolicyGetDigest(session)
+	c.Check(err, IsNil)
+	c.Check(digest, DeepEquals, expectedDigest)
+}
+
+func (s *signerSuite) TestExecuteWithSignerValidateParamsMissingAuthorization(c *C) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+
+	authKey, err := objectutil.NewECCPublicKey(&key.PublicKey)
+	c.Assert(err, IsNil)
+
+	builder := NewPolicyBuilder()
+	c.Check(builder.RootBranch().PolicySigned(authKey, []byte("foo")), IsNil)
+	policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+
+	session := s.StartAuthSession(c, nil, nil, tpm2.SessionTypePolicy, nil, tpm2.HashAlgorithmSHA256)
+
+	s.ForgetCommands()
+
+	_, err = ExecuteWithSigner(NewTPMConnection(s.TPM), policy, session, key, nil, []byte("bar"), nil, &PolicyExecuteParams{ValidateParams: true})
+	c.Check(err, ErrorMatches, `invalid parameters: root branch: cannot complete authorization with authName=0x[[:xdigit:]]+, policyRef=0x666f6f: no ticket and the PolicyResourceLoader cannot provide the authorization`)
+
+	var pae *PolicyAuthorizationError
+	c.Assert(err, internal_testutil.ErrorAs, &pae)
+	c.Check(pae.AuthName, DeepEquals, authKey.Name())
+
+	// Nothing should have been executed.
+	c.Check(s.CommandLog(), internal_testutil.LenEquals, 0)
+}
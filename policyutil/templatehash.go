@@ -0,0 +1,30 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package policyutil
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/mu"
+)
+
+// ComputeTemplateHash computes a digest of the supplied object template using the specified
+// digest algorithm.
+//
+// The result of this is useful with [tpm2.TPMContext.PolicyTemplate].
+func ComputeTemplateHash(alg tpm2.HashAlgorithmId, template *tpm2.Public) (tpm2.Digest, error) {
+	if !alg.Available() {
+		return nil, errors.New("algorithm is not available")
+	}
+
+	h := alg.NewHash()
+	if _, err := mu.MarshalToWriter(h, template); err != nil {
+		return nil, fmt.Errorf("cannot marshal template: %w", err)
+	}
+
+	return h.Sum(nil), nil
+}
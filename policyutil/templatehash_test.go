@@ -0,0 +1,57 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package policyutil_test
+
+import (
+	"crypto"
+	_ "crypto/sha1"
+	_ "crypto/sha256"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/mu"
+	"github.com/canonical/go-tpm2/objectutil"
+	. "github.com/canonical/go-tpm2/policyutil"
+)
+
+type templateHashSuite struct{}
+
+var _ = Suite(&templateHashSuite{})
+
+func (s *templateHashSuite) testComputeTemplateHash(c *C, alg tpm2.HashAlgorithmId, template *tpm2.Public) {
+	templateHash, err := ComputeTemplateHash(alg, template)
+	c.Check(err, IsNil)
+
+	h := alg.GetHash().New()
+	mu.MustMarshalToWriter(h, template)
+	c.Check(templateHash, DeepEquals, tpm2.Digest(h.Sum(nil)))
+}
+
+func (s *templateHashSuite) TestComputeTemplateHashRSA(c *C) {
+	s.testComputeTemplateHash(c, tpm2.HashAlgorithmSHA256, objectutil.NewRSAStorageKeyTemplate())
+}
+
+func (s *templateHashSuite) TestComputeTemplateHashECC(c *C) {
+	s.testComputeTemplateHash(c, tpm2.HashAlgorithmSHA256, objectutil.NewECCKeyTemplate(objectutil.UsageSign))
+}
+
+func (s *templateHashSuite) TestComputeTemplateHashSHA1(c *C) {
+	s.testComputeTemplateHash(c, tpm2.HashAlgorithmSHA1, objectutil.NewRSAStorageKeyTemplate())
+}
+
+func (s *templateHashSuite) TestComputeTemplateHashDifferentTemplates(c *C) {
+	h1, err := ComputeTemplateHash(tpm2.HashAlgorithmSHA256, objectutil.NewRSAStorageKeyTemplate())
+	c.Check(err, IsNil)
+	h2, err := ComputeTemplateHash(tpm2.HashAlgorithmSHA256, objectutil.NewRSAStorageKeyTemplate(objectutil.WithRSAKeyBits(3072)))
+	c.Check(err, IsNil)
+	c.Check(h1, Not(DeepEquals), h2)
+	c.Check(h1, HasLen, crypto.SHA256.Size())
+}
+
+func (s *templateHashSuite) TestComputeTemplateHashUnavailableAlg(c *C) {
+	_, err := ComputeTemplateHash(tpm2.HashAlgorithmNull, objectutil.NewRSAStorageKeyTemplate())
+	c.Check(err, ErrorMatches, `algorithm is not available`)
+}
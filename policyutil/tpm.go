@@ -5,6 +5,8 @@
 package policyutil
 
 import (
+	"fmt"
+
 	"github.com/canonical/go-tpm2"
 )
 
@@ -17,6 +19,12 @@ type TPMConnection interface {
 
 	VerifySignature(key tpm2.ResourceContext, digest tpm2.Digest, signature *tpm2.Signature) (*tpm2.TkVerified, error)
 
+	// PCRRead returns the values of the PCRs in the supplied selection.
+	// Policy.Execute may pass a selection that is larger than a single
+	// TPM2_PCR_Read command can return, and implementations must handle
+	// this, eg, by issuing as many commands as are required. The
+	// implementation returned from NewTPMConnection does this via
+	// tpm2.TPMContext.PCRRead.
 	PCRRead(pcrs tpm2.PCRSelectionList) (tpm2.PCRValues, error)
 
 	PolicySigned(authKey tpm2.ResourceContext, policySession tpm2.SessionContext, includeNonceTPM bool, cpHashA tpm2.Digest, policyRef tpm2.Nonce, expiration int32, auth *tpm2.Signature) (tpm2.Timeout, *tpm2.TkAuth, error)
@@ -33,6 +41,11 @@ type TPMConnection interface {
 	PolicyAuthorize(policySession tpm2.SessionContext, approvedPolicy tpm2.Digest, policyRef tpm2.Nonce, keySign tpm2.Name, verified *tpm2.TkVerified) error
 	PolicyAuthValue(policySession tpm2.SessionContext) error
 	PolicyPassword(policySession tpm2.SessionContext) error
+
+	// PolicyGetDigest returns the current digest of the supplied policy session.
+	// Policy.Execute uses this internally, but it can also be called by an
+	// implementation at any point during execution for diagnostic purposes,
+	// eg, to observe the digest before each assertion is executed.
 	PolicyGetDigest(policySession tpm2.SessionContext) (tpm2.Digest, error)
 	PolicyNvWritten(policySession tpm2.SessionContext, writtenSet bool) error
 
@@ -46,11 +59,139 @@ type TPMConnection interface {
 	NVReadPublic(handle tpm2.HandleContext) (*tpm2.NVPublic, error)
 }
 
+// PolicyRestartTPMConnection is an optional interface that can be implemented by a
+// [TPMConnection] in order to support TPM2_PolicyRestart. This allows sessions
+// used for reading NV indices during automatic branch selection to be reused rather
+// than a new session being started for each index. The TPMConnection returned from
+// [NewTPMConnection] implements this.
+type PolicyRestartTPMConnection interface {
+	PolicyRestart(policySession tpm2.SessionContext) error
+}
+
+// SaltedSessionTPMConnection is an optional interface that can be implemented by a
+// [TPMConnection] in order to support starting salted sessions with a symmetric
+// algorithm for parameter encryption. The session key is derived from a salt that is
+// encrypted with tpmKey, so that it can't be computed from values that are visible
+// on the TPM interface. This is required for [PolicyExecuteParams.NVCheckSessionSymmetric].
+// The TPMConnection returned from [NewTPMConnection] implements this.
+type SaltedSessionTPMConnection interface {
+	StartSaltedAuthSession(tpmKey tpm2.ResourceContext, sessionType tpm2.SessionType, symmetric *tpm2.SymDef, alg tpm2.HashAlgorithmId) (tpm2.SessionContext, error)
+}
+
+// PolicyTemplateTPMConnection is an optional interface that can be implemented by a
+// [TPMConnection] in order to support TPM2_PolicyTemplate assertions. Executing a
+// policy that contains a TPM2_PolicyTemplate assertion with a TPMConnection that doesn't
+// implement this fails with an error. The TPMConnection returned from [NewTPMConnection]
+// implements this.
+type PolicyTemplateTPMConnection interface {
+	PolicyTemplate(policySession tpm2.SessionContext, templateHash tpm2.Digest) error
+}
+
+// PolicyAuthorizeNVTPMConnection is an optional interface that can be implemented by a
+// [TPMConnection] in order to support TPM2_PolicyAuthorizeNV assertions. Executing a
+// policy that contains a TPM2_PolicyAuthorizeNV assertion with a TPMConnection that
+// doesn't implement this fails with an error. The TPMConnection returned from
+// [NewTPMConnection] implements this.
+type PolicyAuthorizeNVTPMConnection interface {
+	PolicyAuthorizeNV(auth, index tpm2.ResourceContext, policySession tpm2.SessionContext, authAuthSession tpm2.SessionContext) error
+}
+
+// CommandsTPMConnection is an optional interface that can be implemented by a
+// [TPMConnection] in order to support querying the commands that are implemented
+// by the TPM. This is required for [Policy.CheckTPMSupport]. The TPMConnection
+// returned from [NewTPMConnection] implements this.
+type CommandsTPMConnection interface {
+	GetCapabilityCommands(first tpm2.CommandCode, propertyCount uint32) (tpm2.CommandAttributesList, error)
+}
+
+// unsupportedCommandError is returned when a command requires an optional method
+// that the supplied TPMConnection doesn't implement.
+type unsupportedCommandError struct {
+	command tpm2.CommandCode
+}
+
+func (e *unsupportedCommandError) Error() string {
+	return fmt.Sprintf("TPMConnection does not support %v", e.command)
+}
+
+func policyRestart(tpm TPMConnection, policySession tpm2.SessionContext) error {
+	c, ok := tpm.(PolicyRestartTPMConnection)
+	if !ok {
+		return &unsupportedCommandError{command: tpm2.CommandPolicyRestart}
+	}
+	return c.PolicyRestart(policySession)
+}
+
+func startSaltedAuthSession(tpm TPMConnection, tpmKey tpm2.ResourceContext, sessionType tpm2.SessionType, symmetric *tpm2.SymDef, alg tpm2.HashAlgorithmId) (tpm2.SessionContext, error) {
+	c, ok := tpm.(SaltedSessionTPMConnection)
+	if !ok {
+		return nil, &unsupportedCommandError{command: tpm2.CommandStartAuthSession}
+	}
+	return c.StartSaltedAuthSession(tpmKey, sessionType, symmetric, alg)
+}
+
+func policyTemplate(tpm TPMConnection, policySession tpm2.SessionContext, templateHash tpm2.Digest) error {
+	c, ok := tpm.(PolicyTemplateTPMConnection)
+	if !ok {
+		return &unsupportedCommandError{command: tpm2.CommandPolicyTemplate}
+	}
+	return c.PolicyTemplate(policySession, templateHash)
+}
+
+func policyAuthorizeNV(tpm TPMConnection, auth, index tpm2.ResourceContext, policySession tpm2.SessionContext, authAuthSession tpm2.SessionContext) error {
+	c, ok := tpm.(PolicyAuthorizeNVTPMConnection)
+	if !ok {
+		return &unsupportedCommandError{command: tpm2.CommandPolicyAuthorizeNV}
+	}
+	return c.PolicyAuthorizeNV(auth, index, policySession, authAuthSession)
+}
+
+func getCapabilityCommands(tpm TPMConnection, first tpm2.CommandCode, propertyCount uint32) (tpm2.CommandAttributesList, error) {
+	c, ok := tpm.(CommandsTPMConnection)
+	if !ok {
+		return nil, &unsupportedCommandError{command: tpm2.CommandGetCapability}
+	}
+	return c.GetCapabilityCommands(first, propertyCount)
+}
+
+// forwardingTpmConnection is a TPMConnection that forwards the optional
+// TPMConnection interfaces to the TPMConnection that it embeds, so that wrappers
+// that embed it don't hide those interfaces.
+type forwardingTpmConnection struct {
+	TPMConnection
+}
+
+func (c forwardingTpmConnection) PolicyRestart(policySession tpm2.SessionContext) error {
+	return policyRestart(c.TPMConnection, policySession)
+}
+
+func (c forwardingTpmConnection) StartSaltedAuthSession(tpmKey tpm2.ResourceContext, sessionType tpm2.SessionType, symmetric *tpm2.SymDef, alg tpm2.HashAlgorithmId) (tpm2.SessionContext, error) {
+	return startSaltedAuthSession(c.TPMConnection, tpmKey, sessionType, symmetric, alg)
+}
+
+func (c forwardingTpmConnection) PolicyTemplate(policySession tpm2.SessionContext, templateHash tpm2.Digest) error {
+	return policyTemplate(c.TPMConnection, policySession, templateHash)
+}
+
+func (c forwardingTpmConnection) PolicyAuthorizeNV(auth, index tpm2.ResourceContext, policySession tpm2.SessionContext, authAuthSession tpm2.SessionContext) error {
+	return policyAuthorizeNV(c.TPMConnection, auth, index, policySession, authAuthSession)
+}
+
+func (c forwardingTpmConnection) GetCapabilityCommands(first tpm2.CommandCode, propertyCount uint32) (tpm2.CommandAttributesList, error) {
+	return getCapabilityCommands(c.TPMConnection, first, propertyCount)
+}
+
 type onlineTpmConnection struct {
 	tpm      *tpm2.TPMContext
 	sessions []tpm2.SessionContext
 }
 
+// NewTPMConnection returns a TPMConnection for the supplied TPM context. The supplied
+// sessions are included with each command. This implements all of the optional
+// TPMConnection interfaces, and is the connection to use for reading PCR values, the
+// TPM's clock and NV indices from a real device during automatic branch selection.
+// PCR values are only read once during each call to [Policy.Execute], regardless of
+// the TPMConnection that is supplied.
 func NewTPMConnection(tpm *tpm2.TPMContext, sessions ...tpm2.SessionContext) TPMConnection {
 	return &onlineTpmConnection{
 		tpm:      tpm,
@@ -62,6 +203,10 @@ func (c *onlineTpmConnection) StartAuthSession(sessionType tpm2.SessionType, alg
 	return c.tpm.StartAuthSession(nil, nil, sessionType, nil, alg, c.sessions...)
 }
 
+func (c *onlineTpmConnection) StartSaltedAuthSession(tpmKey tpm2.ResourceContext, sessionType tpm2.SessionType, symmetric *tpm2.SymDef, alg tpm2.HashAlgorithmId) (tpm2.SessionContext, error) {
+	return c.tpm.StartAuthSession(tpmKey, nil, sessionType, symmetric, alg, c.sessions...)
+}
+
 func (c *onlineTpmConnection) LoadExternal(inPrivate *tpm2.Sensitive, inPublic *tpm2.Public, hierarchy tpm2.Handle) (tpm2.ResourceContext, error) {
 	return c.tpm.LoadExternal(inPrivate, inPublic, hierarchy, c.sessions...)
 }
@@ -144,6 +289,18 @@ func (c *onlineTpmConnection) PolicyNvWritten(policySession tpm2.SessionContext,
 	return c.tpm.PolicyNvWritten(policySession, writtenSet, c.sessions...)
 }
 
+func (c *onlineTpmConnection) PolicyTemplate(policySession tpm2.SessionContext, templateHash tpm2.Digest) error {
+	return c.tpm.PolicyTemplate(policySession, templateHash, c.sessions...)
+}
+
+func (c *onlineTpmConnection) PolicyAuthorizeNV(auth, index tpm2.ResourceContext, policySession tpm2.SessionContext, authAuthSession tpm2.SessionContext) error {
+	return c.tpm.PolicyAuthorizeNV(auth, index, policySession, authAuthSession, c.sessions...)
+}
+
+func (c *onlineTpmConnection) PolicyRestart(policySession tpm2.SessionContext) error {
+	return c.tpm.PolicyRestart(policySession, c.sessions...)
+}
+
 func (c *onlineTpmConnection) ContextSave(handle tpm2.HandleContext) (*tpm2.Context, error) {
 	return c.tpm.ContextSave(handle)
 }
@@ -168,3 +325,70 @@ func (c *onlineTpmConnection) NVReadPublic(handle tpm2.HandleContext) (*tpm2.NVP
 	pub, _, err := c.tpm.NVReadPublic(handle, c.sessions...)
 	return pub, err
 }
+
+func (c *onlineTpmConnection) GetCapabilityCommands(first tpm2.CommandCode, propertyCount uint32) (tpm2.CommandAttributesList, error) {
+	return c.tpm.GetCapabilityCommands(first, propertyCount, c.sessions...)
+}
+
+// pcrCacheTpmConnection is a TPMConnection that caches PCR values read via
+// another TPMConnection, so that PCRs are only read once when they are
+// required more than once during the execution of a policy. The cached values
+// always come from a single TPM2_PCR_Read, so that they are consistent with
+// each other.
+type pcrCacheTpmConnection struct {
+	forwardingTpmConnection
+	values tpm2.PCRValues
+}
+
+func newPcrCacheTpmConnection(tpm TPMConnection) *pcrCacheTpmConnection {
+	return &pcrCacheTpmConnection{
+		forwardingTpmConnection: forwardingTpmConnection{tpm},
+		values:                  make(tpm2.PCRValues),
+	}
+}
+
+func (c *pcrCacheTpmConnection) PCRRead(pcrs tpm2.PCRSelectionList) (tpm2.PCRValues, error) {
+	missing := false
+	for _, selection := range pcrs {
+		for _, pcr := range selection.Select {
+			if _, ok := c.values[selection.Hash][pcr]; !ok {
+				missing = true
+				break
+			}
+		}
+	}
+
+	if missing {
+		// Read the requested PCRs together with the ones that are already
+		// cached, and replace the cache, so that every cached value comes
+		// from the same read.
+		cached, err := c.values.SelectionList()
+		if err != nil {
+			return nil, err
+		}
+		selection, err := cached.Merge(pcrs)
+		if err != nil {
+			return nil, err
+		}
+		values, err := c.TPMConnection.PCRRead(selection)
+		if err != nil {
+			return nil, err
+		}
+		c.values = values
+	}
+
+	out := make(tpm2.PCRValues)
+	for _, selection := range pcrs {
+		for _, pcr := range selection.Select {
+			digest, ok := c.values[selection.Hash][pcr]
+			if !ok {
+				continue
+			}
+			if _, ok := out[selection.Hash]; !ok {
+				out[selection.Hash] = make(map[int]tpm2.Digest)
+			}
+			out[selection.Hash][pcr] = digest
+		}
+	}
+	return out, nil
+}
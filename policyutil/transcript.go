@@ -0,0 +1,332 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package policyutil
+
+import (
+	"github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/mu"
+)
+
+// PolicyTranscriptEntry corresponds to a single TPM command issued during the
+// execution of a policy.
+type PolicyTranscriptEntry struct {
+	CommandCode tpm2.CommandCode // The command code
+	Handles     tpm2.HandleList  // The handles in the command's handle area
+
+	// Params contains the marshalled command parameters. Values that are generated
+	// internally by the session code, such as the caller nonce and encrypted salt for
+	// TPM2_StartAuthSession, are omitted.
+	Params []byte
+
+	// Response contains the marshalled response handle and parameters, if the
+	// command succeeded. Values that are not returned by TPMConnection are omitted.
+	Response []byte
+
+	// Err is the error returned from the command, if any.
+	Err error
+}
+
+// transcriptTpmConnection is a TPMConnection that records the commands that are
+// issued via another TPMConnection.
+type transcriptTpmConnection struct {
+	tpm        TPMConnection
+	transcript []*PolicyTranscriptEntry
+}
+
+func newTranscriptTpmConnection(tpm TPMConnection) *transcriptTpmConnection {
+	return &transcriptTpmConnection{tpm: tpm}
+}
+
+func (c *transcriptTpmConnection) begin(code tpm2.CommandCode, handles []tpm2.HandleContext, params ...interface{}) *PolicyTranscriptEntry {
+	entry := &PolicyTranscriptEntry{CommandCode: code}
+	for _, h := range handles {
+		entry.Handles = append(entry.Handles, h.Handle())
+	}
+	entry.Params, _ = mu.MarshalToBytes(params...)
+	c.transcript = append(c.transcript, entry)
+	return entry
+}
+
+func (c *transcriptTpmConnection) end(entry *PolicyTranscriptEntry, err error, response ...interface{}) {
+	if err != nil {
+		entry.Err = err
+		return
+	}
+	entry.Response, _ = mu.MarshalToBytes(response...)
+}
+
+func (c *transcriptTpmConnection) StartAuthSession(sessionType tpm2.SessionType, alg tpm2.HashAlgorithmId) (tpm2.SessionContext, error) {
+	entry := c.begin(tpm2.CommandStartAuthSession, []tpm2.HandleContext{tpm2.NewLimitedHandleContext(tpm2.HandleNull), tpm2.NewLimitedHandleContext(tpm2.HandleNull)},
+		sessionType, &tpm2.SymDef{Algorithm: tpm2.SymAlgorithmNull}, alg)
+	session, err := c.tpm.StartAuthSession(sessionType, alg)
+	if err != nil {
+		c.end(entry, err)
+		return nil, err
+	}
+	c.end(entry, nil, session.Handle(), session.NonceTPM())
+	return session, nil
+}
+
+func (c *transcriptTpmConnection) StartSaltedAuthSession(tpmKey tpm2.ResourceContext, sessionType tpm2.SessionType, symmetric *tpm2.SymDef, alg tpm2.HashAlgorithmId) (tpm2.SessionContext, error) {
+	tpm, ok := c.tpm.(SaltedSessionTPMConnection)
+	if !ok {
+		return nil, &unsupportedCommandError{command: tpm2.CommandStartAuthSession}
+	}
+	entry := c.begin(tpm2.CommandStartAuthSession, []tpm2.HandleContext{tpmKey, tpm2.NewLimitedHandleContext(tpm2.HandleNull)},
+		sessionType, symmetric, alg)
+	session, err := tpm.StartSaltedAuthSession(tpmKey, sessionType, symmetric, alg)
+	if err != nil {
+		c.end(entry, err)
+		return nil, err
+	}
+	c.end(entry, nil, session.Handle(), session.NonceTPM())
+	return session, nil
+}
+func (c *transcriptTpmConnection) LoadExternal(inPrivate *tpm2.Sensitive, inPublic *tpm2.Public, hierarchy tpm2.Handle) (tpm2.ResourceContext, error) {
+	entry := c.begin(tpm2.CommandLoadExternal, nil, mu.Sized(inPrivate), mu.Sized(inPublic), hierarchy)
+	rc, err := c.tpm.LoadExternal(inPrivate, inPublic, hierarchy)
+	if err != nil {
+		c.end(entry, err)
+		return nil, err
+	}
+	c.end(entry, nil, rc.Handle(), rc.Name())
+	return rc, nil
+}
+
+func (c *transcriptTpmConnection) ReadPublic(handle tpm2.HandleContext) (*tpm2.Public, error) {
+	entry := c.begin(tpm2.CommandReadPublic, []tpm2.HandleContext{handle})
+	pub, err := c.tpm.ReadPublic(handle)
+	c.end(entry, err, mu.Sized(pub))
+	return pub, err
+}
+
+func (c *transcriptTpmConnection) VerifySignature(key tpm2.ResourceContext, digest tpm2.Digest, signature *tpm2.Signature) (*tpm2.TkVerified, error) {
+	entry := c.begin(tpm2.CommandVerifySignature, []tpm2.HandleContext{key}, digest, signature)
+	ticket, err := c.tpm.VerifySignature(key, digest, signature)
+	c.end(entry, err, ticket)
+	return ticket, err
+}
+
+func (c *transcriptTpmConnection) PCRRead(pcrs tpm2.PCRSelectionList) (tpm2.PCRValues, error) {
+	entry := c.begin(tpm2.CommandPCRRead, nil, pcrs)
+	values, err := c.tpm.PCRRead(pcrs)
+	if err != nil {
+		c.end(entry, err)
+		return nil, err
+	}
+	selection, digests, err := values.ToListAndSelection()
+	if err != nil {
+		c.end(entry, err)
+		return nil, err
+	}
+	c.end(entry, nil, selection, digests)
+	return values, nil
+}
+
+func (c *transcriptTpmConnection) PolicySigned(authKey tpm2.ResourceContext, policySession tpm2.SessionContext, includeNonceTPM bool, cpHashA tpm2.Digest, policyRef tpm2.Nonce, expiration int32, auth *tpm2.Signature) (tpm2.Timeout, *tpm2.TkAuth, error) {
+	var nonceTPM tpm2.Nonce
+	if includeNonceTPM {
+		nonceTPM = policySession.NonceTPM()
+	}
+	entry := c.begin(tpm2.CommandPolicySigned, []tpm2.HandleContext{authKey, policySession}, nonceTPM, cpHashA, policyRef, expiration, auth)
+	timeout, ticket, err := c.tpm.PolicySigned(authKey, policySession, includeNonceTPM, cpHashA, policyRef, expiration, auth)
+	c.end(entry, err, timeout, ticket)
+	return timeout, ticket, err
+}
+
+func (c *transcriptTpmConnection) PolicySecret(authObject tpm2.ResourceContext, policySession tpm2.SessionContext, cpHashA tpm2.Digest, policyRef tpm2.Nonce, expiration int32, authObjectAuthSession tpm2.SessionContext) (tpm2.Timeout, *tpm2.TkAuth, error) {
+	entry := c.begin(tpm2.CommandPolicySecret, []tpm2.HandleContext{authObject, policySession}, policySession.NonceTPM(), cpHashA, policyRef, expiration)
+	timeout, ticket, err := c.tpm.PolicySecret(authObject, policySession, cpHashA, policyRef, expiration, authObjectAuthSession)
+	c.end(entry, err, timeout, ticket)
+	return timeout, ticket, err
+}
+
+func (c *transcriptTpmConnection) PolicyTicket(policySession tpm2.SessionContext, timeout tpm2.Timeout, cpHashA tpm2.Digest, policyRef tpm2.Nonce, authName tpm2.Name, ticket *tpm2.TkAuth) error {
+	entry := c.begin(tpm2.CommandPolicyTicket, []tpm2.HandleContext{policySession}, timeout, cpHashA, policyRef, authName, ticket)
+	err := c.tpm.PolicyTicket(policySession, timeout, cpHashA, policyRef, authName, ticket)
+	c.end(entry, err)
+	return err
+}
+
+func (c *transcriptTpmConnection) PolicyOR(policySession tpm2.SessionContext, pHashList tpm2.DigestList) error {
+	entry := c.begin(tpm2.CommandPolicyOR, []tpm2.HandleContext{policySession}, pHashList)
+	err := c.tpm.PolicyOR(policySession, pHashList)
+	c.end(entry, err)
+	return err
+}
+
+func (c *transcriptTpmConnection) PolicyPCR(policySession tpm2.SessionContext, pcrDigest tpm2.Digest, pcrs tpm2.PCRSelectionList) error {
+	entry := c.begin(tpm2.CommandPolicyPCR, []tpm2.HandleContext{policySession}, pcrDigest, pcrs)
+	err := c.tpm.PolicyPCR(policySession, pcrDigest, pcrs)
+	c.end(entry, err)
+	return err
+}
+
+func (c *transcriptTpmConnection) PolicyNV(auth, index tpm2.ResourceContext, policySession tpm2.SessionContext, operandB tpm2.Operand, offset uint16, operation tpm2.ArithmeticOp, authAuthSession tpm2.SessionContext) error {
+	entry := c.begin(tpm2.CommandPolicyNV, []tpm2.HandleContext{auth, index, policySession}, operandB, offset, operation)
+	err := c.tpm.PolicyNV(auth, index, policySession, operandB, offset, operation, authAuthSession)
+	c.end(entry, err)
+	return err
+}
+
+func (c *transcriptTpmConnection) PolicyCounterTimer(policySession tpm2.SessionContext, operandB tpm2.Operand, offset uint16, operation tpm2.ArithmeticOp) error {
+	entry := c.begin(tpm2.CommandPolicyCounterTimer, []tpm2.HandleContext{policySession}, operandB, offset, operation)
+	err := c.tpm.PolicyCounterTimer(policySession, operandB, offset, operation)
+	c.end(entry, err)
+	return err
+}
+
+func (c *transcriptTpmConnection) PolicyCommandCode(policySession tpm2.SessionContext, code tpm2.CommandCode) error {
+	entry := c.begin(tpm2.CommandPolicyCommandCode, []tpm2.HandleContext{policySession}, code)
+	err := c.tpm.PolicyCommandCode(policySession, code)
+	c.end(entry, err)
+	return err
+}
+
+func (c *transcriptTpmConnection) PolicyCpHash(policySession tpm2.SessionContext, cpHashA tpm2.Digest) error {
+	entry := c.begin(tpm2.CommandPolicyCpHash, []tpm2.HandleContext{policySession}, cpHashA)
+	err := c.tpm.PolicyCpHash(policySession, cpHashA)
+	c.end(entry, err)
+	return err
+}
+
+func (c *transcriptTpmConnection) PolicyNameHash(policySession tpm2.SessionContext, nameHash tpm2.Digest) error {
+	entry := c.begin(tpm2.CommandPolicyNameHash, []tpm2.HandleContext{policySession}, nameHash)
+	err := c.tpm.PolicyNameHash(policySession, nameHash)
+	c.end(entry, err)
+	return err
+}
+
+func (c *transcriptTpmConnection) PolicyDuplicationSelect(policySession tpm2.SessionContext, objectName, newParentName tpm2.Name, includeObject bool) error {
+	entry := c.begin(tpm2.CommandPolicyDuplicationSelect, []tpm2.HandleContext{policySession}, objectName, newParentName, includeObject)
+	err := c.tpm.PolicyDuplicationSelect(policySession, objectName, newParentName, includeObject)
+	c.end(entry, err)
+	return err
+}
+
+func (c *transcriptTpmConnection) PolicyAuthorize(policySession tpm2.SessionContext, approvedPolicy tpm2.Digest, policyRef tpm2.Nonce, keySign tpm2.Name, verified *tpm2.TkVerified) error {
+	entry := c.begin(tpm2.CommandPolicyAuthorize, []tpm2.HandleContext{policySession}, approvedPolicy, policyRef, keySign, verified)
+	err := c.tpm.PolicyAuthorize(policySession, approvedPolicy, policyRef, keySign, verified)
+	c.end(entry, err)
+	return err
+}
+
+func (c *transcriptTpmConnection) PolicyAuthValue(policySession tpm2.SessionContext) error {
+	entry := c.begin(tpm2.CommandPolicyAuthValue, []tpm2.HandleContext{policySession})
+	err := c.tpm.PolicyAuthValue(policySession)
+	c.end(entry, err)
+	return err
+}
+
+func (c *transcriptTpmConnection) PolicyPassword(policySession tpm2.SessionContext) error {
+	entry := c.begin(tpm2.CommandPolicyPassword, []tpm2.HandleContext{policySession})
+	err := c.tpm.PolicyPassword(policySession)
+	c.end(entry, err)
+	return err
+}
+
+func (c *transcriptTpmConnection) PolicyGetDigest(policySession tpm2.SessionContext) (tpm2.Digest, error) {
+	entry := c.begin(tpm2.CommandPolicyGetDigest, []tpm2.HandleContext{policySession})
+	digest, err := c.tpm.PolicyGetDigest(policySession)
+	c.end(entry, err, digest)
+	return digest, err
+}
+
+func (c *transcriptTpmConnection) PolicyNvWritten(policySession tpm2.SessionContext, writtenSet bool) error {
+	entry := c.begin(tpm2.CommandPolicyNvWritten, []tpm2.HandleContext{policySession}, writtenSet)
+	err := c.tpm.PolicyNvWritten(policySession, writtenSet)
+	c.end(entry, err)
+	return err
+}
+
+func (c *transcriptTpmConnection) PolicyTemplate(policySession tpm2.SessionContext, templateHash tpm2.Digest) error {
+	tpm, ok := c.tpm.(PolicyTemplateTPMConnection)
+	if !ok {
+		return &unsupportedCommandError{command: tpm2.CommandPolicyTemplate}
+	}
+	entry := c.begin(tpm2.CommandPolicyTemplate, []tpm2.HandleContext{policySession}, templateHash)
+	err := tpm.PolicyTemplate(policySession, templateHash)
+	c.end(entry, err)
+	return err
+}
+
+func (c *transcriptTpmConnection) PolicyAuthorizeNV(auth, index tpm2.ResourceContext, policySession tpm2.SessionContext, authAuthSession tpm2.SessionContext) error {
+	tpm, ok := c.tpm.(PolicyAuthorizeNVTPMConnection)
+	if !ok {
+		return &unsupportedCommandError{command: tpm2.CommandPolicyAuthorizeNV}
+	}
+	entry := c.begin(tpm2.CommandPolicyAuthorizeNV, []tpm2.HandleContext{auth, index, policySession})
+	err := tpm.PolicyAuthorizeNV(auth, index, policySession, authAuthSession)
+	c.end(entry, err)
+	return err
+}
+
+func (c *transcriptTpmConnection) PolicyRestart(policySession tpm2.SessionContext) error {
+	tpm, ok := c.tpm.(PolicyRestartTPMConnection)
+	if !ok {
+		return &unsupportedCommandError{command: tpm2.CommandPolicyRestart}
+	}
+	entry := c.begin(tpm2.CommandPolicyRestart, []tpm2.HandleContext{policySession})
+	err := tpm.PolicyRestart(policySession)
+	c.end(entry, err)
+	return err
+}
+
+func (c *transcriptTpmConnection) ContextSave(handle tpm2.HandleContext) (*tpm2.Context, error) {
+	entry := c.begin(tpm2.CommandContextSave, []tpm2.HandleContext{handle})
+	context, err := c.tpm.ContextSave(handle)
+	c.end(entry, err, context)
+	return context, err
+}
+
+func (c *transcriptTpmConnection) ContextLoad(context *tpm2.Context) (tpm2.HandleContext, error) {
+	entry := c.begin(tpm2.CommandContextLoad, nil, context)
+	hc, err := c.tpm.ContextLoad(context)
+	if err != nil {
+		c.end(entry, err)
+		return nil, err
+	}
+	c.end(entry, nil, hc.Handle())
+	return hc, nil
+}
+
+func (c *transcriptTpmConnection) FlushContext(handle tpm2.HandleContext) error {
+	entry := c.begin(tpm2.CommandFlushContext, nil, handle.Handle())
+	err := c.tpm.FlushContext(handle)
+	c.end(entry, err)
+	return err
+}
+
+func (c *transcriptTpmConnection) ReadClock() (*tpm2.TimeInfo, error) {
+	entry := c.begin(tpm2.CommandReadClock, nil)
+	info, err := c.tpm.ReadClock()
+	c.end(entry, err, info)
+	return info, err
+}
+
+func (c *transcriptTpmConnection) NVRead(auth, index tpm2.ResourceContext, size, offset uint16, authAuthSession tpm2.SessionContext) (tpm2.MaxNVBuffer, error) {
+	entry := c.begin(tpm2.CommandNVRead, []tpm2.HandleContext{auth, index}, size, offset)
+	data, err := c.tpm.NVRead(auth, index, size, offset, authAuthSession)
+	c.end(entry, err, data)
+	return data, err
+}
+
+func (c *transcriptTpmConnection) NVReadPublic(handle tpm2.HandleContext) (*tpm2.NVPublic, error) {
+	entry := c.begin(tpm2.CommandNVReadPublic, []tpm2.HandleContext{handle})
+	pub, err := c.tpm.NVReadPublic(handle)
+	c.end(entry, err, mu.Sized(pub))
+	return pub, err
+}
+
+func (c *transcriptTpmConnection) GetCapabilityCommands(first tpm2.CommandCode, propertyCount uint32) (tpm2.CommandAttributesList, error) {
+	tpm, ok := c.tpm.(CommandsTPMConnection)
+	if !ok {
+		return nil, &unsupportedCommandError{command: tpm2.CommandGetCapability}
+	}
+	entry := c.begin(tpm2.CommandGetCapability, nil, tpm2.CapabilityCommands, uint32(first), propertyCount)
+	commands, err := tpm.GetCapabilityCommands(first, propertyCount)
+	c.end(entry, err, commands)
+	return commands, err
+}
@@ -0,0 +1,162 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package policyutil_test
+
+import (
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/go-tpm2"
+	internal_testutil "github.com/canonical/go-tpm2/internal/testutil"
+	"github.com/canonical/go-tpm2/mu"
+	. "github.com/canonical/go-tpm2/policyutil"
+	"github.com/canonical/go-tpm2/testutil"
+)
+
+type transcriptSuite struct {
+	testutil.TPMTest
+}
+
+func (s *transcriptSuite) SetUpSuite(c *C) {
+	s.TPMFeatures = testutil.TPMFeatureOwnerHierarchy | testutil.TPMFeatureNV | testutil.TPMFeaturePCR
+}
+
+var _ = Suite(&transcriptSuite{})
+
+// checkTranscript checks that the supplied transcript is consistent with the
+// commands that were sent to the TPM.
+func (s *transcriptSuite) checkTranscript(c *C, transcript []*PolicyTranscriptEntry, expected ...tpm2.CommandCode) {
+	log := s.CommandLog()
+	c.Assert(transcript, internal_testutil.LenEquals, len(expected))
+	c.Assert(log, internal_testutil.LenEquals, len(expected))
+
+	for i, entry := range transcript {
+		c.Check(entry.CommandCode, Equals, expected[i])
+		c.Check(log[i].GetCommandCode(c), Equals, expected[i])
+
+		handles, _, params := log[i].UnmarshalCommand(c)
+		c.Check(entry.Handles, DeepEquals, handles)
+		c.Check(entry.Params, DeepEquals, params)
+		c.Check(entry.Err, IsNil)
+	}
+}
+
+func (s *transcriptSuite) TestRecordTranscript(c *C) {
+	builder := NewPolicyBuilder()
+	c.Check(builder.RootBranch().PolicyNvWritten(true), IsNil)
+
+	node := builder.RootBranch().AddBranchNode()
+
+	b1 := node.AddBranch("branch1")
+	c.Check(b1.PolicyAuthValue(), IsNil)
+
+	b2 := node.AddBranch("branch2")
+	c.Check(b2.PolicySecret(s.TPM.OwnerHandleContext(), []byte("foo")), IsNil)
+
+	c.Check(builder.RootBranch().PolicyCommandCode(tpm2.CommandNVChangeAuth), IsNil)
+
+	policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+	expectedDigest, err := policy.Compute(tpm2.HashAlgorithmSHA256)
+	c.Check(err, IsNil)
+
+	session := s.StartAuthSession(c, nil, nil, tpm2.SessionTypePolicy, nil, tpm2.HashAlgorithmSHA256)
+
+	s.ForgetCommands()
+
+	result, err := policy.Execute(NewTPMConnection(s.TPM), session, nil, &PolicyExecuteParams{
+		Path:             "branch1",
+		RecordTranscript: true})
+	c.Check(err, IsNil)
+	c.Check(result.Path, Equals, "branch1")
+
+	s.checkTranscript(c, result.Transcript,
+		tpm2.CommandPolicyNvWritten,
+		tpm2.CommandPolicyAuthValue,
+		tpm2.CommandPolicyOR,
+		tpm2.CommandPolicyCommandCode)
+	for _, entry := range result.Transcript {
+		c.Check(entry.Handles, DeepEquals, tpm2.HandleList{session.Handle()})
+		c.Check(entry.Response, internal_testutil.LenEquals, 0)
+	}
+	c.Check(result.Transcript[3].Params, DeepEquals, mu.MustMarshalToBytes(tpm2.CommandNVChangeAuth))
+
+	digest, err := s.TPM.PolicyGetDigest(session)
+	c.Check(err, IsNil)
+	c.Check(digest, DeepEquals, expectedDigest)
+}
+
+func (s *transcriptSuite) TestRecordTranscriptAutoSelectedPCR(c *C) {
+	_, err := s.TPM.PCREvent(s.TPM.PCRHandleContext(23), []byte("foo"), nil)
+	c.Check(err, IsNil)
+
+	_, pcrValues, err := s.TPM.PCRRead(tpm2.PCRSelectionList{{Hash: tpm2.HashAlgorithmSHA256, Select: []int{7, 23}}})
+	c.Assert(err, IsNil)
+
+	builder := NewPolicyBuilder()
+
+	node := builder.RootBranch().AddBranchNode()
+
+	b1 := node.AddBranch("")
+	c.Check(b1.PolicyPCR(tpm2.PCRValues{tpm2.HashAlgorithmSHA256: map[int]tpm2.Digest{7: pcrValues[tpm2.HashAlgorithmSHA256][7], 23: make(tpm2.Digest, 32)}}), IsNil)
+
+	b2 := node.AddBranch("")
+	c.Check(b2.PolicyPCR(pcrValues), IsNil)
+
+	policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+	expectedDigest, err := policy.Compute(tpm2.HashAlgorithmSHA256)
+	c.Check(err, IsNil)
+
+	session := s.StartAuthSession(c, nil, nil, tpm2.SessionTypePolicy, nil, tpm2.HashAlgorithmSHA256)
+
+	s.ForgetCommands()
+
+	result, err := policy.Execute(NewTPMConnection(s.TPM), session, nil, &PolicyExecuteParams{RecordTranscript: true})
+	c.Check(err, IsNil)
+	c.Check(result.Path, Equals, "$[1]")
+
+	s.checkTranscript(c, result.Transcript,
+		tpm2.CommandPCRRead,
+		tpm2.CommandPolicyPCR,
+		tpm2.CommandPolicyOR)
+
+	selection, digests, err := pcrValues.ToListAndSelection()
+	c.Assert(err, IsNil)
+	c.Check(result.Transcript[0].Response, DeepEquals, mu.MustMarshalToBytes(selection, digests))
+
+	digest, err := s.TPM.PolicyGetDigest(session)
+	c.Check(err, IsNil)
+	c.Check(digest, DeepEquals, expectedDigest)
+}
+
+func (s *transcriptSuite) TestRecordTranscriptPolicySecret(c *C) {
+	builder := NewPolicyBuilder()
+	c.Check(builder.RootBranch().PolicySecret(s.TPM.OwnerHandleContext(), []byte("foo")), IsNil)
+	policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+
+	session := s.StartAuthSession(c, nil, nil, tpm2.SessionTypePolicy, nil, tpm2.HashAlgorithmSHA256)
+
+	s.ForgetCommands()
+
+	result, err := policy.Execute(NewTPMConnection(s.TPM), session, NewTPMPolicyResourceLoader(s.TPM, nil, nil), &PolicyExecuteParams{RecordTranscript: true})
+	c.Check(err, IsNil)
+
+	s.checkTranscript(c, result.Transcript, tpm2.CommandPolicySecret)
+	c.Check(result.Transcript[0].Handles, DeepEquals, tpm2.HandleList{tpm2.HandleOwner, session.Handle()})
+}
+
+func (s *transcriptSuite) TestNoTranscript(c *C) {
+	builder := NewPolicyBuilder()
+	c.Check(builder.RootBranch().PolicyAuthValue(), IsNil)
+	policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+
+	session := s.StartAuthSession(c, nil, nil, tpm2.SessionTypePolicy, nil, tpm2.HashAlgorithmSHA256)
+
+	result, err := policy.Execute(NewTPMConnection(s.TPM), session, nil, nil)
+	c.Check(err, IsNil)
+	c.Check(result.Transcript, IsNil)
+}
@@ -48,6 +48,10 @@ type SessionContext interface {
 	IsAudit() bool            // Whether the session has been used for audit
 	IsExclusive() bool        // Whether the most recent response from the TPM indicated that the session is exclusive for audit purposes
 
+	// The attributes associated with a session are used for every command that it is
+	// supplied to. WithAttrs, IncludeAttrs and ExcludeAttrs return a shallow copy that
+	// can be used to override them for a single command without modifying the original,
+	// eg, tpm.Unseal(object, session.WithAttrs(AttrContinueSession)).
 	Attrs() SessionAttributes                         // The attributes associated with this session
 	SetAttrs(attrs SessionAttributes)                 // Set the attributes that will be used for this SessionContext
 	WithAttrs(attrs SessionAttributes) SessionContext // Return a duplicate of this SessionContext with the specified attributes
@@ -58,6 +62,20 @@ type SessionContext interface {
 	ExcludeAttrs(attrs SessionAttributes) SessionContext
 }
 
+// BoundEntitySessionContext is an optional interface implemented by a SessionContext
+// that can report the entity that it is bound to. SessionContext instances created
+// by this package implement this.
+type BoundEntitySessionContext interface {
+	SessionContext
+
+	// BoundEntity returns the bind name that the session key of a bound HMAC session
+	// was computed from, and true. The bind name is derived from the name and the
+	// authorization value of the bind entity at the time that the session was started.
+	// This returns false if the session is not a bound HMAC session or the context
+	// corresponds to a saved session.
+	BoundEntity() (Name, bool)
+}
+
 type sessionContextInternal interface {
 	SessionContext
 	handleContextInternalMixin
@@ -407,6 +425,14 @@ func (r *sessionContext) ExcludeAttrs(attrs SessionAttributes) SessionContext {
 	return &sessionContext{handleContext: r.handleContext, attrs: r.attrs &^ attrs}
 }
 
+func (r *sessionContext) BoundEntity() (Name, bool) {
+	d := r.Data()
+	if d == nil || !d.IsBound {
+		return nil, false
+	}
+	return d.BoundEntity, true
+}
+
 func (r *sessionContext) Data() *sessionContextData {
 	return r.handleContext.Data.Session.Data
 }
@@ -509,6 +535,51 @@ func (t *TPMContext) CreateResourceContextFromTPM(handle Handle, sessions ...Ses
 	return t.NewResourceContext(handle, sessions...)
 }
 
+// PersistentObjectInfo describes a persistent object returned from
+// [TPMContext.ListPersistentObjects].
+type PersistentObjectInfo struct {
+	Handle Handle  // The persistent handle of the object
+	Name   Name    // The name of the object
+	Public *Public // The public area of the object
+}
+
+// ListPersistentObjects returns information about every persistent object that is currently
+// stored on the TPM. The handles are obtained with [TPMContext.GetCapabilityHandles] and the
+// public area and name of each object is read with [TPMContext.ReadPublic].
+//
+// The public area and name returned from the TPM are checked for consistency as long as the
+// corresponding name algorithm is linked into the current binary.
+//
+// The supplied sessions are used for all commands executed by this function.
+func (t *TPMContext) ListPersistentObjects(sessions ...SessionContext) ([]PersistentObjectInfo, error) {
+	handles, err := t.GetCapabilityHandles(HandleTypePersistent.BaseHandle(), CapabilityMaxProperties, sessions...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot obtain persistent handles: %w", err)
+	}
+
+	var objects []PersistentObjectInfo
+	for _, handle := range handles {
+		if handle.Type() != HandleTypePersistent {
+			continue
+		}
+
+		pub, name, _, err := t.ReadPublic(newLimitedHandleContext(handle), sessions...)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read public area for handle %v: %w", handle, err)
+		}
+		if pub.NameAlg.Available() && !pub.compareName(name) {
+			return nil, &InvalidResponseError{CommandReadPublic, fmt.Errorf("name and public area returned from TPM for handle %v don't match", handle)}
+		}
+
+		objects = append(objects, PersistentObjectInfo{
+			Handle: handle,
+			Name:   name,
+			Public: pub})
+	}
+
+	return objects, nil
+}
+
 // NewLimitedHandleContext creates a new HandleContext for the specified handle. The returned
 // HandleContext can not be used in any commands other than [TPMContext.FlushContext],
 // [TPMContext.ReadPublic] or [TPMContext.NVReadPublic], and it cannot be used with any sessions.
@@ -370,6 +370,75 @@ func (s *resourcesSuite) SessionContextImplExcludeAttrs(c *C) {
 	c.Check(session2.(SessionContextInternal).Attrs(), Equals, AttrContinueSession|AttrCommandEncrypt)
 }
 
+func (s *resourcesSuite) TestSessionContextWithAttrsAppliesToSingleCommand(c *C) {
+	index := s.NVDefineSpace(c, HandleOwner, nil, &NVPublic{
+		Index:   s.NextAvailableHandle(c, 0x01800000),
+		NameAlg: HashAlgorithmSHA256,
+		Attrs:   NVTypeOrdinary.WithAttrs(AttrNVAuthWrite | AttrNVAuthRead | AttrNVNoDA),
+		Size:    8})
+
+	session := s.StartAuthSession(c, nil, nil, SessionTypeHMAC, nil, HashAlgorithmSHA256)
+	handle := session.Handle()
+
+	c.Check(s.TPM.NVWrite(index, index, []byte("foo"), 0, session.WithAttrs(AttrContinueSession)), IsNil)
+	c.Check(session.(SessionContextInternal).Attrs(), Equals, SessionAttributes(0))
+	c.Check(s.TPM.DoesHandleExist(handle), internal_testutil.IsTrue)
+
+	c.Check(s.TPM.NVWrite(index, index, []byte("bar"), 0, session), IsNil)
+	c.Check(s.TPM.DoesHandleExist(handle), internal_testutil.IsFalse)
+}
+
+func (s *resourcesSuite) TestSessionContextMustIncludeAuthValueUnbound(c *C) {
+	object := s.CreateStoragePrimaryKeyRSA(c)
+	session := s.StartAuthSession(c, nil, nil, SessionTypeHMAC, nil, HashAlgorithmSHA256)
+	c.Check(MustIncludeAuthValue(session, object), internal_testutil.IsTrue)
+}
+
+func (s *resourcesSuite) TestSessionContextMustIncludeAuthValueBound(c *C) {
+	index := s.NVDefineSpace(c, HandleOwner, []byte("foo"), &NVPublic{
+		Index:   s.NextAvailableHandle(c, 0x01800000),
+		NameAlg: HashAlgorithmSHA256,
+		Attrs:   NVTypeOrdinary.WithAttrs(AttrNVAuthWrite | AttrNVAuthRead | AttrNVNoDA),
+		Size:    8})
+	other := s.NVDefineSpace(c, HandleOwner, []byte("bar"), &NVPublic{
+		Index:   s.NextAvailableHandle(c, 0x01800000),
+		NameAlg: HashAlgorithmSHA256,
+		Attrs:   NVTypeOrdinary.WithAttrs(AttrNVAuthWrite | AttrNVAuthRead | AttrNVNoDA),
+		Size:    8})
+
+	session := s.StartAuthSession(c, nil, index, SessionTypeHMAC, nil, HashAlgorithmSHA256)
+	c.Check(MustIncludeAuthValue(session, index), internal_testutil.IsFalse)
+	c.Check(MustIncludeAuthValue(session, other), internal_testutil.IsTrue)
+
+	// The session should be usable for both the bind entity and for a
+	// different resource.
+	c.Check(s.TPM.NVWrite(index, index, []byte("foo"), 0, session), IsNil)
+	c.Check(s.TPM.NVWrite(other, other, []byte("bar"), 0, session), IsNil)
+}
+
+func (s *resourcesSuite) TestSessionContextMustIncludeAuthValueBoundChangedAuthValue(c *C) {
+	index := s.NVDefineSpace(c, HandleOwner, []byte("foo"), &NVPublic{
+		Index:   s.NextAvailableHandle(c, 0x01800000),
+		NameAlg: HashAlgorithmSHA256,
+		Attrs:   NVTypeOrdinary.WithAttrs(AttrNVAuthWrite | AttrNVAuthRead | AttrNVNoDA),
+		Size:    8})
+
+	session := s.StartAuthSession(c, nil, index, SessionTypeHMAC, nil, HashAlgorithmSHA256)
+	c.Check(MustIncludeAuthValue(session, index), internal_testutil.IsFalse)
+
+	index.SetAuthValue([]byte("bar"))
+	c.Check(MustIncludeAuthValue(session, index), internal_testutil.IsTrue)
+}
+
+func (s *resourcesSuite) TestSessionContextMustIncludeAuthValuePolicy(c *C) {
+	object := s.CreateStoragePrimaryKeyRSA(c)
+	session := s.StartAuthSession(c, nil, nil, SessionTypePolicy, nil, HashAlgorithmSHA256)
+	c.Check(MustIncludeAuthValue(session, object), internal_testutil.IsFalse)
+
+	c.Check(s.TPM.PolicyAuthValue(session), IsNil)
+	c.Check(MustIncludeAuthValue(session, object), internal_testutil.IsTrue)
+}
+
 func (s *resourcesSuite) TestResourceContextGetAuth(c *C) {
 	rc := s.CreateStoragePrimaryKeyRSA(c)
 	rc.SetAuthValue([]byte("foo"))
@@ -381,3 +450,113 @@ func (s *resourcesSuite) TestResourceContextGetAuthWithTrailingZeroes(c *C) {
 	rc.SetAuthValue([]byte("foo\x00bar\x00\x00"))
 	c.Check(rc.(ResourceContextInternal).GetAuthValue(), DeepEquals, []byte("foo\x00bar"))
 }
+
+type persistentObjectsSuite struct {
+	testutil.TPMTest
+}
+
+func (s *persistentObjectsSuite) SetUpSuite(c *C) {
+	s.TPMFeatures = testutil.TPMFeatureOwnerHierarchy | testutil.TPMFeatureNV | testutil.TPMFeaturePersistent
+}
+
+var _ = Suite(&persistentObjectsSuite{})
+
+func (s *persistentObjectsSuite) TestListPersistentObjects(c *C) {
+	existing, err := s.TPM.ListPersistentObjects()
+	c.Assert(err, IsNil)
+
+	primary := s.CreateStoragePrimaryKeyRSA(c)
+	persist1 := s.EvictControl(c, HandleOwner, primary, s.NextAvailableHandle(c, 0x81000001))
+
+	ecc := s.CreatePrimary(c, HandleOwner, testutil.NewECCStorageKeyTemplate())
+	persist2 := s.EvictControl(c, HandleOwner, ecc, s.NextAvailableHandle(c, persist1.Handle()+1))
+
+	objects, err := s.TPM.ListPersistentObjects()
+	c.Assert(err, IsNil)
+	c.Check(objects, internal_testutil.LenEquals, len(existing)+2)
+
+	found := 0
+	for _, object := range objects {
+		c.Check(object.Handle.Type(), Equals, HandleTypePersistent)
+		c.Check(object.Public.Name(), DeepEquals, object.Name)
+
+		for _, expected := range []ResourceContext{persist1, persist2} {
+			if object.Handle != expected.Handle() {
+				continue
+			}
+			found++
+			c.Check(object.Name, DeepEquals, expected.Name())
+		}
+	}
+	c.Check(found, Equals, 2)
+}
+
+func (s *persistentObjectsSuite) TestListPersistentObjectsWithSession(c *C) {
+	primary := s.CreateStoragePrimaryKeyRSA(c)
+	persist := s.EvictControl(c, HandleOwner, primary, s.NextAvailableHandle(c, 0x81000001))
+
+	session := s.StartAuthSession(c, nil, nil, SessionTypeHMAC, nil, HashAlgorithmSHA256).WithAttrs(AttrContinueSession | AttrAudit)
+
+	objects, err := s.TPM.ListPersistentObjects(session)
+	c.Assert(err, IsNil)
+
+	found := false
+	for _, object := range objects {
+		if object.Handle == persist.Handle() {
+			found = true
+			c.Check(object.Name, DeepEquals, persist.Name())
+		}
+	}
+	c.Check(found, internal_testutil.IsTrue)
+	c.Check(session.IsAudit(), internal_testutil.IsTrue)
+}
+
+func (s *resourcesSuite) TestSessionContextBoundEntityUnbound(c *C) {
+	session := s.StartAuthSession(c, nil, nil, SessionTypeHMAC, nil, HashAlgorithmSHA256)
+	name, bound := session.(BoundEntitySessionContext).BoundEntity()
+	c.Check(bound, internal_testutil.IsFalse)
+	c.Check(name, IsNil)
+}
+
+func (s *resourcesSuite) TestSessionContextBoundEntityBound(c *C) {
+	index := s.NVDefineSpace(c, HandleOwner, []byte("foo"), &NVPublic{
+		Index:   s.NextAvailableHandle(c, 0x01800000),
+		NameAlg: HashAlgorithmSHA256,
+		Attrs:   NVTypeOrdinary.WithAttrs(AttrNVAuthWrite | AttrNVAuthRead | AttrNVNoDA),
+		Size:    8})
+
+	session := s.StartAuthSession(c, nil, index, SessionTypeHMAC, nil, HashAlgorithmSHA256)
+	name, bound := session.(BoundEntitySessionContext).BoundEntity()
+	c.Check(bound, internal_testutil.IsTrue)
+
+	// The bind name is the name of the index with the authorization value
+	// XOR'd in to the least significant bytes.
+	expected := make(Name, len(index.Name()))
+	copy(expected, index.Name())
+	for i, b := range []byte("foo") {
+		expected[len(expected)-3+i] ^= b
+	}
+	c.Check(name, DeepEquals, expected)
+}
+
+func (s *resourcesSuite) TestSessionContextBoundEntityPolicy(c *C) {
+	object := s.CreateStoragePrimaryKeyRSA(c)
+	session := s.StartAuthSession(c, nil, object, SessionTypePolicy, nil, HashAlgorithmSHA256)
+	_, bound := session.(BoundEntitySessionContext).BoundEntity()
+	c.Check(bound, internal_testutil.IsFalse)
+}
+
+func (s *resourcesSuite) TestSessionContextBoundEntitySaved(c *C) {
+	index := s.NVDefineSpace(c, HandleOwner, []byte("foo"), &NVPublic{
+		Index:   s.NextAvailableHandle(c, 0x01800000),
+		NameAlg: HashAlgorithmSHA256,
+		Attrs:   NVTypeOrdinary.WithAttrs(AttrNVAuthWrite | AttrNVAuthRead | AttrNVNoDA),
+		Size:    8})
+
+	session := s.StartAuthSession(c, nil, index, SessionTypeHMAC, nil, HashAlgorithmSHA256)
+	_, err := s.TPM.ContextSave(session)
+	c.Assert(err, IsNil)
+
+	_, bound := session.(BoundEntitySessionContext).BoundEntity()
+	c.Check(bound, internal_testutil.IsFalse)
+}
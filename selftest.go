@@ -0,0 +1,136 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package tpm2
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+const (
+	defaultSelfTestInitialDelay = 20 * time.Millisecond
+	defaultSelfTestMaxDelay     = time.Second
+)
+
+// SelfTestPolicy describes how [TPMContext] handles commands that fail with
+// [WarningTesting] because the TPM is performing self-tests. See
+// [TPMContext.SetSelfTestPolicy].
+type SelfTestPolicy struct {
+	// RunSelfTest indicates that TPM2_SelfTest should be executed with
+	// fullTest set to NO before waiting, so that the TPM tests any algorithms
+	// that haven't been tested yet rather than testing them on demand.
+	RunSelfTest bool
+
+	// Timeout is the maximum total time to wait for self-tests to complete
+	// before giving up and returning the original error.
+	Timeout time.Duration
+
+	// InitialDelay is the delay before polling the result of the self-tests
+	// for the first time. The delay doubles after each poll, up to MaxDelay.
+	// Each delay has up to 50% jitter applied to it. If this is zero, a
+	// default of 20ms is used.
+	InitialDelay time.Duration
+
+	// MaxDelay is the maximum delay between polls. If this is zero, a default
+	// of 1s is used.
+	MaxDelay time.Duration
+}
+
+func (p *SelfTestPolicy) initialDelay() time.Duration {
+	if p.InitialDelay == 0 {
+		return defaultSelfTestInitialDelay
+	}
+	return p.InitialDelay
+}
+
+func (p *SelfTestPolicy) maxDelay() time.Duration {
+	if p.MaxDelay == 0 {
+		return defaultSelfTestMaxDelay
+	}
+	return p.MaxDelay
+}
+
+// jitter returns a random duration in the range [d/2, 3d/2).
+func jitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return d
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d)))
+}
+
+// SetSelfTestPolicy sets the policy for handling commands that fail with [WarningTesting]
+// because the TPM is performing self-tests. By default, these commands are resubmitted in
+// the same way as other commands that the TPM asks to be retried, as described in
+// [TPMContext.SetMaxSubmissions].
+//
+// If a policy is set, a command that fails with [WarningTesting] causes the context to
+// optionally execute TPM2_SelfTest, and then poll the self-test status with
+// TPM2_GetTestResult, waiting with a randomized exponential backoff between each poll,
+// until the self-tests complete or the timeout specified by the policy expires. The
+// command is then resubmitted, which counts towards the maximum number of submissions.
+// If the self-tests fail, the command fails with the error returned from
+// TPM2_GetTestResult. Passing nil restores the default behaviour.
+func (t *TPMContext) SetSelfTestPolicy(policy *SelfTestPolicy) {
+	if policy == nil {
+		t.selfTestPolicy = nil
+		return
+	}
+	p := *policy
+	t.selfTestPolicy = &p
+}
+
+// waitForSelfTest waits for the TPM to complete its self-tests according to the
+// current self-test policy. It returns true if the self-tests completed successfully
+// and the command that failed with TPM_RC_TESTING should be resubmitted. It returns
+// false if the timeout expired. If the self-tests failed, an error is returned. If the
+// supplied context is cancelled whilst waiting, [ErrCommandCancelled] is returned.
+func (t *TPMContext) waitForSelfTest(ctx context.Context) (ok bool, err error) {
+	t.waitingForSelfTest = true
+	defer func() { t.waitingForSelfTest = false }()
+
+	policy := t.selfTestPolicy
+
+	if policy.RunSelfTest {
+		if err := t.SelfTest(false); err != nil && !IsTPMWarning(err, WarningTesting, CommandSelfTest) {
+			return false, err
+		}
+	}
+
+	delay := policy.initialDelay()
+	var waited time.Duration
+
+	for waited < policy.Timeout {
+		d := jitter(delay)
+		if waited+d > policy.Timeout {
+			d = policy.Timeout - waited
+		}
+		if err := sleep(ctx, d); err != nil {
+			return false, err
+		}
+		waited += d
+
+		_, testResult, err := t.GetTestResult()
+		if err != nil {
+			return false, err
+		}
+		err = DecodeResponseCode(CommandGetTestResult, testResult)
+		switch {
+		case err == nil:
+			return true, nil
+		case IsTPMWarning(err, WarningTesting, CommandGetTestResult):
+			// Testing is still in progress.
+		default:
+			return false, err
+		}
+
+		delay *= 2
+		if delay > policy.maxDelay() {
+			delay = policy.maxDelay()
+		}
+	}
+
+	return false, nil
+}
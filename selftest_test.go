@@ -0,0 +1,248 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package tpm2_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	. "github.com/canonical/go-tpm2"
+	internal_testutil "github.com/canonical/go-tpm2/internal/testutil"
+	"github.com/canonical/go-tpm2/mu"
+	"github.com/canonical/go-tpm2/testutil"
+)
+
+const (
+	rcTesting ResponseCode = 0x90a // TPM_RC_TESTING
+	rcFailure ResponseCode = 0x101 // TPM_RC_FAILURE
+)
+
+// mockSelfTestTcti is a fake TCTI that records the code of each command
+// submitted to it, and returns the response produced by the supplied
+// function.
+type mockSelfTestTcti struct {
+	respond  func(code CommandCode) []byte
+	commands []CommandCode
+	rsp      *bytes.Reader
+}
+
+func (t *mockSelfTestTcti) Read(data []byte) (int, error) {
+	n, _ := t.rsp.Read(data)
+	if t.rsp.Len() == 0 {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (t *mockSelfTestTcti) Write(data []byte) (int, error) {
+	var code CommandCode
+	_, err := mu.UnmarshalFromBytes(data[6:], &code)
+	if err != nil {
+		return 0, err
+	}
+	t.commands = append(t.commands, code)
+	t.rsp = bytes.NewReader(t.respond(code))
+	return len(data), nil
+}
+
+func (t *mockSelfTestTcti) Close() error {
+	return nil
+}
+
+func (t *mockSelfTestTcti) SetTimeout(timeout time.Duration) error {
+	return nil
+}
+
+func (t *mockSelfTestTcti) SetLocality(locality uint8) error {
+	return nil
+}
+
+func (t *mockSelfTestTcti) MakeSticky(handle Handle, sticky bool) error {
+	return nil
+}
+
+func makeMockResponse(rc ResponseCode, params ...interface{}) []byte {
+	p := mu.MustMarshalToBytes(params...)
+	return mu.MustMarshalToBytes(TagNoSessions, uint32(10+len(p)), rc, mu.RawBytes(p))
+}
+
+// mockCancellableSelfTestTcti is a mockSelfTestTcti that supports cancellation.
+type mockCancellableSelfTestTcti struct {
+	*mockSelfTestTcti
+}
+
+func (t *mockCancellableSelfTestTcti) Cancel() error {
+	return nil
+}
+
+type selfTestSuite struct {
+	testutil.BaseTest
+
+	tcti   *mockSelfTestTcti
+	tpm    *TPMContext
+	sleeps []time.Duration
+}
+
+func (s *selfTestSuite) SetUpTest(c *C) {
+	s.BaseTest.SetUpTest(c)
+
+	s.tcti = new(mockSelfTestTcti)
+	s.tpm = NewTPMContext(s.tcti)
+	s.sleeps = nil
+	s.AddCleanup(MockSleep(func(d time.Duration) {
+		s.sleeps = append(s.sleeps, d)
+	}))
+}
+
+var _ = Suite(&selfTestSuite{})
+
+// respondWithTestResults returns a response function that fails TPM2_GetRandom
+// with TPM_RC_TESTING until TPM2_GetTestResult has returned each of the supplied
+// test results.
+func (s *selfTestSuite) respondWithTestResults(results ...ResponseCode) func(CommandCode) []byte {
+	testing := true
+	return func(code CommandCode) []byte {
+		switch code {
+		case CommandGetRandom:
+			if testing {
+				return makeMockResponse(rcTesting)
+			}
+			return makeMockResponse(ResponseSuccess, Digest{1, 2, 3, 4})
+		case CommandSelfTest:
+			return makeMockResponse(ResponseSuccess)
+		case CommandGetTestResult:
+			rc := results[0]
+			if len(results) > 1 {
+				results = results[1:]
+			}
+			if rc == ResponseSuccess {
+				testing = false
+			}
+			return makeMockResponse(ResponseSuccess, MaxBuffer(nil), rc)
+		default:
+			return makeMockResponse(ResponseCode(0x143)) // TPM_RC_COMMAND_CODE
+		}
+	}
+}
+
+func (s *selfTestSuite) TestWaitForSelfTest(c *C) {
+	s.tcti.respond = s.respondWithTestResults(rcTesting, ResponseSuccess)
+	s.tpm.SetSelfTestPolicy(&SelfTestPolicy{Timeout: time.Second})
+
+	data, err := s.tpm.GetRandom(4)
+	c.Check(err, IsNil)
+	c.Check(data, DeepEquals, Digest{1, 2, 3, 4})
+
+	c.Check(s.tcti.commands, DeepEquals, []CommandCode{CommandGetRandom, CommandGetTestResult, CommandGetTestResult, CommandGetRandom})
+	c.Assert(s.sleeps, internal_testutil.LenEquals, 2)
+	c.Check(s.sleeps[0] >= 10*time.Millisecond && s.sleeps[0] < 30*time.Millisecond, internal_testutil.IsTrue)
+	c.Check(s.sleeps[1] >= 20*time.Millisecond && s.sleeps[1] < 60*time.Millisecond, internal_testutil.IsTrue)
+}
+
+func (s *selfTestSuite) TestWaitForSelfTestRunSelfTest(c *C) {
+	s.tcti.respond = s.respondWithTestResults(ResponseSuccess)
+	s.tpm.SetSelfTestPolicy(&SelfTestPolicy{RunSelfTest: true, Timeout: time.Second})
+
+	data, err := s.tpm.GetRandom(4)
+	c.Check(err, IsNil)
+	c.Check(data, DeepEquals, Digest{1, 2, 3, 4})
+
+	c.Check(s.tcti.commands, DeepEquals, []CommandCode{CommandGetRandom, CommandSelfTest, CommandGetTestResult, CommandGetRandom})
+	c.Check(s.sleeps, internal_testutil.LenEquals, 1)
+}
+
+func (s *selfTestSuite) TestWaitForSelfTestMaxDelay(c *C) {
+	s.tcti.respond = s.respondWithTestResults(rcTesting, rcTesting, rcTesting, rcTesting, ResponseSuccess)
+	s.tpm.SetSelfTestPolicy(&SelfTestPolicy{
+		Timeout:      time.Minute,
+		InitialDelay: 100 * time.Millisecond,
+		MaxDelay:     200 * time.Millisecond})
+
+	_, err := s.tpm.GetRandom(4)
+	c.Check(err, IsNil)
+
+	c.Assert(s.sleeps, internal_testutil.LenEquals, 5)
+	c.Check(s.sleeps[0] >= 50*time.Millisecond && s.sleeps[0] < 150*time.Millisecond, internal_testutil.IsTrue)
+	for _, d := range s.sleeps[1:] {
+		c.Check(d >= 100*time.Millisecond && d < 300*time.Millisecond, internal_testutil.IsTrue)
+	}
+}
+
+func (s *selfTestSuite) TestWaitForSelfTestTimeout(c *C) {
+	s.tcti.respond = s.respondWithTestResults(rcTesting)
+	s.tpm.SetSelfTestPolicy(&SelfTestPolicy{Timeout: 100 * time.Millisecond})
+
+	_, err := s.tpm.GetRandom(4)
+	c.Check(IsTPMWarning(err, WarningTesting, CommandGetRandom), internal_testutil.IsTrue)
+
+	var total time.Duration
+	for _, d := range s.sleeps {
+		total += d
+	}
+	c.Check(total, Equals, 100*time.Millisecond)
+	c.Check(s.tcti.commands[0], Equals, CommandGetRandom)
+	for _, code := range s.tcti.commands[1:] {
+		c.Check(code, Equals, CommandGetTestResult)
+	}
+}
+
+func (s *selfTestSuite) TestWaitForSelfTestFailure(c *C) {
+	s.tcti.respond = s.respondWithTestResults(rcTesting, rcFailure)
+	s.tpm.SetSelfTestPolicy(&SelfTestPolicy{Timeout: time.Second})
+
+	_, err := s.tpm.GetRandom(4)
+	c.Check(err, ErrorMatches, `cannot complete self-test: TPM returned an error whilst executing command TPM_CC_GetTestResult: TPM_RC_FAILURE \(commands not being accepted because of a TPM failure\)`)
+	c.Check(IsTPMError(err, ErrorFailure, CommandGetTestResult), internal_testutil.IsTrue)
+	c.Check(s.tcti.commands, DeepEquals, []CommandCode{CommandGetRandom, CommandGetTestResult, CommandGetTestResult})
+}
+
+func (s *selfTestSuite) TestNoSelfTestPolicy(c *C) {
+	s.tcti.respond = s.respondWithTestResults(ResponseSuccess)
+
+	_, err := s.tpm.GetRandom(4)
+	c.Check(IsTPMWarning(err, WarningTesting, CommandGetRandom), internal_testutil.IsTrue)
+
+	// The command is retried with the default behaviour, without polling the
+	// self-test status.
+	c.Check(s.tcti.commands, DeepEquals, []CommandCode{CommandGetRandom, CommandGetRandom, CommandGetRandom, CommandGetRandom, CommandGetRandom})
+	c.Check(s.sleeps, internal_testutil.LenEquals, 4)
+}
+
+func (s *selfTestSuite) TestResetSelfTestPolicy(c *C) {
+	s.tcti.respond = s.respondWithTestResults(ResponseSuccess)
+	s.tpm.SetSelfTestPolicy(&SelfTestPolicy{Timeout: time.Second})
+	s.tpm.SetSelfTestPolicy(nil)
+
+	_, err := s.tpm.GetRandom(4)
+	c.Check(IsTPMWarning(err, WarningTesting, CommandGetRandom), internal_testutil.IsTrue)
+	for _, code := range s.tcti.commands {
+		c.Check(code, Equals, CommandGetRandom)
+	}
+}
+
+func (s *selfTestSuite) TestWaitForSelfTestCancelled(c *C) {
+	s.tcti.respond = s.respondWithTestResults(rcTesting, ResponseSuccess)
+	tpm := NewTPMContext(&mockCancellableSelfTestTcti{s.tcti})
+	tpm.SetSelfTestPolicy(&SelfTestPolicy{Timeout: time.Second})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s.AddCleanup(MockSleep(func(d time.Duration) {
+		s.sleeps = append(s.sleeps, d)
+		cancel()
+	}))
+
+	_, _, err := tpm.RunCommandContext(ctx, CommandGetRandom, nil, nil, mu.MustMarshalToBytes(uint16(4)), nil)
+	c.Check(err, Equals, ErrCommandCancelled)
+
+	// The command is not resubmitted after the context is cancelled.
+	c.Check(s.tcti.commands, DeepEquals, []CommandCode{CommandGetRandom})
+	c.Check(s.sleeps, internal_testutil.LenEquals, 1)
+}
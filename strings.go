@@ -203,6 +203,8 @@ func (c CommandCode) String() string {
 		return "TPM_CC_ContextSave"
 	case CommandECDHKeyGen:
 		return "TPM_CC_ECDH_KeyGen"
+	case CommandEncryptDecrypt:
+		return "TPM_CC_EncryptDecrypt"
 	case CommandFlushContext:
 		return "TPM_CC_FlushContext"
 	case CommandLoadExternal:
@@ -281,6 +283,8 @@ func (c CommandCode) String() string {
 		return "TPM_CC_CreateLoaded"
 	case CommandPolicyAuthorizeNV:
 		return "TPM_CC_PolicyAuthorizeNV"
+	case CommandEncryptDecrypt2:
+		return "TPM_CC_EncryptDecrypt2"
 	default:
 		return fmt.Sprintf("0x%08x", uint32(c))
 	}
@@ -682,6 +686,46 @@ func (a ObjectTypeId) Format(s fmt.State, f rune) {
 	AlgorithmId(a).Format(s, f)
 }
 
+func (op ArithmeticOp) String() string {
+	switch op {
+	case OpEq:
+		return "TPM_EO_EQ"
+	case OpNeq:
+		return "TPM_EO_NEQ"
+	case OpSignedGT:
+		return "TPM_EO_SIGNED_GT"
+	case OpUnsignedGT:
+		return "TPM_EO_UNSIGNED_GT"
+	case OpSignedLT:
+		return "TPM_EO_SIGNED_LT"
+	case OpUnsignedLT:
+		return "TPM_EO_UNSIGNED_LT"
+	case OpSignedGE:
+		return "TPM_EO_SIGNED_GE"
+	case OpUnsignedGE:
+		return "TPM_EO_UNSIGNED_GE"
+	case OpSignedLE:
+		return "TPM_EO_SIGNED_LE"
+	case OpUnsignedLE:
+		return "TPM_EO_UNSIGNED_LE"
+	case OpBitset:
+		return "TPM_EO_BITSET"
+	case OpBitclear:
+		return "TPM_EO_BITCLEAR"
+	default:
+		return fmt.Sprintf("0x%04x", uint16(op))
+	}
+}
+
+func (op ArithmeticOp) Format(s fmt.State, f rune) {
+	switch f {
+	case 's', 'v':
+		fmt.Fprintf(s, "%s", op.String())
+	default:
+		fmt.Fprintf(s, makeDefaultFormatter(s, f), uint16(op))
+	}
+}
+
 func (c Capability) String() string {
 	switch c {
 	case CapabilityAlgs:
@@ -16,14 +16,22 @@ const InfiniteTimeout = -1 * time.Millisecond
 // configuring the command timeout.
 var ErrTimeoutNotSupported = errors.New("configurable command timeouts are not supported")
 
+// ErrCommandCancelled is returned from [TPMContext.RunCommandContext] when the supplied
+// context is cancelled or its deadline expires before the command completes.
+var ErrCommandCancelled = errors.New("the command was cancelled")
+
+// ErrCancellationNotSupported is returned from [TPMContext.RunCommandContext] when the
+// supplied context can be cancelled but the [TCTI] doesn't implement [CancellableTCTI].
+var ErrCancellationNotSupported = errors.New("the transmission interface does not support cancellation")
+
 // XXX: Note that the "TCG TSS 2.0 TPM Command Transmission Interface (TCTI) API Specification"
 // defines the following callbacks:
 // - transmit, which is equivalent to io.Writer.
 // - receive, which is equivalent to io.Reader, although that lacks the ability to specify
 //   a timeout.
 // - finalize, which is equivalent to io.Closer.
-// - cancel, which we don't implement at the moment, and the Linux character device doesn't
-//   support cancellation anyway.
+// - cancel, which is equivalent to CancellableTCTI. The Linux character device doesn't
+//   support cancellation.
 // - getPollHandles, doesn't really make sense here because go's runtime does the polling on
 //   Read.
 // - setLocality, makes no sense in this package.
@@ -54,3 +62,16 @@ type TCTI interface {
 	// associated with the supplied handle between commands.
 	MakeSticky(handle Handle, sticky bool) error
 }
+
+// CancellableTCTI is implemented by [TCTI] implementations that support cancelling
+// an in-flight command.
+type CancellableTCTI interface {
+	TCTI
+
+	// Cancel requests that the TPM cancels the command that is currently in progress.
+	// This will be called from a different goroutine to the one that is blocked in Read.
+	// The TPM may still complete the command, but a command that is cancelled should
+	// generally complete with a TPM_RC_CANCELED response. The cancellation request
+	// should only apply to the command that is currently in progress.
+	Cancel() error
+}
@@ -578,6 +578,34 @@ func (s *tpmSimulatorTestSuiteProper) TestResetTPMSimulator(c *C) {
 	c.Check(currentTime.ClockInfo.ResetCount, Equals, origCurrentTime.ClockInfo.ResetCount+1)
 }
 
+func (s *tpmSimulatorTestSuiteProper) TestMssimPowerCycle(c *C) {
+	origCurrentTime, err := s.TPM.ReadClock()
+	c.Assert(err, IsNil)
+
+	c.Check(s.TPM.Shutdown(tpm2.StartupClear), IsNil)
+	c.Check(s.Mssim(c).PowerOff(), IsNil)
+	c.Check(s.Mssim(c).PowerOn(), IsNil)
+	c.Check(s.Mssim(c).NVOn(), IsNil)
+	c.Check(s.TPM.Startup(tpm2.StartupClear), IsNil)
+
+	currentTime, err := s.TPM.ReadClock()
+	c.Assert(err, IsNil)
+	c.Check(currentTime.ClockInfo.ResetCount, Equals, origCurrentTime.ClockInfo.ResetCount+1)
+}
+
+func (s *tpmSimulatorTestSuiteProper) TestMssimReset(c *C) {
+	origCurrentTime, err := s.TPM.ReadClock()
+	c.Assert(err, IsNil)
+
+	c.Check(s.TPM.Shutdown(tpm2.StartupClear), IsNil)
+	c.Check(s.Mssim(c).Reset(), IsNil)
+	c.Check(s.TPM.Startup(tpm2.StartupClear), IsNil)
+
+	currentTime, err := s.TPM.ReadClock()
+	c.Assert(err, IsNil)
+	c.Check(currentTime.ClockInfo.ResetCount, Equals, origCurrentTime.ClockInfo.ResetCount+1)
+}
+
 func (s *tpmSimulatorTestSuiteProper) TestResetAndClearTPMSimulatorUsingPlatformHierarchy(c *C) {
 	s.ResetTPMSimulator(c) // Increment reset count so we can detect the clea
 	c.Check(s.TPM.ClearControl(s.TPM.PlatformHandleContext(), true, nil), IsNil)
@@ -86,6 +86,7 @@ var commandInfoMap = map[tpm2.CommandCode]commandInfo{
 	tpm2.CommandActivateCredential:         commandInfo{2, 2, false, false},
 	tpm2.CommandCertify:                    commandInfo{2, 2, false, false},
 	tpm2.CommandPolicyNV:                   commandInfo{1, 3, false, false},
+	tpm2.CommandPolicyAuthorizeNV:          commandInfo{1, 3, false, false},
 	tpm2.CommandCertifyCreation:            commandInfo{1, 2, false, false},
 	tpm2.CommandDuplicate:                  commandInfo{1, 2, false, false},
 	tpm2.CommandGetTime:                    commandInfo{2, 2, false, false},
@@ -101,6 +102,8 @@ var commandInfoMap = map[tpm2.CommandCode]commandInfo{
 	tpm2.CommandHMACStart:                  commandInfo{1, 1, true, false},
 	tpm2.CommandSequenceUpdate:             commandInfo{1, 1, false, false},
 	tpm2.CommandSign:                       commandInfo{1, 1, false, false},
+	tpm2.CommandEncryptDecrypt:             commandInfo{1, 1, false, false},
+	tpm2.CommandEncryptDecrypt2:            commandInfo{1, 1, false, false},
 	tpm2.CommandUnseal:                     commandInfo{1, 1, false, false},
 	tpm2.CommandPolicySigned:               commandInfo{0, 2, false, false},
 	tpm2.CommandContextLoad:                commandInfo{0, 0, true, false},
@@ -135,6 +138,7 @@ var commandInfoMap = map[tpm2.CommandCode]commandInfo{
 	tpm2.CommandTestParms:                  commandInfo{0, 0, false, false},
 	tpm2.CommandPolicyPassword:             commandInfo{0, 1, false, false},
 	tpm2.CommandPolicyNvWritten:            commandInfo{0, 1, false, false},
+	tpm2.CommandPolicyTemplate:             commandInfo{0, 1, false, false},
 	tpm2.CommandCreateLoaded:               commandInfo{1, 1, true, false},
 }
 
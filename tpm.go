@@ -6,6 +6,8 @@ package tpm2
 
 import (
 	"bytes"
+	"context"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -15,6 +17,20 @@ import (
 	"github.com/canonical/go-tpm2/mu"
 )
 
+// sleep waits for the specified duration, returning early with ErrCommandCancelled
+// if the supplied context is cancelled.
+var sleep = func(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ErrCommandCancelled
+	case <-timer.C:
+		return nil
+	}
+}
+
 func makeInvalidArgError(name, msg string) error {
 	return fmt.Errorf("invalid %s argument: %s", name, msg)
 }
@@ -103,6 +119,7 @@ type execContext struct {
 	dispatcher           execContextDispatcher
 	lastExclusiveSession sessionContextInternal
 	pendingResponse      *rspContext
+	auditSession         SessionContext
 }
 
 func (e *execContext) processResponseAuth(r *rspContext) (err error) {
@@ -156,10 +173,10 @@ func (e *execContext) CompleteResponse(r *rspContext, responseParams ...interfac
 	return nil
 }
 
-func (e *execContext) RunCommand(c *cmdContext, responseHandle *Handle) (*rspContext, error) {
-	var handles HandleList
-	var handleNames []Name
-	sessionParams := newSessionParams()
+// prepareCommand returns the handles, handle names, session parameters and marshalled
+// parameters for the supplied command.
+func (e *execContext) prepareCommand(c *cmdContext) (handles HandleList, handleNames []Name, sessionParams *sessionParams, cpBytes []byte, err error) {
+	sessionParams = newSessionParams()
 
 	for _, h := range c.Handles {
 		handles = append(handles, h.handle.Handle())
@@ -167,21 +184,64 @@ func (e *execContext) RunCommand(c *cmdContext, responseHandle *Handle) (*rspCon
 
 		if h.session != nil {
 			if err := sessionParams.AppendSessionForResource(h.session, h.handle.(ResourceContext)); err != nil {
-				return nil, fmt.Errorf("cannot process HandleContext for command %s at index %d: %v", c.CommandCode, len(handles), err)
+				return nil, nil, nil, nil, fmt.Errorf("cannot process HandleContext for command %s at index %d: %v", c.CommandCode, len(handles), err)
 			}
 		}
 	}
 	if err := sessionParams.AppendExtraSessions(c.ExtraSessions...); err != nil {
-		return nil, fmt.Errorf("cannot process non-auth SessionContext parameters for command %s: %v", c.CommandCode, err)
+		return nil, nil, nil, nil, fmt.Errorf("cannot process non-auth SessionContext parameters for command %s: %v", c.CommandCode, err)
+	}
+	if e.auditSession != nil && e.auditSession.Handle() == HandleUnassigned {
+		// The audit session has been flushed.
+		e.auditSession = nil
+	}
+	if e.auditSession != nil && isSessionAllowed(c.CommandCode) && !sessionParams.hasSession(e.auditSession) {
+		if err := sessionParams.AppendExtraSessions(e.auditSession); err != nil {
+			return nil, nil, nil, nil, fmt.Errorf("cannot process audit session for command %s: %v", c.CommandCode, err)
+		}
+	}
+
+	if err := sessionParams.CheckParameterEncryption(); err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("cannot process SessionContext parameters for command %s: %v", c.CommandCode, err)
 	}
 
 	if sessionParams.hasDecryptSession() && (len(c.Params) == 0 || !isParamEncryptable(c.Params[0])) {
-		return nil, fmt.Errorf("command %s does not support command parameter encryption", c.CommandCode)
+		return nil, nil, nil, nil, fmt.Errorf("command %s does not support command parameter encryption", c.CommandCode)
 	}
 
-	cpBytes, err := mu.MarshalToBytes(c.Params...)
+	cpBytes, err = mu.MarshalToBytes(c.Params...)
 	if err != nil {
-		return nil, fmt.Errorf("cannot marshal parameters for command %s: %w", c.CommandCode, err)
+		return nil, nil, nil, nil, fmt.Errorf("cannot marshal parameters for command %s: %w", c.CommandCode, err)
+	}
+
+	return handles, handleNames, sessionParams, cpBytes, nil
+}
+
+func (e *execContext) CommandSize(c *cmdContext) (int, error) {
+	handles, _, sessionParams, cpBytes, err := e.prepareCommand(c)
+	if err != nil {
+		return 0, err
+	}
+
+	// Building the real command auth area updates the caller nonces of the
+	// sessions, so build one of the same size instead. Parameter encryption
+	// doesn't change the size of the parameters.
+	var cAuthArea []AuthCommand
+	for _, s := range sessionParams.Sessions {
+		cAuthArea = append(cAuthArea, *s.BuildPlaceholderCommandAuth())
+	}
+
+	cmd, err := MarshalCommandPacket(c.CommandCode, handles, cAuthArea, cpBytes)
+	if err != nil {
+		return 0, fmt.Errorf("cannot serialize command packet: %w", err)
+	}
+	return len(cmd), nil
+}
+
+func (e *execContext) RunCommand(c *cmdContext, responseHandle *Handle) (*rspContext, error) {
+	handles, handleNames, sessionParams, cpBytes, err := e.prepareCommand(c)
+	if err != nil {
+		return nil, err
 	}
 
 	cAuthArea, err := sessionParams.BuildCommandAuthArea(c.CommandCode, handleNames, cpBytes)
@@ -276,6 +336,8 @@ type TPMContext struct {
 	tcti                  TCTI
 	permanentResources    map[Handle]*permanentContext
 	maxSubmissions        uint
+	selfTestPolicy        *SelfTestPolicy
+	waitingForSelfTest    bool
 	propertiesInitialized bool
 	maxBufferSize         uint16
 	minPcrSelectSize      uint8
@@ -286,6 +348,7 @@ type TPMContext struct {
 
 // Close calls Close on the transmission interface.
 func (t *TPMContext) Close() error {
+	t.propertiesInitialized = false
 	if err := t.tcti.Close(); err != nil {
 		return &TctiError{"close", err}
 	}
@@ -335,6 +398,66 @@ func (t *TPMContext) RunCommandBytes(packet CommandPacket) (ResponsePacket, erro
 // of the many convenience functions provided by TPMContext instead, or [TPMContext.StartCommand]
 // if one doesn't already exist.
 func (t *TPMContext) RunCommand(commandCode CommandCode, cHandles HandleList, cAuthArea []AuthCommand, cpBytes []byte, rHandle *Handle) (rpBytes []byte, rAuthArea []AuthResponse, err error) {
+	return t.runCommand(context.Background(), commandCode, cHandles, cAuthArea, cpBytes, rHandle)
+}
+
+// RunCommandContext is a variant of [TPMContext.RunCommand] that accepts a context. If
+// the supplied context is cancelled or its deadline expires before the command is
+// submitted, [ErrCommandCancelled] is returned without submitting it.
+//
+// Cancellation of a command that has been submitted requires the underlying transmission
+// interface to implement [CancellableTCTI] (eg, the TPM simulator in the mssim package),
+// in which case the TPM is asked to cancel the command and the response is still waited
+// for. If the TPM cancels the command, [ErrCommandCancelled] is returned. If the TPM
+// completes the command before the cancellation request arrives, its result is returned
+// as normal. If the transmission interface doesn't implement [CancellableTCTI] and the
+// supplied context can be cancelled, [ErrCancellationNotSupported] is returned without
+// submitting the command. Use [TPMContext.RunCommand] or a context that can't be
+// cancelled for these.
+//
+// If the context is cancelled whilst waiting to resubmit a command, the command is not
+// resubmitted and [ErrCommandCancelled] is returned.
+func (t *TPMContext) RunCommandContext(ctx context.Context, commandCode CommandCode, cHandles HandleList, cAuthArea []AuthCommand, cpBytes []byte, rHandle *Handle) (rpBytes []byte, rAuthArea []AuthResponse, err error) {
+	return t.runCommand(ctx, commandCode, cHandles, cAuthArea, cpBytes, rHandle)
+}
+
+// runCommandBytesContext runs the supplied command packet, asking the TPM to cancel it via
+// the transmission interface if the supplied context is cancelled before the response is
+// received. The response is always waited for once the command has been submitted.
+func (t *TPMContext) runCommandBytesContext(ctx context.Context, packet CommandPacket) (ResponsePacket, error) {
+	if ctx.Done() == nil {
+		return t.RunCommandBytes(packet)
+	}
+	if ctx.Err() != nil {
+		return nil, ErrCommandCancelled
+	}
+
+	tcti, ok := t.tcti.(CancellableTCTI)
+	if !ok {
+		return nil, ErrCancellationNotSupported
+	}
+
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		select {
+		case <-done:
+		case <-ctx.Done():
+			tcti.Cancel()
+		}
+	}()
+
+	resp, err := t.RunCommandBytes(packet)
+	close(done)
+
+	// Wait for the goroutine to finish so that a cancellation request
+	// doesn't race with subsequent commands.
+	<-finished
+	return resp, err
+}
+
+func (t *TPMContext) runCommand(ctx context.Context, commandCode CommandCode, cHandles HandleList, cAuthArea []AuthCommand, cpBytes []byte, rHandle *Handle) (rpBytes []byte, rAuthArea []AuthResponse, err error) {
 	cmd, err := MarshalCommandPacket(commandCode, cHandles, cAuthArea, cpBytes)
 	if err != nil {
 		return nil, nil, fmt.Errorf("cannot serialize command packet: %w", err)
@@ -345,7 +468,7 @@ func (t *TPMContext) RunCommand(commandCode CommandCode, cHandles HandleList, cA
 
 	for {
 		var err error
-		resp, err := t.RunCommandBytes(cmd)
+		resp, err := t.runCommandBytesContext(ctx, cmd)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -360,6 +483,9 @@ func (t *TPMContext) RunCommand(commandCode CommandCode, cHandles HandleList, cA
 		if err == nil {
 			return rpBytes, rAuthArea, nil
 		}
+		if IsTPMWarning(err, WarningCanceled, commandCode) && ctx.Err() != nil {
+			return nil, nil, ErrCommandCancelled
+		}
 		if _, isInvalidRc := err.(InvalidResponseCodeError); isInvalidRc {
 			return nil, nil, &InvalidResponseError{commandCode, err}
 		}
@@ -371,7 +497,23 @@ func (t *TPMContext) RunCommand(commandCode CommandCode, cHandles HandleList, cA
 			return nil, nil, err
 		}
 
-		time.Sleep(retryDelay)
+		if IsTPMWarning(err, WarningTesting, commandCode) && t.selfTestPolicy != nil && !t.waitingForSelfTest {
+			ok, testErr := t.waitForSelfTest(ctx)
+			switch {
+			case testErr == ErrCommandCancelled:
+				return nil, nil, testErr
+			case testErr != nil:
+				return nil, nil, fmt.Errorf("cannot complete self-test: %w", testErr)
+			case !ok:
+				return nil, nil, err
+			}
+			try++
+			continue
+		}
+
+		if err := sleep(ctx, retryDelay); err != nil {
+			return nil, nil, err
+		}
 
 		try++
 		retryDelay *= 2
@@ -410,6 +552,31 @@ func (t *TPMContext) SetCommandTimeout(timeout time.Duration) error {
 	return t.tcti.SetTimeout(timeout)
 }
 
+// SetAuditSession sets a HMAC session that will be used to audit every subsequent
+// command executed by this context, without it having to be supplied to each command.
+// The session is used with the [AttrAudit] and [AttrContinueSession] attributes set, in
+// addition to any other attributes that are set on it when this is called. It is added to each command's
+// session list after any sessions that are supplied explicitly, unless it is already
+// supplied explicitly. It is not added to commands that don't accept sessions, such as
+// TPM2_FlushContext.
+//
+// A command that already has the maximum number of sessions will fail with an error
+// whilst an audit session is set. The audit session is cleared automatically if it is
+// flushed with [TPMContext.FlushContext]. Passing nil clears the audit session.
+func (t *TPMContext) SetAuditSession(session SessionContext) {
+	if session == nil {
+		t.execContext.auditSession = nil
+		return
+	}
+	t.execContext.auditSession = session.IncludeAttrs(AttrAudit | AttrContinueSession)
+}
+
+// ClearAuditSession clears the audit session set by [TPMContext.SetAuditSession], so that
+// subsequent commands are no longer audited automatically.
+func (t *TPMContext) ClearAuditSession() {
+	t.SetAuditSession(nil)
+}
+
 // InitProperties executes one or more TPM2_GetCapability commands to initialize properties used
 // internally by TPMContext. This is normally done automatically by functions that require these
 // properties when they are used for the first time, but this function is provided so that the
@@ -470,6 +637,50 @@ func (t *TPMContext) initPropertiesIfNeeded() error {
 	return t.InitProperties()
 }
 
+// InputBufferSize returns the value of the [PropertyInputBuffer] property, which indicates the
+// maximum size of arguments of the [MaxBuffer] type in bytes. The value is queried once with
+// [TPMContext.InitProperties] and then cached. Use [TPMContext.GetInputBuffer] to query the TPM
+// directly.
+func (t *TPMContext) InputBufferSize() (int, error) {
+	if err := t.initPropertiesIfNeeded(); err != nil {
+		return 0, err
+	}
+	return int(t.maxBufferSize), nil
+}
+
+// NVBufferMax returns the value of the [PropertyNVBufferMax] property, which indicates the
+// maximum buffer size supported by the TPM in bytes for [TPMContext.NVReadRaw] and
+// [TPMContext.NVWriteRaw]. The value is queried once with [TPMContext.InitProperties] and then
+// cached. Use [TPMContext.GetNVBufferMax] to query the TPM directly.
+func (t *TPMContext) NVBufferMax() (int, error) {
+	if err := t.initPropertiesIfNeeded(); err != nil {
+		return 0, err
+	}
+	return int(t.maxNVBufferSize), nil
+}
+
+// MaxDigestSize returns the value of the [PropertyMaxDigest] property, which indicates the size
+// of the largest digest algorithm supported by the TPM in bytes. The value is queried once with
+// [TPMContext.InitProperties] and then cached. Use [TPMContext.GetMaxDigest] to query the TPM
+// directly.
+func (t *TPMContext) MaxDigestSize() (int, error) {
+	if err := t.initPropertiesIfNeeded(); err != nil {
+		return 0, err
+	}
+	return int(t.maxDigestSize), nil
+}
+
+// MaxDataSize returns the maximum size of arguments of the [Data] type supported by the TPM in
+// bytes. The value is derived from the cached value returned by [TPMContext.MaxDigestSize]. Use
+// [TPMContext.GetMaxData] to query the TPM directly.
+func (t *TPMContext) MaxDataSize() (int, error) {
+	n, err := t.MaxDigestSize()
+	if err != nil {
+		return 0, err
+	}
+	return n + binary.Size(AlgorithmId(0)), nil
+}
+
 // TPMDevice corresponds a TPM device.
 type TPMDevice interface {
 	// Open opens a communication channel with the TPM device.
@@ -86,6 +86,13 @@ func (r *mockSessionContext) ExcludeAttrs(attrs SessionAttributes) SessionContex
 	return &mockSessionContext{handle: r.handle, data: r.data, attrs: r.attrs &^ attrs}
 }
 
+func (r *mockSessionContext) BoundEntity() (Name, bool) {
+	if !r.data.IsBound {
+		return nil, false
+	}
+	return r.data.BoundEntity, true
+}
+
 func (r *mockSessionContext) Invalidate()               { r.handle = HandleUnassigned }
 func (r *mockSessionContext) Attrs() SessionAttributes  { return r.attrs }
 func (r *mockSessionContext) Data() *SessionContextData { return r.data }
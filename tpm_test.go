@@ -0,0 +1,543 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package tpm2_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	. "github.com/canonical/go-tpm2"
+	internal_testutil "github.com/canonical/go-tpm2/internal/testutil"
+	"github.com/canonical/go-tpm2/mu"
+	"github.com/canonical/go-tpm2/testutil"
+)
+
+type tpmSuite struct {
+	testutil.TPMTest
+}
+
+func (s *tpmSuite) SetUpSuite(c *C) {
+	s.TPMFeatures = testutil.TPMFeatureEndorsementHierarchy
+}
+
+var _ = Suite(&tpmSuite{})
+
+type tpmSuiteNoTPM struct{}
+
+var _ = Suite(&tpmSuiteNoTPM{})
+
+const rcCanceled ResponseCode = 0x909 // TPM_RC_CANCELED
+
+// mockBlockingTcti is a fake TCTI where reads block until the command
+// is released with the supplied response, or until it is closed.
+type mockBlockingTcti struct {
+	mu       sync.Mutex
+	released chan []byte
+	closed   bool
+	rsp      *bytes.Reader
+	commands int
+	last     []byte
+}
+
+func newMockBlockingTcti() *mockBlockingTcti {
+	return &mockBlockingTcti{released: make(chan []byte, 1)}
+}
+
+func (t *mockBlockingTcti) release(rsp []byte) {
+	t.released <- rsp
+}
+
+func (t *mockBlockingTcti) Read(data []byte) (int, error) {
+	if t.rsp == nil {
+		rsp, ok := <-t.released
+		if !ok {
+			return 0, errors.New("closed")
+		}
+		t.rsp = bytes.NewReader(rsp)
+	}
+	n, _ := t.rsp.Read(data)
+	if t.rsp.Len() == 0 {
+		t.rsp = nil
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (t *mockBlockingTcti) Write(data []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return 0, errors.New("closed")
+	}
+	t.commands++
+	t.last = append([]byte(nil), data...)
+	return len(data), nil
+}
+
+func (t *mockBlockingTcti) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.closed {
+		t.closed = true
+		close(t.released)
+	}
+	return nil
+}
+
+func (t *mockBlockingTcti) SetTimeout(timeout time.Duration) error {
+	return nil
+}
+
+func (t *mockBlockingTcti) MakeSticky(handle Handle, sticky bool) error {
+	return nil
+}
+
+// mockCancellableTcti is a mockBlockingTcti that completes the in-flight
+// command with TPM_RC_CANCELED when it is cancelled, or with cancelRsp if
+// it is set.
+type mockCancellableTcti struct {
+	*mockBlockingTcti
+	cancels   int
+	cancelRsp []byte
+}
+
+func (t *mockCancellableTcti) Cancel() error {
+	t.cancels++
+	rsp := t.cancelRsp
+	if rsp == nil {
+		rsp = makeMockResponse(rcCanceled)
+	}
+	t.release(rsp)
+	return nil
+}
+
+func (s *tpmSuiteNoTPM) TestRunCommandContext(c *C) {
+	tcti := newMockBlockingTcti()
+	tpm := NewTPMContext(tcti)
+
+	tcti.release(makeMockResponse(ResponseSuccess, Digest{1, 2, 3, 4}))
+	rpBytes, _, err := tpm.RunCommandContext(context.Background(), CommandGetRandom, nil, nil, mu.MustMarshalToBytes(uint16(4)), nil)
+	c.Check(err, IsNil)
+	c.Check(rpBytes, DeepEquals, mu.MustMarshalToBytes(Digest{1, 2, 3, 4}))
+}
+
+func (s *tpmSuiteNoTPM) TestRunCommandContextCompletesBeforeCancel(c *C) {
+	tcti := &mockCancellableTcti{mockBlockingTcti: newMockBlockingTcti()}
+	tpm := NewTPMContext(tcti)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tcti.release(makeMockResponse(ResponseSuccess, Digest{1, 2, 3, 4}))
+	rpBytes, _, err := tpm.RunCommandContext(ctx, CommandGetRandom, nil, nil, mu.MustMarshalToBytes(uint16(4)), nil)
+	c.Check(err, IsNil)
+	c.Check(rpBytes, DeepEquals, mu.MustMarshalToBytes(Digest{1, 2, 3, 4}))
+	c.Check(tcti.cancels, Equals, 0)
+}
+
+func (s *tpmSuiteNoTPM) TestRunCommandContextCancel(c *C) {
+	tcti := &mockCancellableTcti{mockBlockingTcti: newMockBlockingTcti()}
+	tpm := NewTPMContext(tcti)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, _, err := tpm.RunCommandContext(ctx, CommandCreatePrimary, nil, nil, nil, nil)
+	c.Check(err, Equals, ErrCommandCancelled)
+	c.Check(time.Since(start) < 5*time.Second, internal_testutil.IsTrue)
+	c.Check(tcti.cancels, Equals, 1)
+	c.Check(tcti.closed, internal_testutil.IsFalse)
+
+	// The connection should still be usable.
+	tcti.release(makeMockResponse(ResponseSuccess, Digest{1, 2, 3, 4}))
+	_, err = tpm.GetRandom(4)
+	c.Check(err, IsNil)
+}
+
+func (s *tpmSuiteNoTPM) TestRunCommandContextCancelCompletedByTPM(c *C) {
+	tcti := &mockCancellableTcti{
+		mockBlockingTcti: newMockBlockingTcti(),
+		cancelRsp:        makeMockResponse(ResponseSuccess, Digest{1, 2, 3, 4})}
+	tpm := NewTPMContext(tcti)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	// The TPM completes the command before it sees the cancellation request, so
+	// the result shouldn't be discarded.
+	rpBytes, _, err := tpm.RunCommandContext(ctx, CommandGetRandom, nil, nil, mu.MustMarshalToBytes(uint16(4)), nil)
+	c.Check(err, IsNil)
+	c.Check(rpBytes, DeepEquals, mu.MustMarshalToBytes(Digest{1, 2, 3, 4}))
+	c.Check(tcti.cancels, Equals, 1)
+}
+
+func (s *tpmSuiteNoTPM) TestRunCommandContextCancelNotSupported(c *C) {
+	tcti := newMockBlockingTcti()
+	tpm := NewTPMContext(tcti)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, _, err := tpm.RunCommandContext(ctx, CommandCreatePrimary, nil, nil, nil, nil)
+	c.Check(err, Equals, ErrCancellationNotSupported)
+	c.Check(tcti.commands, Equals, 0)
+	c.Check(tcti.closed, internal_testutil.IsFalse)
+}
+
+func (s *tpmSuiteNoTPM) TestRunCommandContextCancelDuringRetryDelay(c *C) {
+	tcti := &mockCancellableTcti{mockBlockingTcti: newMockBlockingTcti()}
+	tpm := NewTPMContext(tcti)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tcti.release(makeMockResponse(ResponseCode(0x922))) // TPM_RC_RETRY
+
+	go func() {
+		// Cancel once the command has been submitted, whilst waiting to
+		// resubmit it.
+		for {
+			tcti.mu.Lock()
+			n := tcti.commands
+			tcti.mu.Unlock()
+			if n > 0 {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		cancel()
+	}()
+
+	_, _, err := tpm.RunCommandContext(ctx, CommandGetRandom, nil, nil, mu.MustMarshalToBytes(uint16(4)), nil)
+	c.Check(err, Equals, ErrCommandCancelled)
+	c.Check(tcti.commands, Equals, 1)
+}
+
+func (s *tpmSuiteNoTPM) TestRunCommandContextAlreadyCancelled(c *C) {
+	tcti := &mockCancellableTcti{mockBlockingTcti: newMockBlockingTcti()}
+	tpm := NewTPMContext(tcti)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, _, err := tpm.RunCommandContext(ctx, CommandGetRandom, nil, nil, mu.MustMarshalToBytes(uint16(4)), nil)
+	c.Check(err, Equals, ErrCommandCancelled)
+	c.Check(tcti.commands, Equals, 0)
+	c.Check(tcti.cancels, Equals, 0)
+}
+
+func (s *tpmSuite) sessionAuditDigest(c *C, session SessionContext) Digest {
+	auditInfo, _, err := s.TPM.GetSessionAuditDigest(s.TPM.EndorsementHandleContext(), nil, session, nil, nil, nil, nil)
+	c.Assert(err, IsNil)
+	return auditInfo.Attested.SessionAudit.SessionDigest
+}
+
+func (s *tpmSuite) TestSetAuditSession(c *C) {
+	session := s.StartAuthSession(c, nil, nil, SessionTypeHMAC, nil, HashAlgorithmSHA256)
+
+	s.TPM.SetAuditSession(session)
+
+	s.ForgetCommands()
+
+	_, err := s.TPM.GetRandom(8)
+	c.Check(err, IsNil)
+
+	commands := s.CommandLog()
+	c.Assert(commands, internal_testutil.LenEquals, 1)
+	_, authArea, _ := commands[0].UnmarshalCommand(c)
+	c.Assert(authArea, internal_testutil.LenEquals, 1)
+	c.Check(authArea[0].SessionHandle, Equals, session.Handle())
+	c.Check(authArea[0].SessionAttributes, Equals, AttrAudit|AttrContinueSession)
+
+	c.Check(session.IsAudit(), internal_testutil.IsTrue)
+
+	s.TPM.ClearAuditSession()
+
+	digest := s.sessionAuditDigest(c, session)
+	c.Check(digest, Not(DeepEquals), make(Digest, 32))
+}
+
+func (s *tpmSuite) TestSetAuditSessionUpdatesDigest(c *C) {
+	session := s.StartAuthSession(c, nil, nil, SessionTypeHMAC, nil, HashAlgorithmSHA256)
+
+	s.TPM.SetAuditSession(session)
+	_, err := s.TPM.GetRandom(8)
+	c.Check(err, IsNil)
+	s.TPM.ClearAuditSession()
+
+	digest1 := s.sessionAuditDigest(c, session)
+
+	s.TPM.SetAuditSession(session)
+	_, err = s.TPM.GetRandom(8)
+	c.Check(err, IsNil)
+	s.TPM.ClearAuditSession()
+
+	digest2 := s.sessionAuditDigest(c, session)
+	c.Check(digest2, Not(DeepEquals), digest1)
+}
+
+func (s *tpmSuite) TestClearAuditSession(c *C) {
+	session := s.StartAuthSession(c, nil, nil, SessionTypeHMAC, nil, HashAlgorithmSHA256)
+
+	s.TPM.SetAuditSession(session)
+	_, err := s.TPM.GetRandom(8)
+	c.Check(err, IsNil)
+	s.TPM.ClearAuditSession()
+
+	digest1 := s.sessionAuditDigest(c, session)
+
+	s.ForgetCommands()
+
+	_, err = s.TPM.GetRandom(8)
+	c.Check(err, IsNil)
+
+	commands := s.CommandLog()
+	c.Assert(commands, internal_testutil.LenEquals, 1)
+	_, authArea, _ := commands[0].UnmarshalCommand(c)
+	c.Check(authArea, internal_testutil.LenEquals, 0)
+
+	digest2 := s.sessionAuditDigest(c, session)
+	c.Check(digest2, DeepEquals, digest1)
+}
+
+func (s *tpmSuite) TestSetAuditSessionExplicitSession(c *C) {
+	session := s.StartAuthSession(c, nil, nil, SessionTypeHMAC, nil, HashAlgorithmSHA256)
+
+	s.TPM.SetAuditSession(session)
+	defer s.TPM.ClearAuditSession()
+
+	s.ForgetCommands()
+
+	// The audit session shouldn't be added a second time if it is supplied
+	// explicitly.
+	_, err := s.TPM.GetRandom(8, session.WithAttrs(AttrAudit|AttrContinueSession))
+	c.Check(err, IsNil)
+
+	commands := s.CommandLog()
+	c.Assert(commands, internal_testutil.LenEquals, 1)
+	_, authArea, _ := commands[0].UnmarshalCommand(c)
+	c.Check(authArea, internal_testutil.LenEquals, 1)
+}
+
+func (s *tpmSuite) TestSetAuditSessionFlushed(c *C) {
+	session := s.StartAuthSession(c, nil, nil, SessionTypeHMAC, nil, HashAlgorithmSHA256)
+
+	s.TPM.SetAuditSession(session)
+	c.Check(s.TPM.FlushContext(session), IsNil)
+
+	s.ForgetCommands()
+
+	// The audit session is cleared once it has been flushed.
+	_, err := s.TPM.GetRandom(8)
+	c.Check(err, IsNil)
+
+	commands := s.CommandLog()
+	c.Assert(commands, internal_testutil.LenEquals, 1)
+	_, authArea, _ := commands[0].UnmarshalCommand(c)
+	c.Check(authArea, internal_testutil.LenEquals, 0)
+}
+
+func (s *tpmSuite) TestParameterEncryptionNoSymmetric(c *C) {
+	session := s.StartAuthSession(c, nil, nil, SessionTypeHMAC, nil, HashAlgorithmSHA256)
+
+	s.ForgetCommands()
+
+	_, err := s.TPM.GetRandom(8, session.WithAttrs(AttrResponseEncrypt))
+	c.Check(err, ErrorMatches, `cannot process SessionContext parameters for command TPM_CC_GetRandom: session 0x[[:xdigit:]]{8} cannot be used for parameter encryption: no symmetric algorithm`)
+
+	// The command should not have been sent to the TPM.
+	c.Check(s.CommandLog(), internal_testutil.LenEquals, 0)
+}
+
+func (s *tpmSuite) TestEstimateSizeWithSessions(c *C) {
+	symmetric := &SymDef{
+		Algorithm: SymAlgorithmAES,
+		KeyBits:   &SymKeyBitsU{Sym: 128},
+		Mode:      &SymModeU{Sym: SymModeCFB}}
+	session := s.StartAuthSession(c, nil, nil, SessionTypeHMAC, symmetric, HashAlgorithmSHA256)
+	s.TPM.SetAuditSession(s.StartAuthSession(c, nil, nil, SessionTypeHMAC, nil, HashAlgorithmSHA1))
+	defer s.TPM.ClearAuditSession()
+
+	cmd := s.TPM.StartCommand(CommandHash).
+		AddParams(MaxBuffer("foo"), HashAlgorithmSHA256, HandleOwner).
+		AddExtraSessions(session.WithAttrs(AttrContinueSession | AttrCommandEncrypt))
+
+	nonceCaller := append(Nonce(nil), session.(SessionContextInternal).Data().NonceCaller...)
+	size, err := cmd.EstimateSize()
+	c.Check(err, IsNil)
+	c.Check(session.(SessionContextInternal).Data().NonceCaller, DeepEquals, nonceCaller)
+
+	s.ForgetCommands()
+
+	var digest Digest
+	var validation *TkHashcheck
+	c.Check(cmd.Run(nil, &digest, &validation), IsNil)
+
+	commands := s.CommandLog()
+	c.Assert(commands, internal_testutil.LenEquals, 1)
+	handles, authArea, params := commands[0].UnmarshalCommand(c)
+	c.Check(authArea, internal_testutil.LenEquals, 2)
+	packet, err := MarshalCommandPacket(CommandHash, handles, authArea, params)
+	c.Assert(err, IsNil)
+	c.Check(size, Equals, len(packet))
+}
+
+func (s *tpmSuiteNoTPM) testEstimateSize(c *C, cmd *CommandContext, tcti *mockBlockingTcti) {
+	size, err := cmd.EstimateSize()
+	c.Assert(err, IsNil)
+
+	// Fail the command so that the response doesn't need to be valid.
+	tcti.release(makeMockResponse(ResponseCode(0x100) + ResponseCode(ErrorFailure)))
+	_, err = cmd.RunWithoutProcessingResponse(nil)
+	c.Check(IsTPMError(err, ErrorFailure, cmd.Cmd().CommandCode), internal_testutil.IsTrue)
+
+	c.Check(size, Equals, len(tcti.last))
+}
+
+func (s *tpmSuiteNoTPM) TestEstimateSizeNoSessions(c *C) {
+	tcti := newMockBlockingTcti()
+	tpm := NewTPMContext(tcti)
+
+	s.testEstimateSize(c, tpm.StartCommand(CommandGetRandom).AddParams(uint16(32)), tcti)
+}
+
+func (s *tpmSuiteNoTPM) TestEstimateSizeNVWritePassword(c *C) {
+	tcti := newMockBlockingTcti()
+	tpm := NewTPMContext(tcti)
+
+	index, err := NewNVIndexResourceContextFromPub(&NVPublic{
+		Index:   0x01800000,
+		NameAlg: HashAlgorithmSHA256,
+		Attrs:   NVTypeOrdinary.WithAttrs(AttrNVAuthWrite | AttrNVAuthRead),
+		Size:    1024})
+	c.Assert(err, IsNil)
+	index.SetAuthValue([]byte("password"))
+
+	cmd := tpm.StartCommand(CommandNVWrite).
+		AddHandles(UseResourceContextWithAuth(index, nil), UseHandleContext(index)).
+		AddParams(MaxNVBuffer(make([]byte, 1024)), uint16(0))
+	s.testEstimateSize(c, cmd, tcti)
+}
+
+func makeMockFixedPropertiesResponse() []byte {
+	return makeMockResponse(ResponseSuccess, false, &CapabilityData{
+		Capability: CapabilityTPMProperties,
+		Data: &CapabilitiesU{
+			TPMProperties: TaggedTPMPropertyList{
+				{Property: PropertyInputBuffer, Value: 2048},
+				{Property: PropertyMaxDigest, Value: 48},
+				{Property: PropertyNVBufferMax, Value: 512},
+				{Property: PropertyPCRSelectMin, Value: 3}}}})
+}
+
+func (s *tpmSuite) TestCachedProperties(c *C) {
+	inputBuffer, err := s.TPM.InputBufferSize()
+	c.Check(err, IsNil)
+	c.Check(inputBuffer, Equals, s.TPM.GetInputBuffer())
+
+	nvBufferMax, err := s.TPM.NVBufferMax()
+	c.Check(err, IsNil)
+	expected, err := s.TPM.GetNVBufferMax()
+	c.Check(err, IsNil)
+	c.Check(nvBufferMax, Equals, expected)
+
+	maxDigest, err := s.TPM.MaxDigestSize()
+	c.Check(err, IsNil)
+	expected, err = s.TPM.GetMaxDigest()
+	c.Check(err, IsNil)
+	c.Check(maxDigest, Equals, expected)
+
+	maxData, err := s.TPM.MaxDataSize()
+	c.Check(err, IsNil)
+	expected, err = s.TPM.GetMaxData()
+	c.Check(err, IsNil)
+	c.Check(maxData, Equals, expected)
+}
+
+func (s *tpmSuiteNoTPM) TestCachedProperties(c *C) {
+	tcti := newMockBlockingTcti()
+	tpm := NewTPMContext(tcti)
+
+	tcti.release(makeMockFixedPropertiesResponse())
+	inputBuffer, err := tpm.InputBufferSize()
+	c.Check(err, IsNil)
+	c.Check(inputBuffer, Equals, 2048)
+
+	nvBufferMax, err := tpm.NVBufferMax()
+	c.Check(err, IsNil)
+	c.Check(nvBufferMax, Equals, 512)
+
+	maxDigest, err := tpm.MaxDigestSize()
+	c.Check(err, IsNil)
+	c.Check(maxDigest, Equals, 48)
+
+	maxData, err := tpm.MaxDataSize()
+	c.Check(err, IsNil)
+	c.Check(maxData, Equals, 50)
+
+	inputBuffer, err = tpm.InputBufferSize()
+	c.Check(err, IsNil)
+	c.Check(inputBuffer, Equals, 2048)
+
+	c.Check(tcti.commands, Equals, 1)
+}
+
+func (s *tpmSuiteNoTPM) TestCachedPropertiesMatchGetCapability(c *C) {
+	tcti := newMockBlockingTcti()
+	tpm := NewTPMContext(tcti)
+
+	tcti.release(makeMockFixedPropertiesResponse())
+	nvBufferMax, err := tpm.NVBufferMax()
+	c.Check(err, IsNil)
+
+	tcti.release(makeMockResponse(ResponseSuccess, false, &CapabilityData{
+		Capability: CapabilityTPMProperties,
+		Data: &CapabilitiesU{
+			TPMProperties: TaggedTPMPropertyList{{Property: PropertyNVBufferMax, Value: 512}}}}))
+	expected, err := tpm.GetNVBufferMax()
+	c.Check(err, IsNil)
+	c.Check(nvBufferMax, Equals, expected)
+
+	c.Check(tcti.commands, Equals, 2)
+}
+
+func (s *tpmSuiteNoTPM) TestCachedPropertiesInvalidatedByStartup(c *C) {
+	tcti := newMockBlockingTcti()
+	tpm := NewTPMContext(tcti)
+
+	tcti.release(makeMockFixedPropertiesResponse())
+	_, err := tpm.InputBufferSize()
+	c.Check(err, IsNil)
+
+	tcti.release(makeMockResponse(ResponseSuccess))
+	c.Check(tpm.Startup(StartupClear), IsNil)
+
+	tcti.release(makeMockFixedPropertiesResponse())
+	inputBuffer, err := tpm.InputBufferSize()
+	c.Check(err, IsNil)
+	c.Check(inputBuffer, Equals, 2048)
+
+	c.Check(tcti.commands, Equals, 3)
+}
+
+func (s *tpmSuiteNoTPM) TestCachedPropertiesError(c *C) {
+	tcti := newMockBlockingTcti()
+	tpm := NewTPMContext(tcti)
+
+	tcti.release(makeMockResponse(ResponseSuccess, false, &CapabilityData{
+		Capability: CapabilityTPMProperties,
+		Data: &CapabilitiesU{
+			TPMProperties: TaggedTPMPropertyList{
+				{Property: PropertyInputBuffer, Value: 2048}}}}))
+	_, err := tpm.NVBufferMax()
+	c.Check(err, ErrorMatches, `TPM returned an invalid response for command TPM_CC_GetCapability: missing or invalid TPM_PT_MAX_DIGEST property`)
+}
@@ -0,0 +1,145 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package tpm2
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+type retryingTransport struct {
+	inner      io.ReadWriteCloser
+	maxRetries int
+	reconnect  func() (io.ReadWriteCloser, error)
+	isTCTI     bool // whether the transports must implement TCTI
+
+	timeout *time.Duration // the last timeout set with SetTimeout
+}
+
+// RetryingTransport returns a transport that wraps the supplied inner transport, and
+// which attempts to recover from write errors by obtaining a new transport with the
+// supplied reconnect function and then re-sending the command. This is intended for
+// TPMs that are accessed over unreliable links, such as a network connection to a
+// simulator. Up to maxRetries attempts are made for each write. Read errors are always
+// returned to the caller, as a command that was written successfully has most likely
+// been received and executed by the TPM.
+//
+// Re-sending a command is only safe if the command was not received and executed by
+// the TPM before the error occurred, as the TPM does not provide any way of detecting
+// duplicate commands. A command that is executed twice might have unexpected side
+// effects, eg, a NV counter might be incremented twice or a session might be advanced
+// so that subsequent commands fail. This should only be used where the transport's
+// framing guarantees that a command that fails to be written is not delivered to the
+// TPM.
+//
+// If the inner transport implements [TCTI], then the returned transport also implements
+// it and can be passed to [NewTPMContext]. In this case, the transports returned from
+// reconnect must also implement [TCTI], and any timeout configured with SetTimeout is
+// applied to them. If the inner transport implements [CancellableTCTI], then so does
+// the returned transport, and cancellation requests are forwarded to the current
+// transport.
+func RetryingTransport(inner io.ReadWriteCloser, maxRetries int, reconnect func() (io.ReadWriteCloser, error)) io.ReadWriteCloser {
+	t := &retryingTransport{
+		inner:      inner,
+		maxRetries: maxRetries,
+		reconnect:  reconnect,
+	}
+
+	switch inner.(type) {
+	case CancellableTCTI:
+		t.isTCTI = true
+		return &retryingCancellableTCTI{retryingTCTI{t}}
+	case TCTI:
+		t.isTCTI = true
+		return &retryingTCTI{t}
+	default:
+		return t
+	}
+}
+
+func (t *retryingTransport) reset() error {
+	t.inner.Close()
+
+	inner, err := t.reconnect()
+	if err != nil {
+		return fmt.Errorf("cannot reconnect: %w", err)
+	}
+	t.inner = inner
+
+	if !t.isTCTI {
+		return nil
+	}
+
+	tcti, ok := inner.(TCTI)
+	if !ok {
+		return errors.New("reconnected transport does not implement TCTI")
+	}
+	if t.timeout != nil {
+		if err := tcti.SetTimeout(*t.timeout); err != nil {
+			return fmt.Errorf("cannot restore timeout: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (t *retryingTransport) Read(data []byte) (n int, err error) {
+	return t.inner.Read(data)
+}
+
+func (t *retryingTransport) Write(data []byte) (n int, err error) {
+	n, err = t.inner.Write(data)
+	for tries := 0; err != nil && tries < t.maxRetries; tries++ {
+		if err = t.reset(); err != nil {
+			continue
+		}
+		_, err = t.inner.Write(data)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return len(data), nil
+}
+
+func (t *retryingTransport) Close() error {
+	return t.inner.Close()
+}
+
+// retryingTCTI is a retryingTransport with an inner transport that implements TCTI.
+type retryingTCTI struct {
+	*retryingTransport
+}
+
+// SetTimeout implements [TCTI.SetTimeout].
+func (t *retryingTCTI) SetTimeout(timeout time.Duration) error {
+	if err := t.inner.(TCTI).SetTimeout(timeout); err != nil {
+		return err
+	}
+	t.timeout = &timeout
+	return nil
+}
+
+// MakeSticky implements [TCTI.MakeSticky].
+func (t *retryingTCTI) MakeSticky(handle Handle, sticky bool) error {
+	return t.inner.(TCTI).MakeSticky(handle, sticky)
+}
+
+// retryingCancellableTCTI is a retryingTransport with an inner transport that
+// implements CancellableTCTI.
+type retryingCancellableTCTI struct {
+	retryingTCTI
+}
+
+// Cancel implements [CancellableTCTI.Cancel].
+func (t *retryingCancellableTCTI) Cancel() error {
+	tcti, ok := t.inner.(CancellableTCTI)
+	if !ok {
+		return errors.New("reconnected transport does not support cancellation")
+	}
+	return tcti.Cancel()
+}
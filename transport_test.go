@@ -0,0 +1,238 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package tpm2_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	. "github.com/canonical/go-tpm2"
+)
+
+// mockFlakyTransport is a transport that echoes back each command as the response.
+type mockFlakyTransport struct {
+	failWrites int // the number of writes that should fail
+	failReads  int // the number of reads that should fail
+
+	written [][]byte
+	rsp     *bytes.Reader
+	closed  bool
+}
+
+func (t *mockFlakyTransport) Read(data []byte) (int, error) {
+	if t.failReads > 0 {
+		t.failReads--
+		return 0, io.ErrUnexpectedEOF
+	}
+	if t.rsp == nil {
+		return 0, io.EOF
+	}
+	return t.rsp.Read(data)
+}
+
+func (t *mockFlakyTransport) Write(data []byte) (int, error) {
+	if t.failWrites > 0 {
+		t.failWrites--
+		return 0, errors.New("write error")
+	}
+	t.written = append(t.written, append([]byte(nil), data...))
+	t.rsp = bytes.NewReader(data)
+	return len(data), nil
+}
+
+func (t *mockFlakyTransport) Close() error {
+	t.closed = true
+	return nil
+}
+
+// mockFlakyTCTI is a mockFlakyTransport that implements TCTI.
+type mockFlakyTCTI struct {
+	mockFlakyTransport
+	timeout time.Duration
+}
+
+func (t *mockFlakyTCTI) SetTimeout(timeout time.Duration) error {
+	t.timeout = timeout
+	return nil
+}
+
+func (t *mockFlakyTCTI) MakeSticky(handle Handle, sticky bool) error {
+	return errors.New("not implemented")
+}
+
+// mockFlakyCancellableTCTI is a mockFlakyTCTI that implements CancellableTCTI.
+type mockFlakyCancellableTCTI struct {
+	mockFlakyTCTI
+	cancelled bool
+}
+
+func (t *mockFlakyCancellableTCTI) Cancel() error {
+	t.cancelled = true
+	return nil
+}
+
+type transportSuite struct{}
+
+var _ = Suite(&transportSuite{})
+
+func (s *transportSuite) TestRetryingTransportNoErrors(c *C) {
+	inner := new(mockFlakyTransport)
+	transport := RetryingTransport(inner, 3, func() (io.ReadWriteCloser, error) {
+		c.Error("unexpected reconnect")
+		return nil, errors.New("unexpected reconnect")
+	})
+
+	n, err := transport.Write([]byte("foo"))
+	c.Check(err, IsNil)
+	c.Check(n, Equals, 3)
+
+	rsp, err := ioutil.ReadAll(transport)
+	c.Check(err, IsNil)
+	c.Check(rsp, DeepEquals, []byte("foo"))
+
+	c.Check(transport.Close(), IsNil)
+	c.Check(inner.closed, Equals, true)
+}
+
+func (s *transportSuite) TestRetryingTransportWriteFailsOnce(c *C) {
+	inner := &mockFlakyTransport{failWrites: 1}
+	reconnected := new(mockFlakyTransport)
+
+	reconnects := 0
+	transport := RetryingTransport(inner, 3, func() (io.ReadWriteCloser, error) {
+		reconnects++
+		return reconnected, nil
+	})
+
+	n, err := transport.Write([]byte("foo"))
+	c.Check(err, IsNil)
+	c.Check(n, Equals, 3)
+	c.Check(reconnects, Equals, 1)
+	c.Check(inner.closed, Equals, true)
+	c.Check(reconnected.written, DeepEquals, [][]byte{[]byte("foo")})
+
+	rsp, err := ioutil.ReadAll(transport)
+	c.Check(err, IsNil)
+	c.Check(rsp, DeepEquals, []byte("foo"))
+}
+
+func (s *transportSuite) TestRetryingTransportReadFailureNotRetried(c *C) {
+	inner := &mockFlakyTransport{failReads: 1}
+
+	transport := RetryingTransport(inner, 3, func() (io.ReadWriteCloser, error) {
+		c.Error("unexpected reconnect")
+		return nil, errors.New("unexpected reconnect")
+	})
+
+	_, err := transport.Write([]byte("foo"))
+	c.Check(err, IsNil)
+
+	// The command has been delivered, so it mustn't be re-sent.
+	_, err = ioutil.ReadAll(transport)
+	c.Check(err, Equals, io.ErrUnexpectedEOF)
+	c.Check(inner.written, DeepEquals, [][]byte{[]byte("foo")})
+}
+
+func (s *transportSuite) TestRetryingTransportWriteFailsTooManyTimes(c *C) {
+	inner := &mockFlakyTransport{failWrites: 1}
+
+	reconnects := 0
+	transport := RetryingTransport(inner, 2, func() (io.ReadWriteCloser, error) {
+		reconnects++
+		return &mockFlakyTransport{failWrites: 1}, nil
+	})
+
+	_, err := transport.Write([]byte("foo"))
+	c.Check(err, ErrorMatches, `write error`)
+	c.Check(reconnects, Equals, 2)
+}
+
+func (s *transportSuite) TestRetryingTransportReconnectFails(c *C) {
+	inner := &mockFlakyTransport{failWrites: 1}
+
+	transport := RetryingTransport(inner, 2, func() (io.ReadWriteCloser, error) {
+		return nil, errors.New("some error")
+	})
+
+	_, err := transport.Write([]byte("foo"))
+	c.Check(err, ErrorMatches, `cannot reconnect: some error`)
+}
+
+func (s *transportSuite) TestRetryingTransportNoRetryAfterPartialResponse(c *C) {
+	inner := new(mockFlakyTransport)
+
+	transport := RetryingTransport(inner, 3, func() (io.ReadWriteCloser, error) {
+		c.Error("unexpected reconnect")
+		return nil, errors.New("unexpected reconnect")
+	})
+
+	_, err := transport.Write([]byte("foo"))
+	c.Check(err, IsNil)
+
+	buf := make([]byte, 1)
+	n, err := transport.Read(buf)
+	c.Check(err, IsNil)
+	c.Check(n, Equals, 1)
+
+	inner.failReads = 1
+	_, err = transport.Read(buf)
+	c.Check(err, Equals, io.ErrUnexpectedEOF)
+}
+
+func (s *transportSuite) TestRetryingTransportNotTCTI(c *C) {
+	transport := RetryingTransport(new(mockFlakyTransport), 3, nil)
+	_, ok := transport.(TCTI)
+	c.Check(ok, Equals, false)
+}
+
+func (s *transportSuite) TestRetryingTransportTCTI(c *C) {
+	inner := &mockFlakyTCTI{mockFlakyTransport: mockFlakyTransport{failWrites: 1}}
+	reconnected := new(mockFlakyTCTI)
+
+	transport := RetryingTransport(inner, 3, func() (io.ReadWriteCloser, error) {
+		return reconnected, nil
+	})
+	tcti, ok := transport.(TCTI)
+	c.Assert(ok, Equals, true)
+	_, ok = transport.(CancellableTCTI)
+	c.Check(ok, Equals, false)
+
+	c.Check(tcti.SetTimeout(time.Second), IsNil)
+	c.Check(inner.timeout, Equals, time.Second)
+
+	_, err := tcti.Write([]byte("foo"))
+	c.Check(err, IsNil)
+
+	// The timeout is applied to the new transport.
+	c.Check(reconnected.timeout, Equals, time.Second)
+	c.Check(reconnected.written, DeepEquals, [][]byte{[]byte("foo")})
+}
+
+func (s *transportSuite) TestRetryingTransportReconnectNotTCTI(c *C) {
+	inner := &mockFlakyTCTI{mockFlakyTransport: mockFlakyTransport{failWrites: 1}}
+
+	transport := RetryingTransport(inner, 1, func() (io.ReadWriteCloser, error) {
+		return new(mockFlakyTransport), nil
+	})
+
+	_, err := transport.Write([]byte("foo"))
+	c.Check(err, ErrorMatches, `reconnected transport does not implement TCTI`)
+}
+
+func (s *transportSuite) TestRetryingTransportCancellableTCTI(c *C) {
+	inner := new(mockFlakyCancellableTCTI)
+
+	transport := RetryingTransport(inner, 3, nil)
+	tcti, ok := transport.(CancellableTCTI)
+	c.Assert(ok, Equals, true)
+
+	c.Check(tcti.Cancel(), IsNil)
+	c.Check(inner.cancelled, Equals, true)
+}
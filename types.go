@@ -45,6 +45,11 @@ const (
 type PCRValues map[HashAlgorithmId]map[int]Digest
 
 // Marshal implements [mu.CustomMarshaller.Marshal].
+//
+// The encoding is deterministic - selections are sorted by algorithm and the PCRs
+// within each selection are encoded in ascending order, regardless of the order in
+// which values were inserted. This makes the result of [mu.MarshalToBytes] suitable
+// for comparing or computing a digest of a set of PCR values.
 func (v PCRValues) Marshal(w io.Writer) error {
 	pcrs, digests, err := v.ToListAndSelection()
 	if err != nil {
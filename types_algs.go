@@ -717,6 +717,40 @@ func (s *Signature) HashAlg() HashAlgorithmId {
 	return hashAlg
 }
 
+// NewRSASSASignature returns a new RSA-SSA signature with the supplied digest algorithm and
+// signature, which should be the same size as the public key.
+func NewRSASSASignature(hashAlg HashAlgorithmId, sig []byte) *Signature {
+	return &Signature{
+		SigAlg: SigSchemeAlgRSASSA,
+		Signature: &SignatureU{
+			RSASSA: &SignatureRSASSA{
+				Hash: hashAlg,
+				Sig:  sig}}}
+}
+
+// NewRSAPSSSignature returns a new RSA-PSS signature with the supplied digest algorithm and
+// signature, which should be the same size as the public key.
+func NewRSAPSSSignature(hashAlg HashAlgorithmId, sig []byte) *Signature {
+	return &Signature{
+		SigAlg: SigSchemeAlgRSAPSS,
+		Signature: &SignatureU{
+			RSAPSS: &SignatureRSAPSS{
+				Hash: hashAlg,
+				Sig:  sig}}}
+}
+
+// NewECDSASignature returns a new ECDSA signature with the supplied digest algorithm and
+// r and s values, which are big-endian integers.
+func NewECDSASignature(hashAlg HashAlgorithmId, r, s []byte) *Signature {
+	return &Signature{
+		SigAlg: SigSchemeAlgECDSA,
+		Signature: &SignatureU{
+			ECDSA: &SignatureECDSA{
+				Hash:       hashAlg,
+				SignatureR: r,
+				SignatureS: s}}}
+}
+
 // 11.4) Key/Secret Exchange
 
 // EncryptedSecret corresponds to the TPM2B_ENCRYPTED_SECRET type.
@@ -6,11 +6,23 @@ package tpm2_test
 
 import (
 	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"math/big"
 	"reflect"
 	"testing"
 
+	. "gopkg.in/check.v1"
+
 	. "github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/cryptutil"
+	internal_testutil "github.com/canonical/go-tpm2/internal/testutil"
 	"github.com/canonical/go-tpm2/mu"
+	"github.com/canonical/go-tpm2/objectutil"
+	"github.com/canonical/go-tpm2/testutil"
 )
 
 type TestSchemeKeyedHashUContainer struct {
@@ -81,3 +93,138 @@ func TestSchemeKeyedHashUnion(t *testing.T) {
 		})
 	}
 }
+
+type signatureSuiteNoTPM struct{}
+
+var _ = Suite(&signatureSuiteNoTPM{})
+
+func (s *signatureSuiteNoTPM) TestNewRSASSASignature(c *C) {
+	sig := NewRSASSASignature(HashAlgorithmSHA256, []byte{1, 2, 3, 4})
+	c.Check(sig, DeepEquals, &Signature{
+		SigAlg: SigSchemeAlgRSASSA,
+		Signature: &SignatureU{
+			RSASSA: &SignatureRSASSA{
+				Hash: HashAlgorithmSHA256,
+				Sig:  PublicKeyRSA{1, 2, 3, 4}}}})
+	c.Check(mu.IsValid(sig), internal_testutil.IsTrue)
+}
+
+func (s *signatureSuiteNoTPM) TestNewRSAPSSSignature(c *C) {
+	sig := NewRSAPSSSignature(HashAlgorithmSHA384, []byte{1, 2, 3, 4})
+	c.Check(sig, DeepEquals, &Signature{
+		SigAlg: SigSchemeAlgRSAPSS,
+		Signature: &SignatureU{
+			RSAPSS: &SignatureRSAPSS{
+				Hash: HashAlgorithmSHA384,
+				Sig:  PublicKeyRSA{1, 2, 3, 4}}}})
+	c.Check(mu.IsValid(sig), internal_testutil.IsTrue)
+}
+
+func (s *signatureSuiteNoTPM) TestNewECDSASignature(c *C) {
+	sig := NewECDSASignature(HashAlgorithmSHA256, []byte{1, 2}, []byte{3, 4})
+	c.Check(sig, DeepEquals, &Signature{
+		SigAlg: SigSchemeAlgECDSA,
+		Signature: &SignatureU{
+			ECDSA: &SignatureECDSA{
+				Hash:       HashAlgorithmSHA256,
+				SignatureR: ECCParameter{1, 2},
+				SignatureS: ECCParameter{3, 4}}}})
+	c.Check(mu.IsValid(sig), internal_testutil.IsTrue)
+}
+
+func (s *signatureSuiteNoTPM) TestNewRSASSASignatureVerifies(c *C) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	c.Assert(err, IsNil)
+
+	digest := internal_testutil.DecodeHexString(c, "b5bb9d8014a0f9b1d61e21e796d78dccdf1352f23cd32812f4850b878ae4944c")
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest)
+	c.Assert(err, IsNil)
+
+	ok, err := cryptutil.VerifySignature(&key.PublicKey, digest, NewRSASSASignature(HashAlgorithmSHA256, sig))
+	c.Check(err, IsNil)
+	c.Check(ok, internal_testutil.IsTrue)
+}
+
+func (s *signatureSuiteNoTPM) TestNewRSAPSSSignatureVerifies(c *C) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	c.Assert(err, IsNil)
+
+	digest := internal_testutil.DecodeHexString(c, "b5bb9d8014a0f9b1d61e21e796d78dccdf1352f23cd32812f4850b878ae4944c")
+	sig, err := rsa.SignPSS(rand.Reader, key, crypto.SHA256, digest, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+	c.Assert(err, IsNil)
+
+	ok, err := cryptutil.VerifySignature(&key.PublicKey, digest, NewRSAPSSSignature(HashAlgorithmSHA256, sig))
+	c.Check(err, IsNil)
+	c.Check(ok, internal_testutil.IsTrue)
+}
+
+func (s *signatureSuiteNoTPM) TestNewECDSASignatureVerifies(c *C) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+
+	digest := internal_testutil.DecodeHexString(c, "b5bb9d8014a0f9b1d61e21e796d78dccdf1352f23cd32812f4850b878ae4944c")
+	r, sigS, err := ecdsa.Sign(rand.Reader, key, digest)
+	c.Assert(err, IsNil)
+
+	ok, err := cryptutil.VerifySignature(&key.PublicKey, digest, NewECDSASignature(HashAlgorithmSHA256, r.Bytes(), sigS.Bytes()))
+	c.Check(err, IsNil)
+	c.Check(ok, internal_testutil.IsTrue)
+
+	ok, err = cryptutil.VerifySignature(&key.PublicKey, digest, NewECDSASignature(HashAlgorithmSHA256, r.Bytes(), new(big.Int).Add(sigS, big.NewInt(1)).Bytes()))
+	c.Check(err, IsNil)
+	c.Check(ok, internal_testutil.IsFalse)
+}
+
+type signatureSuite struct {
+	testutil.TPMTest
+}
+
+var _ = Suite(&signatureSuite{})
+
+func (s *signatureSuite) testVerifySignature(c *C, pub *Public, digest Digest, sig *Signature) {
+	key, err := s.TPM.LoadExternal(nil, pub, HandleOwner)
+	c.Assert(err, IsNil)
+	defer s.TPM.FlushContext(key)
+
+	_, err = s.TPM.VerifySignature(key, digest, sig)
+	c.Check(err, IsNil)
+}
+
+func (s *signatureSuite) TestNewRSASSASignature(c *C) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	c.Assert(err, IsNil)
+	pub, err := objectutil.NewRSAPublicKey(&key.PublicKey)
+	c.Assert(err, IsNil)
+
+	digest := internal_testutil.DecodeHexString(c, "b5bb9d8014a0f9b1d61e21e796d78dccdf1352f23cd32812f4850b878ae4944c")
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest)
+	c.Assert(err, IsNil)
+
+	s.testVerifySignature(c, pub, digest, NewRSASSASignature(HashAlgorithmSHA256, sig))
+}
+
+func (s *signatureSuite) TestNewRSAPSSSignature(c *C) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	c.Assert(err, IsNil)
+	pub, err := objectutil.NewRSAPublicKey(&key.PublicKey)
+	c.Assert(err, IsNil)
+
+	digest := internal_testutil.DecodeHexString(c, "b5bb9d8014a0f9b1d61e21e796d78dccdf1352f23cd32812f4850b878ae4944c")
+	sig, err := rsa.SignPSS(rand.Reader, key, crypto.SHA256, digest, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+	c.Assert(err, IsNil)
+
+	s.testVerifySignature(c, pub, digest, NewRSAPSSSignature(HashAlgorithmSHA256, sig))
+}
+
+func (s *signatureSuite) TestNewECDSASignature(c *C) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+	pub, err := objectutil.NewECCPublicKey(&key.PublicKey)
+	c.Assert(err, IsNil)
+
+	digest := internal_testutil.DecodeHexString(c, "b5bb9d8014a0f9b1d61e21e796d78dccdf1352f23cd32812f4850b878ae4944c")
+	r, sigS, err := ecdsa.Sign(rand.Reader, key, digest)
+	c.Assert(err, IsNil)
+
+	s.testVerifySignature(c, pub, digest, NewECDSASignature(HashAlgorithmSHA256, r.Bytes(), sigS.Bytes()))
+}
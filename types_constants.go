@@ -150,6 +150,7 @@ const (
 	CommandContextLoad                CommandCode = 0x00000161 // TPM_CC_ContextLoad
 	CommandContextSave                CommandCode = 0x00000162 // TPM_CC_ContextSave
 	CommandECDHKeyGen                 CommandCode = 0x00000163 // TPM_CC_ECDH_KeyGen
+	CommandEncryptDecrypt             CommandCode = 0x00000164 // TPM_CC_EncryptDecrypt
 	CommandFlushContext               CommandCode = 0x00000165 // TPM_CC_FlushContext
 	CommandLoadExternal               CommandCode = 0x00000167 // TPM_CC_LoadExternal
 	CommandMakeCredential             CommandCode = 0x00000168 // TPM_CC_MakeCredential
@@ -189,6 +190,7 @@ const (
 	CommandPolicyTemplate             CommandCode = 0x00000190 // TPM_CC_PolicyTemplate
 	CommandCreateLoaded               CommandCode = 0x00000191 // TPM_CC_CreateLoaded
 	CommandPolicyAuthorizeNV          CommandCode = 0x00000192 // TPM_CC_PolicyAuthorizeNV
+	CommandEncryptDecrypt2            CommandCode = 0x00000193 // TPM_CC_EncryptDecrypt2
 )
 
 // ResponseCode corresponds to the TPM_RC type.
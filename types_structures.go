@@ -6,6 +6,7 @@ package tpm2
 
 import (
 	"encoding/binary"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
@@ -13,6 +14,8 @@ import (
 	"math/big"
 	"reflect"
 	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/canonical/go-tpm2/mu"
 )
@@ -213,6 +216,10 @@ type MaxBuffer []byte
 // supported by the TPM can be determined by calling [TPMContext.GetNVBufferMax].
 type MaxNVBuffer []byte
 
+// IV corresponds to the TPM2B_IV type. The largest size of this is the largest
+// block size of the symmetric algorithms supported by the TPM.
+type IV []byte
+
 // Timeout corresponds to the TPM2B_TIMEOUT type. The spec defines this
 // as having a maximum size of 8 bytes. It is always 8 bytes in the
 // reference implementation and so could be represented as a uint64,
@@ -245,6 +252,74 @@ func MakeHandleName(handle Handle) Name {
 	}
 }
 
+var nameAlgorithms = map[string]HashAlgorithmId{
+	"sha1":     HashAlgorithmSHA1,
+	"sha256":   HashAlgorithmSHA256,
+	"sha384":   HashAlgorithmSHA384,
+	"sha512":   HashAlgorithmSHA512,
+	"sm3_256":  HashAlgorithmSM3_256,
+	"sha3_256": HashAlgorithmSHA3_256,
+	"sha3_384": HashAlgorithmSHA3_384,
+	"sha3_512": HashAlgorithmSHA3_512,
+}
+
+// ParseName parses a Name from the supplied string, which is useful for
+// tooling and for names stored in configuration files. The following forms
+// are accepted:
+//   - "0x<handle>" for the name of a PCR, session or permanent resource,
+//     eg, "0x40000001" for the owner hierarchy.
+//   - "<alg>:<hex digest>" for a digest name, where alg is one of "sha1",
+//     "sha256", "sha384", "sha512", "sm3_256", "sha3_256", "sha3_384" or
+//     "sha3_512", eg, "sha256:e3b0c442...".
+//   - A hex encoded name as it would appear on the wire, which includes the
+//     algorithm identifier for digest names.
+//
+// The length of digests is validated against the algorithm.
+func ParseName(s string) (Name, error) {
+	switch {
+	case s == "":
+		return nil, errors.New("empty name")
+	case strings.HasPrefix(s, "0x"):
+		h, err := strconv.ParseUint(s[2:], 16, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid handle: %w", err)
+		}
+		handle := Handle(h)
+		switch handle.Type() {
+		case HandleTypePCR, HandleTypeHMACSession, HandleTypePolicySession, HandleTypePermanent:
+			return MakeHandleName(handle), nil
+		default:
+			return nil, fmt.Errorf("handle %v does not have a handle name", handle)
+		}
+	case strings.Contains(s, ":"):
+		i := strings.Index(s, ":")
+		alg, ok := nameAlgorithms[strings.ToLower(s[:i])]
+		if !ok {
+			return nil, fmt.Errorf("unrecognized algorithm %q", s[:i])
+		}
+		digest, err := hex.DecodeString(s[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid digest: %w", err)
+		}
+		if len(digest) != alg.Size() {
+			return nil, fmt.Errorf("invalid digest length for algorithm %v", alg)
+		}
+		return mu.MustMarshalToBytes(alg, mu.Raw(digest)), nil
+	default:
+		b, err := hex.DecodeString(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid name: %w", err)
+		}
+		name := Name(b)
+		switch name.Type() {
+		case NameTypeHandle, NameTypeDigest:
+			return name, nil
+		default:
+			return nil, errors.New("invalid name")
+		}
+	}
+}
+
 // NameType describes the type of a name.
 type NameType int
 
@@ -133,6 +133,83 @@ func (s *typesStructuresSuite) TestNameDigestPanic(c *C) {
 	c.Check(func() { name.Digest() }, PanicMatches, "name is not a valid digest")
 }
 
+func (s *typesStructuresSuite) TestParseNameHandle(c *C) {
+	name, err := ParseName("0x40000001")
+	c.Check(err, IsNil)
+	c.Check(name, DeepEquals, MakeHandleName(HandleOwner))
+}
+
+func (s *typesStructuresSuite) TestParseNameHandlePCR(c *C) {
+	name, err := ParseName("0x00000007")
+	c.Check(err, IsNil)
+	c.Check(name, DeepEquals, MakeHandleName(7))
+}
+
+func (s *typesStructuresSuite) TestParseNameDigestSHA256(c *C) {
+	name, err := ParseName("sha256:2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae")
+	c.Check(err, IsNil)
+	c.Check(name, DeepEquals, Name(internal_testutil.DecodeHexString(c, "000b2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae")))
+	c.Check(name.Type(), Equals, NameTypeDigest)
+}
+
+func (s *typesStructuresSuite) TestParseNameDigestSHA1UpperCase(c *C) {
+	name, err := ParseName("SHA1:0beec7b5ea3f0fdbc95d0dd47f3c5bc275da8a33")
+	c.Check(err, IsNil)
+	c.Check(name, DeepEquals, Name(internal_testutil.DecodeHexString(c, "00040beec7b5ea3f0fdbc95d0dd47f3c5bc275da8a33")))
+}
+
+func (s *typesStructuresSuite) TestParseNameRawDigest(c *C) {
+	name, err := ParseName("000b2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae")
+	c.Check(err, IsNil)
+	c.Check(name, DeepEquals, Name(internal_testutil.DecodeHexString(c, "000b2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae")))
+}
+
+func (s *typesStructuresSuite) TestParseNameRawHandle(c *C) {
+	name, err := ParseName("4000000b")
+	c.Check(err, IsNil)
+	c.Check(name, DeepEquals, MakeHandleName(HandleEndorsement))
+}
+
+func (s *typesStructuresSuite) TestParseNameEmpty(c *C) {
+	_, err := ParseName("")
+	c.Check(err, ErrorMatches, `empty name`)
+}
+
+func (s *typesStructuresSuite) TestParseNameInvalidHandle(c *C) {
+	_, err := ParseName("0xfoo")
+	c.Check(err, ErrorMatches, `invalid handle: .*`)
+}
+
+func (s *typesStructuresSuite) TestParseNameHandleNotHandleName(c *C) {
+	_, err := ParseName("0x81000001")
+	c.Check(err, ErrorMatches, `handle 0x81000001 does not have a handle name`)
+}
+
+func (s *typesStructuresSuite) TestParseNameUnrecognizedAlgorithm(c *C) {
+	_, err := ParseName("md5:d3b07384d113edec49eaa6238ad5ff00")
+	c.Check(err, ErrorMatches, `unrecognized algorithm "md5"`)
+}
+
+func (s *typesStructuresSuite) TestParseNameInvalidDigest(c *C) {
+	_, err := ParseName("sha256:foo")
+	c.Check(err, ErrorMatches, `invalid digest: .*`)
+}
+
+func (s *typesStructuresSuite) TestParseNameInvalidDigestLength(c *C) {
+	_, err := ParseName("sha256:0beec7b5ea3f0fdbc95d0dd47f3c5bc275da8a33")
+	c.Check(err, ErrorMatches, `invalid digest length for algorithm TPM_ALG_SHA256`)
+}
+
+func (s *typesStructuresSuite) TestParseNameInvalidRaw(c *C) {
+	_, err := ParseName("000b2c26b4")
+	c.Check(err, ErrorMatches, `invalid name`)
+}
+
+func (s *typesStructuresSuite) TestParseNameInvalidHex(c *C) {
+	_, err := ParseName("xyz")
+	c.Check(err, ErrorMatches, `invalid name: .*`)
+}
+
 func (s *typesStructuresSuite) TestPCRSelectBitmapToPCRs1(c *C) {
 	a := PCRSelectBitmap{Bytes: []byte{144, 0, 128}}
 	pcrs := a.ToPCRs()
@@ -41,6 +41,49 @@ func (s *typesSuite) TestUnmarshalPCRValues(c *C) {
 	c.Check(values, DeepEquals, expected)
 }
 
+func (s *typesSuite) TestMarshalPCRValuesIsDeterministic(c *C) {
+	digest := func(alg HashAlgorithmId, pcr int) Digest {
+		h := alg.NewHash()
+		h.Write([]byte{byte(pcr)})
+		return h.Sum(nil)
+	}
+	algs := []HashAlgorithmId{HashAlgorithmSHA1, HashAlgorithmSHA256, HashAlgorithmSHA384}
+
+	values1 := make(PCRValues)
+	for _, alg := range algs {
+		for pcr := 0; pcr < 24; pcr++ {
+			c.Assert(values1.SetValue(alg, pcr, digest(alg, pcr)), IsNil)
+		}
+	}
+
+	values2 := make(PCRValues)
+	for i := len(algs) - 1; i >= 0; i-- {
+		for pcr := 23; pcr >= 0; pcr-- {
+			c.Assert(values2.SetValue(algs[i], pcr, digest(algs[i], pcr)), IsNil)
+		}
+	}
+	c.Assert(values2, DeepEquals, values1)
+
+	expected, err := mu.MarshalToBytes(values1)
+	c.Assert(err, IsNil)
+
+	// Map iteration order is randomized, so marshal a few times.
+	for i := 0; i < 10; i++ {
+		b, err := mu.MarshalToBytes(values1)
+		c.Check(err, IsNil)
+		c.Check(b, DeepEquals, expected)
+
+		b, err = mu.MarshalToBytes(values2)
+		c.Check(err, IsNil)
+		c.Check(b, DeepEquals, expected)
+	}
+
+	var recovered PCRValues
+	_, err = mu.UnmarshalFromBytes(expected, &recovered)
+	c.Check(err, IsNil)
+	c.Check(recovered, DeepEquals, values1)
+}
+
 func (s *typesSuite) TestMarshalPCRValuesInvalidPCR(c *C) {
 	values := PCRValues{HashAlgorithmSHA256: {4000: internal_testutil.DecodeHexString(c, "4355a46b19d348dc2f57c046f8ef63d4538ebb936000f3c9ee954a27460dd865")}}
 
@@ -211,6 +211,21 @@ func (p *TrialAuthPolicy) PolicyNameHash(nameHash tpm2.Digest) {
 	end()
 }
 
+// PolicyTemplate computes a TPM2_PolicyTemplate assertion for the object template
+// associated with the specified digest.
+func (p *TrialAuthPolicy) PolicyTemplate(templateHash tpm2.Digest) {
+	if len(templateHash) != p.alg.Size() {
+		panic("invalid digest length")
+	}
+	if p.hashOccupied {
+		panic("policy already has a hash")
+	}
+	p.hashOccupied = true
+	h, end := p.beginUpdateForCommand(tpm2.CommandPolicyTemplate)
+	h.Write(templateHash)
+	end()
+}
+
 // PolicyDuplicationSelect computes a TPM2_PolicyDuplicationSelect assertion for
 // the object and parent object with the specified names.
 func (p *TrialAuthPolicy) PolicyDuplicationSelect(object, newParent Entity, includeObject bool) {
@@ -240,6 +255,20 @@ func (p *TrialAuthPolicy) PolicyAuthorize(policyRef tpm2.Nonce, key Entity) {
 	p.update(tpm2.CommandPolicyAuthorize, key, policyRef)
 }
 
+// PolicyAuthorizeNV computes a TPM2_PolicyAuthorizeNV assertion for the
+// specified NV index.
+func (p *TrialAuthPolicy) PolicyAuthorizeNV(nvIndex Entity) {
+	name := nvIndex.Name()
+	if !name.IsValid() {
+		panic("invalid index name")
+	}
+
+	p.reset()
+	h, end := p.beginUpdateForCommand(tpm2.CommandPolicyAuthorizeNV)
+	h.Write(name)
+	end()
+}
+
 // PolicyAuthValue computes a TPM2_PolicyAuthValue assertion.
 func (p *TrialAuthPolicy) PolicyAuthValue() {
 	_, end := p.beginUpdateForCommand(tpm2.CommandPolicyAuthValue)
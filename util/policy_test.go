@@ -456,6 +456,31 @@ func (s *policySuite) TestPolicyNameHashSHA1(c *C) {
 	s.testPolicyNameHash(c, tpm2.HashAlgorithmSHA1)
 }
 
+func (s *policySuite) testPolicyTemplate(c *C, alg tpm2.HashAlgorithmId) {
+	h := alg.NewHash()
+	io.WriteString(h, "template")
+	templateHash := h.Sum(nil)
+
+	session := s.StartAuthSession(c, nil, nil, tpm2.SessionTypeTrial, nil, alg)
+	c.Check(s.TPM.PolicyTemplate(session, templateHash), IsNil)
+
+	expectedDigest, err := s.TPM.PolicyGetDigest(session)
+	c.Check(err, IsNil)
+
+	trial := ComputeAuthPolicy(alg)
+	trial.PolicyTemplate(templateHash)
+
+	c.Check(trial.GetDigest(), DeepEquals, expectedDigest)
+}
+
+func (s *policySuite) TestPolicyTemplate(c *C) {
+	s.testPolicyTemplate(c, tpm2.HashAlgorithmSHA256)
+}
+
+func (s *policySuite) TestPolicyTemplateSHA1(c *C) {
+	s.testPolicyTemplate(c, tpm2.HashAlgorithmSHA1)
+}
+
 type testPolicyDuplicationSelectData struct {
 	alg           tpm2.HashAlgorithmId
 	objectName    tpm2.Name
@@ -547,6 +572,47 @@ func (s *policySuite) testPolicyAuthorize(c *C, data *testPolicyAuthorizeData) {
 	c.Check(trial.GetDigest(), DeepEquals, expectedDigest)
 }
 
+type testPolicyAuthorizeNVData struct {
+	nvPub *tpm2.NVPublic
+	alg   tpm2.HashAlgorithmId
+}
+
+func (s *policySuite) testPolicyAuthorizeNV(c *C, data *testPolicyAuthorizeNVData) {
+	index := s.NVDefineSpace(c, tpm2.HandleOwner, nil, data.nvPub)
+	c.Check(s.TPM.NVWrite(index, index, mu.MustMarshalToBytes(tpm2.MakeTaggedHash(data.alg, make(tpm2.Digest, data.alg.Size()))), 0, nil), IsNil)
+
+	session := s.StartAuthSession(c, nil, nil, tpm2.SessionTypeTrial, nil, data.alg)
+	c.Check(s.TPM.PolicyAuthorizeNV(index, index, session, nil), IsNil)
+
+	expectedDigest, err := s.TPM.PolicyGetDigest(session)
+	c.Check(err, IsNil)
+
+	trial := ComputeAuthPolicy(data.alg)
+	trial.PolicyAuthorizeNV(index.Name())
+
+	c.Check(trial.GetDigest(), DeepEquals, expectedDigest)
+}
+
+func (s *policySuite) TestPolicyAuthorizeNV(c *C) {
+	s.testPolicyAuthorizeNV(c, &testPolicyAuthorizeNVData{
+		nvPub: &tpm2.NVPublic{
+			Index:   s.NextAvailableHandle(c, 0x0181f000),
+			NameAlg: tpm2.HashAlgorithmSHA256,
+			Attrs:   tpm2.NVTypeOrdinary.WithAttrs(tpm2.AttrNVAuthRead | tpm2.AttrNVAuthWrite | tpm2.AttrNVNoDA),
+			Size:    34},
+		alg: tpm2.HashAlgorithmSHA256})
+}
+
+func (s *policySuite) TestPolicyAuthorizeNVSHA1(c *C) {
+	s.testPolicyAuthorizeNV(c, &testPolicyAuthorizeNVData{
+		nvPub: &tpm2.NVPublic{
+			Index:   s.NextAvailableHandle(c, 0x0181f000),
+			NameAlg: tpm2.HashAlgorithmSHA256,
+			Attrs:   tpm2.NVTypeOrdinary.WithAttrs(tpm2.AttrNVAuthRead | tpm2.AttrNVAuthWrite | tpm2.AttrNVNoDA),
+			Size:    22},
+		alg: tpm2.HashAlgorithmSHA1})
+}
+
 func (s *policySuite) TestPolicyAuthorize(c *C) {
 	h := crypto.SHA256.New()
 	io.WriteString(h, "key")